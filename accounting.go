@@ -0,0 +1,83 @@
+package goldjson
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// ByteAccount is the volume of output attributed to a category. See
+// WithByteAccounting.
+type ByteAccount struct {
+	// Lines is the number of lines written.
+	Lines uint64
+	// Bytes is the number of bytes written, including the trailing
+	// newlines.
+	Bytes uint64
+}
+
+// WithByteAccounting enables attributing the written lines to categories
+// (such as subsystems or levels) set with LineWriter.SetCategory, e.g. for
+// chargeback or enforcing quotas on log volume. The totals are read with
+// Encoder.ByteAccounts, and are shared by the Encoder and its clones.
+//
+// Only the lines that were written successfully are counted. The accounting
+// adds a map lookup and a few atomic operations per line.
+func WithByteAccounting() Option {
+	return func(o *options) {
+		o.byteAccounting = true
+	}
+}
+
+type byteAccounts struct {
+	mu       sync.RWMutex
+	accounts map[string]*byteAccount
+}
+
+type byteAccount struct {
+	lines atomic.Uint64
+	bytes atomic.Uint64
+}
+
+func (a *byteAccounts) add(category string, size int) {
+	a.mu.RLock()
+	account := a.accounts[category]
+	a.mu.RUnlock()
+	if account == nil {
+		a.mu.Lock()
+		if account = a.accounts[category]; account == nil {
+			account = &byteAccount{}
+			a.accounts[category] = account
+		}
+		a.mu.Unlock()
+	}
+	account.lines.Add(1)
+	account.bytes.Add(uint64(size))
+}
+
+// ByteAccounts returns the totals of the lines written by the Encoder and
+// its clones per category, with the lines without a category under the
+// empty string. The totals are only collected if the Encoder was created
+// with WithByteAccounting, otherwise nil is returned.
+func (e *Encoder) ByteAccounts() map[string]ByteAccount {
+	a := e.accounts
+	if a == nil {
+		return nil
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	totals := make(map[string]ByteAccount, len(a.accounts))
+	for category, account := range a.accounts {
+		totals[category] = ByteAccount{
+			Lines: account.lines.Load(),
+			Bytes: account.bytes.Load(),
+		}
+	}
+	return totals
+}
+
+// SetCategory sets the category the line is attributed to when written (see
+// WithByteAccounting) and the category whose quota the line counts towards
+// (see WithQuota). Has no effect if neither is enabled.
+func (l *LineWriter) SetCategory(category string) {
+	l.category = category
+}
@@ -0,0 +1,227 @@
+package goldjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/jussi-kalliokoski/goldjson/tokens"
+)
+
+// WithUnsortedMapKeys makes AddAny add the entries of maps in the iteration
+// order of the map, which is random, instead of sorting the keys like
+// encoding/json does. This avoids allocating and sorting a slice of the keys
+// for every map, at the cost of the lines not being deterministic.
+//
+// Maps added with AddMarshal are encoded by encoding/json, which always sorts
+// the keys.
+func WithUnsortedMapKeys() Option {
+	return func(o *options) {
+		o.unsortedMapKeys = true
+	}
+}
+
+// AddAny adds a key-value pair with a value of any type to the active
+// record/list, dispatching the common types to the respective Add methods
+// without going through encoding/json:
+//
+//   - nil as null
+//   - strings like with AddString
+//   - signed and unsigned integers like with AddInt64 and AddUint64
+//   - float64 and float32 like with AddFloat64 and AddFloat32
+//   - bools like with AddBool
+//   - time.Time like with AddTime
+//   - time.Duration as a string, see tokens.AppendDuration
+//   - []byte like with AddBytes
+//   - json.Marshaler like with AddMarshal
+//   - error and fmt.Stringer as the string returned by Error or String, or
+//     as null if the value is a nil pointer
+//   - []string, []time.Time and []time.Duration like with AddStringList,
+//     AddTimeList and AddDurationList, and []float64 like with
+//     AddFloat64ListPrec with a negative precision
+//   - []int, []int64 and []any as lists, and map[string]string and
+//     map[string]any as records with the keys sorted (unless
+//     WithUnsortedMapKeys is used), encoding the values with AddAny
+//
+// In the encoding/json compatibility mode (see WithJSONCompat), durations
+// are added as integers and errors and fmt.Stringer values with AddMarshal.
+//
+// Other values are added with AddMarshal. Sorting the keys of maps
+// allocates, as may converting the values to interfaces in the first place.
+//
+// Returns the first error encountered, in which case the value (or the
+// element of a list or a record) is omitted like with the failing method.
+//
+// If a list is currently active, the key will be ignored.
+func (l *LineWriter) AddAny(key string, value any) error {
+	switch v := value.(type) {
+	case nil:
+		l.addNull(key)
+	case string:
+		l.AddString(key, v)
+	case int:
+		l.AddInt64(key, int64(v))
+	case int8:
+		l.AddInt64(key, int64(v))
+	case int16:
+		l.AddInt64(key, int64(v))
+	case int32:
+		l.AddInt64(key, int64(v))
+	case int64:
+		l.AddInt64(key, v)
+	case uint:
+		l.AddUint64(key, uint64(v))
+	case uint8:
+		l.AddUint64(key, uint64(v))
+	case uint16:
+		l.AddUint64(key, uint64(v))
+	case uint32:
+		l.AddUint64(key, uint64(v))
+	case uint64:
+		l.AddUint64(key, v)
+	case uintptr:
+		l.AddUint64(key, uint64(v))
+	case float64:
+		return l.addFloat64(key, v)
+	case float32:
+		return l.addFloat32(key, v)
+	case bool:
+		l.AddBool(key, v)
+	case time.Time:
+		return l.AddTime(key, v)
+	case time.Duration:
+		if l.encoder.opts.jsonCompat {
+			l.AddInt64(key, int64(v))
+			return nil
+		}
+		l.addDuration(key, v)
+	case []byte:
+		l.AddBytes(key, v)
+	case json.Marshaler:
+		return l.AddMarshal(key, v)
+	case error:
+		if l.encoder.opts.jsonCompat {
+			return l.AddMarshal(key, v)
+		}
+		if isNilPointer(v) {
+			l.addNull(key)
+			return nil
+		}
+		l.AddString(key, v.Error())
+	case fmt.Stringer:
+		if l.encoder.opts.jsonCompat {
+			return l.AddMarshal(key, v)
+		}
+		if isNilPointer(v) {
+			l.addNull(key)
+			return nil
+		}
+		l.AddString(key, v.String())
+	case []string:
+		l.AddStringList(key, v)
+	case []time.Time:
+		return l.AddTimeList(key, v)
+	case []time.Duration:
+		if l.encoder.opts.jsonCompat {
+			l.StartList(key)
+			for _, value := range v {
+				l.AddInt64("", int64(value))
+			}
+			l.EndList()
+			return nil
+		}
+		l.AddDurationList(key, v)
+	case []float64:
+		return l.addFloat64ListPrec(key, v, -1)
+	case []int:
+		l.StartList(key)
+		for _, value := range v {
+			l.AddInt64("", int64(value))
+		}
+		l.EndList()
+	case []int64:
+		l.StartList(key)
+		for _, value := range v {
+			l.AddInt64("", value)
+		}
+		l.EndList()
+	case []any:
+		l.StartList(key)
+		var err error
+		for _, value := range v {
+			err = firstError(err, l.AddAny("", value))
+		}
+		l.EndList()
+		return err
+	case map[string]string:
+		l.StartRecord(key)
+		if l.encoder.opts.unsortedMapKeys {
+			for k, value := range v {
+				l.AddString(k, value)
+			}
+		} else {
+			for _, k := range sortedKeys(v) {
+				l.AddString(k, v[k])
+			}
+		}
+		l.EndRecord()
+	case map[string]any:
+		l.StartRecord(key)
+		var err error
+		if l.encoder.opts.unsortedMapKeys {
+			for k, value := range v {
+				err = firstError(err, l.AddAny(k, value))
+			}
+		} else {
+			for _, k := range sortedKeys(v) {
+				err = firstError(err, l.AddAny(k, v[k]))
+			}
+		}
+		l.EndRecord()
+		return err
+	default:
+		return l.AddMarshal(key, value)
+	}
+	return nil
+}
+
+func (l *LineWriter) addNull(key string) {
+	if l.checkKey(key) != nil {
+		return
+	}
+	l.appendKey(key)
+	l.buf = append(l.buf, "null"...)
+}
+
+func (l *LineWriter) addDuration(key string, value time.Duration) {
+	if l.checkKey(key) != nil {
+		return
+	}
+	l.appendKey(key)
+	l.buf = tokens.AppendDuration(l.buf, value)
+}
+
+// isNilPointer reports whether the value is a nil pointer, whose methods
+// would likely panic if called.
+func isNilPointer(value any) bool {
+	v := reflect.ValueOf(value)
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func firstError(err, next error) error {
+	if err != nil {
+		return err
+	}
+	return next
+}
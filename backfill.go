@@ -0,0 +1,126 @@
+package goldjson
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// Backfill writes lines with explicit event timestamps through an Encoder in
+// the order of the timestamps, for batch and back-fill producers whose lines
+// are only slightly out of order. The lines are held in a window of the
+// given size, and the line with the earliest timestamp is written when the
+// window is full.
+//
+// A line whose timestamp is earlier than that of an already written line is
+// still written, so the output is only ordered if no line is further out of
+// order than the size of the window.
+type Backfill struct {
+	encoder *Encoder
+	window  int
+	mu      sync.Mutex
+	seq     uint64
+	pending backfillHeap
+}
+
+// NewBackfill returns a Backfill that writes through the Encoder, holding at
+// most window lines before writing them. A window of 0 or less writes the
+// lines immediately.
+func (e *Encoder) NewBackfill(window int) *Backfill {
+	return &Backfill{encoder: e, window: window}
+}
+
+// End finishes the line like LineWriter.End, but instead of writing the line
+// immediately, holds it in the window until the window is full and the line
+// has the earliest timestamp, then writes it. Lines with equal timestamps
+// are written in the order they were ended in.
+//
+// The lines are subject to the quota (see WithQuota) and the byte
+// accounting (see WithByteAccounting) when they are written, like the lines
+// written with LineWriter.End.
+//
+// The line MUST have been created by the Encoder of the Backfill. After
+// calling End, the LineWriter can no longer be used.
+//
+// Returns the error from writing the lines, if any, or the error End would
+// return for a written line (see WithKeyValidation and WithStickyErrors).
+func (b *Backfill) End(l *LineWriter, timestamp time.Time) error {
+	category, lineErr := l.category, l.Err()
+	buf := l.Detach()
+	if buf == nil {
+		return nil
+	}
+	line := backfillLine{buf: buf, category: category, err: lineErr, timestamp: timestamp}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	line.seq = b.seq
+	heap.Push(&b.pending, line)
+	for b.pending.Len() > b.window {
+		if err := b.writeFirst(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush writes all the lines held in the window in the order of their
+// timestamps, e.g. at the end of a batch.
+//
+// Returns the first error from writing the lines, if any, like End.
+func (b *Backfill) Flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.pending.Len() > 0 {
+		if err := b.writeFirst(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Backfill) writeFirst() error {
+	line, _ := heap.Pop(&b.pending).(backfillLine)
+	written, err := b.encoder.writeCounted(line.category, line.buf)
+	if written && err == nil {
+		err = line.err
+	}
+	return err
+}
+
+type backfillLine struct {
+	buf       []byte
+	category  string
+	err       error
+	timestamp time.Time
+	seq       uint64
+}
+
+type backfillHeap []backfillLine
+
+func (h backfillHeap) Len() int {
+	return len(h)
+}
+
+func (h backfillHeap) Less(i, j int) bool {
+	if h[i].timestamp.Equal(h[j].timestamp) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].timestamp.Before(h[j].timestamp)
+}
+
+func (h backfillHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *backfillHeap) Push(x any) {
+	line, _ := x.(backfillLine)
+	*h = append(*h, line)
+}
+
+func (h *backfillHeap) Pop() any {
+	old := *h
+	line := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return line
+}
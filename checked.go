@@ -0,0 +1,28 @@
+package goldjson
+
+import "unicode/utf8"
+
+// assertEndScope panics in the checked build if there's no open record
+// (isArray false) or list (isArray true) to end.
+func (l *LineWriter) assertEndScope(isArray bool) {
+	if l.composer.Depth() == 0 {
+		panic("goldjson: no open record or list to end")
+	}
+	if l.composer.InList() != isArray {
+		if isArray {
+			panic("goldjson: EndList called for a record")
+		}
+		panic("goldjson: EndRecord called for a list")
+	}
+}
+
+// assertLine panics in the checked build if the finished line is not
+// balanced or not valid UTF-8.
+func (l *LineWriter) assertLine() {
+	if l.composer.Depth() != 0 {
+		panic("goldjson: line ended with open records or lists")
+	}
+	if !utf8.Valid(l.buf) {
+		panic("goldjson: line is not valid UTF-8")
+	}
+}
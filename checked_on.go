@@ -0,0 +1,7 @@
+//go:build goldjson_checked
+
+package goldjson
+
+// checkedBuild tells whether the package is built in the checked mode, see
+// the goldjson_checked build tag in the package documentation.
+const checkedBuild = true
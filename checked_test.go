@@ -0,0 +1,86 @@
+//go:build goldjson_checked
+
+package goldjson_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jussi-kalliokoski/goldjson"
+)
+
+func init() {
+	checkedEnabled = true
+}
+
+func TestCheckedBuild(t *testing.T) {
+	tests := []struct {
+		name     string
+		use      func(l *goldjson.LineWriter)
+		expected string
+	}{
+		{
+			name: "use after end",
+			use: func(l *goldjson.LineWriter) {
+				_ = l.End()
+				l.AddString("a", "b")
+			},
+			expected: "goldjson: LineWriter used after End",
+		},
+		{
+			name:     "end record without record",
+			use:      func(l *goldjson.LineWriter) { l.EndRecord() },
+			expected: "goldjson: no open record or list to end",
+		},
+		{
+			name: "end record for list",
+			use: func(l *goldjson.LineWriter) {
+				l.StartList("a")
+				l.EndRecord()
+			},
+			expected: "goldjson: EndRecord called for a list",
+		},
+		{
+			name: "end list for record",
+			use: func(l *goldjson.LineWriter) {
+				l.StartRecord("a")
+				l.EndList()
+			},
+			expected: "goldjson: EndList called for a record",
+		},
+		{
+			name: "unbalanced",
+			use: func(l *goldjson.LineWriter) {
+				l.StartRecord("a")
+				_ = l.End()
+			},
+			expected: "goldjson: line ended with open records or lists",
+		},
+		{
+			name: "invalid UTF-8",
+			use: func(l *goldjson.LineWriter) {
+				l.AddSafeString("a", "\xff")
+				_ = l.End()
+			},
+			expected: "goldjson: line is not valid UTF-8",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				expectEqual(t, any(tt.expected), recover())
+			}()
+			tt.use(goldjson.NewEncoder(&bytes.Buffer{}).NewLine())
+		})
+	}
+
+	t.Run("strict closes open records", func(t *testing.T) {
+		var buf bytes.Buffer
+		line := goldjson.NewEncoder(&buf, goldjson.WithStrict()).NewLine()
+		line.StartRecord("a")
+		line.AddString("b", "c")
+		expectNoError(t, line.End())
+		expectEqual(t, `{"a":{"b":"c"}}`+"\n", buf.String())
+	})
+}
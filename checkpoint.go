@@ -0,0 +1,367 @@
+package goldjson
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+
+	"github.com/jussi-kalliokoski/goldjson/tokens"
+)
+
+// CheckpointKey is the key of the record holding the checkpoint in the
+// checkpoint lines written by a CheckpointWriter. The lines of the log MUST
+// NOT start with a record with the key.
+const CheckpointKey = "checkpoint"
+
+// Checkpoint is a position in a log written through a CheckpointWriter, for
+// resuming the processing of the log with ResumeCheckpointReader.
+type Checkpoint struct {
+	// Seq is the 1-based sequence number of the checkpoint.
+	Seq uint64
+	// Offset is the offset of the checkpoint line in bytes.
+	Offset int64
+	// Hash is the SHA-256 of the hash of the previous checkpoint followed by
+	// the lines between the checkpoints.
+	Hash []byte
+}
+
+// CheckpointWriter is an io.Writer that passes the lines written by an
+// Encoder through to another writer, periodically adding checkpoint lines
+// for consumers that process the log as it grows (see CheckpointReader), e.g.
+// after every 1000 lines:
+//
+//	{"checkpoint":{"seq":1,"offset":123456,"hash":"sha256:..."}}
+//
+// The hashes of the checkpoints are chained, so that a consumer resuming
+// from a checkpoint can detect the log being truncated, replaced or modified
+// after the checkpoint.
+//
+// The CheckpointWriter assumes that each write is a single line, which is
+// the case for the writes of an Encoder.
+type CheckpointWriter struct {
+	w     io.Writer
+	every int
+	mu    sync.Mutex
+	state checkpointState
+	lines int
+	buf   []byte
+}
+
+// NewCheckpointWriter returns a CheckpointWriter that writes to w, adding a
+// checkpoint line after every n lines. If n is 0, checkpoint lines are only
+// added with Checkpoint.
+func NewCheckpointWriter(w io.Writer, n int) *CheckpointWriter {
+	return &CheckpointWriter{w: w, every: n, state: newCheckpointState()}
+}
+
+// Resume continues the checkpoints of an existing log read from r, e.g. when
+// appending to a log file, so that the checkpoints stay verifiable. The whole
+// log is read. It must be called before writing.
+//
+// Returns an error if the log fails to verify (see CheckpointReader) or if
+// the log ends with a partial line.
+func (c *CheckpointWriter) Resume(r io.Reader) error {
+	cr := NewCheckpointReader(r)
+	for cr.Next() {
+	}
+	if err := cr.Err(); err != nil {
+		return err
+	}
+	if len(cr.partial) > 0 {
+		return errors.New("goldjson: log ends with a partial line")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state = cr.state
+	return nil
+}
+
+// Write writes the line p to the underlying writer, followed by a checkpoint
+// line if due.
+func (c *CheckpointWriter) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := writeFull(c.w, p); err != nil {
+		return 0, err
+	}
+	c.state.add(p)
+	c.lines++
+	if c.every > 0 && c.lines >= c.every {
+		if err := c.checkpoint(); err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+// Checkpoint adds a checkpoint line, e.g. periodically or before shutting
+// down.
+func (c *CheckpointWriter) Checkpoint() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.checkpoint()
+}
+
+func (c *CheckpointWriter) checkpoint() error {
+	cp := c.state.next()
+	c.buf = appendCheckpoint(c.buf[:0], cp)
+	if err := writeFull(c.w, c.buf); err != nil {
+		return err
+	}
+	c.state.advance(cp, len(c.buf))
+	c.lines = 0
+	return nil
+}
+
+func appendCheckpoint(buf []byte, cp Checkpoint) []byte {
+	buf = append(buf, `{"`+CheckpointKey+`":{"seq":`...)
+	buf = tokens.AppendUint64(buf, cp.Seq)
+	buf = append(buf, `,"offset":`...)
+	buf = tokens.AppendInt64(buf, cp.Offset)
+	buf = append(buf, `,"hash":"sha256:`...)
+	start := len(buf)
+	buf = append(buf, make([]byte, hex.EncodedLen(len(cp.Hash)))...)
+	hex.Encode(buf[start:], cp.Hash)
+	return append(buf, "\"}}\n"...)
+}
+
+// checkpointState tracks the checkpoints of a log.
+type checkpointState struct {
+	last Checkpoint
+	// offset is the offset of the next line.
+	offset int64
+	// hash is the hash of the last checkpoint followed by the lines after
+	// it.
+	hash hash.Hash
+}
+
+func newCheckpointState() checkpointState {
+	s := checkpointState{hash: sha256.New()}
+	s.hash.Write(make([]byte, sha256.Size))
+	return s
+}
+
+// add adds a line, including the trailing newline, to the current segment.
+func (s *checkpointState) add(line []byte) {
+	s.hash.Write(line)
+	s.offset += int64(len(line))
+}
+
+// next returns the checkpoint for the current position.
+func (s *checkpointState) next() Checkpoint {
+	return Checkpoint{Seq: s.last.Seq + 1, Offset: s.offset, Hash: s.hash.Sum(nil)}
+}
+
+// advance starts a new segment after the checkpoint line of the given size.
+func (s *checkpointState) advance(cp Checkpoint, size int) {
+	s.last = cp
+	s.offset = cp.Offset + int64(size)
+	s.hash.Reset()
+	s.hash.Write(cp.Hash)
+}
+
+// ErrCheckpoint is matched by the errors returned by CheckpointReader for
+// logs that don't match their checkpoints. See CheckpointError.
+var ErrCheckpoint = errors.New("goldjson: checkpoint mismatch")
+
+// CheckpointError describes a checkpoint that doesn't match the log.
+type CheckpointError struct {
+	// Offset is the offset of the checkpoint line in bytes.
+	Offset int64
+	Reason string
+}
+
+func (e *CheckpointError) Error() string {
+	return fmt.Sprintf("%s at offset %d: %s", ErrCheckpoint, e.Offset, e.Reason)
+}
+
+// Unwrap returns ErrCheckpoint.
+func (e *CheckpointError) Unwrap() error {
+	return ErrCheckpoint
+}
+
+// CheckpointReader reads the lines of a log written through a
+// CheckpointWriter, verifying the checkpoint lines and skipping them, e.g.
+// for a consumer that processes the log as it grows:
+//
+//	r, err := goldjson.ResumeCheckpointReader(f, saved)
+//	if err != nil {
+//		// ...
+//	}
+//	for {
+//		for r.Next() {
+//			process(r.Line())
+//			if r.Checkpoint().Seq != saved.Seq {
+//				saved = r.Checkpoint()
+//				// persist saved
+//			}
+//		}
+//		if err := r.Err(); err != nil {
+//			// ...
+//		}
+//		// wait for the log to grow
+//	}
+//
+// Next returns false at the end of the underlying reader, after which it
+// can be called again to continue reading once the log has grown. A partial
+// line at the end is kept until the rest of the line has been written.
+type CheckpointReader struct {
+	r       *bufio.Reader
+	state   checkpointState
+	line    []byte
+	partial []byte
+	dec     Decoder
+	err     error
+}
+
+// NewCheckpointReader returns a CheckpointReader that reads a log from the
+// beginning from r.
+func NewCheckpointReader(r io.Reader) *CheckpointReader {
+	return &CheckpointReader{r: bufio.NewReader(r), state: newCheckpointState()}
+}
+
+// ResumeCheckpointReader returns a CheckpointReader that reads the log from
+// r starting after the checkpoint, e.g. the last checkpoint processed before
+// a restart (see CheckpointReader.Checkpoint).
+//
+// Returns a *CheckpointError if the log doesn't have the checkpoint at its
+// offset, e.g. because the log has been truncated or replaced.
+func ResumeCheckpointReader(r io.ReadSeeker, from Checkpoint) (*CheckpointReader, error) {
+	if _, err := r.Seek(from.Offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	c := NewCheckpointReader(r)
+	c.state.offset = from.Offset
+	line, err := c.r.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	cp, ok := c.parse(line)
+	if !ok || cp.Seq != from.Seq || cp.Offset != from.Offset || !bytes.Equal(cp.Hash, from.Hash) {
+		return nil, &CheckpointError{Offset: from.Offset, Reason: "checkpoint not found"}
+	}
+	c.state.advance(cp, len(line))
+	return c, nil
+}
+
+// Next advances to the next line, skipping the checkpoint lines. Returns
+// false at the end of the underlying reader or on error, see Err.
+func (c *CheckpointReader) Next() bool {
+	if c.err != nil {
+		return false
+	}
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			if err != io.EOF {
+				c.err = err
+			}
+			c.line = nil
+			return false
+		}
+		if !isCheckpointLine(line) {
+			c.state.add(line)
+			c.line = line[:len(line)-1]
+			return true
+		}
+		cp, ok := c.parse(line)
+		expected := c.state.next()
+		switch {
+		case !ok:
+			c.err = &CheckpointError{Offset: expected.Offset, Reason: "invalid checkpoint line"}
+		case cp.Seq != expected.Seq:
+			c.err = &CheckpointError{Offset: expected.Offset, Reason: fmt.Sprintf("expected sequence %d, got %d", expected.Seq, cp.Seq)}
+		case cp.Offset != expected.Offset:
+			c.err = &CheckpointError{Offset: expected.Offset, Reason: fmt.Sprintf("offset mismatch: %d", cp.Offset)}
+		case !bytes.Equal(cp.Hash, expected.Hash):
+			c.err = &CheckpointError{Offset: expected.Offset, Reason: "hash mismatch"}
+		}
+		if c.err != nil {
+			return false
+		}
+		c.state.advance(cp, len(line))
+	}
+}
+
+// readLine reads the next complete line, including the trailing newline,
+// keeping a partial line for the next call.
+func (c *CheckpointReader) readLine() ([]byte, error) {
+	for {
+		chunk, err := c.r.ReadSlice('\n')
+		c.partial = append(c.partial, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		c.line = append(c.line[:0], c.partial...)
+		c.partial = c.partial[:0]
+		return c.line, nil
+	}
+}
+
+// isCheckpointLine tells whether the line starts like a checkpoint line.
+func isCheckpointLine(line []byte) bool {
+	return bytes.HasPrefix(line, []byte(`{"`+CheckpointKey+`":{`))
+}
+
+// parse parses a checkpoint line, returning false if the line is not a
+// valid checkpoint line.
+func (c *CheckpointReader) parse(line []byte) (Checkpoint, bool) {
+	var cp Checkpoint
+	if !isCheckpointLine(line) {
+		return cp, false
+	}
+	c.dec.err = nil
+	if !c.dec.setLine(bytes.TrimSuffix(line, []byte("\n"))) || !c.dec.NextField() || c.dec.Type() != ValueRecord {
+		return cp, false
+	}
+	record := c.dec.Raw()
+	if c.dec.NextField() || !c.dec.setLine(record) {
+		return cp, false
+	}
+	for c.dec.NextField() {
+		var err error
+		switch string(c.dec.Key()) {
+		case "seq":
+			cp.Seq, err = c.dec.Uint64()
+		case "offset":
+			cp.Offset, err = c.dec.Int64()
+		case "hash":
+			var value []byte
+			value, err = c.dec.Bytes()
+			if err == nil {
+				cp.Hash, err = hex.DecodeString(string(bytes.TrimPrefix(value, []byte("sha256:"))))
+			}
+		}
+		if err != nil {
+			return cp, false
+		}
+	}
+	return cp, c.dec.Err() == nil && cp.Seq != 0
+}
+
+// Line returns the current line, without the trailing newline. The line is
+// only valid until the next call of Next.
+func (c *CheckpointReader) Line() []byte {
+	return c.line
+}
+
+// Checkpoint returns the last checkpoint read, or the checkpoint resumed
+// from. The Seq of the checkpoint is 0 before the first checkpoint of the
+// log.
+func (c *CheckpointReader) Checkpoint() Checkpoint {
+	return c.state.last
+}
+
+// Err returns the first error encountered by Next, other than io.EOF.
+func (c *CheckpointReader) Err() error {
+	return c.err
+}
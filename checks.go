@@ -0,0 +1,256 @@
+package goldjson
+
+import "time"
+
+// lineChecks is the per-line state of the checks that require tracking the
+// structure of the line, i.e. the strict mode (see WithStrict), key
+// validation (see WithKeyValidation) and sticky errors (see
+// WithStickyErrors), as well as the counters of the trailer (see
+// WithTrailer) and the fields for the schema tracking (see WithSchema).
+type lineChecks struct {
+	strict     bool
+	validation *KeyValidation
+	trailer    bool
+	start      time.Time
+	// fields and dropped count the fields added to and omitted from the
+	// line.
+	fields  int
+	dropped int
+	// schema tells whether the top-level fields are recorded in entries
+	// for the schema tracking.
+	schema  bool
+	entries []schemaEntry
+	// keys are the keys of the open records, only tracked in strict mode.
+	keys   []string
+	scopes []checkScope
+	// err is the first key validation error of the line, or with sticky
+	// errors, the first error of the line.
+	err    error
+	sticky bool
+	// ended is set for the lines that have been ended, see
+	// WithUseAfterEndCheck.
+	ended bool
+	// eventFields are the top-level keys declared for the event version,
+	// see WithEventVersion.
+	eventFields  map[string]struct{}
+	eventVersion int64
+}
+
+type checkScope struct {
+	keysStart int
+	isArray   bool
+	// discardFrom is the buffer offset from which the record/list is
+	// discarded when closed, or -1 if the record/list is kept.
+	discardFrom int
+	// wasFirstEntry tells whether the record/list was started as the first
+	// entry of its parent, to restore the state if it's discarded.
+	wasFirstEntry bool
+	// fields and dropped are the counters of the line when the record/list
+	// was started, to restore them if it's discarded.
+	fields  int
+	dropped int
+}
+
+func (o options) checked() bool {
+	return o.strict || o.keyValidation != nil || o.trailerKey != "" || o.schemaKey != "" || o.useAfterEndCheck || o.stickyErrors || o.floatPolicy == FloatPolicyError || o.eventFields != nil
+}
+
+func newLineChecks(o options) *lineChecks {
+	c := &lineChecks{}
+	c.reset(o)
+	return c
+}
+
+func (c *lineChecks) reset(o options) {
+	c.strict = o.strict
+	c.validation = o.keyValidation
+	c.keys = c.keys[:0]
+	c.scopes = append(c.scopes[:0], checkScope{discardFrom: -1})
+	c.err = nil
+	c.sticky = o.stickyErrors
+	c.trailer = o.trailerKey != ""
+	c.fields = 0
+	c.dropped = 0
+	c.schema = o.schemaKey != ""
+	c.entries = c.entries[:0]
+	c.eventFields = o.eventFields
+	c.eventVersion = o.eventVersion
+	if c.trailer {
+		c.start = time.Now()
+	}
+}
+
+// addKey registers the key in the active record, returning an error if the
+// key must be omitted. Keys are never rejected in lists.
+func (c *lineChecks) addKey(key string) error {
+	c.checkEnded()
+	if c.failed() {
+		c.dropped++
+		return c.err
+	}
+	err := c.validateKey(key)
+	if err != nil {
+		c.dropped++
+	} else {
+		c.fields++
+	}
+	return err
+}
+
+func (c *lineChecks) validateKey(key string) error {
+	scope := &c.scopes[len(c.scopes)-1]
+	if scope.isArray {
+		return nil
+	}
+	if c.eventFields != nil && len(c.scopes) == 1 {
+		if err := c.checkEventField(key); err != nil {
+			if c.err == nil {
+				c.err = err
+			}
+			return err
+		}
+	}
+	if c.validation != nil {
+		if err := c.validation.validate(key); err != nil {
+			if c.err == nil {
+				c.err = err
+			}
+			return err
+		}
+	}
+	if !c.strict {
+		return nil
+	}
+	for _, k := range c.keys[scope.keysStart:] {
+		if k == key {
+			return ErrDuplicateKey
+		}
+	}
+	c.keys = append(c.keys, key)
+	return nil
+}
+
+// failed tells whether the later fields of the line are omitted due to a
+// sticky error.
+func (c *lineChecks) failed() bool {
+	return c.sticky && c.err != nil
+}
+
+// addKnownKeys registers keys that have already been checked, such as the
+// keys of StaticFields.
+func (c *lineChecks) addKnownKeys(keys []string) {
+	c.checkEnded()
+	if c.strict && !c.scopes[len(c.scopes)-1].isArray {
+		c.keys = append(c.keys, keys...)
+	}
+}
+
+// removeLastKey unregisters the most recently added key of the active record.
+func (c *lineChecks) removeLastKey() {
+	c.dropped++
+	c.omitLastKey()
+}
+
+// omitLastKey unregisters the most recently added key of the active record
+// without counting it as dropped.
+func (c *lineChecks) omitLastKey() {
+	c.fields--
+	if c.schema && len(c.scopes) == 1 && len(c.entries) > 0 {
+		c.entries = c.entries[:len(c.entries)-1]
+	}
+	if scope := c.scopes[len(c.scopes)-1]; c.strict && !scope.isArray && len(c.keys) > scope.keysStart {
+		c.keys = c.keys[:len(c.keys)-1]
+	}
+}
+
+func (c *lineChecks) push(isArray bool, discardFrom int, wasFirstEntry bool) {
+	c.scopes = append(c.scopes, checkScope{
+		keysStart:     len(c.keys),
+		isArray:       isArray,
+		discardFrom:   discardFrom,
+		wasFirstEntry: wasFirstEntry,
+		fields:        c.fields,
+		dropped:       c.dropped,
+	})
+}
+
+func (c *lineChecks) pop() checkScope {
+	c.checkEnded()
+	scope := c.scopes[len(c.scopes)-1]
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.keys = c.keys[:scope.keysStart]
+	return scope
+}
+
+// checkKey returns an error if the key must be omitted.
+func (l *LineWriter) checkKey(key string) error {
+	if l.checks == nil {
+		return nil
+	}
+	err := l.checks.addKey(key)
+	if err == nil {
+		l.checks.observe(key, len(l.buf))
+	}
+	return err
+}
+
+// observe records a top-level field for the schema tracking.
+func (c *lineChecks) observe(key string, offset int) {
+	if c.schema && len(c.scopes) == 1 && !c.scopes[0].isArray {
+		c.entries = append(c.entries, schemaEntry{key: key, offset: offset})
+	}
+}
+
+// rejectKey unregisters the key that was accepted for a value that then
+// failed to encode.
+func (l *LineWriter) rejectKey() {
+	if l.checks != nil {
+		l.checks.removeLastKey()
+	}
+}
+
+// startScope registers a record/list being started with the key. If the key
+// is rejected, the record/list is discarded when closed.
+func (l *LineWriter) startScope(key string, isArray bool) {
+	wasFirstEntry := l.composer.Empty()
+	discardFrom := -1
+	if l.checks.addKey(key) != nil {
+		discardFrom = len(l.buf)
+	} else {
+		l.checks.observe(key, len(l.buf))
+	}
+	l.checks.push(isArray, discardFrom, wasFirstEntry)
+}
+
+// endScope unregisters the record/list that was just closed, discarding it
+// if it was started with a rejected key.
+func (l *LineWriter) endScope() {
+	scope := l.checks.pop()
+	if scope.discardFrom == -1 {
+		return
+	}
+	l.buf = l.buf[:scope.discardFrom]
+	l.checks.fields, l.checks.dropped = scope.fields, scope.dropped
+	if scope.wasFirstEntry {
+		l.composer.SetEmpty()
+	}
+}
+
+// endChecks finishes the checks before ending the line, closing all the open
+// records and lists in strict mode, and records the keys of the line if it
+// is used for building StaticFields.
+func (l *LineWriter) endChecks() {
+	if !l.checks.strict {
+		return
+	}
+	for len(l.checks.scopes) > 1 {
+		if l.checks.scopes[len(l.checks.scopes)-1].isArray {
+			l.EndList()
+		} else {
+			l.EndRecord()
+		}
+	}
+	if w, ok := l.encoder.w.(staticFieldsWriter); ok {
+		w.staticFields.keys = append(w.staticFields.keys[:0], l.checks.keys...)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// archiveMagic is the first line of an archive.
+const archiveMagic = "goldjson-archive 1"
+
+// runArchive rewrites the lines in a form that deduplicates the bytes shared
+// by consecutive lines, or restores the original lines with -d.
+//
+// Each line of the input is written as a record
+//
+//	<prefix>,<suffix>:<middle>
+//
+// where prefix and suffix are the lengths of the prefix and the suffix the
+// line shares with the previous line, and middle is the rest of the line.
+// Lines of the same shape usually share their static fields (e.g. the
+// service and host fields) as well as most of the timestamp, so only the
+// changing values are left in the records. The first line is stored as is,
+// so it acts as the header the later lines are encoded against. A last line
+// without a trailing newline is written with ; instead of : as the
+// separator, so the input is restored byte for byte.
+func runArchive(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("archive", flag.ContinueOnError)
+	restore := fs.Bool("d", false, "restore the original lines from an archive")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	in, err := openInput(fs, stdin)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	r := bufio.NewReader(in)
+	w := bufio.NewWriter(stdout)
+	if *restore {
+		err = unarchiveLines(r, w)
+	} else {
+		err = archiveLines(r, w)
+	}
+	if err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+	return w.Flush()
+}
+
+func archiveLines(r *bufio.Reader, w *bufio.Writer) error {
+	_, _ = w.WriteString(archiveMagic + "\n")
+	var prev, record []byte
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			sep := byte(';')
+			if line[len(line)-1] == '\n' {
+				line, sep = line[:len(line)-1], ':'
+			}
+			prefix := commonPrefix(prev, line)
+			suffix := commonSuffix(prev[prefix:], line[prefix:])
+			record = strconv.AppendInt(record[:0], int64(prefix), 10)
+			record = append(record, ',')
+			record = strconv.AppendInt(record, int64(suffix), 10)
+			record = append(record, sep)
+			record = append(record, line[prefix:len(line)-suffix]...)
+			record = append(record, '\n')
+			if _, err := w.Write(record); err != nil {
+				return err
+			}
+			prev = line
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func unarchiveLines(r *bufio.Reader, w *bufio.Writer) error {
+	magic, err := r.ReadBytes('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if string(bytes.TrimSuffix(magic, []byte("\n"))) != archiveMagic {
+		return errors.New("not an archive")
+	}
+	var prev, line []byte
+	for n := 1; ; n++ {
+		record, err := r.ReadBytes('\n')
+		if len(record) == 0 && errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		if record[len(record)-1] != '\n' {
+			return fmt.Errorf("record %d: truncated", n)
+		}
+		prefix, suffix, sep, middle, ok := parseArchiveRecord(record[:len(record)-1])
+		if !ok || prefix+suffix > len(prev) {
+			return fmt.Errorf("record %d: malformed", n)
+		}
+		line = append(line[:0], prev[:prefix]...)
+		line = append(line, middle...)
+		line = append(line, prev[len(prev)-suffix:]...)
+		if _, err := w.Write(line); err != nil {
+			return err
+		}
+		if sep == ':' {
+			_ = w.WriteByte('\n')
+		}
+		prev, line = line, prev
+	}
+}
+
+func parseArchiveRecord(record []byte) (prefix, suffix int, sep byte, middle []byte, ok bool) {
+	i := bytes.IndexAny(record, ":;")
+	if i == -1 {
+		return 0, 0, 0, nil, false
+	}
+	comma := bytes.IndexByte(record[:i], ',')
+	if comma == -1 {
+		return 0, 0, 0, nil, false
+	}
+	p, err := strconv.ParseUint(string(record[:comma]), 10, 31)
+	if err != nil {
+		return 0, 0, 0, nil, false
+	}
+	s, err := strconv.ParseUint(string(record[comma+1:i]), 10, 31)
+	if err != nil {
+		return 0, 0, 0, nil, false
+	}
+	return int(p), int(s), record[i], record[i+1:], true
+}
+
+func commonPrefix(a, b []byte) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+func commonSuffix(a, b []byte) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[len(a)-1-n] == b[len(b)-1-n] {
+		n++
+	}
+	return n
+}
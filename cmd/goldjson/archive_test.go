@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestArchive(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"empty", ""},
+		{"single line", `{"a":1}` + "\n"},
+		{"no trailing newline", `{"a":1}` + "\n" + `{"a":2}`},
+		{"empty lines", "\n\n" + `{"a":1}` + "\n\n"},
+		{"carriage returns", "{\"a\":1}\r\n{\"a\":2}\r\n"},
+		{"repeated lines", strings.Repeat(`{"a":1}`+"\n", 3)},
+		{"shorter lines", `{"a":"aaaaaa","b":1}` + "\n" + `{"a":"a","b":1}` + "\n" + `{"a":"aaaaaaaaaa","b":1}` + "\n"},
+		{"not json", "hello world\nhello there\n:;,\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archived, errArchive := runCommand(t, tt.input, "archive")
+			received, errRestore := runCommand(t, archived, "archive", "-d")
+
+			expectNoError(t, errArchive)
+			expectNoError(t, errRestore)
+			expectEqual(t, tt.input, received)
+		})
+	}
+
+	t.Run("deduplication", func(t *testing.T) {
+		input := `{"time":"2023-06-12T20:42:15.1Z","service":"api","msg":"a"}` + "\n" +
+			`{"time":"2023-06-12T20:42:15.2Z","service":"api","msg":"b"}`
+		expected := archiveMagic + "\n" +
+			`0,0:{"time":"2023-06-12T20:42:15.1Z","service":"api","msg":"a"}` + "\n" +
+			`29,2;2Z","service":"api","msg":"b` + "\n"
+
+		received, err := runCommand(t, input, "archive")
+
+		expectNoError(t, err)
+		expectEqual(t, expected, received)
+	})
+
+	t.Run("invalid archives", func(t *testing.T) {
+		for _, input := range []string{
+			"",
+			"{}\n",
+			archiveMagic + "\n0,0:a",
+			archiveMagic + "\n0,0:a\n2,0:\n",
+			archiveMagic + "\n0,0:a\nx,0:\n",
+			archiveMagic + "\n0,0:a\n1\n",
+		} {
+			_, err := runCommand(t, input, "archive", "-d")
+
+			expectError(t, err)
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+)
+
+// recordSeparator starts every text of a JSON text sequence (RFC 7464).
+const recordSeparator = 0x1e
+
+func runConvert(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	from := fs.String("from", "ndjson", "the `format` of the input: ndjson or json-seq")
+	to := fs.String("to", "json-seq", "the `format` of the output: ndjson or json-seq")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	split, err := splitFunc(*from)
+	if err != nil {
+		return fmt.Errorf("convert: %w", err)
+	}
+	prefix, err := recordPrefix(*to)
+	if err != nil {
+		return fmt.Errorf("convert: %w", err)
+	}
+	in, err := openInput(fs, stdin)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	w := bufio.NewWriter(stdout)
+	s := bufio.NewScanner(in)
+	s.Buffer(nil, 64*1024*1024)
+	s.Split(split)
+	var record bytes.Buffer
+	for n := 1; s.Scan(); n++ {
+		if len(bytes.TrimSpace(s.Bytes())) == 0 {
+			continue
+		}
+		// compacting keeps the records on a single line
+		record.Reset()
+		record.Write(prefix)
+		if err := json.Compact(&record, s.Bytes()); err != nil {
+			return fmt.Errorf("convert: record %d: %w", n, err)
+		}
+		record.WriteByte('\n')
+		if _, err := w.Write(record.Bytes()); err != nil {
+			return err
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func splitFunc(format string) (bufio.SplitFunc, error) {
+	switch format {
+	case "ndjson":
+		return bufio.ScanLines, nil
+	case "json-seq":
+		return scanSeq, nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+func recordPrefix(format string) ([]byte, error) {
+	switch format {
+	case "ndjson":
+		return nil, nil
+	case "json-seq":
+		return []byte{recordSeparator}, nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+// scanSeq is a bufio.SplitFunc for the texts of a JSON text sequence.
+func scanSeq(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	start := 0
+	for start < len(data) && data[start] == recordSeparator {
+		start++
+	}
+	if i := bytes.IndexByte(data[start:], recordSeparator); i != -1 {
+		return start + i, data[start : start+i], nil
+	}
+	if atEOF && start < len(data) {
+		return len(data), data[start:], nil
+	}
+	if atEOF {
+		return len(data), nil, nil
+	}
+	return start, nil, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			"ndjson to json-seq",
+			nil,
+			`{"a":1}` + "\n\n" + `{"a":2}`,
+			"\x1e" + `{"a":1}` + "\n\x1e" + `{"a":2}` + "\n",
+		},
+		{
+			"json-seq to ndjson",
+			[]string{"-from", "json-seq", "-to", "ndjson"},
+			"\x1e" + `{"a":1}` + "\n\x1e\x1e" + `{"a":2}`,
+			`{"a":1}` + "\n" + `{"a":2}` + "\n",
+		},
+		{
+			"multi-line json-seq to ndjson",
+			[]string{"-from", "json-seq", "-to", "ndjson"},
+			"\x1e" + "[1,\n 2]\n",
+			"[1,2]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received, err := runCommand(t, tt.input, append([]string{"convert"}, tt.args...)...)
+
+			expectNoError(t, err)
+			expectEqual(t, tt.expected, received)
+		})
+	}
+
+	t.Run("invalid record", func(t *testing.T) {
+		_, err := runCommand(t, `{"a":`, "convert")
+
+		expectError(t, err)
+	})
+
+	t.Run("unsupported format", func(t *testing.T) {
+		_, err := runCommand(t, "", "convert", "-to", "msgpack")
+
+		expectError(t, err)
+	})
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/jussi-kalliokoski/goldjson"
+)
+
+func runFilter(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("filter", flag.ContinueOnError)
+	var equals, matches listFlag
+	fs.Var(&equals, "eq", "select lines where `path=value`, repeatable")
+	fs.Var(&matches, "match", "select lines where the value at path matches the regexp, as `path=regexp`, repeatable")
+	fields := fs.String("fields", "", "comma-separated `paths` of the fields to output, instead of the whole line")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var conds []condition
+	for _, eq := range equals {
+		path, value, ok := strings.Cut(eq, "=")
+		if !ok {
+			return fmt.Errorf("filter: invalid -eq %q, expected path=value", eq)
+		}
+		conds = append(conds, condition{path: splitPath(path), value: value})
+	}
+	for _, m := range matches {
+		path, expr, ok := strings.Cut(m, "=")
+		if !ok {
+			return fmt.Errorf("filter: invalid -match %q, expected path=regexp", m)
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("filter: %w", err)
+		}
+		conds = append(conds, condition{path: splitPath(path), re: re})
+	}
+	var projection [][]string
+	if *fields != "" {
+		for _, path := range strings.Split(*fields, ",") {
+			projection = append(projection, splitPath(path))
+		}
+	}
+	in, err := openInput(fs, stdin)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	w := bufio.NewWriter(stdout)
+	enc := goldjson.NewEncoder(w)
+	f := newFieldLookup()
+	err = forEachLine(in, func(line []byte) error {
+		for _, cond := range conds {
+			if !cond.matches(f, line) {
+				return nil
+			}
+		}
+		if projection == nil {
+			_, err := w.Write(append(line, '\n'))
+			return err
+		}
+		out := enc.NewLine()
+		for _, path := range projection {
+			if f.lookup(line, path) {
+				_ = out.AddRawJSON(strings.Join(path, "."), f.dec.Raw())
+			}
+		}
+		return out.End()
+	})
+	if err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+type condition struct {
+	path  []string
+	value string
+	re    *regexp.Regexp
+}
+
+// matches compares the value at the path of the line to the condition.
+// Strings are compared unquoted, other values as JSON.
+func (c condition) matches(f *fieldLookup, line []byte) bool {
+	if !f.lookup(line, c.path) {
+		return false
+	}
+	value := string(f.dec.Raw())
+	if f.dec.Type() == goldjson.ValueString {
+		if s, err := f.dec.String(); err == nil {
+			value = s
+		}
+	}
+	if c.re != nil {
+		return c.re.MatchString(value)
+	}
+	return value == c.value
+}
+
+// fieldLookup looks up values in the lines with a goldjson.Decoder, which
+// scans the records only up to the fields looked up, so the lines are never
+// decoded as a whole.
+type fieldLookup struct {
+	src   bytes.Reader
+	dec   *goldjson.Decoder
+	value []byte
+}
+
+func newFieldLookup() *fieldLookup {
+	return &fieldLookup{dec: goldjson.NewDecoder(nil)}
+}
+
+// lookup finds the value at the path of dot-separated keys in the line, if
+// the line is a JSON record that has the path, leaving the Decoder at the
+// field of the value.
+func (f *fieldLookup) lookup(line []byte, path []string) bool {
+	record := line
+	for i, key := range path {
+		if i > 0 {
+			// the Decoder reuses its buffer for the nested record
+			f.value = append(f.value[:0], f.dec.Raw()...)
+			record = f.value
+		}
+		f.src.Reset(record)
+		f.dec.Reset(&f.src)
+		if !f.dec.NextLine() || !f.dec.Lookup(key) {
+			return false
+		}
+	}
+	return true
+}
+
+func splitPath(path string) []string {
+	return strings.Split(path, ".")
+}
+
+// forEachLine calls fn for every non-empty line of r, without the line
+// terminator.
+func forEachLine(r io.Reader, fn func(line []byte) error) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if line = bytes.TrimRight(line, "\r\n"); len(line) > 0 {
+			if fnErr := fn(line); fnErr != nil {
+				return fnErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// listFlag is a flag that can be repeated.
+type listFlag []string
+
+func (f *listFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *listFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import "testing"
+
+func TestFilter(t *testing.T) {
+	input := `{"level":"info","msg":"started","req":{"id":1}}` + "\n" +
+		`{"level":"error","msg":"failed to connect","req":{"id":2}}` + "\n" +
+		"\n" +
+		`{"level":"error","msg":"timeout","req":{"id":3}}` + "\n"
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			"no conditions",
+			nil,
+			`{"level":"info","msg":"started","req":{"id":1}}` + "\n" +
+				`{"level":"error","msg":"failed to connect","req":{"id":2}}` + "\n" +
+				`{"level":"error","msg":"timeout","req":{"id":3}}` + "\n",
+		},
+		{
+			"equal string",
+			[]string{"-eq", "level=info"},
+			`{"level":"info","msg":"started","req":{"id":1}}` + "\n",
+		},
+		{
+			"equal nested number",
+			[]string{"-eq", "req.id=2"},
+			`{"level":"error","msg":"failed to connect","req":{"id":2}}` + "\n",
+		},
+		{
+			"match",
+			[]string{"-eq", "level=error", "-match", "msg=^t"},
+			`{"level":"error","msg":"timeout","req":{"id":3}}` + "\n",
+		},
+		{
+			"not a record",
+			[]string{"-eq", "level.x=1"},
+			"",
+		},
+		{
+			"missing field",
+			[]string{"-eq", "other=x"},
+			"",
+		},
+		{
+			"project",
+			[]string{"-eq", "level=error", "-fields", "req.id,msg,missing"},
+			`{"req.id":2,"msg":"failed to connect"}` + "\n" + `{"req.id":3,"msg":"timeout"}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received, err := runCommand(t, input, append([]string{"filter"}, tt.args...)...)
+
+			expectNoError(t, err)
+			expectEqual(t, tt.expected, received)
+		})
+	}
+
+	t.Run("passthrough", func(t *testing.T) {
+		input := `{"id": 9007199254740993, "msg":"caf\u00e9"}` + "\n" + `{"id":1,"msg":"tea"}` + "\n"
+
+		received, err := runCommand(t, input, "filter", "-eq", "msg=café")
+
+		expectNoError(t, err)
+		expectEqual(t, `{"id": 9007199254740993, "msg":"caf\u00e9"}`+"\n", received)
+	})
+
+	t.Run("invalid condition", func(t *testing.T) {
+		_, err := runCommand(t, input, "filter", "-eq", "level")
+
+		expectError(t, err)
+	})
+}
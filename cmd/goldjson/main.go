@@ -0,0 +1,86 @@
+// Command goldjson is a tool for working with line-delimited JSON.
+//
+// Usage:
+//
+//	goldjson <command> [flags] [file]
+//
+// The commands are:
+//
+//	pretty    pretty-print lines, optionally following a file like tail -f
+//	filter    select lines by field values and project fields
+//	convert   convert between ndjson and JSON text sequences (RFC 7464)
+//	validate  check that every line is well-formed
+//	stats     report key presence, value types and line sizes
+//	redact    redact values by key or pattern
+//	replay    re-emit lines through an Encoder, redacting, renaming and rate limiting
+//	archive   deduplicate consecutive lines for long-term storage, or restore them with -d
+//
+// Each command reads from the given file, or from stdin if no file is given.
+// Run goldjson <command> -h for the flags of a command.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string, stdin io.Reader, stdout io.Writer) error
+}
+
+var commands = []command{
+	{"pretty", "pretty-print lines, optionally following a file like tail -f", runPretty},
+	{"filter", "select lines by field values and project fields", runFilter},
+	{"convert", "convert between ndjson and JSON text sequences (RFC 7464)", runConvert},
+	{"validate", "check that every line is well-formed", runValidate},
+	{"stats", "report key presence, value types and line sizes", runStats},
+	{"redact", "redact values by key or pattern", runRedact},
+	{"replay", "re-emit lines through an Encoder, redacting, renaming and rate limiting", runReplay},
+	{"archive", "deduplicate consecutive lines for long-term storage, or restore them with -d", runArchive},
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "goldjson:", err)
+		}
+		os.Exit(2)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) > 0 {
+		for _, c := range commands {
+			if c.name == args[0] {
+				return c.run(args[1:], stdin, stdout)
+			}
+		}
+	}
+	fmt.Fprintln(os.Stderr, "usage: goldjson <command> [flags] [file]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-9s %s\n", c.name, c.usage)
+	}
+	if len(args) == 0 {
+		return flag.ErrHelp
+	}
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+// openInput returns the file named by the only positional argument of the
+// command, or stdin if there is none.
+func openInput(fs *flag.FlagSet, stdin io.Reader) (io.ReadCloser, error) {
+	switch fs.NArg() {
+	case 0:
+		return io.NopCloser(stdin), nil
+	case 1:
+		return os.Open(fs.Arg(0))
+	default:
+		return nil, fmt.Errorf("%s: too many arguments", fs.Name())
+	}
+}
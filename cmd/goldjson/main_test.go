@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func runCommand(tb testing.TB, input string, args ...string) (string, error) {
+	tb.Helper()
+	var out bytes.Buffer
+	err := run(args, strings.NewReader(input), &out)
+	return out.String(), err
+}
+
+func expectNoError(tb testing.TB, err error) {
+	tb.Helper()
+	if err != nil {
+		tb.Fatalf("expected no error, got %##v", err)
+	}
+}
+
+func expectError(tb testing.TB, err error) {
+	tb.Helper()
+	if err == nil {
+		tb.Fatalf("expected error, got <nil>")
+	}
+}
+
+func expectEqual[T comparable](tb testing.TB, expected, received T) {
+	tb.Helper()
+	if expected != received {
+		tb.Fatalf("expected %##v, got %##v", expected, received)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"time"
+
+	"github.com/jussi-kalliokoski/goldjson"
+)
+
+func runPretty(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("pretty", flag.ContinueOnError)
+	follow := fs.Bool("f", false, "keep reading the file as it grows, like tail -f")
+	color := fs.Bool("color", false, "colorize the output with ANSI escape codes")
+	indent := fs.String("indent", "  ", "the indentation of nested values")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *follow && fs.NArg() == 0 {
+		return errors.New("pretty: -f requires a file")
+	}
+	in, err := openInput(fs, stdin)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	w := bufio.NewWriter(stdout)
+	r := bufio.NewReader(in)
+	p := prettyPrinter{indent: *indent, color: *color, dec: goldjson.NewDecoder(nil)}
+	var partial []byte
+	for {
+		line, err := r.ReadBytes('\n')
+		partial = append(partial, line...)
+		if err == io.EOF && *follow {
+			// wait for the rest of the line or for more lines
+			if flushErr := w.Flush(); flushErr != nil {
+				return flushErr
+			}
+			time.Sleep(200 * time.Millisecond)
+			continue
+		}
+		if len(partial) > 0 && (err == nil || err == io.EOF) {
+			if writeErr := p.writeLine(w, partial); writeErr != nil {
+				return writeErr
+			}
+			partial = partial[:0]
+		}
+		if err == io.EOF {
+			return w.Flush()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+const (
+	colorReset   = "\x1b[0m"
+	colorKey     = "\x1b[34m"
+	colorString  = "\x1b[32m"
+	colorNumber  = "\x1b[36m"
+	colorLiteral = "\x1b[35m"
+)
+
+type prettyPrinter struct {
+	indent string
+	color  bool
+	buf    bytes.Buffer
+	src    bytes.Reader
+	dec    *goldjson.Decoder
+}
+
+// writeLine writes the line indented, or as is if it isn't valid JSON.
+func (p *prettyPrinter) writeLine(w *bufio.Writer, line []byte) error {
+	line = bytes.TrimRight(line, "\r\n")
+	if len(bytes.TrimSpace(line)) == 0 {
+		return nil
+	}
+	p.buf.Reset()
+	if !p.indentRecord(line) {
+		// not a record, e.g. a list line
+		p.buf.Reset()
+		if err := json.Indent(&p.buf, line, "", p.indent); err != nil {
+			_, err = w.Write(append(line, '\n'))
+			return err
+		}
+	}
+	out := p.buf.Bytes()
+	if p.color {
+		out = colorize(out)
+	}
+	_, err := w.Write(append(out, '\n'))
+	return err
+}
+
+// indentRecord writes the line indented to the buffer, walking the fields of
+// the record in the order they appear in the line, so that the keys keep
+// their order and the numbers their precision. Returns false if the line is
+// not a valid record.
+func (p *prettyPrinter) indentRecord(line []byte) bool {
+	p.src.Reset(line)
+	p.dec.Reset(&p.src)
+	if !p.dec.NextLine() {
+		return false
+	}
+	p.buf.WriteByte('{')
+	first := true
+	for p.dec.NextField() {
+		if !first {
+			p.buf.WriteByte(',')
+		}
+		first = false
+		p.buf.WriteByte('\n')
+		p.buf.WriteString(p.indent)
+		p.buf.Write(p.dec.RawKey())
+		p.buf.WriteString(": ")
+		// the nested records and lists are indented as is, which also
+		// keeps their order and precision
+		if err := json.Indent(&p.buf, p.dec.Raw(), p.indent, p.indent); err != nil {
+			return false
+		}
+	}
+	if p.dec.Err() != nil {
+		return false
+	}
+	if !first {
+		p.buf.WriteByte('\n')
+	}
+	p.buf.WriteByte('}')
+	return true
+}
+
+// colorize adds ANSI color codes to valid JSON.
+func colorize(data []byte) []byte {
+	out := make([]byte, 0, len(data)*2)
+	for i := 0; i < len(data); {
+		switch c := data[i]; {
+		case c == '"':
+			end := i + 1
+			for data[end] != '"' {
+				if data[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end++
+			color := colorString
+			if next := skipSpace(data, end); next < len(data) && data[next] == ':' {
+				color = colorKey
+			}
+			out = appendColored(out, color, data[i:end])
+			i = end
+		case c == '-' || (c >= '0' && c <= '9'):
+			end := i + 1
+			for end < len(data) && bytes.IndexByte([]byte("0123456789.eE+-"), data[end]) != -1 {
+				end++
+			}
+			out = appendColored(out, colorNumber, data[i:end])
+			i = end
+		case c == 't' || c == 'f' || c == 'n':
+			end := i + 1
+			for end < len(data) && data[end] >= 'a' && data[end] <= 'z' {
+				end++
+			}
+			out = appendColored(out, colorLiteral, data[i:end])
+			i = end
+		default:
+			out = append(out, c)
+			i++
+		}
+	}
+	return out
+}
+
+func appendColored(out []byte, color string, token []byte) []byte {
+	out = append(out, color...)
+	out = append(out, token...)
+	return append(out, colorReset...)
+}
+
+func skipSpace(data []byte, i int) int {
+	for i < len(data) && (data[i] == ' ' || data[i] == '\t' || data[i] == '\n' || data[i] == '\r') {
+		i++
+	}
+	return i
+}
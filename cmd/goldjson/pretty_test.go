@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPretty(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			"indent",
+			nil,
+			`{"a":"b","c":[1,true]}` + "\n" + `{}` + "\n",
+			"{\n  \"a\": \"b\",\n  \"c\": [\n    1,\n    true\n  ]\n}\n{}\n",
+		},
+		{
+			"order and precision",
+			nil,
+			`{"z":9007199254740993,"a":{"y":1.50,"b":"\u003c"}}` + "\n" + `[1,2]` + "\n",
+			"{\n  \"z\": 9007199254740993,\n  \"a\": {\n    \"y\": 1.50,\n    \"b\": \"\\u003c\"\n  }\n}\n[\n  1,\n  2\n]\n",
+		},
+		{
+			"not JSON",
+			nil,
+			"not json\n\n" + `{"a":1}`,
+			"not json\n{\n  \"a\": 1\n}\n",
+		},
+		{
+			"color",
+			[]string{"-color", "-indent", ""},
+			`{"a":"b:\"","c":-1.5e3,"d":null}` + "\n",
+			"{\n\x1b[34m\"a\"\x1b[0m: \x1b[32m\"b:\\\"\"\x1b[0m,\n\x1b[34m\"c\"\x1b[0m: \x1b[36m-1.5e3\x1b[0m,\n\x1b[34m\"d\"\x1b[0m: \x1b[35mnull\x1b[0m\n}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received, err := runCommand(t, tt.input, append([]string{"pretty"}, tt.args...)...)
+
+			expectNoError(t, err)
+			expectEqual(t, tt.expected, received)
+		})
+	}
+
+	t.Run("file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "log.ndjson")
+		expectNoError(t, os.WriteFile(path, []byte(`{"a":1}`+"\n"), 0o644))
+
+		received, err := runCommand(t, "", "pretty", "-indent", "", path)
+
+		expectNoError(t, err)
+		expectEqual(t, "{\n\"a\": 1\n}\n", received)
+	})
+
+	t.Run("follow without file", func(t *testing.T) {
+		_, err := runCommand(t, "", "pretty", "-f")
+
+		expectError(t, err)
+	})
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/jussi-kalliokoski/goldjson"
+)
+
+func runRedact(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("redact", flag.ContinueOnError)
+	var keys, patterns listFlag
+	fs.Var(&keys, "key", "redact the values of the `key` at any depth, repeatable")
+	fs.Var(&patterns, "pattern", "redact the matches of the `regexp` in string values, repeatable")
+	replacement := fs.String("replacement", "[REDACTED]", "the `string` to replace the redacted values with")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	r := rewriter{keys: map[string]bool{}, replacement: *replacement}
+	for _, key := range keys {
+		r.keys[key] = true
+	}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return fmt.Errorf("redact: %w", err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	in, err := openInput(fs, stdin)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	w := bufio.NewWriter(stdout)
+	enc := goldjson.NewEncoder(w)
+	n := 0
+	err = forEachLine(in, func(line []byte) error {
+		n++
+		if err := r.rewriteLine(enc, line); err != nil {
+			return fmt.Errorf("redact: line %d: %w", n, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// rewriter redacts and renames the fields of lines.
+type rewriter struct {
+	keys        map[string]bool
+	patterns    []*regexp.Regexp
+	replacement string
+	renames     map[string]string
+}
+
+// rewriteLine writes the line with the redactions and renames applied. The
+// line is re-encoded with the Encoder, preserving the order of the keys.
+// Lines that are not records (lists and scalars) are rewritten likewise.
+func (r *rewriter) rewriteLine(enc *goldjson.Encoder, line []byte) error {
+	if !json.Valid(line) {
+		return errors.New("invalid JSON")
+	}
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	tok, _ := dec.Token()
+	var out *goldjson.LineWriter
+	switch tok {
+	case json.Delim('{'):
+		out = enc.NewLine()
+		r.copyEntries(dec, out, false)
+	case json.Delim('['):
+		out = enc.NewListLine()
+		r.copyEntries(dec, out, true)
+	default:
+		out = enc.NewValueLine()
+		r.addToken(dec, out, "", tok)
+	}
+	return out.End()
+}
+
+// copyEntries copies the entries of the active record/list from dec to out,
+// including the closing delimiter.
+func (r *rewriter) copyEntries(dec *json.Decoder, out *goldjson.LineWriter, isList bool) {
+	for dec.More() {
+		key := ""
+		if !isList {
+			tok, _ := dec.Token()
+			key = tok.(string)
+		}
+		redacted := r.keys[key]
+		if newKey, ok := r.renames[key]; ok && !isList {
+			key = newKey
+		}
+		if redacted {
+			var discard json.RawMessage
+			_ = dec.Decode(&discard)
+			out.AddString(key, r.replacement)
+			continue
+		}
+		r.copyValue(dec, out, key)
+	}
+	_, _ = dec.Token()
+}
+
+func (r *rewriter) copyValue(dec *json.Decoder, out *goldjson.LineWriter, key string) {
+	tok, _ := dec.Token()
+	r.addToken(dec, out, key, tok)
+}
+
+// addToken adds the value starting with the token, which has already been
+// read from dec.
+func (r *rewriter) addToken(dec *json.Decoder, out *goldjson.LineWriter, key string, tok json.Token) {
+	switch v := tok.(type) {
+	case json.Delim:
+		if v == '{' {
+			out.StartRecord(key)
+			r.copyEntries(dec, out, false)
+			out.EndRecord()
+		} else {
+			out.StartList(key)
+			r.copyEntries(dec, out, true)
+			out.EndList()
+		}
+	case string:
+		for _, re := range r.patterns {
+			v = re.ReplaceAllLiteralString(v, r.replacement)
+		}
+		out.AddString(key, v)
+	case json.Number:
+		_ = out.AddRawJSON(key, []byte(v))
+	case bool:
+		out.AddBool(key, v)
+	case nil:
+		_ = out.AddRawJSON(key, nil)
+	}
+}
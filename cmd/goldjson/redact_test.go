@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			"unchanged",
+			nil,
+			`{"z":1.50,"a":[true,null,{"b":"c"}],"d":{}}` + "\n",
+			`{"z":1.50,"a":[true,null,{"b":"c"}],"d":{}}` + "\n",
+		},
+		{
+			"not records",
+			[]string{"-pattern", `\d{4}-\d{4}`, "-key", "password"},
+			`["1111-2222",1.50,{"password":"x"}]` + "\n" + `"card 1234-5678"` + "\n" + `null` + "\n",
+			`["[REDACTED]",1.50,{"password":"[REDACTED]"}]` + "\n" + `"card [REDACTED]"` + "\n" + `null` + "\n",
+		},
+		{
+			"keys",
+			[]string{"-key", "password", "-key", "token"},
+			`{"user":"x","password":"y","auth":{"token":{"id":1}},"list":[{"password":2}]}` + "\n",
+			`{"user":"x","password":"[REDACTED]","auth":{"token":"[REDACTED]"},"list":[{"password":"[REDACTED]"}]}` + "\n",
+		},
+		{
+			"patterns",
+			[]string{"-pattern", `\d{4}-\d{4}`, "-replacement", "***"},
+			`{"msg":"card 1234-5678 declined","cards":["1111-2222"]}` + "\n",
+			`{"msg":"card *** declined","cards":["***"]}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received, err := runCommand(t, tt.input, append([]string{"redact"}, tt.args...)...)
+
+			expectNoError(t, err)
+			expectEqual(t, tt.expected, received)
+		})
+	}
+
+	t.Run("invalid line", func(t *testing.T) {
+		_, err := runCommand(t, `{"a":`, "redact")
+
+		expectError(t, err)
+	})
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jussi-kalliokoski/goldjson"
+)
+
+func runReplay(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	from := fs.String("from", "ndjson", "the `format` of the input: ndjson or json-seq")
+	to := fs.String("to", "ndjson", "the `format` of the output: ndjson or json-seq")
+	var keys, patterns, renames listFlag
+	fs.Var(&keys, "key", "redact the values of the `key` at any depth, repeatable")
+	fs.Var(&patterns, "pattern", "redact the matches of the `regexp` in string values, repeatable")
+	replacement := fs.String("replacement", "[REDACTED]", "the `string` to replace the redacted values with")
+	fs.Var(&renames, "rename", "rename the key at any depth, as `old=new`, repeatable")
+	rate := fs.Float64("rate", 0, "the maximum number of `lines` per second, 0 for no limit")
+	strict := fs.Bool("strict", false, "drop duplicate keys (see goldjson.WithStrict)")
+	escapeSlash := fs.Bool("escape-slash", false, "escape / as \\/ in keys and strings (see goldjson.WithEscapeSlash)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	split, err := splitFunc(*from)
+	if err != nil {
+		return fmt.Errorf("replay: %w", err)
+	}
+	prefix, err := recordPrefix(*to)
+	if err != nil {
+		return fmt.Errorf("replay: %w", err)
+	}
+	r := rewriter{keys: map[string]bool{}, replacement: *replacement, renames: map[string]string{}}
+	for _, key := range keys {
+		r.keys[key] = true
+	}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return fmt.Errorf("replay: %w", err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	for _, rename := range renames {
+		oldKey, newKey, ok := strings.Cut(rename, "=")
+		if !ok {
+			return fmt.Errorf("replay: invalid -rename %q, expected old=new", rename)
+		}
+		r.renames[oldKey] = newKey
+	}
+	var opts []goldjson.Option
+	if *strict {
+		opts = append(opts, goldjson.WithStrict())
+	}
+	if *escapeSlash {
+		opts = append(opts, goldjson.WithEscapeSlash())
+	}
+	in, err := openInput(fs, stdin)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	bw := bufio.NewWriter(stdout)
+	w := &prefixWriter{w: bw, prefix: prefix}
+	enc := goldjson.NewEncoder(w, opts...)
+	limit := newRateLimiter(*rate)
+	s := bufio.NewScanner(in)
+	s.Buffer(nil, 64*1024*1024)
+	s.Split(split)
+	var record bytes.Buffer
+	for n := 1; s.Scan(); n++ {
+		if len(bytes.TrimSpace(s.Bytes())) == 0 {
+			continue
+		}
+		// compacting keeps the records on a single line
+		record.Reset()
+		if err := json.Compact(&record, s.Bytes()); err != nil {
+			return fmt.Errorf("replay: record %d: %w", n, err)
+		}
+		limit.wait()
+		if err := r.rewriteLine(enc, record.Bytes()); err != nil {
+			return fmt.Errorf("replay: record %d: %w", n, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// prefixWriter writes the prefix before every write, i.e. before every line
+// written by the Encoder.
+type prefixWriter struct {
+	w      io.Writer
+	prefix []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	if len(w.prefix) > 0 {
+		if _, err := w.w.Write(w.prefix); err != nil {
+			return 0, err
+		}
+	}
+	return w.w.Write(p)
+}
+
+// rateLimiter spaces calls to wait evenly to at most the given rate per
+// second.
+type rateLimiter struct {
+	interval time.Duration
+	next     time.Time
+}
+
+func newRateLimiter(rate float64) *rateLimiter {
+	if rate <= 0 {
+		return &rateLimiter{}
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / rate)}
+}
+
+func (l *rateLimiter) wait() {
+	if l.interval == 0 {
+		return
+	}
+	now := time.Now()
+	if l.next.After(now) {
+		time.Sleep(l.next.Sub(now))
+		now = l.next
+	}
+	l.next = now.Add(l.interval)
+}
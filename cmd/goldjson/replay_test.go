@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReplay(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{
+			"unchanged",
+			nil,
+			`{"z":1.50,"a":[true,null,{"b":"c"}],"d":{}}` + "\n" + `[1]` + "\n",
+			`{"z":1.50,"a":[true,null,{"b":"c"}],"d":{}}` + "\n" + `[1]` + "\n",
+		},
+		{
+			"redact and rename",
+			[]string{"-key", "password", "-rename", "password=secret", "-rename", "msg=message", "-pattern", `\d+`, "-replacement", "#"},
+			`{"msg":"user 42","password":"x","nested":{"msg":"y"},"list":["msg"]}` + "\n",
+			`{"message":"user #","secret":"#","nested":{"message":"y"},"list":["msg"]}` + "\n",
+		},
+		{
+			"from json-seq to ndjson",
+			[]string{"-from", "json-seq"},
+			"\x1e{\n  \"a\": 1\n}\n\x1e[2]\n",
+			`{"a":1}` + "\n" + `[2]` + "\n",
+		},
+		{
+			"to json-seq",
+			[]string{"-to", "json-seq"},
+			`{"a":1}` + "\n" + `[2]` + "\n",
+			"\x1e" + `{"a":1}` + "\n\x1e" + `[2]` + "\n",
+		},
+		{
+			"encoder options",
+			[]string{"-strict", "-escape-slash"},
+			`{"a":"b/c","a":1}` + "\n",
+			`{"a":"b\/c"}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received, err := runCommand(t, tt.input, append([]string{"replay"}, tt.args...)...)
+
+			expectNoError(t, err)
+			expectEqual(t, tt.expected, received)
+		})
+	}
+
+	t.Run("rate", func(t *testing.T) {
+		start := time.Now()
+
+		_, err := runCommand(t, "{}\n{}\n{}\n", "replay", "-rate", "50")
+		elapsed := time.Since(start)
+
+		expectNoError(t, err)
+		expectEqual(t, true, elapsed >= 40*time.Millisecond)
+	})
+
+	t.Run("invalid rename", func(t *testing.T) {
+		_, err := runCommand(t, "{}\n", "replay", "-rename", "a")
+
+		expectError(t, err)
+	})
+
+	t.Run("invalid record", func(t *testing.T) {
+		_, err := runCommand(t, `{"a":`, "replay")
+
+		expectError(t, err)
+	})
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"sort"
+
+	"github.com/jussi-kalliokoski/goldjson"
+)
+
+func runStats(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	in, err := openInput(fs, stdin)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	s := stats{keys: map[string]*keyStats{}}
+	err = forEachLine(in, func(line []byte) error {
+		s.add(line)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(stdout)
+	if err := s.write(goldjson.NewEncoder(w)); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+type stats struct {
+	sizes   []int
+	invalid int64
+	keys    map[string]*keyStats
+}
+
+type keyStats struct {
+	count int64
+	types map[string]int64
+}
+
+func (s *stats) add(line []byte) {
+	s.sizes = append(s.sizes, len(line))
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		s.invalid++
+		return
+	}
+	if record, ok := v.(map[string]any); ok {
+		s.addRecord("", record)
+	}
+}
+
+// addRecord counts the keys of the record, using dot-separated paths for
+// the keys of nested records.
+func (s *stats) addRecord(prefix string, record map[string]any) {
+	for key, value := range record {
+		path := prefix + key
+		k := s.keys[path]
+		if k == nil {
+			k = &keyStats{types: map[string]int64{}}
+			s.keys[path] = k
+		}
+		k.count++
+		k.types[typeName(value)]++
+		if nested, ok := value.(map[string]any); ok {
+			s.addRecord(path+".", nested)
+		}
+	}
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "list"
+	default:
+		return "record"
+	}
+}
+
+// write writes the stats as a single line, e.g.:
+//
+//	{"lines":2,"invalid":0,"size":{"p50":10,"p90":12,"p99":12,"max":12},"keys":{"a":{"count":2,"types":{"string":2}}}}
+func (s *stats) write(enc *goldjson.Encoder) error {
+	line := enc.NewLine()
+	line.AddInt64("lines", int64(len(s.sizes)))
+	line.AddInt64("invalid", s.invalid)
+	sort.Ints(s.sizes)
+	line.StartRecord("size")
+	line.AddInt64("p50", int64(percentile(s.sizes, 50)))
+	line.AddInt64("p90", int64(percentile(s.sizes, 90)))
+	line.AddInt64("p99", int64(percentile(s.sizes, 99)))
+	line.AddInt64("max", int64(percentile(s.sizes, 100)))
+	line.EndRecord()
+	line.StartRecord("keys")
+	for _, path := range sortedKeys(s.keys) {
+		k := s.keys[path]
+		line.StartRecord(path)
+		line.AddInt64("count", k.count)
+		line.StartRecord("types")
+		for _, t := range sortedKeys(k.types) {
+			line.AddInt64(t, k.types[t])
+		}
+		line.EndRecord()
+		line.EndRecord()
+	}
+	line.EndRecord()
+	return line.End()
+}
+
+// percentile returns the nearest-rank percentile of the sorted values.
+func percentile(sorted []int, p int) int {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
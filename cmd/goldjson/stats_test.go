@@ -0,0 +1,16 @@
+package main
+
+import "testing"
+
+func TestStats(t *testing.T) {
+	input := `{"a":"x","b":{"c":1}}` + "\n" +
+		`{"a":null,"b":[1]}` + "\n" +
+		`{"a":"yy"}` + "\n" +
+		`{` + "\n"
+	expected := `{"lines":4,"invalid":1,"size":{"p50":10,"p90":21,"p99":21,"max":21},"keys":{"a":{"count":3,"types":{"null":1,"string":2}},"b":{"count":2,"types":{"list":1,"record":1}},"b.c":{"count":1,"types":{"number":1}}}}` + "\n"
+
+	received, err := runCommand(t, input, "stats")
+
+	expectNoError(t, err)
+	expectEqual(t, expected, received)
+}
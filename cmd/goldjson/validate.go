@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+func runValidate(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	records := fs.Bool("records", true, "require every line to be a JSON record (object)")
+	duplicates := fs.Bool("duplicates", true, "reject records with duplicate keys")
+	ascii := fs.Bool("ascii", false, "require non-ASCII characters to be escaped")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	in, err := openInput(fs, stdin)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	w := bufio.NewWriter(stdout)
+	n, invalid := 0, 0
+	err = forEachLine(in, func(line []byte) error {
+		n++
+		if err := validateLine(line, *records, *duplicates, *ascii); err != nil {
+			invalid++
+			fmt.Fprintf(w, "line %d: %v\n", n, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if invalid > 0 {
+		return fmt.Errorf("validate: %d of %d lines are invalid", invalid, n)
+	}
+	return nil
+}
+
+func validateLine(line []byte, records, duplicates, ascii bool) error {
+	if !json.Valid(line) {
+		var v any
+		return json.Unmarshal(line, &v)
+	}
+	if records && line[0] != '{' {
+		return errors.New("not a record")
+	}
+	if ascii {
+		for i, b := range line {
+			if b >= utf8.RuneSelf {
+				return fmt.Errorf("unescaped non-ASCII character at offset %d", i)
+			}
+		}
+	}
+	if duplicates {
+		dec := json.NewDecoder(bytes.NewReader(line))
+		if err := checkDuplicates(dec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkDuplicates walks the next value of the valid JSON read by dec,
+// returning an error for the first record with duplicate keys.
+func checkDuplicates(dec *json.Decoder) error {
+	tok, _ := dec.Token()
+	switch tok {
+	case json.Delim('{'):
+		keys := map[string]struct{}{}
+		for dec.More() {
+			tok, _ := dec.Token()
+			key := tok.(string)
+			if _, ok := keys[key]; ok {
+				return fmt.Errorf("duplicate key %q", key)
+			}
+			keys[key] = struct{}{}
+			if err := checkDuplicates(dec); err != nil {
+				return err
+			}
+		}
+		_, _ = dec.Token()
+	case json.Delim('['):
+		for dec.More() {
+			if err := checkDuplicates(dec); err != nil {
+				return err
+			}
+		}
+		_, _ = dec.Token()
+	}
+	return nil
+}
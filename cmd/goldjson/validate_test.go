@@ -0,0 +1,65 @@
+package main
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+		valid    bool
+	}{
+		{
+			"valid",
+			nil,
+			`{"a":{"b":1},"c":[{"b":2},{"b":3}]}` + "\n" + `{"a":"ä"}` + "\n",
+			"",
+			true,
+		},
+		{
+			"malformed",
+			nil,
+			`{"a":1}` + "\n" + `{"a":` + "\n",
+			"line 2: unexpected end of JSON input\n",
+			false,
+		},
+		{
+			"not a record",
+			nil,
+			`[1]` + "\n",
+			"line 1: not a record\n",
+			false,
+		},
+		{
+			"not a record allowed",
+			[]string{"-records=false"},
+			`[1]` + "\n",
+			"",
+			true,
+		},
+		{
+			"duplicate keys",
+			nil,
+			`{"a":[{"b":1,"b":2}]}` + "\n",
+			"line 1: duplicate key \"b\"\n",
+			false,
+		},
+		{
+			"ascii",
+			[]string{"-ascii"},
+			`{"a":"\u00e4"}` + "\n" + `{"a":"ä"}` + "\n",
+			"line 2: unescaped non-ASCII character at offset 6\n",
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received, err := runCommand(t, tt.input, append([]string{"validate"}, tt.args...)...)
+
+			expectEqual(t, tt.valid, err == nil)
+			expectEqual(t, tt.expected, received)
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package goldjson
+
+import "github.com/jussi-kalliokoski/goldjson/tokens"
+
+// ComplexFormat determines how complex values are encoded.
+type ComplexFormat int
+
+const (
+	// ComplexFormatRecord encodes complex values as records with the real
+	// and imaginary parts as numbers, e.g. {"re":1.5,"im":-2}.
+	ComplexFormatRecord ComplexFormat = iota
+	// ComplexFormatString encodes complex values as strings in the form
+	// "a+bi", e.g. "1.5-2i".
+	ComplexFormatString
+)
+
+// WithComplexFormat sets the format for encoding complex values. The default
+// is ComplexFormatRecord.
+func WithComplexFormat(format ComplexFormat) Option {
+	return func(o *options) {
+		o.complexFormat = format
+	}
+}
+
+// AddComplex128 adds a key-value pair with a complex128 value to the active
+// record/list, encoded according to the ComplexFormat of the Encoder (see
+// WithComplexFormat).
+//
+// If a list is currently active, the key will be ignored.
+func (l *LineWriter) AddComplex128(key string, value complex128) {
+	if l.checkKey(key) != nil {
+		return
+	}
+	orig, wasEmpty := l.buf, l.composer.Empty()
+	l.appendKey(key)
+	if l.encoder.opts.complexFormat == ComplexFormatString {
+		l.buf = tokens.AppendComplex128(l.buf, value)
+		return
+	}
+	var err error
+	valueStart := len(l.buf)
+	l.buf = append(l.buf, `{"re":`...)
+	if l.buf, err = l.encoder.appendFloat64(l.buf, real(value)); err == nil {
+		l.buf = append(l.buf, `,"im":`...)
+		l.buf, err = l.encoder.appendFloat64(l.buf, imag(value))
+	}
+	if err != nil {
+		l.buf = l.buf[:valueStart]
+		l.failValue(orig, wasEmpty, "float rejected", err)
+		return
+	}
+	l.buf = append(l.buf, '}')
+}
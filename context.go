@@ -0,0 +1,104 @@
+package goldjson
+
+import "context"
+
+// Scope is an Encoder bound to a set of fields that are added to every line
+// created through it.
+//
+// Scopes are immutable, and thus safe to share between goroutines, which
+// makes them suitable for carrying request-scoped fields in a
+// context.Context (see ContextWithScope and FromContext).
+//
+// A nil Scope, as returned by FromContext for a context without a Scope, is
+// valid: it has no Encoder, so the lines created through it (or through the
+// Scopes derived from it with With) are discarded on End.
+type Scope struct {
+	encoder *Encoder
+	fields  StaticFields
+}
+
+// NewScope returns a new Scope without any fields, creating lines using the
+// given Encoder.
+func NewScope(encoder *Encoder) *Scope {
+	return &Scope{encoder: encoder}
+}
+
+// With returns a new Scope that adds the given fields to every line in
+// addition to the fields of the receiver.
+//
+// The fields are merged once here, so adding them to a line costs a single
+// copy regardless of how many times With has been called.
+func (s *Scope) With(fields *StaticFields) *Scope {
+	if s == nil {
+		return &Scope{fields: *fields}
+	}
+	if len(fields.buf) == 0 {
+		return s
+	}
+	if len(s.fields.buf) == 0 {
+		return &Scope{encoder: s.encoder, fields: *fields}
+	}
+	buf := make([]byte, 0, len(s.fields.buf)+1+len(fields.buf))
+	buf = append(buf, s.fields.buf...)
+	buf = append(buf, ',')
+	buf = append(buf, fields.buf...)
+	var keys []string
+	if len(s.fields.keys) > 0 || len(fields.keys) > 0 {
+		keys = make([]string, 0, len(s.fields.keys)+len(fields.keys))
+		keys = append(keys, s.fields.keys...)
+		keys = append(keys, fields.keys...)
+	}
+	return &Scope{encoder: s.encoder, fields: StaticFields{buf: buf, keys: keys}}
+}
+
+// NewLine creates a new line to be written to the writer of the Encoder of
+// the Scope, with the fields of the Scope already added. If the Scope has no
+// Encoder, the line is a no-op line that is discarded on End.
+func (s *Scope) NewLine() *LineWriter {
+	if s == nil || s.encoder == nil {
+		return discardEncoder.newSuppressedLine()
+	}
+	l := s.encoder.NewLine()
+	l.AddStaticFields(&s.fields)
+	return l
+}
+
+// WithContextHook adds a hook that is called with the context of every line
+// created with NewLineContext, e.g. for adding trace IDs or request-scoped
+// fields carried in the context. The hooks are called in the order they were
+// added, before any fields are added by the caller.
+func WithContextHook(hook func(ctx context.Context, l *LineWriter)) Option {
+	return func(o *options) {
+		o.contextHooks = append(o.contextHooks, hook)
+	}
+}
+
+// NewLineContext creates a new line to be written to the writer, like
+// NewLine, and calls the context hooks of the Encoder with ctx and the line
+// (see WithContextHook).
+func (e *Encoder) NewLineContext(ctx context.Context) *LineWriter {
+	l := e.NewLine()
+	for _, hook := range e.opts.contextHooks {
+		hook(ctx, l)
+	}
+	return l
+}
+
+type scopeContextKey struct{}
+
+// ContextWithScope returns a copy of ctx carrying the given Scope.
+//
+// To accumulate fields during the lifetime of a request, extend the Scope
+// carried in the context:
+//
+//	ctx = goldjson.ContextWithScope(ctx, goldjson.FromContext(ctx).With(fields))
+func ContextWithScope(ctx context.Context, scope *Scope) context.Context {
+	return context.WithValue(ctx, scopeContextKey{}, scope)
+}
+
+// FromContext returns the Scope carried by ctx, or nil if ctx doesn't carry a
+// Scope. The nil Scope can still be used, see Scope.
+func FromContext(ctx context.Context) *Scope {
+	s, _ := ctx.Value(scopeContextKey{}).(*Scope)
+	return s
+}
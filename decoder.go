@@ -0,0 +1,693 @@
+package goldjson
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// ValueType is the JSON type of a field value read by a Decoder.
+type ValueType int
+
+const (
+	// ValueString is the type of string values.
+	ValueString ValueType = iota + 1
+	// ValueNumber is the type of number values.
+	ValueNumber
+	// ValueBool is the type of true and false.
+	ValueBool
+	// ValueNull is the type of null.
+	ValueNull
+	// ValueRecord is the type of record (object) values.
+	ValueRecord
+	// ValueList is the type of list (array) values.
+	ValueList
+)
+
+// String returns the name of the ValueType.
+func (t ValueType) String() string {
+	switch t {
+	case ValueString:
+		return "string"
+	case ValueNumber:
+		return "number"
+	case ValueBool:
+		return "bool"
+	case ValueNull:
+		return "null"
+	case ValueRecord:
+		return "record"
+	case ValueList:
+		return "list"
+	default:
+		return "ValueType(" + strconv.Itoa(int(t)) + ")"
+	}
+}
+
+// ErrSyntax is matched by the errors returned for malformed lines. See
+// SyntaxError.
+var ErrSyntax = errors.New("goldjson: invalid JSON")
+
+// SyntaxError describes a malformed line read by a Decoder.
+type SyntaxError struct {
+	// Line is the 1-based number of the line in the input.
+	Line int
+	// Offset is the offset of the error in the line in bytes.
+	Offset int
+	Reason string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s on line %d at offset %d: %s", ErrSyntax, e.Line, e.Offset, e.Reason)
+}
+
+// Unwrap returns ErrSyntax.
+func (e *SyntaxError) Unwrap() error {
+	return ErrSyntax
+}
+
+// ErrValueType is returned by the typed getters of a Decoder when the value
+// of the current field can't be read as the requested type.
+var ErrValueType = errors.New("goldjson: unexpected value type")
+
+// maxDecoderDepth is the maximum nesting depth of the values read by a
+// Decoder.
+const maxDecoderDepth = 1000
+
+// Decoder reads line-delimited JSON records, e.g. as written by an Encoder,
+// with a pull-style API that doesn't allocate per line:
+//
+//	dec := goldjson.NewDecoder(r)
+//	for dec.NextLine() {
+//		for dec.NextField() {
+//			switch string(dec.Key()) {
+//			case "level":
+//				level, err := dec.Int64()
+//				...
+//			}
+//		}
+//	}
+//	if err := dec.Err(); err != nil {
+//		...
+//	}
+//
+// Only the top-level fields of the records are iterated; the raw JSON of
+// nested records and lists is available with Raw. Empty lines are skipped.
+// The lines are validated only as far as they are read, so the fields left
+// unread when moving on to the next line are not checked.
+//
+// The slices returned by the Decoder are only valid until the next call to
+// NextLine or NextField.
+type Decoder struct {
+	r      *bufio.Reader
+	buf    []byte
+	line   []byte
+	lineNo int
+	pos    int
+	first  bool
+	done   bool
+	key    []byte
+	value  []byte
+	typ    ValueType
+	keyBuf []byte
+	strBuf []byte
+	err    error
+}
+
+// NewDecoder returns a Decoder reading from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r), done: true}
+}
+
+// Reset discards the state of the Decoder, including the error, and makes
+// it read from r, reusing the buffers of the Decoder.
+func (d *Decoder) Reset(r io.Reader) {
+	d.r.Reset(r)
+	*d = Decoder{r: d.r, buf: d.buf[:0], keyBuf: d.keyBuf[:0], strBuf: d.strBuf[:0], done: true}
+}
+
+// NextLine advances to the next line, returning false at the end of the
+// input or on error, see Err.
+func (d *Decoder) NextLine() bool {
+	if d.err != nil {
+		return false
+	}
+	d.key, d.value, d.typ, d.done = nil, nil, 0, true
+	for {
+		line, err := d.readLine()
+		if err != nil {
+			if err != io.EOF {
+				d.err = err
+			}
+			d.line = nil
+			return false
+		}
+		d.lineNo++
+		if !d.setLine(line) {
+			continue
+		}
+		return d.err == nil
+	}
+}
+
+// setLine makes line the current line, returning false if it's empty.
+func (d *Decoder) setLine(line []byte) bool {
+	d.line = line
+	pos := skipSpace(line, 0)
+	if pos == len(line) {
+		return false
+	}
+	if line[pos] != '{' {
+		d.fail(pos, "line is not a record")
+		return true
+	}
+	d.pos, d.first, d.done = pos+1, true, false
+	return true
+}
+
+func (d *Decoder) readLine() ([]byte, error) {
+	d.buf = d.buf[:0]
+	for {
+		chunk, err := d.r.ReadSlice('\n')
+		d.buf = append(d.buf, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF && len(d.buf) > 0 {
+			err = nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line := d.buf
+		if n := len(line); n > 0 && line[n-1] == '\n' {
+			line = line[:n-1]
+		}
+		return line, nil
+	}
+}
+
+// Line returns the raw current line without the trailing newline.
+func (d *Decoder) Line() []byte {
+	return d.line
+}
+
+// NextField advances to the next top-level field of the current line,
+// returning false after the last field or on error, see Err.
+func (d *Decoder) NextField() bool {
+	if d.err != nil || d.done {
+		return false
+	}
+	line := d.line
+	pos := skipSpace(line, d.pos)
+	if pos < len(line) && line[pos] == '}' {
+		if end := skipSpace(line, pos+1); end != len(line) {
+			d.fail(end, "unexpected content after the record")
+			return false
+		}
+		d.key, d.value, d.typ, d.done = nil, nil, 0, true
+		return false
+	}
+	if !d.first {
+		if pos == len(line) || line[pos] != ',' {
+			d.fail(pos, "expected a comma or the end of the record")
+			return false
+		}
+		pos = skipSpace(line, pos+1)
+	}
+	d.first = false
+	if pos == len(line) || line[pos] != '"' {
+		d.fail(pos, "expected a key")
+		return false
+	}
+	end, err := scanString(line, pos)
+	if err != nil {
+		d.fail(end, err.Error())
+		return false
+	}
+	d.key = line[pos:end]
+	pos = skipSpace(line, end)
+	if pos == len(line) || line[pos] != ':' {
+		d.fail(pos, "expected a colon")
+		return false
+	}
+	pos = skipSpace(line, pos+1)
+	end, typ, err := scanValue(line, pos, 0)
+	if err != nil {
+		d.fail(end, err.Error())
+		return false
+	}
+	d.value, d.typ, d.pos = line[pos:end], typ, end
+	return true
+}
+
+// Rewind moves back to the start of the current line, so that the next call
+// to NextField returns the first field of the line again.
+func (d *Decoder) Rewind() {
+	if d.err != nil || d.line == nil {
+		return
+	}
+	d.key, d.value, d.typ = nil, nil, 0
+	d.setLine(d.line)
+}
+
+// Lookup advances to the top-level field of the current line with the given
+// key, searching from the start of the line (see Rewind), and returning
+// false if the line has no such field or on error, see Err. The fields
+// before the field are skipped, and the next call to NextField continues
+// after it.
+func (d *Decoder) Lookup(key string) bool {
+	d.Rewind()
+	for d.NextField() {
+		if string(d.Key()) == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Decoder) fail(offset int, reason string) {
+	d.err = &SyntaxError{Line: d.lineNo, Offset: offset, Reason: reason}
+	d.done = true
+}
+
+// Err returns the first error encountered by the Decoder, or nil if the
+// input was read successfully to the end.
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+// Key returns the unescaped key of the current field.
+func (d *Decoder) Key() []byte {
+	if d.key == nil {
+		return nil
+	}
+	var ok bool
+	d.keyBuf, ok = appendUnescaped(d.keyBuf[:0], d.key)
+	if !ok {
+		return d.key[1 : len(d.key)-1]
+	}
+	return d.keyBuf
+}
+
+// RawKey returns the raw JSON of the key of the current field, i.e. the key
+// quoted and escaped as it appears in the line.
+func (d *Decoder) RawKey() []byte {
+	return d.key
+}
+
+// Type returns the type of the value of the current field.
+func (d *Decoder) Type() ValueType {
+	return d.typ
+}
+
+// Raw returns the raw JSON of the value of the current field.
+func (d *Decoder) Raw() []byte {
+	return d.value
+}
+
+// Bytes returns the unescaped value of the current field if it's a string.
+func (d *Decoder) Bytes() ([]byte, error) {
+	if d.typ != ValueString {
+		return nil, d.typeError(ValueString)
+	}
+	var ok bool
+	d.strBuf, ok = appendUnescaped(d.strBuf[:0], d.value)
+	if !ok {
+		return d.value[1 : len(d.value)-1], nil
+	}
+	return d.strBuf, nil
+}
+
+// String returns the value of the current field if it's a string.
+func (d *Decoder) String() (string, error) {
+	b, err := d.Bytes()
+	return string(b), err
+}
+
+// Int64 returns the value of the current field if it's an integer that fits
+// in an int64. Integers encoded as strings, e.g. with WithSafeIntegers, are
+// accepted as well.
+func (d *Decoder) Int64() (int64, error) {
+	digits := d.number()
+	negative := len(digits) > 0 && digits[0] == '-'
+	if negative {
+		digits = digits[1:]
+	}
+	u, ok := parseDigits(digits)
+	if !ok || (!negative && u > math.MaxInt64) || (negative && u > -math.MinInt64) {
+		return 0, d.typeError(ValueNumber)
+	}
+	if negative {
+		return -int64(u), nil
+	}
+	return int64(u), nil
+}
+
+// Uint64 returns the value of the current field if it's a non-negative
+// integer that fits in a uint64. Integers encoded as strings, e.g. with
+// WithSafeIntegers, are accepted as well.
+func (d *Decoder) Uint64() (uint64, error) {
+	u, ok := parseDigits(d.number())
+	if !ok {
+		return 0, d.typeError(ValueNumber)
+	}
+	return u, nil
+}
+
+// Float64 returns the value of the current field if it's a number. Numbers
+// encoded as strings are accepted as well.
+func (d *Decoder) Float64() (float64, error) {
+	digits := d.number()
+	if len(digits) == 0 {
+		return 0, d.typeError(ValueNumber)
+	}
+	f, err := strconv.ParseFloat(unsafe.String(unsafe.SliceData(digits), len(digits)), 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return 0, d.typeError(ValueNumber)
+	}
+	return f, nil
+}
+
+// Bool returns the value of the current field if it's true or false.
+func (d *Decoder) Bool() (bool, error) {
+	if d.typ != ValueBool {
+		return false, d.typeError(ValueBool)
+	}
+	return d.value[0] == 't', nil
+}
+
+// Time returns the value of the current field if it's a time as encoded by
+// AddTime: either an RFC 3339 string or the number of seconds since the Unix
+// epoch, see TimePolicyUnix.
+func (d *Decoder) Time() (time.Time, error) {
+	switch d.typ {
+	case ValueString:
+		s := d.value[1 : len(d.value)-1]
+		t, err := time.Parse(time.RFC3339Nano, unsafe.String(unsafe.SliceData(s), len(s)))
+		if err != nil {
+			return time.Time{}, d.typeError(ValueString)
+		}
+		return t, nil
+	case ValueNumber:
+		f, err := d.Float64()
+		if err != nil {
+			return time.Time{}, err
+		}
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(frac*1e9)), nil
+	default:
+		return time.Time{}, d.typeError(ValueString)
+	}
+}
+
+// number returns the digits of a number value or a string containing a
+// number, or nil for other values.
+func (d *Decoder) number() []byte {
+	switch d.typ {
+	case ValueNumber:
+		return d.value
+	case ValueString:
+		s := d.value[1 : len(d.value)-1]
+		if len(s) == 0 || (s[0] != '-' && !isDigit(s[0])) {
+			return nil
+		}
+		if end, err := scanNumber(s, 0); err == nil && end == len(s) {
+			return s
+		}
+	}
+	return nil
+}
+
+func (d *Decoder) typeError(want ValueType) error {
+	return fmt.Errorf("%w: field %q is a %s, expected a %s", ErrValueType, d.Key(), d.typ, want)
+}
+
+func parseDigits(digits []byte) (uint64, bool) {
+	if len(digits) == 0 {
+		return 0, false
+	}
+	var u uint64
+	for _, c := range digits {
+		if !isDigit(c) {
+			return 0, false
+		}
+		if u > math.MaxUint64/10 {
+			return 0, false
+		}
+		u *= 10
+		if u+uint64(c-'0') < u {
+			return 0, false
+		}
+		u += uint64(c - '0')
+	}
+	return u, true
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func skipSpace(line []byte, pos int) int {
+	for pos < len(line) {
+		switch line[pos] {
+		case ' ', '\t', '\r', '\n':
+			pos++
+		default:
+			return pos
+		}
+	}
+	return pos
+}
+
+// scanValue returns the end of the JSON value starting at pos, and its type.
+func scanValue(line []byte, pos, depth int) (int, ValueType, error) {
+	if pos == len(line) {
+		return pos, 0, errors.New("expected a value")
+	}
+	switch c := line[pos]; {
+	case c == '"':
+		end, err := scanString(line, pos)
+		return end, ValueString, err
+	case c == '{' || c == '[':
+		return scanContainer(line, pos, depth)
+	case c == '-' || isDigit(c):
+		end, err := scanNumber(line, pos)
+		return end, ValueNumber, err
+	case c == 't':
+		return scanLiteral(line, pos, "true", ValueBool)
+	case c == 'f':
+		return scanLiteral(line, pos, "false", ValueBool)
+	case c == 'n':
+		return scanLiteral(line, pos, "null", ValueNull)
+	default:
+		return pos, 0, errors.New("expected a value")
+	}
+}
+
+func scanLiteral(line []byte, pos int, literal string, typ ValueType) (int, ValueType, error) {
+	end := pos + len(literal)
+	if end > len(line) || string(line[pos:end]) != literal {
+		return pos, 0, errors.New("expected a value")
+	}
+	return end, typ, nil
+}
+
+func scanContainer(line []byte, pos, depth int) (int, ValueType, error) {
+	if depth == maxDecoderDepth {
+		return pos, 0, errors.New("nested too deep")
+	}
+	typ, closing := ValueRecord, byte('}')
+	if line[pos] == '[' {
+		typ, closing = ValueList, ']'
+	}
+	pos = skipSpace(line, pos+1)
+	if pos < len(line) && line[pos] == closing {
+		return pos + 1, typ, nil
+	}
+	for {
+		if typ == ValueRecord {
+			if pos == len(line) || line[pos] != '"' {
+				return pos, 0, errors.New("expected a key")
+			}
+			end, err := scanString(line, pos)
+			if err != nil {
+				return end, 0, err
+			}
+			pos = skipSpace(line, end)
+			if pos == len(line) || line[pos] != ':' {
+				return pos, 0, errors.New("expected a colon")
+			}
+			pos = skipSpace(line, pos+1)
+		}
+		end, _, err := scanValue(line, pos, depth+1)
+		if err != nil {
+			return end, 0, err
+		}
+		pos = skipSpace(line, end)
+		if pos == len(line) {
+			return pos, 0, errors.New("unexpected end of line")
+		}
+		switch line[pos] {
+		case ',':
+			pos = skipSpace(line, pos+1)
+		case closing:
+			return pos + 1, typ, nil
+		default:
+			return pos, 0, errors.New("expected a comma or the end of the " + typ.String())
+		}
+	}
+}
+
+func scanString(line []byte, pos int) (int, error) {
+	for i := pos + 1; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '"':
+			return i + 1, nil
+		case c == '\\':
+			i++
+			if i == len(line) {
+				return i, errors.New("unterminated string")
+			}
+			switch line[i] {
+			case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+			case 'u':
+				if i+4 >= len(line) || !isHex(line[i+1:i+5]) {
+					return i, errors.New("invalid escape sequence")
+				}
+				i += 4
+			default:
+				return i, errors.New("invalid escape sequence")
+			}
+		case c < 0x20:
+			return i, errors.New("control character in string")
+		}
+	}
+	return len(line), errors.New("unterminated string")
+}
+
+func scanNumber(line []byte, pos int) (int, error) {
+	i := pos
+	if line[i] == '-' {
+		i++
+	}
+	switch {
+	case i < len(line) && line[i] == '0':
+		i++
+	case i < len(line) && isDigit(line[i]):
+		i = skipDigits(line, i)
+	default:
+		return i, errors.New("invalid number")
+	}
+	if i < len(line) && line[i] == '.' {
+		end := skipDigits(line, i+1)
+		if end == i+1 {
+			return end, errors.New("invalid number")
+		}
+		i = end
+	}
+	if i < len(line) && (line[i] == 'e' || line[i] == 'E') {
+		i++
+		if i < len(line) && (line[i] == '+' || line[i] == '-') {
+			i++
+		}
+		end := skipDigits(line, i)
+		if end == i {
+			return end, errors.New("invalid number")
+		}
+		i = end
+	}
+	return i, nil
+}
+
+func skipDigits(line []byte, pos int) int {
+	for pos < len(line) && isDigit(line[pos]) {
+		pos++
+	}
+	return pos
+}
+
+func isHex(b []byte) bool {
+	for _, c := range b {
+		if !isDigit(c) && (c|0x20 < 'a' || c|0x20 > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// appendUnescaped appends the contents of the quoted, valid JSON string s to
+// buf. Returns false without appending if s contains no escape sequences.
+func appendUnescaped(buf, s []byte) ([]byte, bool) {
+	s = s[1 : len(s)-1]
+	i := 0
+	for i < len(s) && s[i] != '\\' {
+		i++
+	}
+	if i == len(s) {
+		return buf, false
+	}
+	buf = append(buf, s[:i]...)
+	for i < len(s) {
+		c := s[i]
+		if c != '\\' {
+			buf = append(buf, c)
+			i++
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'b':
+			buf = append(buf, '\b')
+		case 'f':
+			buf = append(buf, '\f')
+		case 'n':
+			buf = append(buf, '\n')
+		case 'r':
+			buf = append(buf, '\r')
+		case 't':
+			buf = append(buf, '\t')
+		case 'u':
+			r := parseHex(s[i+1 : i+5])
+			i += 4
+			if utf16.IsSurrogate(r) {
+				r2 := utf8.RuneError
+				if i+6 < len(s) && s[i+1] == '\\' && s[i+2] == 'u' {
+					r2 = parseHex(s[i+3 : i+7])
+				}
+				if combined := utf16.DecodeRune(r, r2); combined != utf8.RuneError {
+					r = combined
+					i += 6
+				} else {
+					r = utf8.RuneError
+				}
+			}
+			buf = utf8.AppendRune(buf, r)
+		default:
+			buf = append(buf, s[i])
+		}
+		i++
+	}
+	return buf, true
+}
+
+func parseHex(b []byte) rune {
+	var r rune
+	for _, c := range b {
+		switch {
+		case isDigit(c):
+			c -= '0'
+		default:
+			c = c | 0x20 - 'a' + 10
+		}
+		r = r<<4 | rune(c)
+	}
+	return r
+}
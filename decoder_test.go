@@ -0,0 +1,359 @@
+package goldjson_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/jussi-kalliokoski/goldjson"
+)
+
+func TestDecoder(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf)
+		line := enc.NewLine()
+		line.AddString("message", "hello \"world\"\n☃")
+		line.AddInt64("int", math.MinInt64)
+		line.AddUint64("uint", math.MaxUint64)
+		line.AddFloat64("float", 1.5)
+		line.AddBool("bool", true)
+		_ = line.AddTime("time", baseTime)
+		line.StartRecord("record")
+		line.AddInt64("nested", 1)
+		line.EndRecord()
+		line.StartList("list")
+		line.AddString("", "a")
+		line.EndList()
+		expectNoError(t, line.End())
+		line = enc.NewLine()
+		line.AddString("second", "line")
+		expectNoError(t, line.End())
+
+		dec := goldjson.NewDecoder(&buf)
+		expectEqual(t, true, dec.NextLine())
+		fields := []struct {
+			key string
+			typ goldjson.ValueType
+			raw string
+		}{
+			{"message", goldjson.ValueString, `"hello \"world\"\n☃"`},
+			{"int", goldjson.ValueNumber, `-9223372036854775808`},
+			{"uint", goldjson.ValueNumber, `18446744073709551615`},
+			{"float", goldjson.ValueNumber, `1.5`},
+			{"bool", goldjson.ValueBool, `true`},
+			{"time", goldjson.ValueString, `"2023-06-12T20:42:15.152952812Z"`},
+			{"record", goldjson.ValueRecord, `{"nested":1}`},
+			{"list", goldjson.ValueList, `["a"]`},
+		}
+		for _, f := range fields {
+			expectEqual(t, true, dec.NextField())
+			expectEqual(t, f.key, string(dec.Key()))
+			expectEqual(t, f.typ, dec.Type())
+			expectEqual(t, f.raw, string(dec.Raw()))
+			switch f.key {
+			case "message":
+				s, err := dec.String()
+				expectNoError(t, err)
+				expectEqual(t, "hello \"world\"\n☃", s)
+			case "int":
+				i, err := dec.Int64()
+				expectNoError(t, err)
+				expectEqual(t, int64(math.MinInt64), i)
+			case "uint":
+				u, err := dec.Uint64()
+				expectNoError(t, err)
+				expectEqual(t, uint64(math.MaxUint64), u)
+			case "float":
+				f, err := dec.Float64()
+				expectNoError(t, err)
+				expectEqual(t, 1.5, f)
+			case "bool":
+				b, err := dec.Bool()
+				expectNoError(t, err)
+				expectEqual(t, true, b)
+			case "time":
+				tm, err := dec.Time()
+				expectNoError(t, err)
+				expectEqual(t, true, baseTime.Equal(tm))
+			}
+		}
+		expectEqual(t, false, dec.NextField())
+		expectEqual(t, true, dec.NextLine())
+		expectEqual(t, `{"second":"line"}`, string(dec.Line()))
+		expectEqual(t, true, dec.NextField())
+		expectEqual(t, "second", string(dec.Key()))
+		expectEqual(t, false, dec.NextField())
+		expectEqual(t, false, dec.NextLine())
+		expectNoError(t, dec.Err())
+	})
+
+	t.Run("skips unread fields and empty lines", func(t *testing.T) {
+		input := "{\"a\":1,\"b\":2}\n\n  \r\n{ }\r\n{\"c\" : [1, {\"d\": null}] }"
+		dec := goldjson.NewDecoder(strings.NewReader(input))
+		var keys []string
+		for dec.NextLine() {
+			if dec.NextField() {
+				keys = append(keys, string(dec.Key()))
+			}
+		}
+		expectNoError(t, dec.Err())
+		expectEqual(t, "a,c", strings.Join(keys, ","))
+	})
+
+	t.Run("long lines", func(t *testing.T) {
+		long := strings.Repeat("x", 10000)
+		input := `{"long":"` + long + `"}` + "\n" + `{"short":1}` + "\n"
+		dec := goldjson.NewDecoder(iotest.OneByteReader(strings.NewReader(input)))
+		expectEqual(t, true, dec.NextLine())
+		expectEqual(t, true, dec.NextField())
+		s, err := dec.String()
+		expectNoError(t, err)
+		expectEqual(t, long, s)
+		expectEqual(t, true, dec.NextLine())
+		expectEqual(t, true, dec.NextField())
+		expectEqual(t, "short", string(dec.Key()))
+	})
+
+	t.Run("escapes", func(t *testing.T) {
+		input := `{"kéy":"😀 \ud83d \/\\\b\f\r\t"}`
+		dec := goldjson.NewDecoder(strings.NewReader(input))
+		expectEqual(t, true, dec.NextLine())
+		expectEqual(t, true, dec.NextField())
+		expectEqual(t, "kéy", string(dec.Key()))
+		b, err := dec.Bytes()
+		expectNoError(t, err)
+		expectEqual(t, "\U0001F600 � /\\\b\f\r\t", string(b))
+	})
+
+	t.Run("numbers", func(t *testing.T) {
+		input := `{"a":"-12","b":"18446744073709551616","c":1e3,"d":-0.5e-1,"e":1686602535.5}`
+		dec := goldjson.NewDecoder(strings.NewReader(input))
+		expectEqual(t, true, dec.NextLine())
+
+		expectEqual(t, true, dec.NextField())
+		i, err := dec.Int64()
+		expectNoError(t, err)
+		expectEqual(t, int64(-12), i)
+		_, err = dec.Uint64()
+		expectEqual(t, true, errors.Is(err, goldjson.ErrValueType))
+
+		expectEqual(t, true, dec.NextField())
+		_, err = dec.Uint64()
+		expectEqual(t, true, errors.Is(err, goldjson.ErrValueType))
+		f, err := dec.Float64()
+		expectNoError(t, err)
+		expectEqual(t, 18446744073709551616.0, f)
+
+		expectEqual(t, true, dec.NextField())
+		_, err = dec.Int64()
+		expectEqual(t, true, errors.Is(err, goldjson.ErrValueType))
+		f, err = dec.Float64()
+		expectNoError(t, err)
+		expectEqual(t, 1000.0, f)
+
+		expectEqual(t, true, dec.NextField())
+		f, err = dec.Float64()
+		expectNoError(t, err)
+		expectEqual(t, -0.05, f)
+
+		expectEqual(t, true, dec.NextField())
+		tm, err := dec.Time()
+		expectNoError(t, err)
+		expectEqual(t, time.Unix(1686602535, 5e8).UnixNano(), tm.UnixNano())
+	})
+
+	t.Run("type errors", func(t *testing.T) {
+		dec := goldjson.NewDecoder(strings.NewReader(`{"a":null}`))
+		expectEqual(t, true, dec.NextLine())
+		expectEqual(t, true, dec.NextField())
+		expectEqual(t, goldjson.ValueNull, dec.Type())
+		_, err := dec.String()
+		expectEqual(t, `goldjson: unexpected value type: field "a" is a null, expected a string`, err.Error())
+		_, err = dec.Bool()
+		expectEqual(t, true, errors.Is(err, goldjson.ErrValueType))
+		_, err = dec.Time()
+		expectEqual(t, true, errors.Is(err, goldjson.ErrValueType))
+	})
+
+	t.Run("syntax errors", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			input    string
+			expected string
+		}{
+			{"not a record", "{}\n[1]", "on line 2 at offset 0: line is not a record"},
+			{"missing key", `{1:2}`, "on line 1 at offset 1: expected a key"},
+			{"missing colon", `{"a" 1}`, "on line 1 at offset 5: expected a colon"},
+			{"missing comma", `{"a":1 "b":2}`, "on line 1 at offset 7: expected a comma or the end of the record"},
+			{"trailing content", `{"a":1} x`, "on line 1 at offset 8: unexpected content after the record"},
+			{"truncated", `{"a":1,`, "on line 1 at offset 7: expected a key"},
+			{"unterminated string", `{"a":"b`, "on line 1 at offset 7: unterminated string"},
+			{"invalid escape", `{"a":"\x"}`, "on line 1 at offset 7: invalid escape sequence"},
+			{"control character", "{\"a\":\"\t\"}", "on line 1 at offset 6: control character in string"},
+			{"invalid number", `{"a":-}`, "on line 1 at offset 6: invalid number"},
+			{"invalid literal", `{"a":nul}`, "on line 1 at offset 5: expected a value"},
+			{"invalid nested", `{"a":[1,]}`, "on line 1 at offset 8: expected a value"},
+			{"unclosed nested", `{"a":{"b":1`, "on line 1 at offset 11: unexpected end of line"},
+			{"nested too deep", `{"a":` + strings.Repeat("[", 1001), "on line 1 at offset 1005: nested too deep"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				dec := goldjson.NewDecoder(strings.NewReader(tt.input))
+				for dec.NextLine() {
+					for dec.NextField() {
+					}
+				}
+				err := dec.Err()
+				expectEqual(t, true, errors.Is(err, goldjson.ErrSyntax))
+				expectEqual(t, "goldjson: invalid JSON "+tt.expected, err.Error())
+				expectEqual(t, false, dec.NextLine())
+			})
+		}
+	})
+
+	t.Run("read error", func(t *testing.T) {
+		dec := goldjson.NewDecoder(iotest.ErrReader(errors.New("oops")))
+		expectEqual(t, false, dec.NextLine())
+		expectEqual(t, "oops", dec.Err().Error())
+	})
+
+	t.Run("zero allocations", func(t *testing.T) {
+		if raceEnabled {
+			t.Skip("allocation counts are unreliable with the race detector")
+		}
+		input := strings.Repeat(`{"message":"hello\nworld","int":-1,"float":1.5,"time":"2023-06-12T20:42:15.5Z","list":[1,2]}`+"\n", 200)
+		dec := goldjson.NewDecoder(strings.NewReader(input))
+		received := testing.AllocsPerRun(100, func() {
+			dec.NextLine()
+			for dec.NextField() {
+				switch string(dec.Key()) {
+				case "message":
+					_, _ = dec.Bytes()
+				case "int":
+					_, _ = dec.Int64()
+				case "float":
+					_, _ = dec.Float64()
+				case "time":
+					_, _ = dec.Time()
+				}
+			}
+		})
+		expectEqual(t, 0.0, received)
+	})
+}
+
+func TestDecoderReset(t *testing.T) {
+	dec := goldjson.NewDecoder(strings.NewReader(`{"a":}` + "\n"))
+	expectEqual(t, true, dec.NextLine())
+	expectEqual(t, false, dec.NextField())
+	expectError(t, dec.Err())
+
+	dec.Reset(strings.NewReader(`{"a\u0062":1}`))
+	expectNoError(t, dec.Err())
+	expectEqual(t, true, dec.NextLine())
+	expectEqual(t, true, dec.NextField())
+	expectEqual(t, "ab", string(dec.Key()))
+	expectEqual(t, `"a\u0062"`, string(dec.RawKey()))
+	expectEqual(t, false, dec.NextField())
+	expectEqual(t, false, dec.NextLine())
+	expectNoError(t, dec.Err())
+}
+
+func TestDecoderLookup(t *testing.T) {
+	dec := goldjson.NewDecoder(strings.NewReader(`{"a":1,"b":{"c":2},"d":3}` + "\n"))
+	expectEqual(t, true, dec.NextLine())
+	expectEqual(t, true, dec.Lookup("b"))
+	expectEqual(t, `{"c":2}`, string(dec.Raw()))
+	expectEqual(t, true, dec.NextField())
+	expectEqual(t, "d", string(dec.Key()))
+	expectEqual(t, true, dec.Lookup("a"))
+	expectEqual(t, false, dec.Lookup("c"))
+	dec.Rewind()
+	expectEqual(t, true, dec.NextField())
+	expectEqual(t, "a", string(dec.Key()))
+	expectNoError(t, dec.Err())
+}
+
+func TestEventDispatcher(t *testing.T) {
+	input := `{"v":1,"msg":"one"}` + "\n" + `{"message":"two","v":2}` + "\n" + `{"v":3}` + "\n" + `{"msg":"none"}` + "\n" + `{"v":"x"}` + "\n"
+	readMessage := func(key string, received *[]string) func(dec *goldjson.Decoder) error {
+		return func(dec *goldjson.Decoder) error {
+			for dec.NextField() {
+				if string(dec.Key()) == key {
+					s, err := dec.String()
+					*received = append(*received, s)
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	t.Run("handlers", func(t *testing.T) {
+		var received []string
+		dispatcher := goldjson.EventDispatcher{
+			Key: "v",
+			Handlers: map[int64]func(dec *goldjson.Decoder) error{
+				1: readMessage("msg", &received),
+				2: readMessage("message", &received),
+			},
+		}
+		dec := goldjson.NewDecoder(strings.NewReader(input))
+		var errs []string
+		for dec.NextLine() {
+			if err := dispatcher.Dispatch(dec); err != nil {
+				expectEqual(t, true, errors.Is(err, goldjson.ErrUnknownEventVersion))
+				errs = append(errs, err.Error())
+			}
+		}
+		expectNoError(t, dec.Err())
+		expectEqual(t, "one,two", strings.Join(received, ","))
+		expectEqual(t, strings.Join([]string{
+			"goldjson: unknown event version: 3",
+			`goldjson: unknown event version: field "v" not found`,
+			`goldjson: unknown event version: goldjson: unexpected value type: field "v" is a string, expected a number`,
+		}, "\n"), strings.Join(errs, "\n"))
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		type unknown struct {
+			version int64
+			ok      bool
+		}
+		var received []string
+		var unknowns []unknown
+		dispatcher := goldjson.EventDispatcher{
+			Key: "v",
+			Handlers: map[int64]func(dec *goldjson.Decoder) error{
+				1: readMessage("msg", &received),
+			},
+			Unknown: func(dec *goldjson.Decoder, version int64, ok bool) error {
+				unknowns = append(unknowns, unknown{version, ok})
+				return readMessage("msg", &received)(dec)
+			},
+		}
+		dec := goldjson.NewDecoder(strings.NewReader(input))
+		for dec.NextLine() {
+			expectNoError(t, dispatcher.Dispatch(dec))
+		}
+		expectNoError(t, dec.Err())
+		expectEqual(t, "one,none", strings.Join(received, ","))
+		expectEqual(t, "[{2 true} {3 true} {0 false} {0 false}]", fmt.Sprint(unknowns))
+	})
+
+	t.Run("syntax error", func(t *testing.T) {
+		dispatcher := goldjson.EventDispatcher{Key: "v"}
+		dec := goldjson.NewDecoder(strings.NewReader(`{"a":}` + "\n"))
+		expectEqual(t, true, dec.NextLine())
+		err := dispatcher.Dispatch(dec)
+		expectEqual(t, true, errors.Is(err, goldjson.ErrSyntax))
+		expectEqual(t, err, dec.Err())
+	})
+}
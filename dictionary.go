@@ -0,0 +1,84 @@
+package goldjson
+
+import (
+	"io"
+	"sync"
+)
+
+// DictionarySampler is an io.Writer that passes the lines written by an
+// Encoder through to another writer while sampling them for building a
+// compression dictionary (see Dictionary). Structured log lines share most
+// of their keys and many of their values with each other, so compressing
+// them with a dictionary built from earlier lines improves the compression
+// ratio, especially when the lines are compressed in small blocks.
+//
+// The DictionarySampler assumes that each write is a single line, which is
+// the case for the writes of an Encoder.
+type DictionarySampler struct {
+	w       io.Writer
+	every   int
+	maxSize int
+	mu      sync.Mutex
+	n       int
+	size    int
+	samples [][]byte
+}
+
+// NewDictionarySampler returns a DictionarySampler that writes to w and
+// samples every nth line, keeping at most maxSize bytes of the most recent
+// samples. An every of 1 or less samples all the lines.
+func NewDictionarySampler(w io.Writer, every, maxSize int) *DictionarySampler {
+	if every < 1 {
+		every = 1
+	}
+	return &DictionarySampler{w: w, every: every, maxSize: maxSize}
+}
+
+// Write writes p to the underlying writer, sampling it if it is the nth
+// line.
+func (s *DictionarySampler) Write(p []byte) (int, error) {
+	s.sample(p)
+	return s.w.Write(p)
+}
+
+func (s *DictionarySampler) sample(p []byte) {
+	if len(p) > s.maxSize {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.n++
+	if s.n < s.every {
+		return
+	}
+	s.n = 0
+	s.samples = append(s.samples, append([]byte(nil), p...))
+	s.size += len(p)
+	drop := 0
+	for s.size > s.maxSize {
+		s.size -= len(s.samples[drop])
+		drop++
+	}
+	s.samples = s.samples[drop:]
+}
+
+// Dictionary returns the sampled lines as a raw content dictionary, i.e. the
+// sampled lines concatenated, oldest first, so that the most recent lines
+// are closest to the compressed data. Returns nil if no lines have been
+// sampled.
+//
+// A raw content dictionary can be used as is, e.g. as the preset dictionary
+// of compress/flate (see flate.NewWriterDict) or as a raw content
+// dictionary of zstd (e.g. zstd -D).
+func (s *DictionarySampler) Dictionary() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.size == 0 {
+		return nil
+	}
+	dict := make([]byte, 0, s.size)
+	for _, sample := range s.samples {
+		dict = append(dict, sample...)
+	}
+	return dict
+}
@@ -0,0 +1,191 @@
+package goldjson
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// WithDoubleBuffering makes the Encoder write lines into one of two buffers
+// of the given size, while the other buffer is being written to the
+// underlying writer by a background goroutine. This decouples the latency of
+// End from the latency of the underlying writer: End only blocks when both
+// buffers are full.
+//
+// The buffers are also written out periodically (see WithFlushInterval), as
+// well as on Flush and Close. The caller MUST call Close on the Encoder to
+// write out the remaining lines and stop the background goroutine; the
+// underlying writer itself is not closed.
+//
+// The first error returned by the underlying writer is returned by all
+// subsequent writes, as well as Flush and Close.
+func WithDoubleBuffering(size int) Option {
+	return func(o *options) {
+		o.doubleBuffering = size
+	}
+}
+
+type doubleBufferedWriter struct {
+	mu      sync.Mutex
+	cond    sync.Cond
+	w       io.Writer
+	size    int
+	active  []byte
+	spare   []byte
+	pending []byte
+	err     error
+	closed  bool
+	kick    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func newDoubleBufferedWriter(w io.Writer, size int, flushInterval time.Duration) *doubleBufferedWriter {
+	d := &doubleBufferedWriter{
+		w:      w,
+		size:   size,
+		active: make([]byte, 0, size),
+		spare:  make([]byte, 0, size),
+		kick:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	d.cond.L = &d.mu
+	go d.run(flushInterval)
+	return d
+}
+
+func (d *doubleBufferedWriter) Write(data []byte) (n int, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return 0, os.ErrClosed
+	}
+	if d.err != nil {
+		return 0, d.err
+	}
+	for len(d.active) > 0 && len(d.active)+len(data) > d.size {
+		if d.swap() {
+			break
+		}
+		d.cond.Wait()
+	}
+	d.active = append(d.active, data...)
+	return len(data), nil
+}
+
+// Flush writes out all the buffered data and waits for the writes to
+// complete, then flushes the underlying writer if it is buffered.
+func (d *doubleBufferedWriter) Flush() error {
+	d.mu.Lock()
+	err := d.flush()
+	d.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if f, ok := d.w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Health returns an error if the writer has been closed or a write to the
+// underlying writer has failed, or the health of the underlying writer, if
+// it implements HealthChecker.
+func (d *doubleBufferedWriter) Health() error {
+	d.mu.Lock()
+	closed, err := d.closed, d.err
+	d.mu.Unlock()
+	if closed {
+		return os.ErrClosed
+	}
+	if err != nil {
+		return err
+	}
+	if h, ok := d.w.(HealthChecker); ok {
+		return h.Health()
+	}
+	return nil
+}
+
+// Close flushes the buffered data and stops the background goroutine.
+func (d *doubleBufferedWriter) Close() error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return os.ErrClosed
+	}
+	err := d.flush()
+	d.closed = true
+	d.mu.Unlock()
+	close(d.stop)
+	<-d.done
+	return err
+}
+
+func (d *doubleBufferedWriter) flush() error {
+	for len(d.active) > 0 || d.pending != nil {
+		if !d.swap() {
+			d.cond.Wait()
+		}
+	}
+	return d.err
+}
+
+// swap hands the active buffer to the background goroutine, if it's not
+// busy writing the other one. Returns false if the background goroutine is
+// busy.
+func (d *doubleBufferedWriter) swap() bool {
+	if d.pending != nil {
+		return false
+	}
+	if len(d.active) == 0 {
+		return true
+	}
+	d.pending, d.active, d.spare = d.active, d.spare[:0], nil
+	select {
+	case d.kick <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+func (d *doubleBufferedWriter) run(flushInterval time.Duration) {
+	defer close(d.done)
+	var tick <-chan time.Time
+	if flushInterval > 0 {
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-d.kick:
+		case <-tick:
+			d.mu.Lock()
+			d.swap()
+			d.mu.Unlock()
+		case <-d.stop:
+			return
+		}
+		d.writePending()
+	}
+}
+
+func (d *doubleBufferedWriter) writePending() {
+	d.mu.Lock()
+	buf := d.pending
+	d.mu.Unlock()
+	if buf == nil {
+		return
+	}
+	err := writeFull(d.w, buf)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err != nil && d.err == nil {
+		d.err = err
+	}
+	d.pending, d.spare = nil, buf[:0]
+	d.cond.Broadcast()
+}
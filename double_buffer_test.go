@@ -0,0 +1,179 @@
+package goldjson_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jussi-kalliokoski/goldjson"
+)
+
+func TestDoubleBuffering(t *testing.T) {
+	t.Run("flush", func(t *testing.T) {
+		var w syncWriter
+		enc := goldjson.NewEncoder(&w, goldjson.WithDoubleBuffering(1024), goldjson.WithFlushInterval(0))
+		expected := strings.Repeat(`{"a":"b"}`+"\n", 3)
+
+		for i := 0; i < 3; i++ {
+			line := enc.NewLine()
+			line.AddString("a", "b")
+			expectNoError(t, line.End())
+		}
+		beforeFlush := w.String()
+		flushErr := enc.Flush()
+		afterFlush := w.String()
+		closeErr := enc.Close()
+
+		expectNoError(t, flushErr)
+		expectNoError(t, closeErr)
+		expectEqual(t, "", beforeFlush)
+		expectEqual(t, expected, afterFlush)
+	})
+
+	t.Run("flushes periodically", func(t *testing.T) {
+		var w syncWriter
+		enc := goldjson.NewEncoder(&w, goldjson.WithDoubleBuffering(1024), goldjson.WithFlushInterval(time.Millisecond))
+		defer func() { _ = enc.Close() }()
+		expected := `{"a":"b"}` + "\n"
+
+		line := enc.NewLine()
+		line.AddString("a", "b")
+		_ = line.End()
+		deadline := time.Now().Add(5 * time.Second)
+		for w.String() == "" && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+
+		expectEqual(t, expected, w.String())
+	})
+
+	t.Run("does not wait for slow writer", func(t *testing.T) {
+		w := &blockingWriter{release: make(chan struct{})}
+		enc := goldjson.NewEncoder(w, goldjson.WithDoubleBuffering(16), goldjson.WithFlushInterval(0))
+		expected := `{"a":"b"}` + "\n" + `{"a":"c"}` + "\n"
+
+		ended := make(chan struct{})
+		go func() {
+			defer close(ended)
+			for _, value := range []string{"b", "c"} {
+				line := enc.NewLine()
+				line.AddString("a", value)
+				_ = line.End()
+			}
+		}()
+		select {
+		case <-ended:
+		case <-time.After(5 * time.Second):
+			t.Fatal("End blocked on the underlying writer")
+		}
+		close(w.release)
+		closeErr := enc.Close()
+
+		expectNoError(t, closeErr)
+		expectEqual(t, expected, w.buf.String())
+	})
+
+	t.Run("sticky error", func(t *testing.T) {
+		enc := goldjson.NewEncoder(ErrorWriter{}, goldjson.WithDoubleBuffering(1024), goldjson.WithFlushInterval(0))
+
+		healthErr1 := enc.Health()
+		endErr1 := enc.NewLine().End()
+		flushErr := enc.Flush()
+		healthErr2 := enc.Health()
+		endErr2 := enc.NewLine().End()
+		closeErr := enc.Close()
+
+		expectNoError(t, healthErr1)
+		expectNoError(t, endErr1)
+		expectError(t, flushErr)
+		expectEqual(t, flushErr, healthErr2)
+		expectError(t, endErr2)
+		expectError(t, closeErr)
+	})
+
+	t.Run("health of underlying writer", func(t *testing.T) {
+		w := healthWriter{err: errors.New("disconnected")}
+		enc := goldjson.NewEncoder(w, goldjson.WithDoubleBuffering(1024))
+		defer func() { _ = enc.Close() }()
+
+		healthErr := enc.Health()
+
+		expectEqual(t, w.err, healthErr)
+	})
+
+	t.Run("short writes", func(t *testing.T) {
+		w := &chunkWriter{chunk: 4}
+		enc := goldjson.NewEncoder(w, goldjson.WithDoubleBuffering(1024), goldjson.WithFlushInterval(0))
+		expected := strings.Repeat(`{"a":"b"}`+"\n", 3)
+
+		for i := 0; i < 3; i++ {
+			line := enc.NewLine()
+			line.AddString("a", "b")
+			expectNoError(t, line.End())
+		}
+		closeErr := enc.Close()
+
+		expectNoError(t, closeErr)
+		expectEqual(t, expected, w.buf.String())
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		var w syncWriter
+		enc := goldjson.NewEncoder(&w, goldjson.WithDoubleBuffering(1024))
+		expectNoError(t, enc.Close())
+
+		endErr := enc.NewLine().End()
+
+		expectError(t, endErr)
+		expectEqual(t, os.ErrClosed, enc.Health())
+	})
+
+	t.Run("emergency line", func(t *testing.T) {
+		var w syncWriter
+		enc := goldjson.NewEncoder(&w, goldjson.WithDoubleBuffering(1024), goldjson.WithFlushInterval(0))
+
+		line := enc.NewLine()
+		line.AddString("a", "buffered")
+		expectNoError(t, line.End())
+		emergency := enc.EmergencyLine()
+		emergency.AddString("a", "emergency")
+		expectNoError(t, emergency.End())
+		beforeClose := w.String()
+		closeErr := enc.Close()
+
+		expectNoError(t, closeErr)
+		expectEqual(t, `{"a":"emergency"}`+"\n", beforeClose)
+		expectEqual(t, `{"a":"emergency"}`+"\n"+`{"a":"buffered"}`+"\n", w.String())
+	})
+}
+
+type syncWriter struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (w *syncWriter) Write(data []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(data)
+}
+
+func (w *syncWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+type blockingWriter struct {
+	release chan struct{}
+	buf     bytes.Buffer
+}
+
+func (w *blockingWriter) Write(data []byte) (n int, err error) {
+	<-w.release
+	return w.buf.Write(data)
+}
@@ -0,0 +1,67 @@
+package goldjson
+
+import "os"
+
+// EmergencyLine creates a new line that is written synchronously when
+// ended, for panic and fatal paths where the line should reach the
+// destination as soon as possible.
+//
+// The line bypasses the LineWriter pool, the write hooks and the byte
+// accounting. The Encoders created with NewFileEncoder write the line
+// straight to the file, and the Encoders using WithDoubleBuffering straight
+// to the underlying writer, without waiting for the buffered lines or the
+// locks held by the regular writes, so the line reaches the file descriptor
+// even if the regular write path is stuck.
+//
+// Other writers are written to like with End, waiting for the mutex of
+// WithLocking, if any, so the line is only written once the regular writes
+// in progress have completed. A *bufio.Writer is flushed after the line is
+// written to it.
+//
+// The line may thus be written before lines that were ended earlier but are
+// still buffered. When writing straight to the underlying writer of
+// WithDoubleBuffering, the writer MUST be safe for concurrent use, as
+// *os.File is.
+func (e *Encoder) EmergencyLine() *LineWriter {
+	l := &LineWriter{encoder: e, emergency: true}
+	e.initLine(l, '{', '}')
+	return l
+}
+
+// emergencyWriter is implemented by the writers that can write a line
+// bypassing their buffering and locking.
+type emergencyWriter interface {
+	writeEmergency(buf []byte) error
+}
+
+func (e *Encoder) writeEmergency(buf []byte) error {
+	if w, ok := e.w.(emergencyWriter); ok {
+		return w.writeEmergency(buf)
+	}
+	if e.mu != nil {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+	}
+	if e.bw != nil {
+		if err := writeBuffered(e.bw, buf); err != nil {
+			return err
+		}
+		return e.bw.Flush()
+	}
+	return writeFull(e.w, buf)
+}
+
+func (w *fileWriter) writeEmergency(buf []byte) error {
+	f := w.fd.Load()
+	if f == nil {
+		return os.ErrClosed
+	}
+	return writeFull(f, buf)
+}
+
+func (d *doubleBufferedWriter) writeEmergency(buf []byte) error {
+	if w, ok := d.w.(emergencyWriter); ok {
+		return w.writeEmergency(buf)
+	}
+	return writeFull(d.w, buf)
+}
@@ -0,0 +1,31 @@
+package goldjson
+
+// RegisterEnum registers a table of names for the integer-coded values of
+// the key, such as status codes or state machine states, to be used by
+// AddEnum. The names are encoded once here, so adding an enum value costs a
+// single copy of the pre-encoded name.
+//
+// Registering an enum for a key again replaces the previous table.
+//
+// NOTE: Not thread-safe, MUST only be called before using the Encoder.
+func (e *Encoder) RegisterEnum(key string, names map[int64]string) {
+	e.keys.PutEnum(key, names)
+}
+
+// AddEnum adds a key-value pair with the name of an integer-coded value to
+// the active record/list, using the table registered for the key with
+// RegisterEnum. If the key has no table or the table has no name for the
+// value, the value is added as a number.
+//
+// If a list is currently active, the key will be ignored.
+func (l *LineWriter) AddEnum(key string, value int64) {
+	if l.checkKey(key) != nil {
+		return
+	}
+	l.appendKey(key)
+	if name, ok := l.encoder.keys.enums[key][value]; ok {
+		l.buf = append(l.buf, name...)
+		return
+	}
+	l.buf = l.encoder.appendInt64(l.buf, value)
+}
@@ -0,0 +1,235 @@
+package goldjson
+
+import (
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/jussi-kalliokoski/goldjson/tokens"
+)
+
+// WithSafeSet makes the Encoder escape the ASCII characters that are not in
+// the given set in keys and string values, e.g. to additionally escape "=" or
+// DEL for a particular consumer. The characters JSON requires to be escaped
+// are always escaped, regardless of the set.
+//
+// The set doesn't apply to the values added with AddMarshal or
+// AddSafeString, or to StaticFields created with the package-level
+// NewStaticFields; use Encoder.NewStaticFields instead.
+func WithSafeSet(set tokens.SafeSet) Option {
+	return func(o *options) {
+		set = set.Sanitized()
+		o.safeSet = &set
+	}
+}
+
+// WithEscapeSlash makes the Encoder escape the forward slash (/) as \/ in keys
+// and string values, e.g. for embedding the output in HTML <script> elements
+// or for legacy parsers that require it.
+//
+// Like WithSafeSet, the option doesn't apply to the values added with
+// AddMarshal or AddSafeString, or to StaticFields created with the
+// package-level NewStaticFields.
+func WithEscapeSlash() Option {
+	return func(o *options) {
+		o.escapeSlash = true
+	}
+}
+
+// WithHTMLSafe makes the Encoder escape "<", ">" and "&" in keys and string
+// values like json.Marshal does by default, e.g. for output that is embedded
+// in HTML, where the unescaped characters could be used for HTML injection.
+// The values added with AddMarshal are escaped as well.
+//
+// Like WithSafeSet, the option doesn't apply to the values added with
+// AddSafeString, or to StaticFields created with the package-level
+// NewStaticFields.
+func WithHTMLSafe() Option {
+	return func(o *options) {
+		o.htmlSafe = true
+	}
+}
+
+// WithNewlineReplacement makes the Encoder replace each line break (\r\n, \n
+// or \r) in string values with the given replacement, e.g. " " or "⏎",
+// for legacy collectors that mangle the escaped line breaks of multi-line
+// strings. An empty replacement removes the line breaks. Keys are not
+// affected.
+//
+// The output never contains raw line breaks or other control characters
+// regardless of this option, since they are always escaped.
+//
+// Like WithSafeSet, the option doesn't apply to the values added with
+// AddMarshal or AddSafeString (unless in strict mode), or to StaticFields
+// created with the package-level NewStaticFields.
+func WithNewlineReplacement(replacement string) Option {
+	return func(o *options) {
+		o.newlineReplacement = &replacement
+	}
+}
+
+// WithASCIIOnly makes the Encoder escape all the non-ASCII characters in keys
+// and string values as \uXXXX sequences (or surrogate pairs of them), e.g.
+// for legacy consumers that can't handle multi-byte UTF-8.
+//
+// Like WithSafeSet, the option doesn't apply to the values added with
+// AddMarshal or AddSafeString, or to StaticFields created with the
+// package-level NewStaticFields.
+func WithASCIIOnly() Option {
+	return func(o *options) {
+		o.asciiOnly = true
+	}
+}
+
+// escapeNonASCII escapes the non-ASCII characters in the encoded JSON at
+// buf[start:], which MUST be valid UTF-8, expanding it in place.
+func escapeNonASCII(buf []byte, start int) []byte {
+	extra := 0
+	for i := start; i < len(buf); {
+		if buf[i] < utf8.RuneSelf {
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(buf[i:])
+		extra += escapedRuneSize(r) - size
+		i += size
+	}
+	if extra == 0 {
+		return buf
+	}
+	end := len(buf)
+	buf = append(buf, make([]byte, extra)...)
+	// move the characters to their final positions from the end, so that
+	// they're not overwritten before they're moved
+	w := len(buf)
+	for i := end; i > start; {
+		if b := buf[i-1]; b < utf8.RuneSelf {
+			w--
+			buf[w] = b
+			i--
+			continue
+		}
+		r, size := utf8.DecodeLastRune(buf[start:i])
+		i -= size
+		w -= escapedRuneSize(r)
+		if r > 0xffff {
+			r1, r2 := utf16.EncodeRune(r)
+			appendRuneEscape(buf[w:w], r1)
+			appendRuneEscape(buf[w+6:w+6], r2)
+		} else {
+			appendRuneEscape(buf[w:w], r)
+		}
+	}
+	return buf
+}
+
+func escapedRuneSize(r rune) int {
+	if r > 0xffff {
+		return 2 * len(`\u0000`)
+	}
+	return len(`\u0000`)
+}
+
+func appendRuneEscape(buf []byte, r rune) []byte {
+	const hex = "0123456789abcdef"
+	return append(buf, '\\', 'u', hex[r>>12&0xf], hex[r>>8&0xf], hex[r>>4&0xf], hex[r&0xf])
+}
+
+// stringEncoder encodes strings according to the escaping options of an
+// Encoder.
+type stringEncoder struct {
+	safeSet *tokens.SafeSet
+	// newlines is the replacement of the line breaks in values, if any.
+	newlines *string
+	// stdlib makes the encoder escape like the json.Marshal of the Go
+	// toolchain, see WithJSONCompat.
+	stdlib bool
+	// ascii makes the encoder escape the non-ASCII characters, see
+	// WithASCIIOnly.
+	ascii bool
+}
+
+func newStringEncoder(o options) stringEncoder {
+	if o.jsonCompat {
+		return stringEncoder{safeSet: o.safeSet, stdlib: true}
+	}
+	if !o.escapeSlash && !o.htmlSafe {
+		return stringEncoder{safeSet: o.safeSet, newlines: o.newlineReplacement, ascii: o.asciiOnly}
+	}
+	set := tokens.DefaultSafeSet()
+	if o.safeSet != nil {
+		set = *o.safeSet
+	}
+	if o.escapeSlash {
+		set['/'] = false
+	}
+	if o.htmlSafe {
+		set['<'], set['>'], set['&'] = false, false, false
+	}
+	return stringEncoder{safeSet: &set, newlines: o.newlineReplacement, ascii: o.asciiOnly}
+}
+
+// AppendValue appends a string value, replacing its line breaks if
+// configured (see WithNewlineReplacement).
+func (s stringEncoder) AppendValue(buf []byte, value string) []byte {
+	if s.ascii {
+		start := len(buf)
+		s.ascii = false
+		return escapeNonASCII(s.AppendValue(buf, value), start)
+	}
+	if s.newlines == nil {
+		return s.Append(buf, value)
+	}
+	set := s.safeSet
+	if set == nil {
+		set = &defaultSafeSet
+	}
+	return tokens.AppendStringReplaceNewlines(buf, value, *s.newlines, set)
+}
+
+func (s stringEncoder) Append(buf []byte, value string) []byte {
+	if s.ascii {
+		start := len(buf)
+		s.ascii = false
+		return escapeNonASCII(s.Append(buf, value), start)
+	}
+	if s.stdlib {
+		start := len(buf)
+		buf = tokens.AppendStringSafeSet(buf, value, s.safeSet)
+		return stdlibEscapes(buf, start, value)
+	}
+	if s.safeSet != nil {
+		return tokens.AppendStringSafeSet(buf, value, s.safeSet)
+	}
+	return tokens.AppendString(buf, value)
+}
+
+func (s stringEncoder) AppendKey(buf []byte, key string) []byte {
+	if s.ascii {
+		start := len(buf)
+		s.ascii = false
+		return escapeNonASCII(s.AppendKey(buf, key), start)
+	}
+	if s.stdlib {
+		start := len(buf)
+		buf = tokens.AppendKeySafeSet(buf, key, s.safeSet)
+		return stdlibEscapes(buf, start, key)
+	}
+	if s.safeSet != nil {
+		return tokens.AppendKeySafeSet(buf, key, s.safeSet)
+	}
+	return tokens.AppendKey(buf, key)
+}
+
+func (s stringEncoder) AppendStack(buf []byte, skip int) []byte {
+	if s.ascii {
+		start := len(buf)
+		s.ascii = false
+		return escapeNonASCII(s.AppendStack(buf, skip+1), start)
+	}
+	if s.safeSet != nil {
+		return tokens.AppendStackSafeSet(buf, skip+1, s.safeSet)
+	}
+	return tokens.AppendStack(buf, skip+1)
+}
+
+var defaultSafeSet = tokens.DefaultSafeSet()
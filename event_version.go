@@ -0,0 +1,141 @@
+package goldjson
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/jussi-kalliokoski/goldjson/tokens"
+)
+
+// EventRegistry maps the versions of the events written in the lines to the
+// top-level fields of each version, e.g. for documenting how the shape of
+// the events has evolved, and for checking that the lines match the version
+// they are stamped with. See WithEventVersion.
+type EventRegistry map[int64][]SchemaField
+
+// WithEventVersion makes the Encoder stamp every line with the version of
+// the events under the given key, as the first field of the line after the
+// line ID (see WithLineID), e.g. for long-lived pipelines where the shape of
+// the events evolves, and the consumers must tell apart the lines written by
+// different versions of the producers:
+//
+//	{"v":3,"msg":"hello"}
+//
+// If the registry declares the fields of the version, the top-level keys of
+// the lines are checked against them, including the keys of the fields
+// added by the Encoder itself (e.g. the line ID, the clock skew or the
+// sampling fields). A field with an undeclared key is omitted from the line
+// like a key rejected by WithKeyValidation, i.e. it's reported with a
+// *KeyError. The check adds the cost of tracking the structure of each
+// line, like the strict mode. The fields of StaticFields are not checked.
+//
+// Lines whose top-level value is not a record (see NewListLine and
+// NewValueLine) are not stamped. See EventDispatcher for reading the lines.
+func WithEventVersion(key string, version int64, registry EventRegistry) Option {
+	return func(o *options) {
+		o.eventVersionKey = key
+		o.eventVersion = version
+		o.eventRegistry = registry
+	}
+}
+
+// declareEventFields sets up the keys declared for the event version, if
+// any.
+func (o *options) declareEventFields() {
+	o.eventFields = nil
+	fields, ok := o.eventRegistry[o.eventVersion]
+	if o.eventVersionKey == "" || !ok {
+		return
+	}
+	o.eventFields = make(map[string]struct{}, len(fields)+1)
+	o.eventFields[o.eventVersionKey] = struct{}{}
+	for _, f := range fields {
+		o.eventFields[f.Key] = struct{}{}
+	}
+}
+
+// checkEventField returns an error if the top-level key is not declared for
+// the event version.
+func (c *lineChecks) checkEventField(key string) error {
+	if _, ok := c.eventFields[key]; ok {
+		return nil
+	}
+	return &KeyError{Key: key, Reason: "not declared for event version " + strconv.FormatInt(c.eventVersion, 10)}
+}
+
+func (l *LineWriter) addEventVersion() {
+	key := l.encoder.opts.eventVersionKey
+	if l.checkKey(key) != nil {
+		return
+	}
+	l.appendKey(key)
+	l.buf = tokens.AppendInt64(l.buf, l.encoder.opts.eventVersion)
+}
+
+// ErrUnknownEventVersion is matched by the errors returned by
+// EventDispatcher.Dispatch for lines without a handler for their version.
+var ErrUnknownEventVersion = errors.New("goldjson: unknown event version")
+
+// EventDispatcher dispatches the lines read by a Decoder to handlers by the
+// version of the events, as stamped by WithEventVersion:
+//
+//	dispatcher := goldjson.EventDispatcher{
+//		Key: "v",
+//		Handlers: map[int64]func(dec *goldjson.Decoder) error{
+//			1: readV1,
+//			2: readV2,
+//		},
+//	}
+//	for dec.NextLine() {
+//		if err := dispatcher.Dispatch(dec); err != nil {
+//			...
+//		}
+//	}
+type EventDispatcher struct {
+	// Key is the key of the version field.
+	Key string
+	// Handlers are the handlers of the lines by version. The handlers are
+	// called with the Decoder positioned at the start of the line, i.e.
+	// before the first field.
+	Handlers map[int64]func(dec *Decoder) error
+	// Unknown, if set, handles the lines without a handler for their
+	// version, as well as the lines without a valid version field (ok is
+	// false). Otherwise such lines fail with ErrUnknownEventVersion.
+	Unknown func(dec *Decoder, version int64, ok bool) error
+}
+
+// Dispatch calls the handler of the version of the current line of the
+// Decoder, returning the error of the handler.
+func (x *EventDispatcher) Dispatch(dec *Decoder) error {
+	version, err := dec.eventVersion(x.Key)
+	ok := err == nil
+	if ok {
+		if handler := x.Handlers[version]; handler != nil {
+			return handler(dec)
+		}
+	}
+	if x.Unknown != nil {
+		return x.Unknown(dec, version, ok)
+	}
+	if dec.err != nil {
+		return dec.err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %v", ErrUnknownEventVersion, err)
+	}
+	return fmt.Errorf("%w: %d", ErrUnknownEventVersion, version)
+}
+
+// eventVersion returns the version of the current line, leaving the Decoder
+// positioned at the start of the line.
+func (d *Decoder) eventVersion(key string) (int64, error) {
+	defer d.Rewind()
+	if !d.Lookup(key) {
+		if d.err != nil {
+			return 0, d.err
+		}
+		return 0, fmt.Errorf("field %q not found", key)
+	}
+	return d.Int64()
+}
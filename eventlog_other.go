@@ -0,0 +1,14 @@
+//go:build !windows
+
+package goldjson
+
+import "errors"
+
+// NewEventLogEncoder returns a new Encoder that reports each line as an event
+// of the given source to the Windows Event Log.
+//
+// The Event Log sink is only available on Windows, on other platforms an
+// error is always returned.
+func NewEventLogEncoder(source string, opts ...Option) (*Encoder, error) {
+	return nil, errors.New("goldjson: the Event Log sink is not supported on this platform")
+}
@@ -0,0 +1,115 @@
+//go:build windows
+
+package goldjson
+
+import (
+	"bytes"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	advapi32                  = syscall.NewLazyDLL("advapi32.dll")
+	procRegisterEventSourceW  = advapi32.NewProc("RegisterEventSourceW")
+	procDeregisterEventSource = advapi32.NewProc("DeregisterEventSource")
+	procReportEventW          = advapi32.NewProc("ReportEventW")
+)
+
+// The event types of ReportEventW.
+const (
+	eventLogErrorType       = 0x0001
+	eventLogWarningType     = 0x0002
+	eventLogInformationType = 0x0004
+)
+
+// NewEventLogEncoder returns a new Encoder that reports each line as an event
+// of the given source to the Windows Event Log, with the JSON line as the
+// message of the event and the severity of the line (see LineSeverity and
+// SeverityKey) as the type of the event: errors as errors, warnings as
+// warnings, and other lines as information.
+//
+// The events are reported with the event ID 1. For the Event Viewer to
+// display the message as is, the source should be registered with
+// EventCreate.exe as the message file, e.g. with
+// golang.org/x/sys/windows/svc/eventlog.InstallAsEventCreate. The messages
+// of events are limited to 31839 characters, so longer lines fail to write.
+//
+// The Event Log sink is only available on Windows.
+func NewEventLogEncoder(source string, opts ...Option) (*Encoder, error) {
+	o := buildOptions(opts)
+	w, err := openEventLogWriter(source)
+	if err != nil {
+		return nil, err
+	}
+	return newEncoder(w, w, o), nil
+}
+
+type eventLogWriter struct {
+	mu     sync.Mutex
+	handle uintptr
+}
+
+func openEventLogWriter(source string) (*eventLogWriter, error) {
+	name, err := syscall.UTF16PtrFromString(source)
+	if err != nil {
+		return nil, err
+	}
+	handle, _, err := procRegisterEventSourceW.Call(0, uintptr(unsafe.Pointer(name)))
+	if handle == 0 {
+		return nil, err
+	}
+	return &eventLogWriter{handle: handle}, nil
+}
+
+func (w *eventLogWriter) Write(data []byte) (int, error) {
+	eventType := eventLogInformationType
+	switch LineSeverity(data, SeverityKey) {
+	case SeverityWarning:
+		eventType = eventLogWarningType
+	case SeverityError:
+		eventType = eventLogErrorType
+	}
+	// the line can't contain NUL characters, as they're escaped in JSON
+	msg, err := syscall.UTF16PtrFromString(string(bytes.TrimSuffix(data, []byte("\n"))))
+	if err != nil {
+		return 0, err
+	}
+	strs := [1]*uint16{msg}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.handle == 0 {
+		return 0, os.ErrClosed
+	}
+	ok, _, err := procReportEventW.Call(
+		w.handle,
+		uintptr(eventType),
+		0, // category
+		1, // event ID
+		0, // user SID
+		uintptr(len(strs)),
+		0, // size of the binary data
+		uintptr(unsafe.Pointer(&strs[0])),
+		0, // binary data
+	)
+	if ok == 0 {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// Close deregisters the event source.
+func (w *eventLogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.handle == 0 {
+		return os.ErrClosed
+	}
+	ok, _, err := procDeregisterEventSource.Call(w.handle)
+	w.handle = 0
+	if ok == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package goldjson
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NewFileEncoder returns a new Encoder that appends lines to the file at the
+// given path, creating the file if it doesn't exist.
+//
+// The writes are buffered (see WithBufferSize) and the buffer is flushed
+// periodically (see WithFlushInterval). The caller MUST call Close on the
+// returned Encoder to flush the remaining buffered lines and close the file.
+//
+// Use Reopen (e.g. on SIGHUP) or WithRotationCheck to start writing to a new
+// file after the old one has been rotated away.
+func NewFileEncoder(path string, opts ...Option) (*Encoder, error) {
+	o := buildOptions(opts)
+	w := &fileWriter{
+		path: path,
+		opts: o,
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return newEncoder(w, w, o), nil
+}
+
+type fileWriter struct {
+	mu        sync.Mutex
+	path      string
+	opts      options
+	file      *os.File
+	buf       *bufio.Writer
+	w         io.Writer
+	timer     *time.Timer
+	lastCheck time.Time
+	err       error
+	// fd is the open file for writeEmergency, which doesn't take the mutex.
+	fd atomic.Pointer[os.File]
+}
+
+func (w *fileWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, w.opts.filePermission)
+	if err != nil {
+		return err
+	}
+	if w.opts.fileLocking {
+		// fail early if file locking is not supported
+		err := lockFile(f)
+		if err == nil {
+			err = unlockFile(f)
+		}
+		if err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+	w.file = f
+	w.fd.Store(f)
+	w.w = f
+	if w.opts.bufferSize > 0 {
+		if w.buf == nil {
+			w.buf = bufio.NewWriterSize(f, w.opts.bufferSize)
+		} else {
+			w.buf.Reset(f)
+		}
+		w.w = w.buf
+	}
+	w.lastCheck = time.Now()
+	return nil
+}
+
+func (w *fileWriter) Write(data []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	if w.opts.rotationCheck > 0 && time.Since(w.lastCheck) >= w.opts.rotationCheck {
+		if err := w.checkRotation(); err != nil {
+			return 0, err
+		}
+	}
+	if w.opts.fileLocking {
+		n, err = w.writeLocked(data)
+	} else {
+		n, err = w.w.Write(data)
+	}
+	if w.buf != nil && w.buf.Buffered() > 0 && w.timer == nil && w.opts.flushInterval > 0 {
+		w.timer = time.AfterFunc(w.opts.flushInterval, w.flushTimer)
+	}
+	return n, err
+}
+
+func (w *fileWriter) flushTimer() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.timer = nil
+	if w.file == nil {
+		return
+	}
+	// there's no caller to report the error to, so store it for the next
+	// explicit Flush or Close
+	if err := w.flush(); err != nil && w.err == nil {
+		w.err = err
+	}
+}
+
+// Flush writes any buffered data to the file.
+func (w *fileWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return os.ErrClosed
+	}
+	err := w.flush()
+	if w.err != nil {
+		err, w.err = w.err, nil
+	}
+	return err
+}
+
+// Health returns an error if the file has been closed, a periodic flush has
+// failed since the last Flush, or the file can no longer be accessed.
+func (w *fileWriter) Health() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return os.ErrClosed
+	}
+	if w.err != nil {
+		return w.err
+	}
+	_, err := w.file.Stat()
+	return err
+}
+
+// Reopen flushes the buffered data to the current file and starts writing to
+// the file at the path, creating it if needed.
+func (w *fileWriter) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return os.ErrClosed
+	}
+	return w.reopen()
+}
+
+// Close flushes the buffered data and closes the file.
+func (w *fileWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return os.ErrClosed
+	}
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	err := w.flush()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	w.file = nil
+	w.fd.Store(nil)
+	return err
+}
+
+func (w *fileWriter) flush() error {
+	if w.buf == nil {
+		return nil
+	}
+	if w.opts.fileLocking {
+		return w.flushLocked()
+	}
+	return w.buf.Flush()
+}
+
+func (w *fileWriter) reopen() error {
+	flushErr := w.flush()
+	closeErr := w.file.Close()
+	if err := w.open(); err != nil {
+		w.file = nil
+		w.fd.Store(nil)
+		return err
+	}
+	if flushErr != nil {
+		return flushErr
+	}
+	return closeErr
+}
+
+func (w *fileWriter) checkRotation() error {
+	w.lastCheck = time.Now()
+	current, err := w.file.Stat()
+	if err != nil {
+		return err
+	}
+	latest, err := os.Stat(w.path)
+	if err == nil && os.SameFile(current, latest) {
+		return nil
+	}
+	return w.reopen()
+}
@@ -0,0 +1,54 @@
+package goldjson
+
+// WithFileLocking makes encoders returned by NewFileEncoder hold an exclusive
+// advisory lock (flock) on the file while writing to it, so that multiple
+// processes appending to the same file with file locking enabled serialize
+// their writes of whole lines, e.g. on NFS where the atomicity of O_APPEND
+// writes can't be relied upon.
+//
+// With buffering (see WithBufferSize), the buffer is flushed only at line
+// boundaries, and lines larger than the buffer are written directly.
+//
+// File locking is only available on Unix-like platforms; on other platforms
+// NewFileEncoder returns an error.
+func WithFileLocking() Option {
+	return func(o *options) {
+		o.fileLocking = true
+	}
+}
+
+// writeLocked writes the data to the file so that only whole lines are
+// written, under the lock.
+func (w *fileWriter) writeLocked(data []byte) (int, error) {
+	if w.buf != nil && len(data) <= w.buf.Available() {
+		return w.buf.Write(data)
+	}
+	if err := w.flush(); err != nil {
+		return 0, err
+	}
+	if w.buf != nil && len(data) <= w.buf.Size() {
+		return w.buf.Write(data)
+	}
+	if err := lockFile(w.file); err != nil {
+		return 0, err
+	}
+	n, err := w.file.Write(data)
+	if unlockErr := unlockFile(w.file); err == nil {
+		err = unlockErr
+	}
+	return n, err
+}
+
+func (w *fileWriter) flushLocked() error {
+	if w.buf.Buffered() == 0 {
+		return nil
+	}
+	if err := lockFile(w.file); err != nil {
+		return err
+	}
+	err := w.buf.Flush()
+	if unlockErr := unlockFile(w.file); err == nil {
+		err = unlockErr
+	}
+	return err
+}
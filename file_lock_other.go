@@ -0,0 +1,18 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+
+package goldjson
+
+import (
+	"errors"
+	"os"
+)
+
+var errFileLockingNotSupported = errors.New("goldjson: file locking is not supported on this platform")
+
+func lockFile(f *os.File) error {
+	return errFileLockingNotSupported
+}
+
+func unlockFile(f *os.File) error {
+	return errFileLockingNotSupported
+}
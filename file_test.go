@@ -0,0 +1,265 @@
+package goldjson_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jussi-kalliokoski/goldjson"
+)
+
+func TestFileEncoder(t *testing.T) {
+	writeLine := func(tb testing.TB, enc *goldjson.Encoder, value string) {
+		tb.Helper()
+		line := enc.NewLine()
+		line.AddString("a", value)
+		expectNoError(tb, line.End())
+	}
+	readFile := func(tb testing.TB, path string) string {
+		tb.Helper()
+		b, err := os.ReadFile(path)
+		expectNoError(tb, err)
+		return string(b)
+	}
+
+	t.Run("buffered until flushed", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "log.ndjson")
+		enc, err := goldjson.NewFileEncoder(path, goldjson.WithFlushInterval(0))
+		expectNoError(t, err)
+
+		writeLine(t, enc, "b")
+		beforeFlush := readFile(t, path)
+		flushErr := enc.Flush()
+		afterFlush := readFile(t, path)
+		closeErr := enc.Close()
+
+		expectNoError(t, flushErr)
+		expectNoError(t, closeErr)
+		expectEqual(t, "", beforeFlush)
+		expectEqual(t, `{"a":"b"}`+"\n", afterFlush)
+	})
+
+	t.Run("appends to existing file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "log.ndjson")
+		expectNoError(t, os.WriteFile(path, []byte(`{"a":"b"}`+"\n"), 0o644))
+		enc, err := goldjson.NewFileEncoder(path)
+		expectNoError(t, err)
+
+		writeLine(t, enc, "c")
+		closeErr := enc.Close()
+
+		expectNoError(t, closeErr)
+		expectEqual(t, `{"a":"b"}`+"\n"+`{"a":"c"}`+"\n", readFile(t, path))
+	})
+
+	t.Run("flushes periodically", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "log.ndjson")
+		enc, err := goldjson.NewFileEncoder(path, goldjson.WithFlushInterval(time.Millisecond))
+		expectNoError(t, err)
+		defer func() { _ = enc.Close() }()
+
+		writeLine(t, enc, "b")
+		deadline := time.Now().Add(5 * time.Second)
+		for readFile(t, path) == "" && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+
+		expectEqual(t, `{"a":"b"}`+"\n", readFile(t, path))
+	})
+
+	t.Run("reopen", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "log.ndjson")
+		rotatedPath := filepath.Join(dir, "log.ndjson.1")
+		enc, err := goldjson.NewFileEncoder(path)
+		expectNoError(t, err)
+
+		writeLine(t, enc, "b")
+		expectNoError(t, os.Rename(path, rotatedPath))
+		reopenErr := enc.Reopen()
+		writeLine(t, enc, "c")
+		closeErr := enc.Close()
+
+		expectNoError(t, reopenErr)
+		expectNoError(t, closeErr)
+		expectEqual(t, `{"a":"b"}`+"\n", readFile(t, rotatedPath))
+		expectEqual(t, `{"a":"c"}`+"\n", readFile(t, path))
+	})
+
+	t.Run("rotation check", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "log.ndjson")
+		rotatedPath := filepath.Join(dir, "log.ndjson.1")
+		enc, err := goldjson.NewFileEncoder(path, goldjson.WithBufferSize(0), goldjson.WithRotationCheck(time.Nanosecond))
+		expectNoError(t, err)
+
+		writeLine(t, enc, "b")
+		expectNoError(t, os.Rename(path, rotatedPath))
+		time.Sleep(time.Millisecond)
+		writeLine(t, enc, "c")
+		closeErr := enc.Close()
+
+		expectNoError(t, closeErr)
+		expectEqual(t, `{"a":"b"}`+"\n", readFile(t, rotatedPath))
+		expectEqual(t, `{"a":"c"}`+"\n", readFile(t, path))
+	})
+
+	t.Run("emergency line", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "log.ndjson")
+		enc, err := goldjson.NewFileEncoder(path, goldjson.WithFlushInterval(0))
+		expectNoError(t, err)
+
+		writeLine(t, enc, "buffered")
+		emergency := enc.EmergencyLine()
+		emergency.AddString("a", "emergency")
+		expectNoError(t, emergency.End())
+		beforeClose := readFile(t, path)
+		expectNoError(t, enc.Close())
+		closedErr := enc.EmergencyLine().End()
+
+		expectEqual(t, os.ErrClosed, closedErr)
+		expectEqual(t, `{"a":"emergency"}`+"\n", beforeClose)
+		expectEqual(t, `{"a":"emergency"}`+"\n"+`{"a":"buffered"}`+"\n", readFile(t, path))
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "log.ndjson")
+		enc, err := goldjson.NewFileEncoder(path)
+		expectNoError(t, err)
+		healthErr := enc.Health()
+		expectNoError(t, enc.Close())
+
+		line := enc.NewLine()
+		endErr := line.End()
+
+		expectError(t, endErr)
+		expectNoError(t, healthErr)
+		expectEqual(t, os.ErrClosed, enc.Health())
+	})
+}
+
+func TestJournaledFileEncoder(t *testing.T) {
+	writeLine := func(tb testing.TB, enc *goldjson.Encoder, value string) {
+		tb.Helper()
+		line := enc.NewLine()
+		line.AddString("a", value)
+		expectNoError(tb, line.End())
+	}
+	readFile := func(tb testing.TB, path string) string {
+		tb.Helper()
+		b, err := os.ReadFile(path)
+		expectNoError(tb, err)
+		return string(b)
+	}
+
+	t.Run("commits on flush", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "log.ndjson")
+		enc, err := goldjson.NewJournaledFileEncoder(path)
+		expectNoError(t, err)
+
+		writeLine(t, enc, "b")
+		beforeFlush := readFile(t, path+".journal")
+		flushErr := enc.Flush()
+		afterFlush := readFile(t, path+".journal")
+		writeLine(t, enc, "c")
+		closeErr := enc.Close()
+
+		expectNoError(t, flushErr)
+		expectNoError(t, closeErr)
+		expectEqual(t, "0", beforeFlush)
+		expectEqual(t, "10", afterFlush)
+		expectEqual(t, "20", readFile(t, path+".journal"))
+		expectEqual(t, `{"a":"b"}`+"\n"+`{"a":"c"}`+"\n", readFile(t, path))
+	})
+
+	t.Run("truncates uncommitted lines", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "log.ndjson")
+		expectNoError(t, os.WriteFile(path, []byte(`{"a":"b"}`+"\n"+`{"a":"c"}`+"\n"+`{"a"`), 0o644))
+		expectNoError(t, os.WriteFile(path+".journal", []byte("10"), 0o644))
+		enc, err := goldjson.NewJournaledFileEncoder(path)
+		expectNoError(t, err)
+
+		writeLine(t, enc, "d")
+		closeErr := enc.Close()
+
+		expectNoError(t, closeErr)
+		expectEqual(t, `{"a":"b"}`+"\n"+`{"a":"d"}`+"\n", readFile(t, path))
+	})
+
+	t.Run("truncates partial line without journal", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "log.ndjson")
+		expectNoError(t, os.WriteFile(path, []byte(`{"a":"b"}`+"\n"+`{"a"`), 0o644))
+		enc, err := goldjson.NewJournaledFileEncoder(path)
+		expectNoError(t, err)
+
+		writeLine(t, enc, "c")
+		closeErr := enc.Close()
+
+		expectNoError(t, closeErr)
+		expectEqual(t, `{"a":"b"}`+"\n"+`{"a":"c"}`+"\n", readFile(t, path))
+	})
+
+	t.Run("journal beyond end of file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "log.ndjson")
+		expectNoError(t, os.WriteFile(path, []byte(`{"a":"b"}`+"\n"), 0o644))
+		expectNoError(t, os.WriteFile(path+".journal", []byte("20"), 0o644))
+
+		_, err := goldjson.NewJournaledFileEncoder(path)
+
+		expectError(t, err)
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "log.ndjson")
+		enc, err := goldjson.NewJournaledFileEncoder(path)
+		expectNoError(t, err)
+		expectNoError(t, enc.Health())
+		expectNoError(t, enc.Close())
+
+		line := enc.NewLine()
+		line.AddString("a", "b")
+
+		expectError(t, line.End())
+		expectError(t, enc.Health())
+	})
+}
+
+func TestFileLocking(t *testing.T) {
+	switch runtime.GOOS {
+	case "darwin", "dragonfly", "freebsd", "linux", "netbsd", "openbsd":
+	default:
+		t.Skip("file locking is not supported on " + runtime.GOOS)
+	}
+	path := filepath.Join(t.TempDir(), "log.ndjson")
+	value := strings.Repeat("x", 100)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		enc, err := goldjson.NewFileEncoder(path, goldjson.WithFileLocking(), goldjson.WithBufferSize(256*i), goldjson.WithFlushInterval(0))
+		expectNoError(t, err)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				line := enc.NewLine()
+				line.AddInt64("encoder", int64(i))
+				line.AddString("value", value[:j])
+				expectNoError(t, line.End())
+			}
+			expectNoError(t, enc.Close())
+		}(i)
+	}
+	wg.Wait()
+
+	b, err := os.ReadFile(path)
+	expectNoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	expectEqual(t, 400, len(lines))
+	for _, line := range lines {
+		expectEqual(t, true, json.Valid([]byte(line)))
+	}
+}
@@ -0,0 +1,48 @@
+package goldjson
+
+// AddFloat64ListPrec adds a key-value pair with a list of float64 values,
+// each rounded to prec digits after the decimal point (see
+// tokens.AppendFloat64Prec), to the active record/list. The buffer is grown
+// once for the whole list, which makes this suitable for large metrics-style
+// lists such as histograms or embeddings.
+//
+// A negative prec encodes the values like AddFloat64. With FloatPolicyError,
+// a list containing a non-finite value is omitted as a whole.
+//
+// If a list is currently active, the key will be ignored.
+func (l *LineWriter) AddFloat64ListPrec(key string, values []float64, prec int) {
+	_ = l.addFloat64ListPrec(key, values, prec)
+}
+
+// addFloat64ListPrec adds the list like AddFloat64ListPrec, returning
+// ErrNonFiniteFloat if the list is rejected.
+func (l *LineWriter) addFloat64ListPrec(key string, values []float64, prec int) error {
+	if err := l.checkKey(key); err != nil {
+		return err
+	}
+	orig, wasEmpty := l.buf, l.composer.Empty()
+	l.appendKey(key)
+	valueStart := len(l.buf)
+	// a sign, a few integer digits, a decimal point and a comma per value
+	perValue := 8 + prec
+	if prec < 0 {
+		perValue = 24
+	}
+	if n := 2 + len(values)*perValue; cap(l.buf)-len(l.buf) < n {
+		l.buf = append(l.buf, make([]byte, n)...)[:len(l.buf)]
+	}
+	l.buf = append(l.buf, '[')
+	for i, value := range values {
+		if i != 0 {
+			l.buf = append(l.buf, ',')
+		}
+		var err error
+		if l.buf, err = l.encoder.appendFloat64Prec(l.buf, value, prec); err != nil {
+			l.buf = l.buf[:valueStart]
+			l.failValue(orig, wasEmpty, "float rejected", err)
+			return err
+		}
+	}
+	l.buf = append(l.buf, ']')
+	return nil
+}
@@ -0,0 +1,121 @@
+package goldjson
+
+import (
+	"errors"
+	"math"
+
+	"github.com/jussi-kalliokoski/goldjson/tokens"
+)
+
+// FloatPolicy determines how non-finite float values (NaN and infinities),
+// which JSON has no representation for, are encoded.
+type FloatPolicy int
+
+const (
+	// FloatPolicyString encodes the non-finite values as the strings "NaN",
+	// "+Inf" and "-Inf", like tokens.AppendFloat64. In strict mode and in
+	// the encoding/json compatibility mode, they're encoded as null instead.
+	FloatPolicyString FloatPolicy = iota
+	// FloatPolicyNull encodes the non-finite values as null.
+	FloatPolicyNull
+	// FloatPolicyError rejects the non-finite values like json.Marshal does,
+	// omitting the field (or adding a placeholder, see
+	// WithErrorPlaceholders) and keeping ErrNonFiniteFloat as the error of
+	// the line, returned by LineWriter.Err and LineWriter.End.
+	FloatPolicyError
+)
+
+// WithFloatPolicy sets the policy for encoding non-finite float values. The
+// default is FloatPolicyString.
+//
+// The policy applies to AddFloat64, AddFloat32, AddFloat64ListPrec and
+// AddComplex128 (with ComplexFormatRecord), as well as the AddFloat64
+// methods of LayoutLine, GroupRecord and TemplateLine.
+func WithFloatPolicy(policy FloatPolicy) Option {
+	return func(o *options) {
+		o.floatPolicy = policy
+	}
+}
+
+// ErrNonFiniteFloat is the error of a line where a non-finite float value was
+// rejected. See FloatPolicyError.
+var ErrNonFiniteFloat = errors.New("goldjson: non-finite float")
+
+// addFloat64 adds the float like AddFloat64, returning ErrNonFiniteFloat if
+// the value is rejected.
+func (l *LineWriter) addFloat64(key string, value float64) error {
+	if l.encoder.opts.replaceValue != nil {
+		if ok, err := l.replaceValue(key, KindFloat64, value); ok {
+			return err
+		}
+	}
+	if err := l.checkKey(key); err != nil {
+		return err
+	}
+	orig, wasEmpty := l.buf, l.composer.Empty()
+	l.appendKey(key)
+	var err error
+	l.buf, err = l.encoder.appendFloat64(l.buf, value)
+	if err != nil {
+		l.failValue(orig, wasEmpty, "float rejected", err)
+	}
+	return err
+}
+
+// addFloat32 adds the float like AddFloat32, returning ErrNonFiniteFloat if
+// the value is rejected.
+func (l *LineWriter) addFloat32(key string, value float32) error {
+	if l.encoder.opts.replaceValue != nil {
+		if ok, err := l.replaceValue(key, KindFloat32, value); ok {
+			return err
+		}
+	}
+	if err := l.checkKey(key); err != nil {
+		return err
+	}
+	orig, wasEmpty := l.buf, l.composer.Empty()
+	l.appendKey(key)
+	var err error
+	l.buf, err = l.encoder.appendFloat32(l.buf, value)
+	if err != nil {
+		l.failValue(orig, wasEmpty, "float rejected", err)
+	}
+	return err
+}
+
+// appendFloat64 appends the float, encoding the non-finite values according
+// to the FloatPolicy of the Encoder.
+func (e *Encoder) appendFloat64(buf []byte, value float64) ([]byte, error) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return e.appendNonFinite(buf, value)
+	}
+	return tokens.AppendFloat64(buf, value), nil
+}
+
+// appendFloat32 appends the float with 32-bit precision, encoding the
+// non-finite values according to the FloatPolicy of the Encoder.
+func (e *Encoder) appendFloat32(buf []byte, value float32) ([]byte, error) {
+	if v := float64(value); math.IsNaN(v) || math.IsInf(v, 0) {
+		return e.appendNonFinite(buf, v)
+	}
+	return tokens.AppendFloat32(buf, value), nil
+}
+
+// appendFloat64Prec appends the float with the given precision, encoding the
+// non-finite values according to the FloatPolicy of the Encoder.
+func (e *Encoder) appendFloat64Prec(buf []byte, value float64, prec int) ([]byte, error) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return e.appendNonFinite(buf, value)
+	}
+	return tokens.AppendFloat64Prec(buf, value, prec), nil
+}
+
+func (e *Encoder) appendNonFinite(buf []byte, value float64) ([]byte, error) {
+	switch {
+	case e.opts.floatPolicy == FloatPolicyError:
+		return buf, ErrNonFiniteFloat
+	case e.opts.floatPolicy == FloatPolicyNull, e.opts.strict, e.opts.jsonCompat:
+		return append(buf, "null"...), nil
+	}
+	return tokens.AppendFloat64(buf, value), nil
+}
@@ -1,11 +1,58 @@
 // Package goldjson provides utilities for handling line-delimited JSON.
 //
 // The main use case of the package is to provide a performant base tool for
-// writing custom log/slog Handlers.
+// writing custom log/slog Handlers. A ready-made Handler is returned by
+// NewHandler (with Go 1.21 or later). The lines can be read back with a
+// Decoder.
+//
+// # Zero-allocation fast path
+//
+// Once the LineWriter pool of an Encoder has warmed up, the following subset
+// of the API performs no heap allocations per line:
+//
+//   - Encoder.NewLine, LineWriter.Discard and LineWriter.End, when the
+//     underlying writer doesn't allocate (e.g. a *bufio.Writer with enough
+//     room, or *os.File)
+//   - LineWriter.EndTo, when the given buffer has enough room
+//   - keys prepared with Encoder.PrepareKey or cached with
+//     WithDynamicKeyCache, as well as keys that need no escaping
+//   - LineWriter.AddString, AddSafeString, AddInt64, AddUint64,
+//     AddInt64String, AddUint64String, AddBool, AddFloat64, AddFloat32,
+//     AddFloat64ListPrec, AddComplex128, AddEnum, AddLevel (for levels
+//     from -8 to 15), AddBytes, AddDurationList, AddStringList,
+//     AddTime and AddTimeList (for valid times), and AddMessagef (for args
+//     that don't allocate when converted to interfaces); with
+//     WithValueCache, AddString only for cached values
+//   - LineWriter.StartRecord, EndRecord, StartList and EndList up to the
+//     depth of 64
+//   - LineWriter.AddStaticFields
+//   - LineWriter.IfVerbose, including the no-op LineWriter it returns
+//   - Layout.NewLine and the LayoutLine methods, except for AddMarshal
+//   - Group.Start and the GroupRecord methods, except for AddMarshal
+//   - Template.NewLine and the TemplateLine methods, except for AddMarshal
+//
+// This is verified by the tests of the package.
+//
+// # Checked build
+//
+// Building with the goldjson_checked build tag, e.g. in CI with
+// go test -tags goldjson_checked ./..., turns misuse of the API into panics:
+//
+//   - using a LineWriter after End or Detach, as with WithUseAfterEndCheck
+//   - EndRecord or EndList without a matching open record or list
+//   - ending a line with records or lists left open, unless in strict mode
+//     (see WithStrict), where End closes them
+//   - lines that are not valid UTF-8, e.g. due to AddSafeString or
+//     AddRawJSON
+//
+// The checked build doesn't pool the LineWriters, so it allocates per line.
+// Without the build tag, the checks are compiled out.
 package goldjson
 
 import (
+	"bufio"
 	"io"
+	"reflect"
 	"sync"
 	"time"
 
@@ -14,67 +61,415 @@ import (
 
 // Encoder is used for encoding line-delimited JSON records.
 type Encoder struct {
-	keys keyStore
-	w    io.Writer
-	p    sync.Pool
+	keys      keyStore
+	w         io.Writer
+	bw        *bufio.Writer
+	closer    io.Closer
+	opts      options
+	str       stringEncoder
+	poolStats *poolStats
+	mu        *sync.Mutex
+	accounts  *byteAccounts
+	schema    *schemaStore
+	sampling  *samplingCounters
+	quotas    *quotas
+	tenants   map[string]*Scope
+	values    *valueCache
+	// suppressed is the Encoder of the lines suppressed by NewLineLevel, see
+	// newSuppressedEncoder.
+	suppressed *Encoder
+	p          sync.Pool
+}
+
+// NewEncoder returns a new Encoder writing to w, configured with the given
+// options (see Option).
+//
+// Wrapping w in a *bufio.Writer is the cheapest way to buffer the lines: the
+// Encoder writes to it without the indirection of the io.Writer interface,
+// and Flush flushes it.
+func NewEncoder(w io.Writer, opts ...Option) *Encoder {
+	return newEncoder(w, nil, buildOptions(opts))
+}
+
+// newEncoder returns a new Encoder writing to w, wrapping w as required by
+// the options. The closer, if any, is closed when the Encoder is closed.
+func newEncoder(w io.Writer, closer io.Closer, opts options) *Encoder {
+	if opts.doubleBuffering > 0 {
+		d := newDoubleBufferedWriter(w, opts.doubleBuffering, opts.flushInterval)
+		w = d
+		closer = closers{d, closer}
+	}
+	e := &Encoder{w: w, closer: closer, opts: opts}
+	// a *bufio.Writer is written to directly, see writeBuffered
+	e.bw, _ = w.(*bufio.Writer)
+	if opts.locking {
+		e.mu = &sync.Mutex{}
+	}
+	if opts.byteAccounting {
+		e.accounts = &byteAccounts{accounts: map[string]*byteAccount{}}
+	}
+	if opts.schemaKey != "" {
+		e.schema = newSchemaStore(opts.schemaFields)
+	}
+	if opts.sampleRateKey != "" || opts.suppressedKey != "" {
+		e.sampling = &samplingCounters{levels: map[int]*levelCounters{}}
+	}
+	if opts.quota != nil && opts.quota.Window > 0 {
+		e.quotas = newQuotas(opts.quota)
+	}
+	e.setup()
+	e.warmPool()
+	return e
 }
 
-// NewEncoder returns a new Encoder.
-func NewEncoder(w io.Writer) *Encoder {
-	return &Encoder{w: w}
+func (e *Encoder) setup() {
+	e.str = newStringEncoder(e.opts)
+	e.keys.str = e.str
+	if e.opts.poolStats {
+		e.poolStats = &poolStats{}
+	}
+	if e.opts.valueCacheSize > 0 {
+		e.values = newValueCache(e.opts.valueCacheSize)
+	}
+	size := e.opts.dynamicKeyCache
+	if p := e.opts.warmProfile; p != nil && size < len(p.Keys) {
+		size = len(p.Keys)
+	}
+	if size > 0 {
+		e.keys.dynamic = newKeyCache(size)
+		e.warmKeys()
+	}
+	if e.opts.hasMinLevel || e.opts.sampler != nil {
+		e.suppressed = newSuppressedEncoder(e.opts)
+	}
 }
 
 // PrepareKey caches the encoded version of a key to make it faster to encode.
 //
-// NOTE: Not thread-safe, MUST only be called before using the Encoder.
+// NOTE: Not thread-safe, MUST only be called before using the Encoder. For
+// keys only known at runtime, see WithDynamicKeyCache.
 func (e *Encoder) PrepareKey(key string) {
 	e.keys.Put(key)
 }
 
 // NewLine creates a new line to be written to the writer.
 func (e *Encoder) NewLine() *LineWriter {
+	return e.newLine('{', '}')
+}
+
+// NewListLine creates a new line whose top-level value is a list instead of
+// a record. The keys of the values added to the line are ignored.
+func (e *Encoder) NewListLine() *LineWriter {
+	return e.newLine('[', ']')
+}
+
+// NewValueLine creates a new line whose top-level value is a single value
+// instead of a record, e.g. a string or a number. The key of the value is
+// ignored.
+//
+// Exactly one value MUST be added to the line before calling End.
+func (e *Encoder) NewValueLine() *LineWriter {
+	return e.newLine(0, 0)
+}
+
+func (e *Encoder) newLine(start, end byte) *LineWriter {
 	l, _ := e.p.Get().(*LineWriter)
+	if e.poolStats != nil {
+		e.poolStats.get(l == nil)
+	}
 	if l == nil {
 		l = &LineWriter{encoder: e}
 	}
-	l.buf = append(l.buf, '{')
-	l.isFirstEntry = 1
+	e.initLine(l, start, end)
 	return l
 }
 
+func (e *Encoder) initLine(l *LineWriter, start, end byte) {
+	l.end = end
+	l.discard = false
+	l.category = ""
+	l.skew = 0
+	l.composer.Reset(start != '{')
+	if start != 0 {
+		l.buf = append(l.buf, start)
+	}
+	if e.opts.checked() {
+		if l.checks == nil {
+			l.checks = newLineChecks(e.opts)
+		} else {
+			l.checks.reset(e.opts)
+		}
+		l.checks.scopes[0].isArray = start != '{'
+	}
+	if e.opts.lineID != nil && start == '{' {
+		l.addLineID()
+	}
+	if e.opts.eventVersionKey != "" && start == '{' {
+		l.addEventVersion()
+	}
+	if e.opts.clockSkew != nil {
+		l.initClockSkew(start == '{')
+	}
+}
+
 // Clone returns a copy that can be safely modified independently from the
 // original.
 func (e *Encoder) Clone() *Encoder {
-	return &Encoder{
-		keys: e.keys.Clone(),
-		w:    e.w,
+	c := &Encoder{
+		keys:     e.keys.Clone(),
+		w:        e.w,
+		bw:       e.bw,
+		closer:   e.closer,
+		opts:     e.opts,
+		mu:       e.mu,
+		accounts: e.accounts,
+		schema:   e.schema,
+		sampling: e.sampling,
+		quotas:   e.quotas,
+	}
+	if e.tenants != nil {
+		c.tenants = make(map[string]*Scope, len(e.tenants))
+		for name, s := range e.tenants {
+			c.tenants[name] = s
+		}
 	}
+	c.setup()
+	return c
+}
+
+// Flush writes any buffered lines to the destination, if the underlying
+// writer of the Encoder is buffered, i.e. implements Flush() error (such as
+// *bufio.Writer).
+func (e *Encoder) Flush() error {
+	if e.mu != nil {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+	}
+	if f, ok := e.w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Reopen reopens the destination of the Encoder, if the underlying writer
+// supports it. This is the case for Encoders created with NewFileEncoder,
+// where Reopen can be used to start writing to a new file after log rotation.
+func (e *Encoder) Reopen() error {
+	if e.mu != nil {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+	}
+	if r, ok := e.w.(interface{ Reopen() error }); ok {
+		return r.Reopen()
+	}
+	return nil
+}
+
+// Close flushes the Encoder and releases the resources owned by it, such as
+// the file opened by NewFileEncoder. Writers passed to NewEncoder are never
+// closed, only flushed.
+//
+// After calling Close, the Encoder can no longer be used.
+func (e *Encoder) Close() error {
+	if e.closer != nil {
+		if e.mu != nil {
+			e.mu.Lock()
+			defer e.mu.Unlock()
+		}
+		return e.closer.Close()
+	}
+	return e.Flush()
+}
+
+type closers []io.Closer
+
+func (c closers) Close() error {
+	var err error
+	for _, closer := range c {
+		if closer == nil {
+			continue
+		}
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
 }
 
 // LineWriter represents a line-delimited JSON record/list.
+//
+// Adding values that can always be encoded (such as strings and numbers)
+// never fails, so the respective Add methods don't return an error. The Add
+// methods for values whose encoding can fail (such as AddTime and AddMarshal)
+// return the error and leave the line as it was before the call, i.e. the
+// failed field is omitted and the line can still be completed normally
+// (unless the Encoder adds placeholders for failed fields, see
+// WithErrorPlaceholders). For call sites where a failure is a programming
+// error, the Must variants of those methods panic instead of returning the
+// error.
 type LineWriter struct {
-	buf          []byte
-	depth        int
-	isFirstEntry uint64
-	isArray      uint64
-	parent       *LineWriter
-	encoder      *Encoder
+	buf      []byte
+	composer tokens.Composer
+	encoder  *Encoder
+	checks   *lineChecks
+	// end is the closing bracket of the top-level value, if any.
+	end byte
+	// discard is set for lines suppressed by NewLineLevel.
+	discard bool
+	// category is the category of the line for WithByteAccounting.
+	category string
+	// emergency is set for lines created by EmergencyLine.
+	emergency bool
+	// skew is the clock skew correction of the line, see WithClockSkew.
+	skew time.Duration
+	// scratch is the buffer the values are formatted into before encoding,
+	// see AddMessagef.
+	scratch []byte
+	// nop is the no-op writer returned by IfVerbose, if any.
+	nop *LineWriter
 }
 
 // End finishes the line and writes it to the underlying writer of the Encoder.
 //
-// To get well-formed JSON, the caller MUST ensure that all inner records have
-// been ended.
+// To get well-formed JSON, the caller MUST ensure that all inner records and
+// lists have been ended.
 //
 // After calling End, the LineWriter can no longer be used.
 //
-// Returns the error from the underlying writer, if any.
+// Short writes are retried until the whole line is written; if the writer
+// fails after writing a part of the line, the returned error is a
+// *PartialWriteError.
+//
+// Returns the error from the underlying writer, if any, or the first key
+// validation error of the line (see WithKeyValidation), or with
+// WithStickyErrors, the first error of the line.
 func (l *LineWriter) End() error {
-	l.buf = append(l.buf, '}', '\n')
-	_, err := l.encoder.w.Write(l.buf)
+	l.finish()
+	if l.emergency {
+		return l.encoder.writeEmergency(l.buf)
+	}
+	var err error
+	if !l.discard {
+		var written bool
+		written, err = l.encoder.writeCounted(l.category, l.buf)
+		if written && err == nil && l.checks != nil {
+			err = l.checks.err
+		}
+	}
+	l.release()
+	return err
+}
+
+// writeCounted writes the line of the category subject to the quota (see
+// WithQuota) and the byte accounting (see WithByteAccounting). Returns false
+// if the line was dropped due to the quota.
+func (e *Encoder) writeCounted(category string, buf []byte) (bool, error) {
+	if !e.allowQuota(category, len(buf)) {
+		return false, nil
+	}
+	err := e.write(buf)
+	if err == nil && e.accounts != nil {
+		e.accounts.add(category, len(buf))
+	}
+	return true, err
+}
+
+// Discard drops the line without writing it, e.g. when building the line
+// fails halfway through. The records and lists of the line don't need to be
+// ended before discarding.
+//
+// After calling Discard, the LineWriter can no longer be used.
+func (l *LineWriter) Discard() {
+	if l.checks != nil {
+		l.checks.checkEnded()
+	}
+	if l.emergency {
+		return
+	}
+	l.release()
+}
+
+// release returns the line to the pool.
+func (l *LineWriter) release() {
+	if l.encoder.opts.useAfterEndCheck {
+		l.markEnded()
+		return
+	}
 	l.buf = l.buf[:0]
+	if l.encoder.poolStats != nil {
+		l.encoder.poolStats.put(cap(l.buf))
+	}
 	l.encoder.p.Put(l)
-	return err
+}
+
+// Detach finishes the line like End, but instead of writing the line to the
+// underlying writer of the Encoder, hands the encoded line, including the
+// trailing newline, over to the caller, e.g. for a queueing layer of its
+// own. The buffer of the line is not returned to the pool, so the caller is
+// free to retain it.
+//
+// Returns nil if the line was suppressed by NewLineLevel. Key validation
+// errors are not reported.
+//
+// After calling Detach, the LineWriter can no longer be used.
+func (l *LineWriter) Detach() []byte {
+	l.finish()
+	var buf []byte
+	if !l.discard {
+		buf = l.buf
+	}
+	l.buf = nil
+	if l.encoder.opts.useAfterEndCheck {
+		l.markEnded()
+	}
+	return buf
+}
+
+// EndTo finishes the line like End, but instead of writing the line to the
+// underlying writer of the Encoder, appends the encoded line, including the
+// trailing newline, to buf and returns the extended buffer, e.g. for routing
+// the lines to a ring buffer or a message queue. Unlike Detach, EndTo
+// returns the buffer of the line to the pool, so the lines can be encoded
+// into a reused buffer without allocating.
+//
+// If the line was suppressed by NewLineLevel, buf is returned as is.
+// Otherwise returns the first key validation error of the line (see
+// WithKeyValidation), or with WithStickyErrors, the first error of the line.
+//
+// After calling EndTo, the LineWriter can no longer be used.
+func (l *LineWriter) EndTo(buf []byte) ([]byte, error) {
+	l.finish()
+	var err error
+	if !l.discard {
+		buf = append(buf, l.buf...)
+		if l.checks != nil {
+			err = l.checks.err
+		}
+	}
+	if !l.emergency {
+		l.release()
+	}
+	return buf, err
+}
+
+func (l *LineWriter) finish() {
+	if l.checks != nil {
+		l.checks.checkEnded()
+		l.endChecks()
+		if l.checks.schema && l.end == '}' && len(l.checks.entries) > 0 {
+			l.encoder.schema.observe(l.buf, l.checks.entries)
+		}
+		if l.checks.trailer && l.end == '}' {
+			l.appendTrailer()
+		}
+	}
+	if l.end != 0 {
+		l.buf = append(l.buf, l.end)
+	}
+	l.buf = append(l.buf, '\n')
+	if checkedBuild {
+		l.assertLine()
+	}
 }
 
 // AddString adds a key-value pair with a string value to the active
@@ -82,8 +477,61 @@ func (l *LineWriter) End() error {
 //
 // If a list is currently active, the key will be ignored.
 func (l *LineWriter) AddString(key, value string) {
+	if l.encoder.opts.replaceValue != nil {
+		if ok, _ := l.replaceValue(key, KindString, value); ok {
+			return
+		}
+	}
+	if l.checkKey(key) != nil {
+		return
+	}
+	l.appendKey(key)
+	l.buf = l.encoder.appendStringValue(l.buf, value)
+}
+
+// AddStack adds a key-value pair with the stack of the calling goroutine as
+// the value to the active record/list. The stack is encoded as a list of
+// strings in the form "file:line function", innermost frame first (see
+// tokens.AppendStack).
+//
+// The argument skip is the number of frames to skip, with 0 identifying the
+// caller of AddStack.
+//
+// If a list is currently active, the key will be ignored.
+func (l *LineWriter) AddStack(key string, skip int) {
+	if l.checkKey(key) != nil {
+		return
+	}
+	l.appendKey(key)
+	l.buf = l.encoder.str.AppendStack(l.buf, skip+1)
+}
+
+// AddSafeString adds a key-value pair with a string value that is known to
+// need no escaping to the active record/list. The value is copied as is, so
+// the caller MUST ensure that it contains no quotes, backslashes, control
+// characters or invalid UTF-8, otherwise the output will be malformed.
+//
+// This is useful for avoiding the escaping cost for values such as
+// identifiers, enum names and pre-formatted numbers.
+//
+// If a list is currently active, the key will be ignored.
+func (l *LineWriter) AddSafeString(key, value string) {
+	if l.encoder.opts.replaceValue != nil {
+		if ok, _ := l.replaceValue(key, KindString, value); ok {
+			return
+		}
+	}
+	if l.checkKey(key) != nil {
+		return
+	}
 	l.appendKey(key)
-	l.buf = tokens.AppendString(l.buf, value)
+	if l.encoder.opts.strict {
+		l.buf = l.encoder.str.AppendValue(l.buf, value)
+		return
+	}
+	l.buf = append(l.buf, '"')
+	l.buf = append(l.buf, value...)
+	l.buf = append(l.buf, '"')
 }
 
 // AddInt64 adds a key-value pair with an int64 value to the active
@@ -91,8 +539,16 @@ func (l *LineWriter) AddString(key, value string) {
 //
 // If a list is currently active, the key will be ignored.
 func (l *LineWriter) AddInt64(key string, value int64) {
+	if l.encoder.opts.replaceValue != nil {
+		if ok, _ := l.replaceValue(key, KindInt64, value); ok {
+			return
+		}
+	}
+	if l.checkKey(key) != nil {
+		return
+	}
 	l.appendKey(key)
-	l.buf = tokens.AppendInt64(l.buf, value)
+	l.buf = l.encoder.appendInt64(l.buf, value)
 }
 
 // AddUint64 adds a key-value pair with a uint64 value to the active
@@ -100,14 +556,30 @@ func (l *LineWriter) AddInt64(key string, value int64) {
 //
 // If a list is currently active, the key will be ignored.
 func (l *LineWriter) AddUint64(key string, value uint64) {
+	if l.encoder.opts.replaceValue != nil {
+		if ok, _ := l.replaceValue(key, KindUint64, value); ok {
+			return
+		}
+	}
+	if l.checkKey(key) != nil {
+		return
+	}
 	l.appendKey(key)
-	l.buf = tokens.AppendUint64(l.buf, value)
+	l.buf = l.encoder.appendUint64(l.buf, value)
 }
 
 // AddBool adds a key-value pair with a bool value to the active record/list.
 //
 // If a list is currently active, the key will be ignored.
 func (l *LineWriter) AddBool(key string, value bool) {
+	if l.encoder.opts.replaceValue != nil {
+		if ok, _ := l.replaceValue(key, KindBool, value); ok {
+			return
+		}
+	}
+	if l.checkKey(key) != nil {
+		return
+	}
 	l.appendKey(key)
 	l.buf = tokens.AppendBool(l.buf, value)
 }
@@ -115,21 +587,46 @@ func (l *LineWriter) AddBool(key string, value bool) {
 // AddFloat64 adds a key-value pair with a float64 value to the active
 // record/list.
 //
+// Non-finite values (NaN and infinities) are handled according to the
+// FloatPolicy of the Encoder, see WithFloatPolicy.
+//
 // If a list is currently active, the key will be ignored.
 func (l *LineWriter) AddFloat64(key string, value float64) {
-	l.appendKey(key)
-	l.buf = tokens.AppendFloat64(l.buf, value)
+	_ = l.addFloat64(key, value)
+}
+
+// AddFloat32 adds a key-value pair with a float32 value to the active
+// record/list, formatted with 32-bit precision (see tokens.AppendFloat32),
+// e.g. 0.1 instead of the 0.10000000149011612 of AddFloat64.
+//
+// Non-finite values (NaN and infinities) are handled according to the
+// FloatPolicy of the Encoder, see WithFloatPolicy.
+//
+// If a list is currently active, the key will be ignored.
+func (l *LineWriter) AddFloat32(key string, value float32) {
+	_ = l.addFloat32(key, value)
 }
 
 // AddTime adds a key-value pair with a time.Time value to the active
 // record/list.
+//
+// Times whose year is outside of the range [0,9999] are handled according to
+// the TimePolicy of the Encoder, see WithTimePolicy.
 func (l *LineWriter) AddTime(key string, value time.Time) error {
-	orig := l.buf
+	if l.encoder.opts.replaceValue != nil {
+		if ok, err := l.replaceValue(key, KindTime, value); ok {
+			return err
+		}
+	}
+	if err := l.checkKey(key); err != nil {
+		return err
+	}
+	orig, wasEmpty := l.buf, l.composer.Empty()
 	l.appendKey(key)
 	var err error
-	l.buf, err = tokens.AppendTime(l.buf, value)
+	l.buf, err = l.encoder.appendTime(l.buf, l.skewed(value))
 	if err != nil {
-		l.buf = orig
+		l.failValue(orig, wasEmpty, "time encoding failed", err)
 		return err
 	}
 	return err
@@ -137,18 +634,106 @@ func (l *LineWriter) AddTime(key string, value time.Time) error {
 
 // AddMarshal adds a key-value pair with a JSON value to the active
 // record/list.
+//
+// A json.RawMessage value is added like with AddRawJSON instead of being
+// re-encoded.
 func (l *LineWriter) AddMarshal(key string, value any) error {
-	orig := l.buf
+	if l.encoder.opts.replaceValue != nil {
+		if ok, err := l.replaceValue(key, KindAny, value); ok {
+			return err
+		}
+	}
+	if err := l.checkKey(key); err != nil {
+		return err
+	}
+	orig, wasEmpty := l.buf, l.composer.Empty()
 	l.appendKey(key)
 	var err error
-	l.buf, err = tokens.AppendMarshal(l.buf, value)
+	l.buf, err = l.encoder.appendMarshal(l.buf, value)
 	if err != nil {
-		l.buf = orig
+		l.failValue(orig, wasEmpty, "marshal failed", err)
 		return err
 	}
 	return nil
 }
 
+// AddBytes adds a key-value pair with a byte slice value encoded as a
+// string in standard base64 (see tokens.AppendBase64) to the active
+// record/list, like encoding/json encodes []byte values, except that a nil
+// value is encoded as an empty string instead of null.
+//
+// If a list is currently active, the key will be ignored.
+func (l *LineWriter) AddBytes(key string, value []byte) {
+	if l.encoder.opts.replaceValue != nil {
+		// the copy keeps the value from escaping to the heap when there's
+		// no hook, and the hook from retaining the buffer of the caller
+		if ok, _ := l.replaceValue(key, KindBytes, append([]byte(nil), value...)); ok {
+			return
+		}
+	}
+	if l.checkKey(key) != nil {
+		return
+	}
+	l.appendKey(key)
+	l.buf = tokens.AppendBase64(l.buf, value)
+}
+
+// MustAddTime is like AddTime, but panics if the value cannot be encoded.
+func (l *LineWriter) MustAddTime(key string, value time.Time) {
+	if err := l.AddTime(key, value); err != nil {
+		panic(err)
+	}
+}
+
+// MustAddMarshal is like AddMarshal, but panics if the value cannot be
+// encoded.
+func (l *LineWriter) MustAddMarshal(key string, value any) {
+	if err := l.AddMarshal(key, value); err != nil {
+		panic(err)
+	}
+}
+
+// AddErrorChain adds a key-value pair with a list of the errors in the chain
+// of err to the active record/list. Each error in the chain is represented as
+// a record with the type and the message of the error.
+//
+// The chain is walked depth-first, following both errors.Unwrap and the
+// Unwrap() []error method used by errors.Join. A nil err is encoded as null.
+//
+// If a list is currently active, the key will be ignored.
+func (l *LineWriter) AddErrorChain(key string, err error) {
+	if err == nil {
+		if l.checkKey(key) != nil {
+			return
+		}
+		l.appendKey(key)
+		l.buf = append(l.buf, "null"...)
+		return
+	}
+	l.StartList(key)
+	l.appendErrorChain(err)
+	l.EndList()
+}
+
+func (l *LineWriter) appendErrorChain(err error) {
+	l.StartRecord("")
+	l.AddString("type", reflect.TypeOf(err).String())
+	l.AddString("message", err.Error())
+	l.EndRecord()
+	switch u := err.(type) {
+	case interface{ Unwrap() error }:
+		if inner := u.Unwrap(); inner != nil {
+			l.appendErrorChain(inner)
+		}
+	case interface{ Unwrap() []error }:
+		for _, inner := range u.Unwrap() {
+			if inner != nil {
+				l.appendErrorChain(inner)
+			}
+		}
+	}
+}
+
 // StartRecord creates a new key-value pair to the active record/list with a
 // record type.
 //
@@ -156,36 +741,72 @@ func (l *LineWriter) AddMarshal(key string, value any) error {
 //
 // EndRecord MUST be called after all the pairs of the record have been added.
 func (l *LineWriter) StartRecord(key string) {
-	l.appendKey(key)
-	l.buf = append(l.buf, '{')
-	if l.depth == 63 {
-		parent := &LineWriter{}
-		*parent = *l
-		*l = LineWriter{
-			buf:          l.buf,
-			isFirstEntry: 1,
-			depth:        0,
-			parent:       parent,
-			encoder:      l.encoder,
-		}
-		return
+	if l.checks != nil {
+		l.startScope(key, false)
 	}
-	l.depth++
-	l.isFirstEntry = l.isFirstEntry | (1 << l.depth)
-	l.isArray = l.isArray & ^(1 << l.depth)
+	l.appendKey(key)
+	l.buf = l.composer.Start(l.buf, false)
 }
 
 // EndRecord closes the active record.
 //
 // If the active record is the top-level record, this function will panic.
 func (l *LineWriter) EndRecord() {
-	l.depth--
-	if l.depth == -1 {
-		parent := l.parent
-		parent.buf = l.buf
-		*l = *parent
+	if l.checks != nil {
+		l.checks.checkEnded()
+	}
+	if checkedBuild {
+		l.assertEndScope(false)
+	}
+	l.buf = l.composer.EndRecord(l.buf)
+	if l.checks != nil {
+		l.endScope()
+	}
+}
+
+// EndRecordOmitEmpty closes the active record like EndRecord, but if nothing
+// was added to the record, removes the record along with its key as if it
+// had never been started, e.g. for omitting empty groups of log/slog.
+func (l *LineWriter) EndRecordOmitEmpty() {
+	empty := l.composer.Empty()
+	if l.checks != nil && l.checks.scopes[len(l.checks.scopes)-1].discardFrom != -1 {
+		// the record is discarded anyway
+		empty = false
+	}
+	l.EndRecord()
+	if !empty {
+		return
+	}
+	l.buf = l.buf[:len(l.buf)-2]
+	if !l.composer.InList() {
+		// remove the key, i.e. the quoted string before the colon
+		end := len(l.buf) - 2
+		start := end - 1
+		for ; start > 0; start-- {
+			if l.buf[start] == '"' && !isEscaped(l.buf[:start]) {
+				break
+			}
+		}
+		l.buf = l.buf[:start]
+	}
+	if n := len(l.buf) - 1; n >= 0 && l.buf[n] == ',' {
+		l.buf = l.buf[:n]
+	} else {
+		l.composer.SetEmpty()
+	}
+	if l.checks != nil {
+		l.checks.omitLastKey()
 	}
-	l.buf = append(l.buf, '}')
+}
+
+// isEscaped tells whether the byte after buf is escaped, i.e. preceded by an
+// odd number of backslashes.
+func isEscaped(buf []byte) bool {
+	n := 0
+	for i := len(buf) - 1; i >= 0 && buf[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
 }
 
 // StartList creates a new key-value pair to the active record with a list
@@ -193,54 +814,50 @@ func (l *LineWriter) EndRecord() {
 //
 // EndList MUST be called after all the values of the list have been added.
 func (l *LineWriter) StartList(key string) {
-	l.appendKey(key)
-	l.buf = append(l.buf, '[')
-	if l.depth == 63 {
-		parent := &LineWriter{}
-		*parent = *l
-		*l = LineWriter{
-			buf:          l.buf,
-			isFirstEntry: 1,
-			isArray:      1,
-			depth:        0,
-			parent:       parent,
-		}
-		return
+	if l.checks != nil {
+		l.startScope(key, true)
 	}
-	l.depth++
-	l.isFirstEntry = l.isFirstEntry | (1 << l.depth)
-	l.isArray = l.isArray | (1 << l.depth)
+	l.appendKey(key)
+	l.buf = l.composer.Start(l.buf, true)
 }
 
 // EndList closes the active list.
 func (l *LineWriter) EndList() {
-	l.depth--
-	if l.depth == -1 {
-		parent := l.parent
-		parent.buf = l.buf
-		*l = *parent
+	if l.checks != nil {
+		l.checks.checkEnded()
+	}
+	if checkedBuild {
+		l.assertEndScope(true)
+	}
+	l.buf = l.composer.EndList(l.buf)
+	if l.checks != nil {
+		l.endScope()
 	}
-	l.buf = append(l.buf, ']')
 }
 
 // AddStaticFields adds StaticFields to the active record.
 func (l *LineWriter) AddStaticFields(staticFields *StaticFields) {
+	if len(staticFields.buf) == 0 {
+		return
+	}
+	if l.checks != nil {
+		if l.checks.failed() {
+			return
+		}
+		l.checks.addKnownKeys(staticFields.keys)
+	}
 	l.separator()
 	l.buf = append(l.buf, staticFields.buf...)
 }
 
 func (l *LineWriter) appendKey(key string) {
 	l.separator()
-	if l.isArray&(1<<l.depth) == 0 {
+	if !l.composer.InList() {
 		l.buf = l.encoder.keys.Append(l.buf, key)
 		l.buf = append(l.buf, ':')
 	}
 }
 
 func (l *LineWriter) separator() {
-	if l.isFirstEntry&(1<<l.depth) == 0 {
-		l.buf = append(l.buf, ',')
-	} else {
-		l.isFirstEntry = l.isFirstEntry ^ (1 << l.depth)
-	}
+	l.buf = l.composer.AppendSeparator(l.buf)
 }
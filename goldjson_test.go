@@ -1,16 +1,30 @@
 package goldjson_test
 
 import (
+	"bufio"
 	"bytes"
+	"compress/flate"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"math"
 	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
 	"time"
 	"unicode/utf8"
 
 	"github.com/jussi-kalliokoski/goldjson"
+	"github.com/jussi-kalliokoski/goldjson/tokens"
 )
 
 func TestWidth(t *testing.T) {
@@ -304,6 +318,75 @@ func TestPreparedKeys(t *testing.T) {
 	}
 }
 
+func TestDynamicKeyCache(t *testing.T) {
+	long := strings.Repeat("k\n", 200)
+	keys := []string{"a", "b\n", "c", "a", long, "d\"", "b\n", long, "e", "a"}
+	tests := []struct {
+		name       string
+		maxEntries int
+		opts       []goldjson.Option
+	}{
+		{"full", 2, nil},
+		{"large", 100, nil},
+		{"escape slash", 100, []goldjson.Option{goldjson.WithEscapeSlash()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var expectedBuf, receivedBuf bytes.Buffer
+			uncached := goldjson.NewEncoder(&expectedBuf, tt.opts...)
+			cached := goldjson.NewEncoder(&receivedBuf, append(tt.opts, goldjson.WithDynamicKeyCache(tt.maxEntries))...)
+
+			for _, enc := range []*goldjson.Encoder{uncached, cached} {
+				fields, fieldsWriter := enc.NewStaticFields()
+				fieldsWriter.AddString("a/", "b")
+				_ = fieldsWriter.End()
+				for i := 0; i < 2; i++ {
+					line := enc.NewLineWith(fields)
+					for j, key := range keys {
+						line.AddInt64(key, int64(j))
+					}
+					line.StartRecord("r/")
+					line.AddString("a/", "b")
+					line.EndRecord()
+					_ = line.End()
+				}
+			}
+			expected := expectedBuf.String()
+			received := receivedBuf.String()
+
+			expectEqual(t, expected, received)
+		})
+	}
+
+	t.Run("concurrent", func(t *testing.T) {
+		const goroutines = 8
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf, goldjson.WithLocking(), goldjson.WithDynamicKeyCache(4))
+
+		var wg sync.WaitGroup
+		for i := 0; i < goroutines; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					line := enc.NewLine()
+					line.AddInt64(keys[j%len(keys)], int64(j))
+					_ = line.End()
+				}
+			}()
+		}
+		wg.Wait()
+		lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+
+		expectEqual(t, goroutines*100, len(lines))
+		for _, line := range lines {
+			var record map[string]int64
+			expectNoError(t, json.Unmarshal([]byte(line), &record))
+		}
+	})
+}
+
 func TestStaticFields(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -311,47 +394,4554 @@ func TestStaticFields(t *testing.T) {
 		expected string
 	}{
 		{
-			"in first position",
+			"in first position",
+			func(l *goldjson.LineWriter) {
+				f, fw := goldjson.NewStaticFields()
+				_ = fw.AddMarshal("a", map[string]string{"b": "c"})
+				_ = fw.End()
+				l.AddStaticFields(f)
+			},
+			`{"a":{"b":"c"}}`,
+		},
+		{
+			"in second position",
+			func(l *goldjson.LineWriter) {
+				f, fw := goldjson.NewStaticFields()
+				_ = fw.AddMarshal("c", map[string]string{"x": "y"})
+				_ = fw.End()
+				l.AddString("a", "b")
+				l.AddStaticFields(f)
+			},
+			`{"a":"b","c":{"x":"y"}}`,
+		},
+		{
+			"with trailing fields",
+			func(l *goldjson.LineWriter) {
+				f, fw := goldjson.NewStaticFields()
+				_ = fw.AddMarshal("a", map[string]string{"x": "y"})
+				_ = fw.End()
+				l.AddStaticFields(f)
+				l.AddString("b", "c")
+			},
+			`{"a":{"x":"y"},"b":"c"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf)
+			expected := tt.expected + "\n"
+
+			line := enc.NewLine()
+			tt.build(line)
+			_ = line.End()
+			received := buf.String()
+
+			expectEqual(t, expected, received)
+		})
+	}
+
+	t.Run("new line with", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf, goldjson.WithStrict())
+		f, fw := enc.NewStaticFields()
+		fw.AddString("a", "b")
+		_ = fw.End()
+		expected := `{"a":"b","c":"d"}` + "\n"
+
+		line := enc.NewLineWith(f)
+		line.AddString("a", "duplicate")
+		line.AddString("c", "d")
+		_ = line.End()
+		received := buf.String()
+
+		expectEqual(t, expected, received)
+	})
+
+	t.Run("clone and merge", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf, goldjson.WithStrict())
+		newFields := func(key, value string) *goldjson.StaticFields {
+			f, fw := enc.NewStaticFields()
+			if key != "" {
+				fw.AddString(key, value)
+			}
+			_ = fw.End()
+			return f
+		}
+		a, c, empty := newFields("a", "b"), newFields("c", "d"), newFields("", "")
+		expected := `{"a":"b","c":"d"}` + "\n" +
+			`{"c":"d","a":"b"}` + "\n" +
+			`{"a":"b"}` + "\n" +
+			`{"c":"d","a":"duplicate"}` + "\n" +
+			`{"a":"b"}` + "\n"
+
+		merged := a.Merge(c)
+		for _, f := range []*goldjson.StaticFields{merged, c.Merge(a), a.Merge(empty), empty.Merge(c), a.Clone()} {
+			line := enc.NewLineWith(f)
+			line.AddString("a", "duplicate")
+			_ = line.End()
+		}
+		received := buf.String()
+
+		expectEqual(t, expected, received)
+	})
+
+	t.Run("extend", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf, goldjson.WithEscapeSlash())
+		f, fw := enc.NewStaticFields()
+		fw.AddString("a", "/")
+		_ = fw.End()
+		expected := `{"a":"\/","b":"\/"}` + "\n" + `{"a":"\/"}` + "\n"
+
+		extended, ew := f.Extend()
+		ew.AddString("b", "/")
+		_ = ew.End()
+		for _, f := range []*goldjson.StaticFields{extended, f} {
+			line := enc.NewLineWith(f)
+			_ = line.End()
+		}
+		received := buf.String()
+
+		expectEqual(t, expected, received)
+	})
+
+	t.Run("extend package-level", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf)
+		f, fw := goldjson.NewStaticFields()
+		fw.AddString("a", "b")
+		_ = fw.End()
+		expected := `{"a":"b","c":"d"}` + "\n"
+
+		extended, ew := f.Extend()
+		ew.AddString("c", "d")
+		_ = ew.End()
+		line := enc.NewLineWith(extended)
+		_ = line.End()
+		received := buf.String()
+
+		expectEqual(t, expected, received)
+	})
+}
+
+func TestPrepareKeysFromStruct(t *testing.T) {
+	type Embedded struct {
+		Promoted string `json:"promoted"`
+	}
+	type Node struct {
+		Embedded
+		Name     string `json:"name,omitempty"`
+		Untagged int
+		Ignored  bool    `json:"-"`
+		Children []*Node `json:"children"`
+		hidden   string
+	}
+	var buf bytes.Buffer
+	enc := goldjson.NewEncoder(&buf)
+	nodeType := reflect.TypeOf(Node{})
+	tagName := func(name string) string {
+		f, _ := nodeType.FieldByName(name)
+		key, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		return key
+	}
+	expected := `{"name":"a","Untagged":1,"promoted":"b","children":[]}` + "\n"
+
+	enc.PrepareKeysFromStruct(&Node{hidden: ""})
+	enc.PrepareKeysFromStruct(nil)
+	enc.PrepareKeysFromStruct(1)
+	line := enc.NewLine()
+	line.AddString(tagName("Name"), "a")
+	line.AddInt64(nodeType.Field(2).Name, 1)
+	line.AddString(tagName("Promoted"), "b")
+	line.StartList(tagName("Children"))
+	line.EndList()
+	_ = line.End()
+	received := buf.String()
+
+	expectEqual(t, expected, received)
+}
+
+func TestTimePolicy(t *testing.T) {
+	past := time.Date(-1, 06, 12, 20, 42, 15, 0, baseZone)
+	future := time.Date(10000, 06, 12, 20, 42, 15, 0, baseZone)
+	tests := []struct {
+		name     string
+		policy   goldjson.TimePolicy
+		expected string
+	}{
+		{"error", goldjson.TimePolicyError, `{"valid":"2023-06-12T20:42:15.152952812Z"}`},
+		{"clamp", goldjson.TimePolicyClamp, `{"valid":"2023-06-12T20:42:15.152952812Z","past":"0000-01-01T00:00:00Z","future":"9999-12-31T23:59:59.999999999Z"}`},
+		{"unix", goldjson.TimePolicyUnix, `{"valid":"2023-06-12T20:42:15.152952812Z","past":-62184683865,"future":253416458535}`},
+		{"extended year", goldjson.TimePolicyExtendedYear, `{"valid":"2023-06-12T20:42:15.152952812Z","past":"-000001-06-12T20:42:15Z","future":"+010000-06-12T20:42:15Z"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf, goldjson.WithTimePolicy(tt.policy))
+			expected := tt.expected + "\n"
+
+			line := enc.NewLine()
+			validErr := line.AddTime("valid", baseTime)
+			pastErr := line.AddTime("past", past)
+			futureErr := line.AddTime("future", future)
+			_ = line.End()
+			received := buf.String()
+
+			expectNoError(t, validErr)
+			if tt.policy == goldjson.TimePolicyError {
+				expectError(t, pastErr)
+				expectError(t, futureErr)
+			} else {
+				expectNoError(t, pastErr)
+				expectNoError(t, futureErr)
+			}
+			expectEqual(t, expected, received)
+		})
+	}
+}
+
+func TestFloatPolicy(t *testing.T) {
+	placeholder := `{"!error":"float rejected: goldjson: non-finite float"}`
+	tests := []struct {
+		name     string
+		opts     []goldjson.Option
+		expected string
+		err      error
+	}{
+		{
+			"string",
+			nil,
+			`{"layout":"+Inf","valid":0.5,"nan":"NaN","inf":"+Inf","list":[1,"-Inf"],"complex":{"re":"NaN","im":0}}`,
+			nil,
+		},
+		{
+			"string in strict mode",
+			[]goldjson.Option{goldjson.WithStrict()},
+			`{"layout":null,"valid":0.5,"nan":null,"inf":null,"list":[1,null],"complex":{"re":null,"im":0}}`,
+			nil,
+		},
+		{
+			"null",
+			[]goldjson.Option{goldjson.WithFloatPolicy(goldjson.FloatPolicyNull)},
+			`{"layout":null,"valid":0.5,"nan":null,"inf":null,"list":[1,null],"complex":{"re":null,"im":0}}`,
+			nil,
+		},
+		{
+			"error",
+			[]goldjson.Option{goldjson.WithFloatPolicy(goldjson.FloatPolicyError)},
+			`{"valid":0.5}`,
+			goldjson.ErrNonFiniteFloat,
+		},
+		{
+			"error with placeholders",
+			[]goldjson.Option{goldjson.WithFloatPolicy(goldjson.FloatPolicyError), goldjson.WithErrorPlaceholders()},
+			`{"layout":` + placeholder + `,"valid":0.5,"nan":` + placeholder + `,"inf":` + placeholder + `,"list":` + placeholder + `,"complex":` + placeholder + `}`,
+			goldjson.ErrNonFiniteFloat,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			opts := append([]goldjson.Option{goldjson.WithComplexFormat(goldjson.ComplexFormatRecord)}, tt.opts...)
+			enc := goldjson.NewEncoder(&buf, opts...)
+			layout := enc.NewLayout("layout")
+			expected := tt.expected + "\n"
+
+			l := layout.NewLine()
+			l.AddFloat64(math.Inf(1))
+			line := l.Line()
+			line.AddFloat64("valid", 0.5)
+			line.AddFloat64("nan", math.NaN())
+			line.AddFloat32("inf", float32(math.Inf(1)))
+			line.AddFloat64ListPrec("list", []float64{1, math.Inf(-1)}, -1)
+			line.AddComplex128("complex", complex(math.NaN(), 0))
+			err := line.End()
+			received := buf.String()
+
+			expectEqual(t, tt.err, err)
+			expectEqual(t, expected, received)
+		})
+	}
+
+	t.Run("AddAny", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf, goldjson.WithFloatPolicy(goldjson.FloatPolicyError))
+		expected := `{"valid":[0.5]}` + "\n"
+
+		line := enc.NewLine()
+		validErr := line.AddAny("valid", []float64{0.5})
+		floatErr := line.AddAny("float", math.NaN())
+		listErr := line.AddAny("list", []float64{math.NaN()})
+		_ = line.End()
+		received := buf.String()
+
+		expectNoError(t, validErr)
+		expectEqual(t, goldjson.ErrNonFiniteFloat, floatErr)
+		expectEqual(t, goldjson.ErrNonFiniteFloat, listErr)
+		expectEqual(t, expected, received)
+	})
+}
+
+func TestAddFloat32(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    float32
+		expected string
+	}{
+		{"zero", 0, `0`},
+		{"fraction", 0.1, `0.1`},
+		{"negative", -123.456, `-123.456`},
+		{"small", 1e-7, `1e-7`},
+		{"large", 1e21, `1e+21`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf)
+			expected := `{"value":` + tt.expected + `,"any":` + tt.expected + `}` + "\n"
+
+			line := enc.NewLine()
+			line.AddFloat32("value", tt.value)
+			err := line.AddAny("any", tt.value)
+			_ = line.End()
+			received := buf.String()
+
+			expectNoError(t, err)
+			expectEqual(t, expected, received)
+		})
+	}
+}
+
+func TestTimeList(t *testing.T) {
+	future := time.Date(10000, 06, 12, 20, 42, 15, 0, baseZone)
+	tests := []struct {
+		name     string
+		opts     []goldjson.Option
+		values   []time.Time
+		expected string
+		err      bool
+	}{
+		{"empty", nil, nil, `{"a":"b","list":[]}`, false},
+		{"valid", nil, []time.Time{baseTime, baseTime.Add(time.Second)}, `{"a":"b","list":["2023-06-12T20:42:15.152952812Z","2023-06-12T20:42:16.152952812Z"]}`, false},
+		{"invalid", nil, []time.Time{baseTime, future}, `{"a":"b"}`, true},
+		{"invalid with policy", []goldjson.Option{goldjson.WithTimePolicy(goldjson.TimePolicyUnix)}, []time.Time{future}, `{"a":"b","list":[253416458535]}`, false},
+		{"invalid with placeholders", []goldjson.Option{goldjson.WithErrorPlaceholders()}, []time.Time{baseTime, future}, `{"a":"b","list":{"!error":"time encoding failed: time.Time year outside of range [0,9999]"}}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf, tt.opts...)
+			expected := tt.expected + "\n"
+
+			line := enc.NewLine()
+			line.AddString("a", "b")
+			err := line.AddTimeList("list", tt.values)
+			_ = line.End()
+			received := buf.String()
+
+			expectEqual(t, tt.err, err != nil)
+			expectEqual(t, expected, received)
+		})
+	}
+
+	t.Run("first entry", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf)
+
+		line := enc.NewLine()
+		err := line.AddTimeList("list", []time.Time{future})
+		line.AddString("a", "b")
+		_ = line.End()
+		received := buf.String()
+
+		expectError(t, err)
+		expectEqual(t, `{"a":"b"}`+"\n", received)
+	})
+}
+
+func TestDurationList(t *testing.T) {
+	var buf bytes.Buffer
+	enc := goldjson.NewEncoder(&buf)
+	expected := `{"list":["0s","1.5ms","-2µs","1h2m0.5s"],"empty":[]}` + "\n"
+
+	line := enc.NewLine()
+	line.AddDurationList("list", []time.Duration{0, 1500 * time.Microsecond, -2 * time.Microsecond, time.Hour + 2*time.Minute + 500*time.Millisecond})
+	line.AddDurationList("empty", nil)
+	_ = line.End()
+	received := buf.String()
+
+	expectEqual(t, expected, received)
+}
+
+func TestLocking(t *testing.T) {
+	const goroutines = 8
+	const linesPerGoroutine = 100
+	var buf bytes.Buffer
+	w := bufio.NewWriterSize(&buf, 64)
+	enc := goldjson.NewEncoder(w, goldjson.WithLocking())
+	clone := enc.Clone()
+
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			e := enc
+			if i%2 == 1 {
+				e = clone
+			}
+			for j := 0; j < linesPerGoroutine; j++ {
+				line := e.NewLine()
+				line.AddInt64("goroutine", int64(i))
+				line.AddInt64("line", int64(j))
+				line.AddString("padding", "abcdefghijklmnopqrstuvwxyz")
+				_ = line.End()
+			}
+			_ = e.Flush()
+		}(i)
+	}
+	wg.Wait()
+	flushErr := enc.Flush()
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+
+	expectNoError(t, flushErr)
+	expectEqual(t, goroutines*linesPerGoroutine, len(lines))
+	next := make([]int64, goroutines)
+	for _, line := range lines {
+		var record struct {
+			Goroutine int64 `json:"goroutine"`
+			Line      int64 `json:"line"`
+		}
+		expectNoError(t, json.Unmarshal([]byte(line), &record))
+		expectEqual(t, next[record.Goroutine], record.Line)
+		next[record.Goroutine]++
+	}
+}
+
+func TestHealth(t *testing.T) {
+	t.Run("not a health checker", func(t *testing.T) {
+		enc := goldjson.NewEncoder(io.Discard)
+
+		err := enc.Health()
+
+		expectNoError(t, err)
+	})
+
+	t.Run("health checker", func(t *testing.T) {
+		w := healthWriter{err: errors.New("disconnected")}
+		enc := goldjson.NewEncoder(w)
+
+		err := enc.Health()
+
+		expectEqual(t, w.err, err)
+	})
+}
+
+type healthWriter struct {
+	err error
+}
+
+func (w healthWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w healthWriter) Health() error               { return w.err }
+
+func TestPartialWrites(t *testing.T) {
+	t.Run("short writes", func(t *testing.T) {
+		w := &chunkWriter{chunk: 3}
+		enc := goldjson.NewEncoder(w)
+
+		line := enc.NewLine()
+		line.AddString("hello", "world")
+		err := line.End()
+
+		expectNoError(t, err)
+		expectEqual(t, `{"hello":"world"}`+"\n", w.buf.String())
+	})
+
+	t.Run("retriable error", func(t *testing.T) {
+		w := &chunkWriter{chunk: 3, err: timeoutError{}}
+		enc := goldjson.NewEncoder(w)
+
+		line := enc.NewLine()
+		line.AddString("hello", "world")
+		err := line.End()
+
+		expectNoError(t, err)
+		expectEqual(t, `{"hello":"world"}`+"\n", w.buf.String())
+	})
+
+	t.Run("no progress", func(t *testing.T) {
+		w := &chunkWriter{chunk: 3, limit: 6}
+		enc := goldjson.NewEncoder(w)
+
+		line := enc.NewLine()
+		line.AddString("hello", "world")
+		err := line.End()
+
+		var partial *goldjson.PartialWriteError
+		expectEqual(t, true, errors.As(err, &partial))
+		expectEqual(t, 6, partial.Written)
+		expectEqual(t, 18, partial.Size)
+		expectEqual(t, true, errors.Is(err, io.ErrShortWrite))
+	})
+
+	t.Run("hard failure", func(t *testing.T) {
+		w := &chunkWriter{chunk: 3, err: errors.New("broken pipe")}
+		enc := goldjson.NewEncoder(w)
+
+		line := enc.NewLine()
+		line.AddString("hello", "world")
+		err := line.End()
+
+		var partial *goldjson.PartialWriteError
+		expectEqual(t, true, errors.As(err, &partial))
+		expectEqual(t, 3, partial.Written)
+		expectEqual(t, w.err, partial.Err)
+	})
+
+	t.Run("buffered writer", func(t *testing.T) {
+		w := &chunkWriter{chunk: 3, err: errors.New("broken pipe")}
+		enc := goldjson.NewEncoder(bufio.NewWriterSize(w, 16))
+
+		line := enc.NewLine()
+		line.AddString("hello", "world")
+		err := line.End()
+		errNext := enc.NewLine().End()
+
+		var partial *goldjson.PartialWriteError
+		expectEqual(t, true, errors.As(err, &partial))
+		expectEqual(t, 3, partial.Written)
+		expectEqual(t, w.err, partial.Err)
+		expectEqual(t, false, errors.As(errNext, &partial))
+		expectEqual(t, w.err, errNext)
+	})
+
+	t.Run("failure before writing", func(t *testing.T) {
+		enc := goldjson.NewEncoder(ErrorWriter{})
+
+		err := enc.NewLine().End()
+
+		var partial *goldjson.PartialWriteError
+		expectError(t, err)
+		expectEqual(t, false, errors.As(err, &partial))
+	})
+}
+
+// chunkWriter writes at most chunk bytes per call, returning err along with
+// each short write, and writes nothing once limit bytes have been written.
+type chunkWriter struct {
+	buf   bytes.Buffer
+	chunk int
+	limit int
+	err   error
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if n > w.chunk {
+		n = w.chunk
+	}
+	if w.limit > 0 && w.buf.Len()+n > w.limit {
+		n = w.limit - w.buf.Len()
+	}
+	w.buf.Write(p[:n])
+	if n < len(p) {
+		return n, w.err
+	}
+	return n, nil
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string { return "timeout" }
+func (timeoutError) Timeout() bool { return true }
+
+func TestTopLevelValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []goldjson.Option
+		build    func(*goldjson.Encoder) *goldjson.LineWriter
+		expected string
+	}{
+		{
+			"list",
+			nil,
+			func(e *goldjson.Encoder) *goldjson.LineWriter {
+				l := e.NewListLine()
+				l.AddInt64("ignored", 1)
+				l.StartRecord("")
+				l.AddString("a", "b")
+				l.EndRecord()
+				l.StartList("")
+				l.EndList()
+				return l
+			},
+			`[1,{"a":"b"},[]]`,
+		},
+		{
+			"empty list",
+			nil,
+			func(e *goldjson.Encoder) *goldjson.LineWriter { return e.NewListLine() },
+			`[]`,
+		},
+		{
+			"strict list",
+			[]goldjson.Option{goldjson.WithStrict()},
+			func(e *goldjson.Encoder) *goldjson.LineWriter {
+				l := e.NewListLine()
+				l.AddInt64("a", 1)
+				l.AddInt64("a", 2)
+				l.StartRecord("")
+				return l
+			},
+			`[1,2,{}]`,
+		},
+		{
+			"string value",
+			nil,
+			func(e *goldjson.Encoder) *goldjson.LineWriter {
+				l := e.NewValueLine()
+				l.AddString("ignored", "a\n")
+				return l
+			},
+			`"a\n"`,
+		},
+		{
+			"record value",
+			nil,
+			func(e *goldjson.Encoder) *goldjson.LineWriter {
+				l := e.NewValueLine()
+				l.StartRecord("")
+				l.AddInt64("a", 1)
+				l.EndRecord()
+				return l
+			},
+			`{"a":1}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf, tt.opts...)
+			expected := tt.expected + "\n" + `{"x":"y"}` + "\n"
+
+			_ = tt.build(enc).End()
+			line := enc.NewLine()
+			line.AddString("x", "y")
+			_ = line.End()
+			received := buf.String()
+
+			expectEqual(t, expected, received)
+		})
+	}
+}
+
+func TestSafeIntegers(t *testing.T) {
+	var buf bytes.Buffer
+	enc := goldjson.NewEncoder(&buf, goldjson.WithSafeIntegers())
+	layout := enc.NewLayout("a", "b")
+	expected := `{"a":9007199254740991,"b":"-9007199254740992","c":"18446744073709551615","d":"9007199254740992"}` + "\n" +
+		`{"a":"9007199254740992","b":1}` + "\n"
+
+	line := enc.NewLine()
+	line.AddInt64("a", tokens.MaxSafeInteger)
+	line.AddInt64("b", -tokens.MaxSafeInteger-1)
+	line.AddUint64("c", math.MaxUint64)
+	line.AddEnum("d", tokens.MaxSafeInteger+1)
+	_ = line.End()
+	layoutLine := layout.NewLine()
+	layoutLine.AddInt64(tokens.MaxSafeInteger + 1)
+	layoutLine.AddUint64(1)
+	_ = layoutLine.End()
+	received := buf.String()
+
+	expectEqual(t, expected, received)
+}
+
+func TestIntegerStrings(t *testing.T) {
+	var buf bytes.Buffer
+	enc := goldjson.NewEncoder(&buf)
+	expected := `{"id":1234,"id_str":"1234","min":"-9223372036854775808","max":"18446744073709551615","list":["1"]}` + "\n"
+
+	line := enc.NewLine()
+	line.AddInt64("id", 1234)
+	line.AddInt64String("id_str", 1234)
+	line.AddInt64String("min", math.MinInt64)
+	line.AddUint64String("max", math.MaxUint64)
+	line.StartList("list")
+	line.AddUint64String("ignored", 1)
+	line.EndList()
+	_ = line.End()
+	received := buf.String()
+
+	expectEqual(t, expected, received)
+}
+
+func TestTrailer(t *testing.T) {
+	type meta struct {
+		EncodeNS int64 `json:"encode_ns"`
+		Fields   int   `json:"fields"`
+		Dropped  int   `json:"dropped"`
+	}
+	tests := []struct {
+		name     string
+		opts     []goldjson.Option
+		build    func(*goldjson.LineWriter)
+		expected string
+		meta     meta
+	}{
+		{
+			"empty",
+			nil,
+			func(l *goldjson.LineWriter) {},
+			`{}`,
+			meta{},
+		},
+		{
+			"nested",
+			nil,
+			func(l *goldjson.LineWriter) {
+				l.AddString("a", "b")
+				l.StartRecord("c")
+				l.AddInt64("d", 1)
+				l.StartList("e")
+				l.AddBool("", true)
+				l.EndList()
+				l.EndRecord()
+			},
+			`{"a":"b","c":{"d":1,"e":[true]}}`,
+			meta{Fields: 5},
+		},
+		{
+			"failed value",
+			nil,
+			func(l *goldjson.LineWriter) {
+				l.AddString("a", "b")
+				_ = l.AddMarshal("c", ErrorMarshal{})
+			},
+			`{"a":"b"}`,
+			meta{Fields: 1, Dropped: 1},
+		},
+		{
+			"duplicate keys",
+			[]goldjson.Option{goldjson.WithStrict()},
+			func(l *goldjson.LineWriter) {
+				l.AddString("a", "b")
+				l.AddString("a", "c")
+				l.StartRecord("a")
+				l.AddString("d", "e")
+				l.EndRecord()
+			},
+			`{"a":"b"}`,
+			meta{Fields: 1, Dropped: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf, append(tt.opts, goldjson.WithTrailer("_meta"))...)
+
+			line := enc.NewLine()
+			tt.build(line)
+			_ = line.End()
+			var received struct {
+				Meta meta `json:"_meta"`
+			}
+			err := json.Unmarshal(buf.Bytes(), &received)
+			rest := regexp.MustCompile(`,?"_meta":\{[^}]*\}`).ReplaceAllString(strings.TrimSuffix(buf.String(), "\n"), "")
+
+			expectNoError(t, err)
+			expectEqual(t, tt.expected, rest)
+			expectEqual(t, true, received.Meta.EncodeNS >= 0)
+			expectEqual(t, tt.meta.Fields, received.Meta.Fields)
+			expectEqual(t, tt.meta.Dropped, received.Meta.Dropped)
+		})
+	}
+
+	t.Run("static fields and list lines", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf, goldjson.WithTrailer("_meta"))
+		fields, fieldsWriter := enc.NewStaticFields()
+		fieldsWriter.AddString("a", "b")
+		_ = fieldsWriter.End()
+
+		line := enc.NewListLine()
+		line.AddInt64("", 1)
+		_ = line.End()
+		line = enc.NewLine()
+		line.AddStaticFields(fields)
+		_ = line.End()
+		received := buf.String()
+
+		expectEqual(t, true, strings.HasPrefix(received, `[1]`+"\n"+`{"a":"b","_meta":{"encode_ns":`))
+		expectEqual(t, true, strings.HasSuffix(received, `,"fields":0,"dropped":0}}`+"\n"))
+	})
+}
+
+func TestFloat64ListPrec(t *testing.T) {
+	z := 0.0
+	tests := []struct {
+		name     string
+		opts     []goldjson.Option
+		values   []float64
+		prec     int
+		expected string
+	}{
+		{"empty", nil, nil, 3, `{"a":[]}`},
+		{"rounded", nil, []float64{1.23456, -0.5, 2, 1e-9, 1e21}, 3, `{"a":[1.235,-0.5,2,0,1e+21]}`},
+		{"no decimals", nil, []float64{1.5, 2.4}, 0, `{"a":[2,2]}`},
+		{"shortest", nil, []float64{1.23456, 1e-9}, -1, `{"a":[1.23456,1e-9]}`},
+		{"non-finite", nil, []float64{0 / z, 1 / z}, 2, `{"a":["NaN","+Inf"]}`},
+		{"non-finite in strict mode", []goldjson.Option{goldjson.WithStrict()}, []float64{0 / z, 1}, 2, `{"a":[null,1]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf, tt.opts...)
+			expected := tt.expected + "\n"
+
+			line := enc.NewLine()
+			line.AddFloat64ListPrec("a", tt.values, tt.prec)
+			_ = line.End()
+			received := buf.String()
+
+			expectEqual(t, expected, received)
+		})
+	}
+
+	t.Run("in list", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf)
+
+		line := enc.NewListLine()
+		line.AddFloat64ListPrec("ignored", []float64{1, 2}, 1)
+		line.AddFloat64ListPrec("ignored", []float64{3}, 1)
+		_ = line.End()
+		received := buf.String()
+
+		expectEqual(t, `[[1,2],[3]]`+"\n", received)
+	})
+}
+
+func TestSchema(t *testing.T) {
+	t.Run("tracked", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf, goldjson.WithSchema("_schema"))
+		clone := enc.Clone()
+		layout := enc.NewLayout("layout")
+		fields, fieldsWriter := enc.NewStaticFields()
+		fieldsWriter.AddString("static", "value")
+		_ = fieldsWriter.End()
+		expected := `{"_schema":{"msg":["string"],"quoted\"key":["number","null"],"rec":["record"],"ok":["bool"],"list":["list"],"layout":["number"]}}` + "\n"
+
+		line := enc.NewLine()
+		line.AddStaticFields(fields)
+		line.AddString("msg", "a")
+		line.AddInt64("quoted\"key", 1)
+		line.StartRecord("rec")
+		line.AddString("nested", "b")
+		line.EndRecord()
+		_ = line.AddMarshal("failed", ErrorMarshal{})
+		_ = line.End()
+		line = clone.NewLine()
+		_ = line.AddRawJSON("quoted\"key", nil)
+		line.AddBool("ok", false)
+		line.StartList("list")
+		line.AddString("", "c")
+		line.EndList()
+		_ = line.End()
+		layoutLine := layout.NewLine()
+		layoutLine.AddFloat64(1.5)
+		_ = layoutLine.End()
+		line = enc.NewListLine()
+		line.AddString("ignored", "d")
+		_ = line.End()
+		buf.Reset()
+		err := enc.WriteSchema()
+		received := buf.String()
+
+		expectNoError(t, err)
+		expectEqual(t, expected, received)
+		expectEqual(t, 6, len(clone.Schema()))
+	})
+
+	t.Run("declared", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf, goldjson.WithSchema("_schema",
+			goldjson.SchemaField{Key: "msg", Types: []goldjson.SchemaType{goldjson.SchemaString}},
+			goldjson.SchemaField{Key: "n", Types: []goldjson.SchemaType{goldjson.SchemaNumber, goldjson.SchemaNumber}},
+		))
+		expected := `{"_schema":{"msg":["string"],"n":["number"]}}` + "\n" +
+			`{"msg":"a","n":1}` + "\n" +
+			`{"n":"b"}` + "\n" +
+			`{"_schema":{"msg":["string"],"n":["number","string"]}}` + "\n"
+
+		err1 := enc.WriteSchema()
+		line := enc.NewLine()
+		line.AddString("msg", "a")
+		line.AddInt64("n", 1)
+		_ = line.End()
+		line = enc.NewLine()
+		line.AddString("n", "b")
+		_ = line.End()
+		err2 := enc.WriteSchema()
+		received := buf.String()
+
+		expectNoError(t, err1)
+		expectNoError(t, err2)
+		expectEqual(t, expected, received)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf)
+
+		err := enc.WriteSchema()
+
+		expectNoError(t, err)
+		expectEqual(t, "", buf.String())
+		expectEqual(t, true, enc.Schema() == nil)
+	})
+}
+
+func TestEnum(t *testing.T) {
+	names := map[int64]string{0: "IDLE", 1: "RUNNING", 2: "\"STOPPED\""}
+	tests := []struct {
+		name     string
+		build    func(*goldjson.LineWriter)
+		expected string
+	}{
+		{
+			"registered",
+			func(l *goldjson.LineWriter) { l.AddEnum("state", 1) },
+			`{"state":"RUNNING"}`,
+		},
+		{
+			"escaped",
+			func(l *goldjson.LineWriter) { l.AddEnum("state", 2) },
+			`{"state":"\"STOPPED\""}`,
+		},
+		{
+			"unknown value",
+			func(l *goldjson.LineWriter) { l.AddEnum("state", 3) },
+			`{"state":3}`,
+		},
+		{
+			"unregistered key",
+			func(l *goldjson.LineWriter) { l.AddEnum("other", 1) },
+			`{"other":1}`,
+		},
+		{
+			"in list",
+			func(l *goldjson.LineWriter) {
+				l.StartList("states")
+				l.AddEnum("state", 0)
+				l.EndList()
+			},
+			`{"states":["IDLE"]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf)
+			enc.RegisterEnum("state", names)
+			expected := tt.expected + "\n"
+
+			line := enc.Clone().NewLine()
+			tt.build(line)
+			_ = line.End()
+			received := buf.String()
+
+			expectEqual(t, expected, received)
+		})
+	}
+}
+
+func TestAddStack(t *testing.T) {
+	var buf bytes.Buffer
+	enc := goldjson.NewEncoder(&buf)
+
+	line := enc.NewLine()
+	line.AddStack("stack", 0)
+	line.StartList("list")
+	line.AddStack("ignored", 0)
+	line.EndList()
+	_ = line.End()
+	var record struct {
+		Stack []string   `json:"stack"`
+		List  [][]string `json:"list"`
+	}
+	err := json.Unmarshal(buf.Bytes(), &record)
+
+	expectNoError(t, err)
+	expectEqual(t, true, strings.HasSuffix(record.Stack[0], " github.com/jussi-kalliokoski/goldjson_test.TestAddStack"))
+	expectEqual(t, 1, len(record.List))
+	expectEqual(t, true, strings.HasSuffix(record.List[0][0], " github.com/jussi-kalliokoski/goldjson_test.TestAddStack"))
+	expectEqual(t, record.Stack[1], record.List[0][1])
+}
+
+func TestComplex(t *testing.T) {
+	z := 0.0
+	tests := []struct {
+		name     string
+		opts     []goldjson.Option
+		expected string
+	}{
+		{"record", nil, `{"a":{"re":1.5,"im":-2},"b":[{"re":"NaN","im":0}]}`},
+		{"string", []goldjson.Option{goldjson.WithComplexFormat(goldjson.ComplexFormatString)}, `{"a":"1.5-2i","b":["NaN+0i"]}`},
+		{"strict", []goldjson.Option{goldjson.WithStrict()}, `{"a":{"re":1.5,"im":-2},"b":[{"re":null,"im":0}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf, tt.opts...)
+			expected := tt.expected + "\n"
+
+			line := enc.NewLine()
+			line.AddComplex128("a", complex(1.5, -2))
+			line.StartList("b")
+			line.AddComplex128("", complex(0/z, 0))
+			line.EndList()
+			_ = line.End()
+			received := buf.String()
+
+			expectEqual(t, expected, received)
+		})
+	}
+}
+
+func TestUTC(t *testing.T) {
+	value := time.Date(2023, 06, 12, 23, 42, 15, 0, time.FixedZone("EEST", 3*60*60))
+	tests := []struct {
+		name     string
+		opts     []goldjson.Option
+		expected string
+	}{
+		{"default", nil, `{"t":"2023-06-12T23:42:15+03:00"}`},
+		{"utc", []goldjson.Option{goldjson.WithUTC()}, `{"t":"2023-06-12T20:42:15Z"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf, tt.opts...)
+			expected := tt.expected + "\n"
+
+			line := enc.NewLine()
+			_ = line.AddTime("t", value)
+			_ = line.End()
+			received := buf.String()
+
+			expectEqual(t, expected, received)
+		})
+	}
+}
+
+func TestWriteHooks(t *testing.T) {
+	t.Run("both", func(t *testing.T) {
+		var events []string
+		hooks := goldjson.WriteHooks{
+			BeforeWrite: func(size int) {
+				events = append(events, fmt.Sprintf("before %d", size))
+			},
+			AfterWrite: func(size int, elapsed time.Duration, err error) {
+				events = append(events, fmt.Sprintf("after %d %v %v", size, elapsed >= 0, err))
+			},
+		}
+		enc := goldjson.NewEncoder(io.Discard, goldjson.WithWriteHooks(hooks))
+
+		line := enc.NewLine()
+		line.AddString("a", "b")
+		_ = line.End()
+
+		expectEqual(t, 2, len(events))
+		expectEqual(t, "before 10", events[0])
+		expectEqual(t, "after 10 true <nil>", events[1])
+	})
+
+	t.Run("static fields", func(t *testing.T) {
+		var events []string
+		hooks := goldjson.WriteHooks{
+			BeforeWrite: func(size int) {
+				events = append(events, fmt.Sprintf("before %d", size))
+			},
+			AfterWrite: func(size int, elapsed time.Duration, err error) {
+				events = append(events, fmt.Sprintf("after %d", size))
+			},
+		}
+		warn := func(size int, elapsed time.Duration) {
+			events = append(events, fmt.Sprintf("slow %d", size))
+		}
+		enc := goldjson.NewEncoder(io.Discard, goldjson.WithWriteHooks(hooks), goldjson.WithSlowWriteWarning(time.Nanosecond, warn))
+
+		fields, fw := enc.NewStaticFields()
+		fw.AddString("a", "b")
+		fieldsErr := fw.End()
+		tpl, tw := enc.NewTemplate()
+		tw.AddString("c", "d")
+		tpl.Slot("e")
+		templateErr := tw.End()
+
+		expectNoError(t, fieldsErr)
+		expectNoError(t, templateErr)
+		expectEqual(t, "", strings.Join(events, ","))
+		line := enc.NewLineWith(fields)
+		_ = line.End()
+		// the slow write warning depends on the resolution of the clock
+		expectEqual(t, "before 10,after 10", strings.Join(events[:2], ","))
+	})
+
+	t.Run("error", func(t *testing.T) {
+		var received error
+		hooks := goldjson.WriteHooks{
+			AfterWrite: func(size int, elapsed time.Duration, err error) {
+				received = err
+			},
+		}
+		enc := goldjson.NewEncoder(ErrorWriter{}, goldjson.WithWriteHooks(hooks))
+
+		endErr := enc.NewLine().End()
+
+		expectError(t, endErr)
+		expectEqual(t, endErr, received)
+	})
+}
+
+func TestSlowWriteWarning(t *testing.T) {
+	slowWriter := func(w io.Writer) io.Writer {
+		return writerFunc(func(p []byte) (int, error) {
+			if bytes.Contains(p, []byte(`"slow"`)) {
+				time.Sleep(5 * time.Millisecond)
+			}
+			return w.Write(p)
+		})
+	}
+
+	t.Run("callback", func(t *testing.T) {
+		var warnings []string
+		warn := func(size int, elapsed time.Duration) {
+			warnings = append(warnings, fmt.Sprintf("%d %v", size, elapsed >= 5*time.Millisecond))
+		}
+		enc := goldjson.NewEncoder(slowWriter(io.Discard), goldjson.WithSlowWriteWarning(time.Millisecond, warn))
+
+		for _, value := range []string{"fast", "slow"} {
+			line := enc.NewLine()
+			line.AddString("a", value)
+			_ = line.End()
+		}
+
+		expectEqual(t, 1, len(warnings))
+		expectEqual(t, "13 true", warnings[0])
+	})
+
+	t.Run("warning line", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(slowWriter(&buf), goldjson.WithSlowWriteWarning(time.Millisecond, nil))
+
+		line := enc.NewLine()
+		line.AddString("a", "slow")
+		_ = line.End()
+		received := regexp.MustCompile(`"elapsed_ns":\d+`).ReplaceAllString(buf.String(), `"elapsed_ns":0`)
+
+		expectEqual(t, `{"a":"slow"}`+"\n"+`{"warning":"slow write","size":13,"elapsed_ns":0}`+"\n", received)
+	})
+}
+
+func TestSafeSet(t *testing.T) {
+	set := tokens.DefaultSafeSet()
+	set['='] = false
+	set['"'] = true
+	tests := []struct {
+		name     string
+		build    func(*goldjson.Encoder, *goldjson.LineWriter)
+		expected string
+	}{
+		{
+			"key and value",
+			func(_ *goldjson.Encoder, l *goldjson.LineWriter) { l.AddString("a=b", "c=\"d\"") },
+			`{"a\u003db":"c\u003d\"d\""}`,
+		},
+		{
+			"prepared key",
+			func(_ *goldjson.Encoder, l *goldjson.LineWriter) { l.AddBool("prepared=", true) },
+			`{"prepared\u003d":true}`,
+		},
+		{
+			"static fields",
+			func(e *goldjson.Encoder, l *goldjson.LineWriter) {
+				f, fw := e.NewStaticFields()
+				fw.AddString("a=", "b=")
+				_ = fw.End()
+				l.AddStaticFields(f)
+			},
+			`{"a\u003d":"b\u003d"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf, goldjson.WithSafeSet(set))
+			enc.PrepareKey("prepared=")
+			expected := tt.expected + "\n"
+
+			line := enc.NewLine()
+			tt.build(enc, line)
+			_ = line.End()
+			received := buf.String()
+
+			expectEqual(t, expected, received)
+		})
+	}
+
+	t.Run("layout", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf, goldjson.WithSafeSet(set))
+		layout := enc.NewLayout("a=")
+		expected := `{"a\u003d":"b\u003d"}` + "\n"
+
+		line := layout.NewLine()
+		line.AddString("b=")
+		_ = line.End()
+		received := buf.String()
+
+		expectEqual(t, expected, received)
+	})
+}
+
+func TestEscapeSlash(t *testing.T) {
+	set := tokens.DefaultSafeSet()
+	set['='] = false
+	tests := []struct {
+		name     string
+		opts     []goldjson.Option
+		expected string
+	}{
+		{
+			"default",
+			nil,
+			`{"a/b":"</script>="}`,
+		},
+		{
+			"escape slash",
+			[]goldjson.Option{goldjson.WithEscapeSlash()},
+			`{"a\/b":"<\/script>="}`,
+		},
+		{
+			"with safe set",
+			[]goldjson.Option{goldjson.WithSafeSet(set), goldjson.WithEscapeSlash()},
+			`{"a\/b":"<\/script>\u003d"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf, tt.opts...)
+			expected := tt.expected + "\n"
+
+			line := enc.NewLine()
+			line.AddString("a/b", "</script>=")
+			_ = line.End()
+			received := buf.String()
+
+			expectEqual(t, expected, received)
+		})
+	}
+}
+
+func TestHTMLSafe(t *testing.T) {
+	set := tokens.DefaultSafeSet()
+	set['='] = false
+	tests := []struct {
+		name     string
+		opts     []goldjson.Option
+		expected string
+	}{
+		{
+			"default",
+			nil,
+			`{"a<b":"</a>=&","m":{"v":"<&>"}}`,
+		},
+		{
+			"html safe",
+			[]goldjson.Option{goldjson.WithHTMLSafe()},
+			`{"a\u003cb":"\u003c/a\u003e=\u0026","m":{"v":"\u003c\u0026\u003e"}}`,
+		},
+		{
+			"with safe set and escape slash",
+			[]goldjson.Option{goldjson.WithSafeSet(set), goldjson.WithEscapeSlash(), goldjson.WithHTMLSafe()},
+			`{"a\u003cb":"\u003c\/a\u003e\u003d\u0026","m":{"v":"\u003c\u0026\u003e"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf, tt.opts...)
+			expected := tt.expected + "\n"
+
+			line := enc.NewLine()
+			line.AddString("a<b", "</a>=&")
+			err := line.AddMarshal("m", map[string]string{"v": "<&>"})
+			_ = line.End()
+			received := buf.String()
+
+			expectNoError(t, err)
+			expectEqual(t, expected, received)
+		})
+	}
+}
+
+func TestASCIIOnly(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []goldjson.Option
+		key      string
+		value    string
+		expected string
+	}{
+		{"ascii", nil, "a", "b\n", `{"a":"b\n"}`},
+		{"two bytes", nil, "ä", "é", `{"\u00e4":"\u00e9"}`},
+		{"three bytes", nil, "k", "€\u2028x", `{"k":"\u20ac\u2028x"}`},
+		{"surrogate pair", nil, "k", "a😀b", `{"k":"a\ud83d\ude00b"}`},
+		{"invalid", nil, "k", "\xffä", `{"k":"\ufffd\u00e4"}`},
+		{"mixed escapes", nil, "k", "\"ä\\ö\t", `{"k":"\"\u00e4\\\u00f6\t"}`},
+		{"newline replacement", []goldjson.Option{goldjson.WithNewlineReplacement("⏎")}, "k", "ä\nö", `{"k":"\u00e4\u23ce\u00f6"}`},
+		{"escape slash", []goldjson.Option{goldjson.WithEscapeSlash()}, "k", "ä/ö", `{"k":"\u00e4\/\u00f6"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf, append(tt.opts, goldjson.WithASCIIOnly())...)
+			expected := tt.expected + "\n"
+
+			line := enc.NewLine()
+			line.AddString(tt.key, tt.value)
+			_ = line.End()
+			received := buf.String()
+
+			expectEqual(t, expected, received)
+		})
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf, goldjson.WithASCIIOnly())
+		layout := enc.NewLayout("ключ")
+		value := "日本語 😀 ümlaut"
+
+		line := layout.NewLine()
+		line.AddString(value)
+		_ = line.End()
+		var received map[string]string
+		err := json.Unmarshal(buf.Bytes(), &received)
+
+		expectNoError(t, err)
+		expectEqual(t, value, received["ключ"])
+		for _, b := range buf.Bytes() {
+			expectEqual(t, true, b < utf8.RuneSelf)
+		}
+	})
+}
+
+func TestNewlineReplacement(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []goldjson.Option
+		expected string
+	}{
+		{
+			"default",
+			nil,
+			`{"e":"f\ng","a\nb":"c\r\nd"}`,
+		},
+		{
+			"replaced",
+			[]goldjson.Option{goldjson.WithNewlineReplacement(" ⏎ ")},
+			`{"e":"f ⏎ g","a\nb":"c ⏎ d"}`,
+		},
+		{
+			"with escape slash",
+			[]goldjson.Option{goldjson.WithNewlineReplacement("/"), goldjson.WithEscapeSlash()},
+			`{"e":"f\/g","a\nb":"c\/d"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf, tt.opts...)
+			layout := enc.NewLayout("e")
+			expected := tt.expected + "\n"
+
+			line := layout.NewLine()
+			line.AddString("f\ng")
+			line.Line().AddString("a\nb", "c\r\nd")
+			_ = line.End()
+			received := buf.String()
+
+			expectEqual(t, expected, received)
+		})
+	}
+}
+
+func TestJSONCompat(t *testing.T) {
+	values := map[string]any{
+		"string":    "<a href=\"x\">&amp;</a> \b\f\x01\\u0008\n\t/",
+		"<key>":     "value",
+		"\b":        "\f",
+		"invalid":   "\xff",
+		"int":       -1,
+		"uint":      uint64(1 << 63),
+		"float":     0.1,
+		"small":     1e-7,
+		"large":     1e21,
+		"negative":  -123456.789,
+		"bool":      true,
+		"nil":       nil,
+		"time":      baseTime,
+		"duration":  1500 * time.Millisecond,
+		"durations": []time.Duration{time.Second},
+		"error":     errors.New("oops"),
+		"stringer":  net.IPv4(127, 0, 0, 1),
+		"bytes":     []byte("<hello>"),
+		"list":      []any{1, "<", []string{"&"}, map[string]string{"b": "<", "a": ">"}},
+		"point":     Point{X: 1, Y: 2},
+		"raw":       json.RawMessage(`{"a": "<"}`),
+	}
+	tests := []struct {
+		name string
+		opts []goldjson.Option
+	}{
+		{"default", nil},
+		{"conflicting options", []goldjson.Option{
+			goldjson.WithEscapeSlash(),
+			goldjson.WithNewlineReplacement(" "),
+			goldjson.WithSafeIntegers(),
+			goldjson.WithUnsortedMapKeys(),
+			goldjson.WithUTC(),
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf, append(tt.opts, goldjson.WithJSONCompat())...)
+			b, err := json.Marshal(values)
+			expectNoError(t, err)
+			expected := `{"values":` + string(b) + "}\n"
+
+			line := enc.NewLine()
+			errAdd := line.AddAny("values", values)
+			_ = line.End()
+			received := buf.String()
+
+			expectNoError(t, errAdd)
+			expectEqual(t, expected, received)
+		})
+	}
+
+	t.Run("non-finite floats", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf, goldjson.WithJSONCompat())
+		expected := `{"nan":null,"inf":[null]}` + "\n"
+
+		line := enc.NewLine()
+		line.AddFloat64("nan", math.NaN())
+		line.AddFloat64ListPrec("inf", []float64{math.Inf(1)}, 3)
+		_ = line.End()
+		received := buf.String()
+
+		expectEqual(t, expected, received)
+	})
+}
+
+func TestSafeString(t *testing.T) {
+	var buf bytes.Buffer
+	enc := goldjson.NewEncoder(&buf)
+	expected := `{"a":"b","c":"d"}` + "\n"
+
+	line := enc.NewLine()
+	line.AddSafeString("a", "b")
+	line.AddSafeString("c", "d")
+	_ = line.End()
+	received := buf.String()
+
+	expectEqual(t, expected, received)
+}
+
+func TestValueCache(t *testing.T) {
+	long := strings.Repeat("a\"", 200)
+	values := []string{"GET", "a\nb", "<html>", "POST", long, "GET", "a\nb", "PUT", "GET", long, "POST", ""}
+	tests := []struct {
+		name string
+		size int
+		opts []goldjson.Option
+	}{
+		{"evicting", 2, nil},
+		{"large", 100, nil},
+		{"newline replacement", 2, []goldjson.Option{goldjson.WithNewlineReplacement(" ")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var expectedBuf, receivedBuf bytes.Buffer
+			uncached := goldjson.NewEncoder(&expectedBuf, tt.opts...)
+			cached := goldjson.NewEncoder(&receivedBuf, append(tt.opts, goldjson.WithValueCache(tt.size))...)
+			layout := cached.NewLayout("v")
+
+			for _, value := range values {
+				line := uncached.NewLine()
+				line.AddString("v", value)
+				_ = line.End()
+				line = uncached.NewLine()
+				line.AddString("v", value)
+				_ = line.End()
+				line = cached.NewLine()
+				line.AddString("v", value)
+				_ = line.End()
+				layoutLine := layout.NewLine()
+				layoutLine.AddString(value)
+				_ = layoutLine.End()
+			}
+			expected := expectedBuf.String()
+			received := receivedBuf.String()
+
+			expectEqual(t, expected, received)
+		})
+	}
+
+	t.Run("concurrent", func(t *testing.T) {
+		const goroutines = 8
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf, goldjson.WithLocking(), goldjson.WithValueCache(3))
+
+		var wg sync.WaitGroup
+		for i := 0; i < goroutines; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					line := enc.NewLine()
+					line.AddString("v", values[j%len(values)])
+					_ = line.End()
+				}
+			}()
+		}
+		wg.Wait()
+		lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+
+		expectEqual(t, goroutines*100, len(lines))
+		for _, line := range lines {
+			var record struct {
+				V string `json:"v"`
+			}
+			expectNoError(t, json.Unmarshal([]byte(line), &record))
+		}
+	})
+}
+
+func TestZeroAllocations(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocation counts are unreliable with the race detector")
+	}
+	if checkedEnabled {
+		t.Skip("lines are not pooled in the checked build")
+	}
+	z := float64(0)
+	fields, fieldsWriter := goldjson.NewStaticFields()
+	fieldsWriter.AddString("static", "value")
+	_ = fieldsWriter.End()
+	floats := make([]float64, 1000)
+	for i := range floats {
+		floats[i] = float64(i) / 7
+	}
+	tests := []struct {
+		name  string
+		build func(*goldjson.LineWriter)
+	}{
+		{"string", func(l *goldjson.LineWriter) { l.AddString("key", "value\n") }},
+		{"safe string", func(l *goldjson.LineWriter) { l.AddSafeString("key", "value") }},
+		{"int64", func(l *goldjson.LineWriter) { l.AddInt64("key", -123456789) }},
+		{"uint64", func(l *goldjson.LineWriter) { l.AddUint64("key", 123456789) }},
+		{"int64 string", func(l *goldjson.LineWriter) { l.AddInt64String("key", -123456789) }},
+		{"uint64 string", func(l *goldjson.LineWriter) { l.AddUint64String("key", 123456789) }},
+		{"bool", func(l *goldjson.LineWriter) { l.AddBool("key", true) }},
+		{"float64", func(l *goldjson.LineWriter) { l.AddFloat64("key", -123456.789) }},
+		{"special float64", func(l *goldjson.LineWriter) { l.AddFloat64("key", 0/z) }},
+		{"float32", func(l *goldjson.LineWriter) { l.AddFloat32("key", 0.1) }},
+		{"complex128", func(l *goldjson.LineWriter) { l.AddComplex128("key", complex(1.5, -2)) }},
+		{"float64 list", func(l *goldjson.LineWriter) { l.AddFloat64ListPrec("key", floats, 3) }},
+		{"time list", func(l *goldjson.LineWriter) { _ = l.AddTimeList("key", []time.Time{baseTime, baseTime}) }},
+		{"duration list", func(l *goldjson.LineWriter) { l.AddDurationList("key", []time.Duration{time.Second, time.Millisecond}) }},
+		{"string list", func(l *goldjson.LineWriter) { l.AddStringList("key", []string{"a", "b\n"}) }},
+		{"bytes", func(l *goldjson.LineWriter) { l.AddBytes("key", []byte("hello")) }},
+		{"messagef", func(l *goldjson.LineWriter) { l.AddMessagef("key", "%s took %d ms\n", "request", 12) }},
+		{"if verbose", func(l *goldjson.LineWriter) {
+			verbose := l.IfVerbose(1)
+			verbose.StartRecord("record")
+			verbose.AddString("key", "value")
+			verbose.EndRecord()
+		}},
+		{"level", func(l *goldjson.LineWriter) { l.AddLevel("level", 4) }},
+		{"enum", func(l *goldjson.LineWriter) { l.AddEnum("enum", 1) }},
+		{"time", func(l *goldjson.LineWriter) { _ = l.AddTime("key", baseTime) }},
+		{"prepared escaped key", func(l *goldjson.LineWriter) { l.AddBool("prepared\n", true) }},
+		{"static fields", func(l *goldjson.LineWriter) { l.AddStaticFields(fields) }},
+		{"nested", func(l *goldjson.LineWriter) {
+			l.StartRecord("record")
+			l.StartList("list")
+			l.AddInt64("", 1)
+			l.EndList()
+			l.EndRecord()
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := bufio.NewWriter(io.Discard)
+			enc := goldjson.NewEncoder(w)
+			enc.PrepareKey("prepared\n")
+			enc.RegisterEnum("enum", map[int64]string{1: "RUNNING"})
+
+			received := testing.AllocsPerRun(100, func() {
+				line := enc.NewLine()
+				tt.build(line)
+				_ = line.End()
+			})
+
+			expectEqual(t, 0, received)
+		})
+	}
+
+	t.Run("end to", func(t *testing.T) {
+		enc := goldjson.NewEncoder(io.Discard)
+		buf := make([]byte, 0, 1024)
+
+		received := testing.AllocsPerRun(100, func() {
+			line := enc.NewLine()
+			line.AddString("key", "value")
+			buf, _ = line.EndTo(buf[:0])
+		})
+
+		expectEqual(t, 0, received)
+	})
+
+	t.Run("value cache", func(t *testing.T) {
+		enc := goldjson.NewEncoder(io.Discard, goldjson.WithValueCache(2))
+
+		received := testing.AllocsPerRun(100, func() {
+			line := enc.NewLine()
+			line.AddString("a", "value\n")
+			line.AddString("b", "other")
+			_ = line.End()
+		})
+
+		expectEqual(t, 0, received)
+	})
+
+	t.Run("dynamic key cache", func(t *testing.T) {
+		enc := goldjson.NewEncoder(io.Discard, goldjson.WithDynamicKeyCache(2))
+
+		received := testing.AllocsPerRun(100, func() {
+			line := enc.NewLine()
+			line.AddBool("a\n", true)
+			line.AddBool("b", false)
+			_ = line.End()
+		})
+
+		expectEqual(t, 0, received)
+	})
+
+	t.Run("discard", func(t *testing.T) {
+		enc := goldjson.NewEncoder(io.Discard)
+
+		received := testing.AllocsPerRun(100, func() {
+			line := enc.NewLine()
+			line.AddString("key", "value")
+			line.Discard()
+		})
+
+		expectEqual(t, 0, received)
+	})
+
+	t.Run("layout", func(t *testing.T) {
+		w := bufio.NewWriter(io.Discard)
+		enc := goldjson.NewEncoder(w)
+		layout := enc.NewLayout("a", "b", "c")
+
+		received := testing.AllocsPerRun(100, func() {
+			line := layout.NewLine()
+			line.AddString("value")
+			line.Skip()
+			_ = line.AddTime(baseTime)
+			_ = line.End()
+		})
+
+		expectEqual(t, 0, received)
+	})
+
+	t.Run("template", func(t *testing.T) {
+		w := bufio.NewWriter(io.Discard)
+		enc := goldjson.NewEncoder(w)
+		tpl, tw := enc.NewTemplate()
+		tw.AddString("service", "api")
+		tpl.Slot("a")
+		tw.AddString("region", "eu")
+		tpl.Slot("b")
+		_ = tw.End()
+
+		received := testing.AllocsPerRun(100, func() {
+			line := tpl.NewLine()
+			line.AddString("value")
+			_ = line.AddTime(baseTime)
+			_ = line.End()
+		})
+
+		expectEqual(t, 0, received)
+	})
+
+	t.Run("group", func(t *testing.T) {
+		w := bufio.NewWriter(io.Discard)
+		enc := goldjson.NewEncoder(w)
+		group := enc.NewGroup("http", "method", "path", "status")
+
+		received := testing.AllocsPerRun(100, func() {
+			line := enc.NewLine()
+			r := group.Start(line)
+			r.AddString("GET")
+			r.AddString("/")
+			r.AddInt64(200)
+			r.End()
+			_ = line.End()
+		})
+
+		expectEqual(t, 0, received)
+	})
+}
+
+func TestByteAccounting(t *testing.T) {
+	t.Run("categories", func(t *testing.T) {
+		enc := goldjson.NewEncoder(io.Discard, goldjson.WithByteAccounting(), goldjson.WithMinLevel(1))
+		clone := enc.Clone()
+
+		for _, e := range []*goldjson.Encoder{enc, clone} {
+			line := e.NewLine()
+			line.SetCategory("db")
+			line.AddString("a", "b")
+			_ = line.End()
+		}
+		line := enc.NewLine()
+		line.AddInt64("a", 1)
+		_ = line.End()
+		line, _ = enc.NewLineLevel(0)
+		line.SetCategory("db")
+		_ = line.End()
+		line = enc.NewLine()
+		line.AddInt64("a", 1)
+		_ = line.End()
+		received := enc.ByteAccounts()
+
+		expectEqual(t, 2, len(received))
+		expectEqual(t, goldjson.ByteAccount{Lines: 2, Bytes: 20}, received["db"])
+		expectEqual(t, goldjson.ByteAccount{Lines: 2, Bytes: 16}, received[""])
+	})
+
+	t.Run("failed writes", func(t *testing.T) {
+		enc := goldjson.NewEncoder(ErrorWriter{}, goldjson.WithByteAccounting())
+
+		_ = enc.NewLine().End()
+		received := enc.ByteAccounts()
+
+		expectEqual(t, 0, len(received))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		enc := goldjson.NewEncoder(io.Discard)
+
+		line := enc.NewLine()
+		line.SetCategory("db")
+		_ = line.End()
+		received := enc.ByteAccounts()
+
+		expectEqual(t, true, received == nil)
+	})
+}
+
+func TestQuota(t *testing.T) {
+	writeLines := func(enc *goldjson.Encoder, categories ...string) {
+		for i, category := range categories {
+			line := enc.NewLine()
+			line.SetCategory(category)
+			line.AddInt64("n", int64(i))
+			_ = line.End()
+		}
+	}
+
+	t.Run("drop", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf, goldjson.WithQuota(goldjson.Quota{
+			Bytes:  20,
+			Limits: map[string]int64{"unlimited": 0},
+			Window: time.Hour,
+		}))
+		expected := strings.Join([]string{
+			`{"n":0}`,
+			`{"n":1}`,
+			`{"warning":"quota exceeded","category":"a","limit":20,"window_ns":3600000000000}`,
+			`{"n":4}`,
+			`{"n":5}`,
+			`{"n":6}`,
+			`{"n":7}`,
+			"",
+		}, "\n")
+
+		writeLines(enc, "a", "a", "a", "a", "b", "unlimited", "unlimited", "unlimited")
+		received := buf.String()
+
+		expectEqual(t, expected, received)
+	})
+
+	t.Run("downsample", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf, goldjson.WithQuota(goldjson.Quota{
+			Bytes:     20,
+			Window:    time.Hour,
+			KeepEvery: 2,
+		}))
+		expected := strings.Join([]string{
+			`{"n":0}`,
+			`{"n":1}`,
+			`{"warning":"quota exceeded","category":"","limit":20,"window_ns":3600000000000}`,
+			`{"n":3}`,
+			`{"n":5}`,
+			"",
+		}, "\n")
+
+		writeLines(enc, "", "", "", "", "", "")
+		received := buf.String()
+
+		expectEqual(t, expected, received)
+	})
+
+	t.Run("recovery", func(t *testing.T) {
+		var buf bytes.Buffer
+		var notices []string
+		enc := goldjson.NewEncoder(&buf, goldjson.WithQuota(goldjson.Quota{
+			Bytes:  10,
+			Window: 10 * time.Millisecond,
+			Notice: func(category string, exceeded bool, dropped uint64) {
+				notices = append(notices, fmt.Sprintf("%s %v %d", category, exceeded, dropped))
+			},
+		}))
+
+		writeLines(enc.Clone(), "a", "a", "a")
+		time.Sleep(25 * time.Millisecond)
+		writeLines(enc, "a")
+		received := buf.String()
+
+		expectEqual(t, `{"n":0}`+"\n"+`{"n":0}`+"\n", received)
+		expectEqual(t, "a true 0,a false 2", strings.Join(notices, ","))
+	})
+}
+
+func TestPoolStats(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		enc := goldjson.NewEncoder(io.Discard)
+
+		_ = enc.NewLine().End()
+		received := enc.PoolStats()
+
+		expectEqual(t, goldjson.PoolStats{}, received)
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		if checkedEnabled {
+			t.Skip("lines are not pooled in the checked build")
+		}
+		enc := goldjson.NewEncoder(io.Discard, goldjson.WithPoolStats())
+
+		for i := 0; i < 3; i++ {
+			line := enc.NewLine()
+			line.AddString("a", "b")
+			_ = line.End()
+		}
+		large := enc.NewLine()
+		large.AddString("a", string(make([]byte, 10000)))
+		_ = large.End()
+		received := enc.PoolStats()
+
+		expectEqual(t, 4, received.Lines)
+		expectEqual(t, 4, received.Returned)
+		if received.Misses < 1 || received.Misses > 4 {
+			t.Fatalf("expected 1-4 misses, got %d", received.Misses)
+		}
+		expectEqual(t, int64(received.Returned)-int64(received.Lines-received.Misses), received.Pooled)
+		var total uint64
+		for _, n := range received.BufferCapacityHistogram {
+			total += n
+		}
+		expectEqual(t, 4, total)
+		expectEqual(t, 0, received.BufferCapacityHistogram[goldjson.PoolStatsBuckets-1])
+	})
+}
+
+func TestWarmProfile(t *testing.T) {
+	t.Run("export", func(t *testing.T) {
+		enc := goldjson.NewEncoder(io.Discard, goldjson.WithDynamicKeyCache(8), goldjson.WithPoolStats())
+
+		for _, key := range []string{"b", "a", "b"} {
+			line := enc.NewLine()
+			line.AddString(key, "value")
+			_ = line.End()
+		}
+		received := enc.WarmProfile()
+
+		expectEqual(t, "a,b", strings.Join(received.Keys, ","))
+		if !checkedEnabled {
+			// the lines are not returned to the pool in the checked build
+			expectEqual(t, 64, received.LineSize)
+		}
+		if received.PoolSize < 1 || received.PoolSize > 3 {
+			t.Fatalf("expected a pool size of 1-3, got %d", received.PoolSize)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		enc := goldjson.NewEncoder(io.Discard)
+
+		_ = enc.NewLine().End()
+		received := enc.WarmProfile()
+
+		expectEqual(t, 0, len(received.Keys))
+		expectEqual(t, 0, received.LineSize)
+		expectEqual(t, 0, received.PoolSize)
+	})
+
+	t.Run("load", func(t *testing.T) {
+		data, err := json.Marshal(goldjson.WarmProfile{Keys: []string{"a", "b"}, LineSize: 1024, PoolSize: 4})
+		expectNoError(t, err)
+		var profile goldjson.WarmProfile
+		expectNoError(t, json.Unmarshal(data, &profile))
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf, goldjson.WithWarmProfile(profile), goldjson.WithPoolStats())
+		expected := `{"a":1,"b":2}` + "\n"
+
+		warmed := enc.WarmProfile()
+		line := enc.NewLine()
+		line.AddInt64("a", 1)
+		line.AddInt64("b", 2)
+		_ = line.End()
+		received := buf.String()
+		stats := enc.PoolStats()
+
+		expectEqual(t, expected, received)
+		expectEqual(t, "a,b", strings.Join(warmed.Keys, ","))
+		if !checkedEnabled {
+			expectEqual(t, 4, warmed.PoolSize)
+			expectEqual(t, 1024, warmed.LineSize)
+			expectEqual(t, 5, stats.Returned)
+		}
+		if !checkedEnabled && !raceEnabled {
+			// the race detector makes the pool drop items at random
+			expectEqual(t, 0, stats.Misses)
+		}
+	})
+}
+
+func TestLayout(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     []string
+		build    func(*goldjson.LayoutLine)
+		expected string
+	}{
+		{
+			"all types",
+			[]string{"s", "i", "u", "b", "f", "t", "m"},
+			func(l *goldjson.LayoutLine) {
+				l.AddString("x")
+				l.AddInt64(-1)
+				l.AddUint64(1)
+				l.AddBool(true)
+				l.AddFloat64(1.5)
+				_ = l.AddTime(baseTime)
+				_ = l.AddMarshal(Point{1, 2})
+			},
+			`{"s":"x","i":-1,"u":1,"b":true,"f":1.5,"t":"2023-06-12T20:42:15.152952812Z","m":{"x":1,"y":2}}`,
+		},
+		{
+			"skipped first",
+			[]string{"a", "b", "c"},
+			func(l *goldjson.LayoutLine) {
+				l.Skip()
+				l.AddString("x")
+				l.AddString("y")
+			},
+			`{"b":"x","c":"y"}`,
+		},
+		{
+			"failed first",
+			[]string{"a", "b"},
+			func(l *goldjson.LayoutLine) {
+				_ = l.AddMarshal(ErrorMarshal{})
+				l.AddString("x")
+			},
+			`{"b":"x"}`,
+		},
+		{
+			"escaped keys",
+			[]string{"a\n", "\"b\""},
+			func(l *goldjson.LayoutLine) {
+				l.AddString("x")
+				l.AddString("y")
+			},
+			`{"a\n":"x","\"b\"":"y"}`,
+		},
+		{
+			"partial with dynamic fields",
+			[]string{"a", "b"},
+			func(l *goldjson.LayoutLine) {
+				l.AddString("x")
+				l.Line().AddString("c", "y")
+			},
+			`{"a":"x","c":"y"}`,
+		},
+		{
+			"only dynamic fields",
+			[]string{"a", "b"},
+			func(l *goldjson.LayoutLine) {
+				l.Line().AddString("c", "y")
+			},
+			`{"c":"y"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf)
+			layout := enc.NewLayout(tt.keys...)
+			expected := tt.expected + "\n"
+
+			line := layout.NewLine()
+			tt.build(&line)
+			_ = line.End()
+			received := buf.String()
+
+			expectEqual(t, expected, received)
+		})
+	}
+}
+
+func TestGroup(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []goldjson.Option
+		build    func(*goldjson.LineWriter, *goldjson.Group)
+		expected string
+	}{
+		{
+			"all types",
+			nil,
+			func(l *goldjson.LineWriter, g *goldjson.Group) {
+				r := g.Start(l)
+				r.AddString("x")
+				r.AddInt64(-1)
+				r.AddUint64(1)
+				r.AddBool(true)
+				r.AddFloat64(1.5)
+				_ = r.AddTime(baseTime)
+				_ = r.AddMarshal(Point{1, 2})
+				r.End()
+			},
+			`{"g":{"s":"x","i":-1,"u":1,"b":true,"f":1.5,"t":"2023-06-12T20:42:15.152952812Z","m":{"x":1,"y":2}}}`,
+		},
+		{
+			"between fields",
+			nil,
+			func(l *goldjson.LineWriter, g *goldjson.Group) {
+				l.AddString("a", "b")
+				r := g.Start(l)
+				r.Skip()
+				r.AddInt64(1)
+				r.End()
+				l.AddString("c", "d")
+			},
+			`{"a":"b","g":{"i":1},"c":"d"}`,
+		},
+		{
+			"repeated in list",
+			nil,
+			func(l *goldjson.LineWriter, g *goldjson.Group) {
+				l.StartList("l")
+				for i := 0; i < 2; i++ {
+					r := g.Start(l)
+					r.AddString("x")
+					r.End()
+				}
+				l.EndList()
+			},
+			`{"l":[{"s":"x"},{"s":"x"}]}`,
+		},
+		{
+			"strict duplicate group",
+			[]goldjson.Option{goldjson.WithStrict()},
+			func(l *goldjson.LineWriter, g *goldjson.Group) {
+				for i := 0; i < 2; i++ {
+					r := g.Start(l)
+					r.AddString("x")
+					r.End()
+				}
+			},
+			`{"g":{"s":"x"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf, tt.opts...)
+			g := enc.NewGroup("g", "s", "i", "u", "b", "f", "t", "m")
+			expected := tt.expected + "\n"
+
+			line := enc.NewLine()
+			tt.build(line, g)
+			_ = line.End()
+			received := buf.String()
+
+			expectEqual(t, expected, received)
+		})
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []goldjson.Option
+		build    func(*goldjson.Template, *goldjson.LineWriter)
+		fill     func(*goldjson.TemplateLine)
+		expected string
+	}{
+		{
+			"all types",
+			nil,
+			func(tpl *goldjson.Template, w *goldjson.LineWriter) {
+				for _, key := range []string{"s", "i", "u", "b", "f", "t", "m"} {
+					tpl.Slot(key)
+				}
+			},
+			func(l *goldjson.TemplateLine) {
+				l.AddString("x")
+				l.AddInt64(-1)
+				l.AddUint64(1)
+				l.AddBool(true)
+				l.AddFloat64(1.5)
+				_ = l.AddTime(baseTime)
+				_ = l.AddMarshal(Point{1, 2})
+			},
+			`{"s":"x","i":-1,"u":1,"b":true,"f":1.5,"t":"2023-06-12T20:42:15.152952812Z","m":{"x":1,"y":2}}`,
+		},
+		{
+			"between fields",
+			nil,
+			func(tpl *goldjson.Template, w *goldjson.LineWriter) {
+				w.AddString("a", "b")
+				tpl.Slot("s")
+				w.StartRecord("r")
+				w.AddInt64("c", 1)
+				w.EndRecord()
+				tpl.Slot("i")
+				w.AddString("d", "e")
+			},
+			func(l *goldjson.TemplateLine) {
+				l.AddString("x")
+				l.AddInt64(2)
+			},
+			`{"a":"b","s":"x","r":{"c":1},"i":2,"d":"e"}`,
+		},
+		{
+			"skipped slots",
+			nil,
+			func(tpl *goldjson.Template, w *goldjson.LineWriter) {
+				tpl.Slot("s")
+				w.AddString("a", "b")
+				tpl.Slot("i")
+				tpl.Slot("u")
+				w.AddString("c", "d")
+				tpl.Slot("b")
+			},
+			func(l *goldjson.TemplateLine) {
+				l.Skip()
+				l.Skip()
+				l.AddUint64(1)
+			},
+			`{"a":"b","u":1,"c":"d"}`,
+		},
+		{
+			"no slots",
+			nil,
+			func(tpl *goldjson.Template, w *goldjson.LineWriter) {
+				w.AddString("a", "b")
+			},
+			func(l *goldjson.TemplateLine) {},
+			`{"a":"b","dynamic":true}`,
+		},
+		{
+			"only slots",
+			nil,
+			func(tpl *goldjson.Template, w *goldjson.LineWriter) {
+				tpl.Slot("s")
+			},
+			func(l *goldjson.TemplateLine) {
+				l.AddString("x")
+			},
+			`{"s":"x","dynamic":true}`,
+		},
+		{
+			"strict duplicate slot",
+			[]goldjson.Option{goldjson.WithStrict()},
+			func(tpl *goldjson.Template, w *goldjson.LineWriter) {
+				w.AddString("a", "b")
+				tpl.Slot("s")
+				w.AddString("c", "d")
+				tpl.Slot("a")
+			},
+			func(l *goldjson.TemplateLine) {
+				l.AddString("x")
+				l.AddString("y")
+			},
+			`{"a":"b","s":"x","c":"d"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf, tt.opts...)
+			tpl, w := enc.NewTemplate()
+			tt.build(tpl, w)
+			expectNoError(t, w.End())
+			expected := strings.Repeat(tt.expected+"\n", 2)
+
+			for i := 0; i < 2; i++ {
+				line := tpl.NewLine()
+				tt.fill(&line)
+				l := line.Line()
+				if strings.Contains(tt.expected, "dynamic") {
+					l.AddBool("dynamic", true)
+				}
+				_ = l.End()
+			}
+			received := buf.String()
+
+			expectEqual(t, expected, received)
+		})
+	}
+
+	t.Run("nested slot", func(t *testing.T) {
+		enc := goldjson.NewEncoder(io.Discard)
+		tpl, w := enc.NewTemplate()
+		w.StartRecord("r")
+		defer func() {
+			expectEqual(t, true, recover() != nil)
+		}()
+
+		tpl.Slot("s")
+	})
+}
+
+func TestScope(t *testing.T) {
+	newFields := func(key, value string) *goldjson.StaticFields {
+		f, fw := goldjson.NewStaticFields()
+		fw.AddString(key, value)
+		_ = fw.End()
+		return f
+	}
+	empty, emptyWriter := goldjson.NewStaticFields()
+	_ = emptyWriter.End()
+
+	tests := []struct {
+		name     string
+		build    func(*goldjson.Scope) *goldjson.Scope
+		expected string
+	}{
+		{
+			"no fields",
+			func(s *goldjson.Scope) *goldjson.Scope { return s },
+			`{"x":"y"}`,
+		},
+		{
+			"empty fields",
+			func(s *goldjson.Scope) *goldjson.Scope { return s.With(empty) },
+			`{"x":"y"}`,
+		},
+		{
+			"one set of fields",
+			func(s *goldjson.Scope) *goldjson.Scope { return s.With(newFields("a", "b")) },
+			`{"a":"b","x":"y"}`,
+		},
+		{
+			"accumulated fields",
+			func(s *goldjson.Scope) *goldjson.Scope {
+				return s.With(newFields("a", "b")).With(empty).With(newFields("c", "d"))
+			},
+			`{"a":"b","c":"d","x":"y"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf)
+			ctx := goldjson.ContextWithScope(context.Background(), tt.build(goldjson.NewScope(enc)))
+			expected := tt.expected + "\n"
+
+			line := goldjson.FromContext(ctx).NewLine()
+			line.AddString("x", "y")
+			_ = line.End()
+			received := buf.String()
+
+			expectEqual(t, expected, received)
+		})
+	}
+
+	t.Run("missing", func(t *testing.T) {
+		received := goldjson.FromContext(context.Background())
+
+		expectEqual(t, nil, received)
+	})
+
+	t.Run("nil scope", func(t *testing.T) {
+		ctx := context.Background()
+		scope := goldjson.FromContext(ctx).With(newFields("a", "b"))
+		ctx = goldjson.ContextWithScope(ctx, scope)
+
+		line := goldjson.FromContext(ctx).NewLine()
+		line.AddString("x", "y")
+		expectNoError(t, line.End())
+		line = goldjson.FromContext(context.Background()).NewLine()
+		line.AddString("x", "y")
+		expectNoError(t, line.End())
+	})
+}
+
+func TestTenants(t *testing.T) {
+	newFields := func(key, value string) *goldjson.StaticFields {
+		f, fw := goldjson.NewStaticFields()
+		fw.AddString(key, value)
+		_ = fw.End()
+		return f
+	}
+	var buf bytes.Buffer
+	enc := goldjson.NewEncoder(&buf)
+	const key = "acme_key"
+	enc.AddTenant("acme", newFields("tenant", "acme")).PrepareKey(key)
+	enc.AddTenant("globex", newFields("tenant", "globex"))
+
+	for _, tenant := range []string{"acme", "globex", "unknown"} {
+		line := enc.NewLineFor(tenant)
+		line.AddString(key, "y")
+		_ = line.End()
+	}
+	expected := `{"tenant":"acme","acme_key":"y"}` + "\n" +
+		`{"tenant":"globex","acme_key":"y"}` + "\n" +
+		`{"acme_key":"y"}` + "\n"
+	received := buf.String()
+
+	expectEqual(t, expected, received)
+}
+
+func TestDetach(t *testing.T) {
+	var buf bytes.Buffer
+	enc := goldjson.NewEncoder(&buf, goldjson.WithMinLevel(1))
+	first := enc.NewLine()
+	first.AddString("a", "b")
+	second := enc.NewLine()
+	second.AddString("c", "d")
+	suppressed, _ := enc.NewLineLevel(0)
+	suppressed.AddString("e", "f")
+
+	receivedFirst := first.Detach()
+	receivedSecond := second.Detach()
+	receivedSuppressed := suppressed.Detach()
+	expectEqual(t, `{"a":"b"}`+"\n", string(receivedFirst))
+	expectEqual(t, `{"c":"d"}`+"\n", string(receivedSecond))
+	expectEqual(t, true, receivedSuppressed == nil)
+	expectEqual(t, 0, buf.Len())
+
+	line := enc.NewLine()
+	line.AddString("g", "h")
+	_ = line.End()
+	expectEqual(t, `{"a":"b"}`+"\n", string(receivedFirst))
+	expectEqual(t, `{"g":"h"}`+"\n", buf.String())
+}
+
+func TestEndTo(t *testing.T) {
+	var buf bytes.Buffer
+	enc := goldjson.NewEncoder(&buf, goldjson.WithMinLevel(1), goldjson.WithKeyValidation(goldjson.KeyValidation{RejectEmpty: true}))
+	expected := `{"a":"b"}` + "\n" + `{"c":"d"}` + "\n"
+
+	var received []byte
+	line := enc.NewLine()
+	line.AddString("a", "b")
+	received, firstErr := line.EndTo(received)
+	suppressed, _ := enc.NewLineLevel(0)
+	suppressed.AddString("e", "f")
+	received, suppressedErr := suppressed.EndTo(received)
+	line = enc.NewLine()
+	line.AddString("c", "d")
+	line.AddString("", "rejected")
+	received, secondErr := line.EndTo(received)
+
+	expectEqual(t, expected, string(received))
+	expectNoError(t, firstErr)
+	expectNoError(t, suppressedErr)
+	expectError(t, secondErr)
+	expectEqual(t, 0, buf.Len())
+}
+
+func TestDiscard(t *testing.T) {
+	t.Run("open records", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf, goldjson.WithStrict())
+
+		for i := 0; i < 3; i++ {
+			line := enc.NewLine()
+			line.AddString("a", "b")
+			line.StartRecord("c")
+			line.StartList("d")
+			line.Discard()
+		}
+		line := enc.NewLine()
+		line.AddString("a", "b")
+		_ = line.End()
+		received := buf.String()
+
+		expectEqual(t, `{"a":"b"}`+"\n", received)
+	})
+
+	t.Run("deeply nested", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf)
+
+		line := enc.NewLine()
+		for i := 0; i < 100; i++ {
+			line.StartRecord("a")
+		}
+		line.Discard()
+		line = enc.NewLine()
+		line.StartRecord("a")
+		line.EndRecord()
+		_ = line.End()
+		received := buf.String()
+
+		expectEqual(t, `{"a":{}}`+"\n", received)
+	})
+
+	t.Run("emergency", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf)
+
+		line := enc.EmergencyLine()
+		line.AddString("a", "b")
+		line.Discard()
+
+		expectEqual(t, 0, buf.Len())
+	})
+	t.Run("emergency flushes bufio.Writer", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(bufio.NewWriter(&buf), goldjson.WithLocking())
+
+		line := enc.NewLine()
+		line.AddString("a", "buffered")
+		expectNoError(t, line.End())
+		line = enc.EmergencyLine()
+		line.AddString("a", "emergency")
+		err := line.End()
+
+		expectNoError(t, err)
+		expectEqual(t, `{"a":"buffered"}`+"\n"+`{"a":"emergency"}`+"\n", buf.String())
+	})
+}
+
+func TestUseAfterEndCheck(t *testing.T) {
+	expectPanic := func(t *testing.T, f func()) {
+		t.Helper()
+		defer func() {
+			t.Helper()
+			expectEqual(t, "goldjson: LineWriter used after End", recover())
+		}()
+		f()
+	}
+
+	staticFields, staticLine := goldjson.NewStaticFields()
+	staticLine.AddString("c", "d")
+	expectNoError(t, staticLine.End())
+
+	tests := []struct {
+		name string
+		use  func(l *goldjson.LineWriter)
+	}{
+		{"add", func(l *goldjson.LineWriter) { l.AddString("c", "d") }},
+		{"start record", func(l *goldjson.LineWriter) { l.StartRecord("c") }},
+		{"end record", func(l *goldjson.LineWriter) { l.EndRecord() }},
+		{"end record omit empty", func(l *goldjson.LineWriter) { l.EndRecordOmitEmpty() }},
+		{"end list", func(l *goldjson.LineWriter) { l.EndList() }},
+		{"static fields", func(l *goldjson.LineWriter) { l.AddStaticFields(staticFields) }},
+		{"end", func(l *goldjson.LineWriter) { _ = l.End() }},
+		{"detach", func(l *goldjson.LineWriter) { _ = l.Detach() }},
+		{"discard", func(l *goldjson.LineWriter) { l.Discard() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf, goldjson.WithUseAfterEndCheck())
+			line := enc.NewLine()
+			line.AddString("a", "b")
+			expectNoError(t, line.End())
+
+			expectPanic(t, func() { tt.use(line) })
+			expectEqual(t, `{"a":"b"}`+"\n", buf.String())
+		})
+	}
+
+	t.Run("detached", func(t *testing.T) {
+		enc := goldjson.NewEncoder(io.Discard, goldjson.WithUseAfterEndCheck())
+		line := enc.NewLine()
+		line.AddString("a", "b")
+		received := line.Detach()
+
+		expectPanic(t, func() { line.AddString("c", "d") })
+		expectEqual(t, `{"a":"b"}`+"\n", string(received))
+	})
+
+	t.Run("not reused", func(t *testing.T) {
+		enc := goldjson.NewEncoder(io.Discard, goldjson.WithUseAfterEndCheck())
+		line := enc.NewLine()
+		expectNoError(t, line.End())
+		next := enc.NewLine()
+		next.AddString("a", "b")
+
+		expectPanic(t, func() { line.AddString("c", "d") })
+		expectEqual(t, `{"a":"b"}`+"\n", string(next.Detach()))
+	})
+}
+
+func TestDictionarySampler(t *testing.T) {
+	writeLines := func(enc *goldjson.Encoder, from, to int) {
+		for i := from; i < to; i++ {
+			line := enc.NewLine()
+			line.AddString("service", "checkout")
+			line.AddString("message", "request handled")
+			line.AddInt64("seq", int64(i))
+			_ = line.End()
+		}
+	}
+
+	t.Run("samples", func(t *testing.T) {
+		var buf bytes.Buffer
+		s := goldjson.NewDictionarySampler(&buf, 2, 1024)
+		enc := goldjson.NewEncoder(s)
+		expectEqual(t, true, s.Dictionary() == nil)
+
+		writeLines(enc, 0, 4)
+		expectEqual(t, 4, strings.Count(buf.String(), "\n"))
+		expectedDict := `{"service":"checkout","message":"request handled","seq":1}` + "\n" +
+			`{"service":"checkout","message":"request handled","seq":3}` + "\n"
+		expectEqual(t, expectedDict, string(s.Dictionary()))
+	})
+
+	t.Run("max size", func(t *testing.T) {
+		s := goldjson.NewDictionarySampler(io.Discard, 1, 100)
+		writeLines(goldjson.NewEncoder(s), 0, 3)
+		expected := `{"service":"checkout","message":"request handled","seq":2}` + "\n"
+		received := string(s.Dictionary())
+
+		expectEqual(t, expected, received)
+	})
+
+	t.Run("compression", func(t *testing.T) {
+		compressedSize := func(dict []byte) int {
+			var buf bytes.Buffer
+			fw, _ := flate.NewWriterDict(&buf, flate.BestCompression, dict)
+			writeLines(goldjson.NewEncoder(fw), 1000, 1001)
+			_ = fw.Close()
+			return buf.Len()
+		}
+		s := goldjson.NewDictionarySampler(io.Discard, 1, 4096)
+		writeLines(goldjson.NewEncoder(s), 0, 10)
+
+		expectEqual(t, true, compressedSize(s.Dictionary()) < compressedSize(nil))
+	})
+}
+
+func TestChainWriter(t *testing.T) {
+	keys := goldjson.KeySet{"k1": []byte("secret1"), "k2": []byte("secret2")}
+	writeLines := func(w io.Writer, from, to int) {
+		enc := goldjson.NewEncoder(w)
+		for i := from; i < to; i++ {
+			line := enc.NewLine()
+			if i%2 == 1 {
+				line.AddInt64("seq", int64(i))
+			}
+			_ = line.End()
+		}
+	}
+	signed := func() (string, []byte) {
+		var buf bytes.Buffer
+		w := goldjson.NewChainWriter(&buf, "k1", keys["k1"])
+		writeLines(w, 0, 2)
+		// rotate the key, continuing the chain
+		rotated := goldjson.NewChainWriter(&buf, "k2", keys["k2"])
+		rotated.Resume(w.Digest())
+		writeLines(rotated, 2, 4)
+		return buf.String(), rotated.Digest()
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		log, digest := signed()
+		lines := strings.Split(log, "\n")
+
+		report, err := goldjson.VerifyFile(strings.NewReader(log), keys)
+
+		expectNoError(t, err)
+		expectEqual(t, 4, report.Lines)
+		expectEqual(t, string(digest), string(report.Digest))
+		expectEqual(t, true, strings.HasPrefix(lines[0], `{"chain":"hmac-sha256:k1:`))
+		expectEqual(t, true, strings.HasPrefix(lines[3], `{"seq":3,"chain":"hmac-sha256:k2:`))
+	})
+
+	t.Run("plain", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := goldjson.NewChainWriter(&buf, "", nil)
+		writeLines(w, 0, 3)
+
+		report, err := goldjson.VerifyFile(bytes.NewReader(buf.Bytes()), nil)
+		_, errWithKeys := goldjson.VerifyFile(bytes.NewReader(buf.Bytes()), keys)
+
+		expectNoError(t, err)
+		expectEqual(t, 3, report.Lines)
+		expectEqual(t, true, strings.HasPrefix(buf.String(), `{"chain":"sha256:`))
+		expectEqual(t, `goldjson: integrity check failed on line 1: invalid chain field`, errWithKeys.Error())
+	})
+
+	tamper := []struct {
+		name     string
+		modify   func(lines []string) []string
+		keys     goldjson.KeySet
+		expected string
+	}{
+		{
+			name: "modified",
+			modify: func(lines []string) []string {
+				lines[1] = strings.Replace(lines[1], `"seq":1`, `"seq":9`, 1)
+				return lines
+			},
+			expected: "on line 2: digest mismatch",
+		},
+		{
+			name:     "removed",
+			modify:   func(lines []string) []string { return append(lines[:1], lines[2:]...) },
+			expected: "on line 2: digest mismatch",
+		},
+		{
+			name: "reordered",
+			modify: func(lines []string) []string {
+				lines[1], lines[2] = lines[2], lines[1]
+				return lines
+			},
+			expected: "on line 2: digest mismatch",
+		},
+		{
+			name: "inserted",
+			modify: func(lines []string) []string {
+				return append(lines[:2], append([]string{`{"seq":9}`}, lines[2:]...)...)
+			},
+			expected: "on line 3: missing chain field",
+		},
+		{
+			name: "truncated",
+			modify: func(lines []string) []string {
+				lines[3] = lines[3][:10]
+				return lines
+			},
+			expected: "on line 4: truncated line",
+		},
+		{
+			name:     "unknown key",
+			modify:   func(lines []string) []string { return lines },
+			keys:     goldjson.KeySet{"k1": keys["k1"]},
+			expected: `on line 3: unknown key ID "k2"`,
+		},
+		{
+			name:     "wrong key",
+			modify:   func(lines []string) []string { return lines },
+			keys:     goldjson.KeySet{"k1": keys["k1"], "k2": keys["k1"]},
+			expected: "on line 3: digest mismatch",
+		},
+	}
+
+	for _, tt := range tamper {
+		t.Run(tt.name, func(t *testing.T) {
+			log, _ := signed()
+			lines := tt.modify(strings.Split(strings.TrimSuffix(log, "\n"), "\n"))
+			log = strings.Join(lines, "\n")
+			if tt.name != "truncated" {
+				log += "\n"
+			}
+			verifyKeys := keys
+			if tt.keys != nil {
+				verifyKeys = tt.keys
+			}
+
+			_, err := goldjson.VerifyFile(strings.NewReader(log), verifyKeys)
+
+			expectEqual(t, true, errors.Is(err, goldjson.ErrIntegrity))
+			expectEqual(t, "goldjson: integrity check failed "+tt.expected, err.Error())
+		})
+	}
+
+	t.Run("not a record", func(t *testing.T) {
+		w := goldjson.NewChainWriter(io.Discard, "", nil)
+
+		_, err := w.Write([]byte("[1]\n"))
+
+		expectError(t, err)
+	})
+
+	t.Run("read error", func(t *testing.T) {
+		_, err := goldjson.VerifyFile(iotest.ErrReader(errors.New("oops")), nil)
+
+		expectEqual(t, "oops", err.Error())
+	})
+}
+
+func TestIndexWriter(t *testing.T) {
+	var buf, sidecar bytes.Buffer
+	w := goldjson.NewIndexWriter(&buf, "request_id", &sidecar)
+	enc := goldjson.NewEncoder(w)
+	for i, id := range []string{"a", "b", "", "a\n", "a"} {
+		line := enc.NewLine()
+		if id != "" {
+			line.AddString("request_id", id)
+		}
+		line.AddInt64("seq", int64(i))
+		_ = line.End()
+	}
+	line := enc.NewLine()
+	line.AddInt64("request_id", 5)
+	_ = line.End()
+	readLines := func(x *goldjson.Index, value string) string {
+		var lines []string
+		err := x.ReadLines(bytes.NewReader(buf.Bytes()), value, func(line []byte) error {
+			lines = append(lines, string(line))
+			return nil
+		})
+		expectNoError(t, err)
+		return strings.Join(lines, "|")
+	}
+
+	t.Run("in memory", func(t *testing.T) {
+		x := w.Index()
+
+		expectEqual(t, `{"request_id":"a","seq":0}|{"request_id":"a","seq":4}`, readLines(x, "a"))
+		expectEqual(t, `{"request_id":"a\n","seq":3}`, readLines(x, "a\n"))
+		expectEqual(t, `{"request_id":5}`, readLines(x, "5"))
+		expectEqual(t, "", readLines(x, "missing"))
+		expectEqual(t, 2, len(x.Lookup("a")))
+		expectEqual(t, goldjson.IndexEntry{Offset: 27, Size: 27}, x.Lookup("b")[0])
+	})
+
+	t.Run("sidecar", func(t *testing.T) {
+		x, err := goldjson.LoadIndex(bytes.NewReader(sidecar.Bytes()))
+
+		expectNoError(t, err)
+		expectEqual(t, 5, strings.Count(sidecar.String(), "\n"))
+		expectEqual(t, `{"value":"b","offset":27,"size":27}`, strings.Split(sidecar.String(), "\n")[1])
+		expectEqual(t, `{"request_id":"a","seq":0}|{"request_id":"a","seq":4}`, readLines(x, "a"))
+		expectEqual(t, `{"request_id":5}`, readLines(x, "5"))
+	})
+
+	t.Run("offset", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := goldjson.NewIndexWriter(&buf, "id", nil)
+		w.SetOffset(100)
+		_, _ = w.Write([]byte(`{"id":"x"}` + "\n"))
+
+		expectEqual(t, goldjson.IndexEntry{Offset: 100, Size: 11}, w.Index().Lookup("x")[0])
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		x := w.Index()
+		errStop := errors.New("stop")
+		n := 0
+
+		err := x.ReadLines(bytes.NewReader(buf.Bytes()), "a", func([]byte) error {
+			n++
+			return errStop
+		})
+		errRead := x.ReadLines(bytes.NewReader(nil), "a", func([]byte) error { return nil })
+		_, errLoad := goldjson.LoadIndex(strings.NewReader(`{"value":1}`))
+
+		expectEqual(t, errStop, err)
+		expectEqual(t, 1, n)
+		expectEqual(t, io.EOF, errRead)
+		expectEqual(t, true, errors.Is(errLoad, goldjson.ErrValueType))
+	})
+}
+
+func TestCheckpointWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := goldjson.NewCheckpointWriter(&buf, 2)
+	enc := goldjson.NewEncoder(w)
+	for i := 0; i < 5; i++ {
+		line := enc.NewLine()
+		line.AddInt64("seq", int64(i))
+		_ = line.End()
+	}
+	log := buf.Bytes()
+	readAll := func(r *goldjson.CheckpointReader) string {
+		var lines []string
+		for r.Next() {
+			lines = append(lines, string(r.Line()))
+		}
+		expectNoError(t, r.Err())
+		return strings.Join(lines, "|")
+	}
+
+	t.Run("checkpoint lines", func(t *testing.T) {
+		lines := strings.Split(string(log), "\n")
+
+		expectEqual(t, 8, len(lines))
+		expectEqual(t, true, strings.HasPrefix(lines[2], `{"checkpoint":{"seq":1,"offset":20,"hash":"sha256:`))
+		expectEqual(t, true, strings.HasPrefix(lines[5], `{"checkpoint":{"seq":2,"offset":`))
+	})
+
+	t.Run("from the beginning", func(t *testing.T) {
+		r := goldjson.NewCheckpointReader(bytes.NewReader(log))
+
+		expectEqual(t, `{"seq":0}|{"seq":1}|{"seq":2}|{"seq":3}|{"seq":4}`, readAll(r))
+		expectEqual(t, uint64(2), r.Checkpoint().Seq)
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		r := goldjson.NewCheckpointReader(bytes.NewReader(log))
+		for r.Next() && r.Checkpoint().Seq == 0 {
+		}
+		first := r.Checkpoint()
+
+		resumed, err := goldjson.ResumeCheckpointReader(bytes.NewReader(log), first)
+		expectNoError(t, err)
+
+		expectEqual(t, uint64(1), first.Seq)
+		expectEqual(t, first.Seq, resumed.Checkpoint().Seq)
+		expectEqual(t, `{"seq":2}|{"seq":3}|{"seq":4}`, readAll(resumed))
+	})
+
+	t.Run("resume from a missing checkpoint", func(t *testing.T) {
+		r := goldjson.NewCheckpointReader(bytes.NewReader(log))
+		readAll(r)
+		last := r.Checkpoint()
+		replaced := bytes.Replace(log, []byte(`{"seq":0}`), []byte(`{"seq":00}`), 1)
+
+		_, err := goldjson.ResumeCheckpointReader(bytes.NewReader(replaced), last)
+
+		expectEqual(t, true, errors.Is(err, goldjson.ErrCheckpoint))
+		expectEqual(t, "goldjson: checkpoint mismatch at offset 158: checkpoint not found", err.Error())
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			log      []byte
+			expected string
+		}{
+			{"modified line", bytes.Replace(log, []byte(`{"seq":1}`), []byte(`{"seq":7}`), 1), "at offset 20: hash mismatch"},
+			{"removed line", bytes.Replace(log, []byte(`{"seq":3}`+"\n"), nil, 1), "at offset 148: offset mismatch: 158"},
+			{"removed first line", log[bytes.IndexByte(log, '\n')+1:], "at offset 10: offset mismatch: 20"},
+			{"invalid checkpoint", bytes.Replace(log, []byte(`"seq":1,`), []byte(`"seq":true,`), 1), "at offset 20: invalid checkpoint line"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				r := goldjson.NewCheckpointReader(bytes.NewReader(tt.log))
+				for r.Next() {
+				}
+				err := r.Err()
+
+				expectEqual(t, true, errors.Is(err, goldjson.ErrCheckpoint))
+				expectEqual(t, "goldjson: checkpoint mismatch "+tt.expected, err.Error())
+			})
+		}
+	})
+
+	t.Run("growing log", func(t *testing.T) {
+		var growing bytes.Buffer
+		r := goldjson.NewCheckpointReader(&growing)
+
+		growing.Write(log[:5])
+		expectEqual(t, false, r.Next())
+		growing.Write(log[5:12])
+		expectEqual(t, true, r.Next())
+		expectEqual(t, `{"seq":0}`, string(r.Line()))
+		expectEqual(t, false, r.Next())
+		growing.Write(log[12:])
+
+		expectEqual(t, `{"seq":1}|{"seq":2}|{"seq":3}|{"seq":4}`, readAll(r))
+	})
+
+	t.Run("resume writing", func(t *testing.T) {
+		appended := bytes.NewBuffer(append([]byte(nil), log...))
+		w := goldjson.NewCheckpointWriter(appended, 0)
+		expectNoError(t, w.Resume(bytes.NewReader(log)))
+		enc := goldjson.NewEncoder(w)
+		line := enc.NewLine()
+		line.AddInt64("seq", 5)
+		_ = line.End()
+		expectNoError(t, w.Checkpoint())
+
+		r := goldjson.NewCheckpointReader(appended)
+
+		expectEqual(t, `{"seq":0}|{"seq":1}|{"seq":2}|{"seq":3}|{"seq":4}|{"seq":5}`, readAll(r))
+		expectEqual(t, uint64(3), r.Checkpoint().Seq)
+	})
+
+	t.Run("resume writing after a partial line", func(t *testing.T) {
+		w := goldjson.NewCheckpointWriter(io.Discard, 0)
+
+		err := w.Resume(bytes.NewReader(log[:len(log)-1]))
+
+		expectError(t, err)
+	})
+}
+
+func TestBackfill(t *testing.T) {
+	tests := []struct {
+		name     string
+		window   int
+		offsets  []int
+		expected string
+	}{
+		{"no window", 0, []int{2, 1, 3}, "2,1,3,"},
+		{"ordered", 2, []int{1, 2, 3, 4}, "1,2,3,4,"},
+		{"reordered within window", 2, []int{3, 1, 2, 5, 4}, "1,2,3,4,5,"},
+		{"out of order beyond window", 1, []int{3, 2, 1}, "2,1,3,"},
+		{"equal timestamps", 3, []int{2, 1, 2, 1}, "1,1,2,2,"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf, goldjson.WithMinLevel(1))
+			b := enc.NewBackfill(tt.window)
+			for _, offset := range tt.offsets {
+				line := enc.NewLine()
+				line.AddInt64("offset", int64(offset))
+				expectNoError(t, b.End(line, baseTime.Add(time.Duration(offset)*time.Second)))
+			}
+			suppressed, _ := enc.NewLineLevel(0)
+			expectNoError(t, b.End(suppressed, baseTime))
+			expectNoError(t, b.Flush())
+			var received strings.Builder
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				var v struct{ Offset int }
+				_ = json.Unmarshal([]byte(line), &v)
+				fmt.Fprintf(&received, "%d,", v.Offset)
+			}
+
+			expectEqual(t, tt.expected, received.String())
+		})
+	}
+
+	t.Run("write error", func(t *testing.T) {
+		enc := goldjson.NewEncoder(ErrorWriter{})
+		b := enc.NewBackfill(0)
+		line := enc.NewLine()
+		line.AddString("a", "b")
+
+		expectError(t, b.End(line, baseTime))
+	})
+
+	t.Run("quota, accounting and sticky errors", func(t *testing.T) {
+		var buf bytes.Buffer
+		var notices []string
+		enc := goldjson.NewEncoder(&buf,
+			goldjson.WithQuota(goldjson.Quota{Bytes: 20, Window: time.Hour, Notice: func(category string, exceeded bool, dropped uint64) {
+				notices = append(notices, fmt.Sprintf("%s %v", category, exceeded))
+			}}),
+			goldjson.WithByteAccounting(),
+			goldjson.WithStickyErrors(),
+		)
+		b := enc.NewBackfill(1)
+		var errs []error
+		for i := 3; i > 0; i-- {
+			line := enc.NewLine()
+			line.SetCategory("a")
+			line.AddInt64("offset", int64(i))
+			if i == 2 {
+				_ = line.AddMarshal("bad", ErrorMarshal{})
+			}
+			errs = append(errs, b.End(line, baseTime.Add(time.Duration(i)*time.Second)))
+		}
+		errs = append(errs, b.Flush())
+
+		expectEqual(t, "<nil> true <nil> <nil>", fmt.Sprint(errs[0], errs[1] != nil, errs[2], errs[3]))
+		expectEqual(t, `{"offset":2}`+"\n", buf.String())
+		expectEqual(t, "a true", strings.Join(notices, ","))
+		expectEqual(t, goldjson.ByteAccount{Lines: 1, Bytes: 13}, enc.ByteAccounts()["a"])
+	})
+}
+
+func TestLineID(t *testing.T) {
+	t.Run("generator", func(t *testing.T) {
+		var buf bytes.Buffer
+		var seq uint64
+		enc := goldjson.NewEncoder(&buf, goldjson.WithStrict(), goldjson.WithLineID("id", func(buf []byte) []byte {
+			seq++
+			return tokens.AppendUint64(buf, seq)
+		}))
+		fields, fw := enc.NewStaticFields()
+		fw.AddString("service", "checkout")
+		_ = fw.End()
+
+		line := enc.NewLine()
+		line.AddStaticFields(fields)
+		line.AddString("id", "duplicate")
+		_ = line.End()
+		line = enc.NewLine()
+		line.AddString("a", "b")
+		_ = line.End()
+		list := enc.NewListLine()
+		list.AddString("", "c")
+		_ = list.End()
+		expected := `{"id":1,"service":"checkout"}` + "\n" + `{"id":2,"a":"b"}` + "\n" + `["c"]` + "\n"
+		received := buf.String()
+
+		expectEqual(t, expected, received)
+	})
+
+	t.Run("UUIDv7", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf, goldjson.WithLineID("id", goldjson.UUIDv7))
+		for i := 0; i < 100; i++ {
+			_ = enc.NewLine().End()
+		}
+		format := regexp.MustCompile(`^\{"id":"[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}"\}$`)
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		for i, line := range lines {
+			expectEqual(t, true, format.MatchString(line))
+			if i > 0 {
+				expectEqual(t, true, lines[i-1] < line)
+			}
+		}
+		expectEqual(t, 100, len(lines))
+	})
+}
+
+func TestEventVersion(t *testing.T) {
+	registry := goldjson.EventRegistry{
+		1: {{Key: "msg"}},
+		2: {{Key: "id"}, {Key: "message"}, {Key: "status"}},
+	}
+
+	t.Run("stamp", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf, goldjson.WithEventVersion("v", 3, registry))
+		line := enc.NewLine()
+		line.AddString("anything", "goes")
+		expectNoError(t, line.End())
+		list := enc.NewListLine()
+		list.AddString("", "a")
+		expectNoError(t, list.End())
+		expected := `{"v":3,"anything":"goes"}` + "\n" + `["a"]` + "\n"
+		received := buf.String()
+
+		expectEqual(t, expected, received)
+	})
+
+	t.Run("declared fields", func(t *testing.T) {
+		var buf bytes.Buffer
+		var seq uint64
+		enc := goldjson.NewEncoder(&buf, goldjson.WithEventVersion("v", 2, registry), goldjson.WithLineID("id", func(buf []byte) []byte {
+			seq++
+			return tokens.AppendUint64(buf, seq)
+		}))
+		fields, fw := enc.NewStaticFields()
+		fw.AddString("service", "checkout")
+		expectNoError(t, fw.End())
+		line := enc.NewLineWith(fields)
+		line.AddString("message", "hello")
+		line.AddString("msg", "hello")
+		line.StartRecord("status")
+		line.AddInt64("code", 200)
+		line.EndRecord()
+		err := line.End()
+		expected := `{"id":1,"v":2,"service":"checkout","message":"hello","status":{"code":200}}` + "\n"
+		received := buf.String()
+
+		expectEqual(t, expected, received)
+		var keyErr *goldjson.KeyError
+		expectEqual(t, true, errors.As(err, &keyErr))
+		expectEqual(t, "msg", keyErr.Key)
+		expectEqual(t, `goldjson: invalid key "msg": not declared for event version 2`, err.Error())
+	})
+}
+
+func TestClockSkew(t *testing.T) {
+	var buf bytes.Buffer
+	skew := 1500 * time.Millisecond
+	enc := goldjson.NewEncoder(&buf, goldjson.WithClockSkew("skew_ns", func() time.Duration { return skew }))
+	fields, fieldsWriter := enc.NewStaticFields()
+	_ = fieldsWriter.AddTime("static", baseTime)
+	_ = fieldsWriter.End()
+	layout := enc.NewLayout("layout")
+
+	line := enc.NewLine()
+	_ = line.AddTime("time", baseTime)
+	_ = line.AddTimeList("times", []time.Time{baseTime})
+	line.AddStaticFields(fields)
+	_ = line.End()
+	skew = -time.Second
+	ll := layout.NewLine()
+	_ = ll.AddTime(baseTime)
+	_ = ll.End()
+	list := enc.NewListLine()
+	_ = list.AddTime("", baseTime)
+	_ = list.End()
+	nested := enc.NewListLine()
+	for i := 0; i < 70; i++ {
+		nested.StartList("")
+	}
+	_ = nested.AddTime("", baseTime)
+	for i := 0; i < 70; i++ {
+		nested.EndList()
+	}
+	_ = nested.End()
+
+	expected := `{"skew_ns":1500000000,"time":"2023-06-12T20:42:16.652952812Z","times":["2023-06-12T20:42:16.652952812Z"],"static":"2023-06-12T20:42:15.152952812Z"}` + "\n" +
+		`{"skew_ns":-1000000000,"layout":"2023-06-12T20:42:14.152952812Z"}` + "\n" +
+		`["2023-06-12T20:42:14.152952812Z"]` + "\n" +
+		`[` + strings.Repeat("[", 70) + `"2023-06-12T20:42:14.152952812Z"` + strings.Repeat("]", 70) + `]` + "\n"
+	received := buf.String()
+
+	expectEqual(t, expected, received)
+}
+
+func TestReplaceValue(t *testing.T) {
+	var kinds []string
+	hook := func(key string, kind goldjson.Kind, value any) (any, bool) {
+		kinds = append(kinds, kind.String())
+		switch key {
+		case "user_id":
+			return "hashed:" + value.(string), true
+		case "duration_ms":
+			return value.(float64) * 1000, true
+		case "ratio":
+			return value.(float32) * 100, true
+		case "drop":
+			return nil, true
+		case "bad":
+			return ErrorMarshal{}, true
+		case "secret":
+			return []byte("x"), true
+		case "level":
+			if value.(int) >= 12 {
+				return "FATAL", true
+			}
+		}
+		return nil, false
+	}
+	var buf bytes.Buffer
+	enc := goldjson.NewEncoder(&buf, goldjson.WithReplaceValue(hook))
+
+	line := enc.NewLine()
+	line.AddString("user_id", "1234")
+	line.AddSafeString("name", "x")
+	line.AddFloat64("duration_ms", 1.5)
+	line.AddFloat32("ratio", 0.25)
+	line.AddInt64("drop", 1)
+	line.AddUint64("u", 2)
+	line.AddBool("b", true)
+	timeErr := line.AddTime("t", baseTime)
+	marshalErr := line.AddMarshal("bad", 1)
+	line.AddBytes("secret", []byte("hunter2"))
+	line.AddBytes("raw", []byte("hi"))
+	line.AddLevel("level", 12)
+	line.AddLevel("level", 4)
+	_ = line.End()
+	expected := `{"user_id":"hashed:1234","name":"x","duration_ms":1500,"ratio":25,"drop":null,"u":2,"b":true,"t":"2023-06-12T20:42:15.152952812Z","secret":"eA==","raw":"aGk=","level":"FATAL","level":"WARN"}` + "\n"
+	received := buf.String()
+
+	expectNoError(t, timeErr)
+	expectError(t, marshalErr)
+	expectEqual(t, expected, received)
+	expectEqual(t, "string,string,float64,float32,int64,uint64,bool,time,any,bytes,bytes,level,level", strings.Join(kinds, ","))
+
+	t.Run("layout, group and template", func(t *testing.T) {
+		var buf bytes.Buffer
+		kinds = nil
+		enc := goldjson.NewEncoder(&buf, goldjson.WithReplaceValue(hook))
+		layout := enc.NewLayout("user_id", "duration_ms", "drop", "u", "b", "t", "bad")
+		group := enc.NewGroup("g", "user_id", "drop")
+		tpl, tw := enc.NewTemplate()
+		tw.AddString("service", "api") // consulted once, when built
+		tpl.Slot("user_id")
+		expectNoError(t, tw.End())
+
+		ll := layout.NewLine()
+		ll.AddString("1")
+		ll.AddFloat64(0.5)
+		ll.AddInt64(1)
+		ll.AddUint64(2)
+		ll.AddBool(true)
+		timeErr := ll.AddTime(baseTime)
+		marshalErr := ll.AddMarshal(1)
+		line := ll.Line()
+		r := group.Start(line)
+		r.AddString("2")
+		r.AddInt64(3)
+		r.End()
+		expectNoError(t, line.End())
+		tl := tpl.NewLine()
+		tl.AddString("3")
+		expectNoError(t, tl.End())
+		expected := `{"user_id":"hashed:1","duration_ms":500,"drop":null,"u":2,"b":true,"t":"2023-06-12T20:42:15.152952812Z","g":{"user_id":"hashed:2","drop":null}}` + "\n" +
+			`{"service":"api","user_id":"hashed:3"}` + "\n"
+		received := buf.String()
+
+		expectNoError(t, timeErr)
+		expectError(t, marshalErr)
+		expectEqual(t, expected, received)
+		expectEqual(t, "string,string,float64,int64,uint64,bool,time,any,string,int64,string", strings.Join(kinds, ","))
+	})
+}
+
+func TestEstimateSize(t *testing.T) {
+	z := float64(0)
+	fields, fieldsWriter := goldjson.NewStaticFields()
+	fieldsWriter.AddString("service", "api")
+	fieldsWriter.AddInt64("pid", 1234)
+	_ = fieldsWriter.End()
+	emptyFields, emptyFieldsWriter := goldjson.NewStaticFields()
+	_ = emptyFieldsWriter.End()
+
+	tests := []struct {
+		name     string
+		build    func(*goldjson.LineWriter)
+		estimate int
+	}{
+		{"empty", func(l *goldjson.LineWriter) {}, goldjson.EstimateLineSize()},
+		{
+			"string",
+			func(l *goldjson.LineWriter) { l.AddString("key\n", "value \"☃\" \xff\u2028") },
+			goldjson.EstimateLineSize(goldjson.EstimateFieldSize("key\n", goldjson.EstimateStringSize("value \"☃\" \xff\u2028"))),
+		},
+		{
+			"numbers",
+			func(l *goldjson.LineWriter) {
+				l.AddInt64("a", math.MinInt64)
+				l.AddUint64("b", 0)
+				l.AddFloat64("c", -1.5e-300)
+				l.AddFloat64("d", 0/z)
+			},
+			goldjson.EstimateLineSize(
+				goldjson.EstimateFieldSize("a", goldjson.EstimateInt64Size(math.MinInt64)),
+				goldjson.EstimateFieldSize("b", goldjson.EstimateUint64Size(0)),
+				goldjson.EstimateFieldSize("c", goldjson.EstimateFloat64Size(-1.5e-300)),
+				goldjson.EstimateFieldSize("d", goldjson.EstimateFloat64Size(0/z)),
+			),
+		},
+		{
+			"bools",
+			func(l *goldjson.LineWriter) {
+				l.AddBool("a", true)
+				l.AddBool("b", false)
+			},
+			goldjson.EstimateLineSize(
+				goldjson.EstimateFieldSize("a", goldjson.EstimateBoolSize(true)),
+				goldjson.EstimateFieldSize("b", goldjson.EstimateBoolSize(false)),
+			),
+		},
+		{
+			"time and bytes",
+			func(l *goldjson.LineWriter) {
+				_ = l.AddTime("a", baseTime)
+				l.AddBytes("b", []byte("hello"))
+			},
+			goldjson.EstimateLineSize(
+				goldjson.EstimateFieldSize("a", goldjson.EstimateTimeSize(baseTime)),
+				goldjson.EstimateFieldSize("b", goldjson.EstimateBytesSize([]byte("hello"))),
+			),
+		},
+		{
+			"static fields",
+			func(l *goldjson.LineWriter) {
+				l.AddStaticFields(emptyFields)
+				l.AddStaticFields(fields)
+				l.AddBool("a", true)
+			},
+			goldjson.EstimateLineSize(
+				emptyFields.EstimateSize(),
+				fields.EstimateSize(),
+				goldjson.EstimateFieldSize("a", goldjson.EstimateBoolSize(true)),
+			),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf)
+
+			line := enc.NewLine()
+			tt.build(line)
+			expectNoError(t, line.End())
+
+			expectEqual(t, tt.estimate, buf.Len())
+		})
+	}
+
+	t.Run("invalid time", func(t *testing.T) {
+		expectEqual(t, 0, goldjson.EstimateTimeSize(time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC)))
+	})
+}
+
+func TestAddMessagef(t *testing.T) {
+	t.Run("record", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf, goldjson.WithNewlineReplacement(" "))
+		expected := `{"message":"request \"a\" took 12 ms <true>","long":"` + strings.Repeat("x", 100) + `","empty":""}` + "\n"
+
+		line := enc.NewLine()
+		line.AddMessagef("message", "request %q took %d ms\n<%v>", "a", 12, true)
+		line.AddMessagef("long", "%s", strings.Repeat("x", 100))
+		line.AddMessagef("empty", "")
+		_ = line.End()
+		received := buf.String()
+
+		expectEqual(t, expected, received)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf)
+		expected := `["1/2"]` + "\n"
+
+		line := enc.NewListLine()
+		line.AddMessagef("ignored", "%d/%d", 1, 2)
+		_ = line.End()
+		received := buf.String()
+
+		expectEqual(t, expected, received)
+	})
+
+	t.Run("replace value", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf, goldjson.WithReplaceValue(func(key string, kind goldjson.Kind, value any) (any, bool) {
+			return "<" + value.(string) + ">", kind == goldjson.KindString
+		}))
+		expected := `{"message":"<a 1>"}` + "\n"
+
+		line := enc.NewLine()
+		line.AddMessagef("message", "%s %d", "a", 1)
+		_ = line.End()
+		received := buf.String()
+
+		expectEqual(t, expected, received)
+	})
+}
+
+func TestBytes(t *testing.T) {
+	tests := []struct {
+		name     string
+		val      []byte
+		expected string
+	}{
+		{"nil", nil, `""`},
+		{"padded", []byte("hello"), `"aGVsbG8="`},
+		{"binary", []byte{0xfb, 0xff, 0x00}, `"+/8A"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf)
+			expected := `{"key":` + tt.expected + `,"list":[` + tt.expected + `]}` + "\n"
+
+			line := enc.NewLine()
+			line.AddBytes("key", tt.val)
+			line.StartList("list")
+			line.AddBytes("ignored", tt.val)
+			line.EndList()
+			_ = line.End()
+			received := buf.String()
+
+			expectEqual(t, expected, received)
+		})
+	}
+}
+
+func TestStringList(t *testing.T) {
+	var buf bytes.Buffer
+	enc := goldjson.NewEncoder(&buf)
+
+	line := enc.NewLine()
+	line.AddStringList("a", []string{"b", "c\n"})
+	line.AddStringList("d", nil)
+	line.StartList("e")
+	line.AddStringList("", []string{"f"})
+	line.EndList()
+	_ = line.End()
+	expected := `{"a":["b","c\n"],"d":[],"e":[["f"]]}` + "\n"
+	received := buf.String()
+
+	expectEqual(t, expected, received)
+}
+
+func TestURLValues(t *testing.T) {
+	var buf bytes.Buffer
+	enc := goldjson.NewEncoder(&buf)
+	values := url.Values{"tag": {"a", "b"}, "page": {"2"}, "q": {`"x"`}}
+
+	line := enc.NewLine()
+	line.AddURLValues("query", values)
+	line.AddURLValues("empty", nil)
+	_ = line.End()
+	expected := `{"query":{"page":["2"],"q":["\"x\""],"tag":["a","b"]},"empty":{}}` + "\n"
+	received := buf.String()
+
+	expectEqual(t, expected, received)
+}
+
+func TestHeaders(t *testing.T) {
+	headers := http.Header{
+		"Accept":        {"text/html"},
+		"Authorization": {"Bearer secret"},
+		"X-Forwarded":   {"a", "b"},
+	}
+	tests := []struct {
+		name      string
+		allowlist []string
+		expected  string
+	}{
+		{"all", nil, `{"headers":{"Accept":["text/html"],"Authorization":["Bearer secret"],"X-Forwarded":["a","b"]}}`},
+		{"allowlist", []string{"x-forwarded", "accept", "missing"}, `{"headers":{"X-Forwarded":["a","b"],"Accept":["text/html"]}}`},
+		{"empty allowlist", []string{}, `{"headers":{}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf)
+			expected := tt.expected + "\n"
+
+			line := enc.NewLine()
+			line.AddHeaders("headers", headers, tt.allowlist)
+			_ = line.End()
+			received := buf.String()
+
+			expectEqual(t, expected, received)
+		})
+	}
+}
+
+func TestAddAny(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    any
+		expected string
+	}{
+		{"nil", nil, `null`},
+		{"string", "a\"b", `"a\"b"`},
+		{"int", -1, `-1`},
+		{"int8", int8(-8), `-8`},
+		{"int16", int16(-16), `-16`},
+		{"int32", int32(-32), `-32`},
+		{"int64", int64(-64), `-64`},
+		{"uint", uint(1), `1`},
+		{"uint8", uint8(8), `8`},
+		{"uint16", uint16(16), `16`},
+		{"uint32", uint32(32), `32`},
+		{"uint64", uint64(64), `64`},
+		{"uintptr", uintptr(1), `1`},
+		{"float32", float32(0.1), `0.1`},
+		{"float64", 0.5, `0.5`},
+		{"bool", true, `true`},
+		{"time", baseTime, `"2023-06-12T20:42:15.152952812Z"`},
+		{"duration", 1500 * time.Millisecond, `"1.5s"`},
+		{"bytes", []byte("hello"), `"aGVsbG8="`},
+		{"marshaler", json.RawMessage(`{"a":1}`), `{"a":1}`},
+		{"error", errors.New("oops"), `"oops"`},
+		{"stringer", net.IPv4(127, 0, 0, 1), `"127.0.0.1"`},
+		{"nil pointer error", (*url.Error)(nil), `null`},
+		{"nil pointer stringer", (*time.Duration)(nil), `null`},
+		{"string list", []string{"a", "b"}, `["a","b"]`},
+		{"time list", []time.Time{baseTime}, `["2023-06-12T20:42:15.152952812Z"]`},
+		{"duration list", []time.Duration{time.Second}, `["1s"]`},
+		{"float64 list", []float64{0.5, 1}, `[0.5,1]`},
+		{"int list", []int{1, 2}, `[1,2]`},
+		{"int64 list", []int64{1, 2}, `[1,2]`},
+		{"any list", []any{1, "a", nil, []any{true}}, `[1,"a",null,[true]]`},
+		{"string map", map[string]string{"b": "2", "a": "1"}, `{"a":"1","b":"2"}`},
+		{"any map", map[string]any{"b": []int{1}, "a": map[string]any{"c": nil}}, `{"a":{"c":null},"b":[1]}`},
+		{"other", Point{X: 1, Y: 2}, `{"x":1,"y":2}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf)
+			expected := `{"value":` + tt.expected + `}` + "\n"
+
+			line := enc.NewLine()
+			err := line.AddAny("value", tt.value)
+			_ = line.End()
+			received := buf.String()
+
+			expectNoError(t, err)
+			expectEqual(t, expected, received)
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf)
+		invalidTime := time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC)
+		expected := `{"list":[1,3],"record":{"a":1},"marshal":"a"}` + "\n"
+
+		line := enc.NewLine()
+		errList := line.AddAny("list", []any{1, invalidTime, 3})
+		errRecord := line.AddAny("record", map[string]any{"a": 1, "b": ErrorMarshal{}})
+		errNone := line.AddAny("marshal", "a")
+		_ = line.End()
+		received := buf.String()
+
+		expectError(t, errList)
+		expectError(t, errRecord)
+		expectNoError(t, errNone)
+		expectEqual(t, expected, received)
+	})
+
+	t.Run("unsorted map keys", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf, goldjson.WithUnsortedMapKeys())
+		value := map[string]any{"a": 1, "b": map[string]string{"c": "d", "e": "f"}, "g": nil}
+		expected := map[string]any{"a": 1.0, "b": map[string]any{"c": "d", "e": "f"}, "g": nil}
+
+		line := enc.NewLine()
+		err := line.AddAny("value", value)
+		_ = line.End()
+		var received struct {
+			Value map[string]any `json:"value"`
+		}
+		errUnmarshal := json.Unmarshal(buf.Bytes(), &received)
+
+		expectNoError(t, err)
+		expectNoError(t, errUnmarshal)
+		expectEqual(t, fmt.Sprint(expected), fmt.Sprint(received.Value))
+	})
+}
+
+func TestContextHook(t *testing.T) {
+	type requestIDKey struct{}
+	var buf bytes.Buffer
+	enc := goldjson.NewEncoder(
+		&buf,
+		goldjson.WithContextHook(func(ctx context.Context, l *goldjson.LineWriter) {
+			if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+				l.AddString("request_id", id)
+			}
+		}),
+		goldjson.WithContextHook(func(ctx context.Context, l *goldjson.LineWriter) {
+			l.AddBool("hooked", true)
+		}),
+	)
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "abc")
+	expected := `{"request_id":"abc","hooked":true,"x":"y"}` + "\n" + `{"hooked":true,"x":"y"}` + "\n" + `{"x":"y"}` + "\n"
+
+	for _, line := range []*goldjson.LineWriter{
+		enc.NewLineContext(ctx),
+		enc.NewLineContext(context.Background()),
+		enc.NewLine(),
+	} {
+		line.AddString("x", "y")
+		_ = line.End()
+	}
+	received := buf.String()
+
+	expectEqual(t, expected, received)
+}
+
+func TestLineSeverity(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected goldjson.Severity
+	}{
+		{`{"level":"DEBUG"}`, goldjson.SeverityDebug},
+		{`{"level":"DEBUG+2"}`, goldjson.SeverityDebug},
+		{`{"level":"trace"}`, goldjson.SeverityDebug},
+		{`{"level":"INFO"}`, goldjson.SeverityInfo},
+		{`{"msg":"hello","level":"WARN"}`, goldjson.SeverityWarning},
+		{`{"level":"Warning"}`, goldjson.SeverityWarning},
+		{`{"level":"ERROR-1"}`, goldjson.SeverityError},
+		{`{"level":"fatal"}`, goldjson.SeverityError},
+		{`{"level":-4}`, goldjson.SeverityDebug},
+		{`{"level":0}`, goldjson.SeverityInfo},
+		{`{"level":5}`, goldjson.SeverityWarning},
+		{`{"level":12}`, goldjson.SeverityError},
+		{`{"level":"NOTICE"}`, goldjson.SeverityInfo},
+		{`{"level":true}`, goldjson.SeverityInfo},
+		{`{"level":1.5}`, goldjson.SeverityInfo},
+		{`{"severity":"ERROR"}`, goldjson.SeverityInfo},
+		{`{"nested":{"level":"ERROR"}}`, goldjson.SeverityInfo},
+		{`["ERROR"]`, goldjson.SeverityInfo},
+		{``, goldjson.SeverityInfo},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			received := goldjson.LineSeverity([]byte(tt.line+"\n"), goldjson.SeverityKey)
+
+			expectEqual(t, tt.expected, received)
+		})
+	}
+}
+
+func TestAddLevel(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   goldjson.LevelFormat
+		levels   []int
+		expected string
+	}{
+		{"text", goldjson.LevelFormatText, []int{-4, -8, 0, 2, 4, 8, 12, 100, -100}, `["DEBUG","DEBUG-4","INFO","INFO+2","WARN","ERROR","ERROR+4","ERROR+92","DEBUG-96"]`},
+		{"lowercase", goldjson.LevelFormatLowercase, []int{-4, 0, 6, 8, 100}, `["debug","info","warn+2","error","error+92"]`},
+		{"numeric", goldjson.LevelFormatNumeric, []int{-4, 0, 6, 100}, `[-4,0,6,100]`},
+		{"syslog", goldjson.LevelFormatSyslog, []int{-4, 0, 3, 4, 8, 100}, `[7,6,6,4,3,3]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf, goldjson.WithLevelFormat(tt.format))
+			expected := `{"level":` + tt.expected + "}\n"
+
+			line := enc.NewLine()
+			line.StartList("level")
+			for _, level := range tt.levels {
+				line.AddLevel("", level)
+			}
+			line.EndList()
+			_ = line.End()
+			received := buf.String()
+
+			expectEqual(t, expected, received)
+		})
+	}
+}
+
+func TestIfVerbose(t *testing.T) {
+	fields, fieldsWriter := goldjson.NewStaticFields()
+	fieldsWriter.AddString("static", "value")
+	_ = fieldsWriter.End()
+	tests := []struct {
+		name     string
+		opts     []goldjson.Option
+		expected string
+	}{
+		{
+			"default verbosity",
+			nil,
+			`{"a":0,"b":{"c":0},"d":"e"}`,
+		},
+		{
+			"verbose",
+			[]goldjson.Option{goldjson.WithVerbosity(1)},
+			`{"a":0,"b":{"c":0,"c":1,"f":["g"]},"a":1,"static":"value","d":"e"}`,
+		},
+		{
+			"strict",
+			[]goldjson.Option{goldjson.WithStrict()},
+			`{"a":0,"b":{"c":0},"d":"e"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf, tt.opts...)
+			expected := tt.expected + "\n"
+
+			line := enc.NewLine()
+			line.IfVerbose(0).AddInt64("a", 0)
+			line.StartRecord("b")
+			line.IfVerbose(0).AddInt64("c", 0)
+			verbose := line.IfVerbose(1)
+			verbose.AddInt64("c", 1)
+			verbose.StartList("f")
+			verbose.AddString("", "g")
+			verbose.EndList()
+			line.EndRecord()
+			verbose = line.IfVerbose(1)
+			verbose.AddInt64("a", 1)
+			verbose.AddStaticFields(fields)
+			line.AddString("d", "e")
+			err := line.End()
+			received := buf.String()
+
+			expectNoError(t, err)
+			expectEqual(t, expected, received)
+		})
+	}
+
+	t.Run("suppressed line", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf, goldjson.WithMinLevel(1), goldjson.WithVerbosity(1))
+
+		line, _ := enc.NewLineLevel(0)
+		received := line.IfVerbose(0)
+		_ = line.End()
+
+		expectEqual(t, true, received != line)
+		expectEqual(t, 0, buf.Len())
+	})
+
+	t.Run("replace hook", func(t *testing.T) {
+		var buf bytes.Buffer
+		var replaced []string
+		enc := goldjson.NewEncoder(&buf, goldjson.WithReplaceValue(func(key string, kind goldjson.Kind, value any) (any, bool) {
+			replaced = append(replaced, key)
+			return nil, false
+		}))
+
+		line := enc.NewLine()
+		line.IfVerbose(1).AddString("query", "SELECT 1")
+		line.IfVerbose(1).AddInt64("rows", 1)
+		line.AddString("msg", "done")
+		err := line.End()
+
+		expectNoError(t, err)
+		expectEqual(t, `{"msg":"done"}`+"\n", buf.String())
+		expectEqual(t, "msg", strings.Join(replaced, ","))
+	})
+}
+
+func TestNewLineLevel(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []goldjson.Option
+		expected string
+	}{
+		{
+			"no minimum level",
+			nil,
+			`{"level":-4}` + "\n" + `{"level":0}` + "\n" + `{"level":4}` + "\n" + `{"level":8}` + "\n",
+		},
+		{
+			"minimum level",
+			[]goldjson.Option{goldjson.WithMinLevel(0)},
+			`{"level":0}` + "\n" + `{"level":4}` + "\n" + `{"level":8}` + "\n",
+		},
+		{
+			"sampler",
+			[]goldjson.Option{
+				goldjson.WithMinLevel(0),
+				goldjson.WithSampler(func(level int) bool { return level != 4 }),
+			},
+			`{"level":0}` + "\n" + `{"level":8}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf, tt.opts...)
+
+			for _, level := range []int{-4, 0, 4, 8} {
+				line, ok := enc.NewLineLevel(level)
+				line.AddInt64("level", int64(level))
+				err := line.End()
+				expectNoError(t, err)
+				expectEqual(t, ok, strings.Contains(tt.expected, fmt.Sprintf(`{"level":%d}`, level)))
+			}
+			received := buf.String()
+
+			expectEqual(t, tt.expected, received)
+		})
+	}
+
+	t.Run("reused after suppression", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf, goldjson.WithMinLevel(1))
+
+		for i := 0; i < 3; i++ {
+			line, _ := enc.NewLineLevel(0)
+			line.AddString("a", "b")
+			_ = line.End()
+			line = enc.NewLine()
+			line.AddString("c", "d")
+			_ = line.End()
+		}
+		received := buf.String()
+
+		expectEqual(t, strings.Repeat(`{"c":"d"}`+"\n", 3), received)
+		expectEqual(t, false, enc.LevelEnabled(0))
+		expectEqual(t, true, enc.LevelEnabled(1))
+	})
+
+	t.Run("sampling fields", func(t *testing.T) {
+		var buf bytes.Buffer
+		var n int
+		sampler := func(level int) bool {
+			n++
+			return level > 0 || n%3 == 0
+		}
+		enc := goldjson.NewEncoder(&buf, goldjson.WithSampler(sampler), goldjson.WithMinLevel(0), goldjson.WithSamplingFields("sample_rate", "suppressed_since_last"))
+
+		for _, level := range []int{-1, 0, 0, 1, 0, 0, 0, 0, 0} {
+			line, _ := enc.NewLineLevel(level)
+			line.AddInt64("level", int64(level))
+			_ = line.End()
+		}
+		expected := `{"sample_rate":1,"suppressed_since_last":0,"level":1}` + "\n" +
+			`{"sample_rate":0.2,"suppressed_since_last":4,"level":0}` + "\n"
+		received := buf.String()
+
+		expectEqual(t, expected, received)
+	})
+
+	t.Run("suppressed line is a no-op", func(t *testing.T) {
+		var buf bytes.Buffer
+		var hooks int
+		enc := goldjson.NewEncoder(&buf,
+			goldjson.WithMinLevel(1),
+			goldjson.WithLineID("id", func(buf []byte) []byte {
+				hooks++
+				return tokens.AppendInt64(buf, 1)
+			}),
+			goldjson.WithReplaceValue(func(key string, kind goldjson.Kind, value any) (any, bool) {
+				hooks++
+				return nil, false
+			}),
+		)
+		build := func() {
+			line, _ := enc.NewLineLevel(0)
+			line.AddString("a", "b")
+			line.StartRecord("c")
+			line.AddInt64("d", 1)
+			line.EndRecord()
+			expectNoError(t, line.Err())
+			expectNoError(t, line.End())
+		}
+
+		build()
+		expectEqual(t, 0, hooks)
+		expectEqual(t, 0, buf.Len())
+		if !raceEnabled && !checkedEnabled {
+			expectEqual(t, 0.0, testing.AllocsPerRun(100, build))
+		}
+	})
+}
+
+func TestEndRecordOmitEmpty(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []goldjson.Option
+		write    func(*goldjson.LineWriter)
+		expected string
+	}{
+		{
+			"only field",
+			nil,
+			func(l *goldjson.LineWriter) {
+				l.StartRecord("a")
+				l.EndRecordOmitEmpty()
+			},
+			`{}`,
+		},
+		{
+			"between fields",
+			nil,
+			func(l *goldjson.LineWriter) {
+				l.AddString("a", "b")
+				l.StartRecord("c")
+				l.EndRecordOmitEmpty()
+				l.AddString("d", "e")
+			},
+			`{"a":"b","d":"e"}`,
+		},
+		{
+			"first field",
+			nil,
+			func(l *goldjson.LineWriter) {
+				l.StartRecord("a")
+				l.EndRecordOmitEmpty()
+				l.AddString("b", "c")
+			},
+			`{"b":"c"}`,
+		},
+		{
+			"not empty",
+			nil,
+			func(l *goldjson.LineWriter) {
+				l.StartRecord("a")
+				l.AddString("b", "c")
+				l.EndRecordOmitEmpty()
+			},
+			`{"a":{"b":"c"}}`,
+		},
+		{
+			"nested empty",
+			nil,
+			func(l *goldjson.LineWriter) {
+				l.AddString("a", "b")
+				l.StartRecord("c")
+				l.StartRecord("d")
+				l.EndRecordOmitEmpty()
+				l.EndRecordOmitEmpty()
+			},
+			`{"a":"b"}`,
+		},
+		{
+			"escaped key",
+			nil,
+			func(l *goldjson.LineWriter) {
+				l.AddString("a", "b")
+				l.StartRecord(`c\"d\`)
+				l.EndRecordOmitEmpty()
+			},
+			`{"a":"b"}`,
+		},
+		{
+			"in list",
+			nil,
+			func(l *goldjson.LineWriter) {
+				l.StartList("a")
+				l.AddString("", "b")
+				l.StartRecord("")
+				l.EndRecordOmitEmpty()
+				l.StartRecord("")
+				l.EndRecordOmitEmpty()
+				l.AddString("", "c")
+				l.EndList()
+			},
+			`{"a":["b","c"]}`,
+		},
+		{
+			"strict",
+			[]goldjson.Option{goldjson.WithStrict()},
+			func(l *goldjson.LineWriter) {
+				l.AddString("a", "b")
+				l.StartRecord("c")
+				l.EndRecordOmitEmpty()
+				l.StartRecord("a")
+				l.EndRecordOmitEmpty()
+				l.AddString("c", "d")
+			},
+			`{"a":"b","c":"d"}`,
+		},
+		{
+			"trailer",
+			[]goldjson.Option{goldjson.WithTrailer("_meta")},
+			func(l *goldjson.LineWriter) {
+				l.AddString("a", "b")
+				l.StartRecord("c")
+				l.EndRecordOmitEmpty()
+			},
+			`{"a":"b","_meta":{"encode_ns":0,"fields":1,"dropped":0}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf, tt.opts...)
+			expected := tt.expected + "\n"
+
+			line := enc.NewLine()
+			tt.write(line)
+			_ = line.End()
+			received := regexp.MustCompile(`"encode_ns":\d+`).ReplaceAllString(buf.String(), `"encode_ns":0`)
+
+			expectEqual(t, expected, received)
+		})
+	}
+}
+
+func TestStrict(t *testing.T) {
+	z := 0.0
+	tests := []struct {
+		name     string
+		build    func(*goldjson.LineWriter)
+		expected string
+	}{
+		{
+			"non-finite floats",
+			func(l *goldjson.LineWriter) {
+				l.AddFloat64("a", 0/z)
+				l.AddFloat64("b", 1/z)
+				l.AddFloat64("c", 1.5)
+			},
+			`{"a":null,"b":null,"c":1.5}`,
+		},
+		{
+			"duplicate keys",
+			func(l *goldjson.LineWriter) {
+				l.AddString("a", "b")
+				l.AddInt64("a", 1)
+				l.AddBool("c", true)
+			},
+			`{"a":"b","c":true}`,
+		},
+		{
+			"same keys in different records",
+			func(l *goldjson.LineWriter) {
+				l.AddString("a", "b")
+				l.StartRecord("c")
+				l.AddString("a", "b")
+				l.EndRecord()
+				l.StartRecord("d")
+				l.AddString("a", "b")
+				l.EndRecord()
+			},
+			`{"a":"b","c":{"a":"b"},"d":{"a":"b"}}`,
+		},
+		{
+			"duplicate record",
+			func(l *goldjson.LineWriter) {
+				l.StartRecord("a")
+				l.AddString("b", "c")
+				l.EndRecord()
+				l.StartList("a")
+				l.AddString("", "d")
+				l.EndList()
+				l.AddString("e", "f")
+			},
+			`{"a":{"b":"c"},"e":"f"}`,
+		},
+		{
+			"duplicate first record",
+			func(l *goldjson.LineWriter) {
+				l.StartRecord("a")
+				l.AddString("b", "c")
+				l.StartRecord("b")
+				l.EndRecord()
+				l.AddString("d", "e")
+				l.EndRecord()
+			},
+			`{"a":{"b":"c","d":"e"}}`,
+		},
+		{
+			"values in lists",
+			func(l *goldjson.LineWriter) {
+				l.StartList("a")
+				l.AddString("", "b")
+				l.AddString("", "c")
+				l.EndList()
+			},
+			`{"a":["b","c"]}`,
+		},
+		{
+			"safe string",
+			func(l *goldjson.LineWriter) {
+				l.AddSafeString("a", `"`)
+			},
+			`{"a":"\""}`,
+		},
+		{
+			"unclosed",
+			func(l *goldjson.LineWriter) {
+				l.StartRecord("a")
+				l.StartList("b")
+				l.StartRecord("")
+			},
+			`{"a":{"b":[{}]}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf, goldjson.WithStrict())
+			expected := tt.expected + "\n"
+
+			line := enc.NewLine()
+			tt.build(line)
+			_ = line.End()
+			received := buf.String()
+
+			expectEqual(t, expected, received)
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf, goldjson.WithStrict())
+		expected := `{"a":1,"b":2}` + "\n"
+
+		line := enc.NewLine()
+		line.AddInt64("a", 1)
+		timeErr := line.AddTime("a", baseTime)
+		marshalErr := line.AddMarshal("b", ErrorMarshal{})
+		line.AddInt64("b", 2)
+		_ = line.End()
+		received := buf.String()
+
+		expectEqual(t, true, errors.Is(timeErr, goldjson.ErrDuplicateKey))
+		expectError(t, marshalErr)
+		expectEqual(t, expected, received)
+	})
+
+	t.Run("static fields", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf, goldjson.WithStrict())
+		fields, fw := enc.NewStaticFields()
+		fw.AddString("a", "b")
+		_ = fw.End()
+		expected := `{"a":"b","c":"d"}` + "\n"
+
+		line := goldjson.NewScope(enc).With(fields).NewLine()
+		line.AddString("a", "x")
+		line.AddString("c", "d")
+		_ = line.End()
+		received := buf.String()
+
+		expectEqual(t, expected, received)
+	})
+
+	t.Run("layout", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf, goldjson.WithStrict())
+		layout := enc.NewLayout("a", "a", "b")
+		expected := `{"a":1,"b":null}` + "\n"
+
+		line := layout.NewLine()
+		line.AddInt64(1)
+		line.AddInt64(2)
+		line.AddFloat64(0 / z)
+		_ = line.End()
+		received := buf.String()
+
+		expectEqual(t, expected, received)
+	})
+}
+
+func TestKeyValidation(t *testing.T) {
+	validation := goldjson.KeyValidation{
+		RejectEmpty: true,
+		RejectNUL:   true,
+		Pattern:     regexp.MustCompile(`^[a-z_]*$`),
+	}
+	tests := []struct {
+		name     string
+		build    func(*goldjson.LineWriter)
+		expected string
+		valid    bool
+	}{
+		{
+			"valid keys",
 			func(l *goldjson.LineWriter) {
-				f, fw := goldjson.NewStaticFields()
-				_ = fw.AddMarshal("a", map[string]string{"b": "c"})
-				_ = fw.End()
-				l.AddStaticFields(f)
+				l.AddString("a_b", "c")
+				l.StartList("d")
+				l.AddString("", "e")
+				l.EndList()
 			},
-			`{"a":{"b":"c"}}`,
+			`{"a_b":"c","d":["e"]}`,
+			true,
 		},
 		{
-			"in second position",
+			"empty key",
+			func(l *goldjson.LineWriter) {
+				l.AddString("", "b")
+				l.AddString("c", "d")
+			},
+			`{"c":"d"}`,
+			false,
+		},
+		{
+			"NUL",
 			func(l *goldjson.LineWriter) {
-				f, fw := goldjson.NewStaticFields()
-				_ = fw.AddMarshal("c", map[string]string{"x": "y"})
-				_ = fw.End()
 				l.AddString("a", "b")
-				l.AddStaticFields(f)
+				l.AddInt64("c\x00", 1)
 			},
-			`{"a":"b","c":{"x":"y"}}`,
+			`{"a":"b"}`,
+			false,
 		},
 		{
-			"with trailing fields",
+			"pattern",
 			func(l *goldjson.LineWriter) {
-				f, fw := goldjson.NewStaticFields()
-				_ = fw.AddMarshal("a", map[string]string{"x": "y"})
-				_ = fw.End()
-				l.AddStaticFields(f)
+				l.StartRecord("A")
 				l.AddString("b", "c")
+				l.EndRecord()
+				l.AddString("d", "e")
 			},
-			`{"a":{"x":"y"},"b":"c"}`,
+			`{"d":"e"}`,
+			false,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			var buf bytes.Buffer
-			enc := goldjson.NewEncoder(&buf)
+			enc := goldjson.NewEncoder(&buf, goldjson.WithKeyValidation(validation))
+			expected := tt.expected + "\n"
+
+			line := enc.NewLine()
+			tt.build(line)
+			endErr := line.End()
+			received := buf.String()
+
+			expectEqual(t, tt.valid, endErr == nil)
+			expectEqual(t, tt.valid, !errors.Is(endErr, goldjson.ErrInvalidKey))
+			expectEqual(t, expected, received)
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf, goldjson.WithKeyValidation(validation))
+		expected := `{"a":"b"}` + "\n"
+
+		line := enc.NewLine()
+		addErr := line.AddMarshal("B", Point{})
+		line.AddString("a", "b")
+		endErr := line.End()
+		received := buf.String()
+
+		var keyErr *goldjson.KeyError
+		expectEqual(t, true, errors.As(addErr, &keyErr))
+		expectEqual(t, "B", keyErr.Key)
+		expectEqual(t, addErr, endErr)
+		expectEqual(t, expected, received)
+	})
+
+	t.Run("layout", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf, goldjson.WithKeyValidation(validation))
+		layout := enc.NewLayout("a", "B")
+		expected := `{"a":1}` + "\n"
+
+		line := layout.NewLine()
+		line.AddInt64(1)
+		line.AddInt64(2)
+		endErr := line.End()
+		received := buf.String()
+
+		expectError(t, endErr)
+		expectEqual(t, expected, received)
+	})
+}
+
+func TestRawJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []goldjson.Option
+		build    func(*goldjson.LineWriter) error
+		expected string
+		valid    bool
+	}{
+		{
+			"raw",
+			nil,
+			func(l *goldjson.LineWriter) error { return l.AddRawJSON("a", []byte(`{"b": "<>"}`)) },
+			`{"a":{"b": "<>"}}`,
+			true,
+		},
+		{
+			"RawMessage",
+			nil,
+			func(l *goldjson.LineWriter) error { return l.AddMarshal("a", json.RawMessage(`[1, 2]`)) },
+			`{"a":[1, 2]}`,
+			true,
+		},
+		{
+			"validated",
+			[]goldjson.Option{goldjson.WithRawJSONValidation()},
+			func(l *goldjson.LineWriter) error { return l.AddRawJSON("a", []byte(`[1, 2]`)) },
+			`{"a":[1, 2]}`,
+			true,
+		},
+		{
+			"invalid raw",
+			[]goldjson.Option{goldjson.WithRawJSONValidation()},
+			func(l *goldjson.LineWriter) error { return l.AddRawJSON("a", []byte(`[1, 2`)) },
+			`{}`,
+			false,
+		},
+		{
+			"invalid RawMessage",
+			[]goldjson.Option{goldjson.WithRawJSONValidation()},
+			func(l *goldjson.LineWriter) error { return l.AddMarshal("a", json.RawMessage(`[1, 2`)) },
+			`{}`,
+			false,
+		},
+		{
+			"validated per value",
+			nil,
+			func(l *goldjson.LineWriter) error { return l.AddValidatedRawJSON("a", []byte(`[1, 2]`)) },
+			`{"a":[1, 2]}`,
+			true,
+		},
+		{
+			"invalid per value",
+			nil,
+			func(l *goldjson.LineWriter) error { return l.AddValidatedRawJSON("a", []byte(`[1, 2`)) },
+			`{}`,
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf, tt.opts...)
+			expected := tt.expected + "\n"
+
+			line := enc.NewLine()
+			addErr := tt.build(line)
+			_ = line.End()
+			received := buf.String()
+
+			expectEqual(t, tt.valid, addErr == nil)
+			expectEqual(t, expected, received)
+		})
+	}
+}
+
+func TestErrorPlaceholders(t *testing.T) {
+	_, err := json.Marshal(ErrorMarshal{})
+	marshalError := `{"!error":"marshal failed: ` + err.Error() + `"}`
+	timeError := `{"!error":"time encoding failed: time.Time year outside of range [0,9999]"}`
+	invalidTime := time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		build    func(*goldjson.Encoder) error
+		expected string
+	}{
+		{
+			"marshal",
+			func(e *goldjson.Encoder) error {
+				l := e.NewLine()
+				err := l.AddMarshal("a", ErrorMarshal{})
+				l.AddInt64("b", 1)
+				_ = l.End()
+				return err
+			},
+			`{"a":` + marshalError + `,"b":1}`,
+		},
+		{
+			"time",
+			func(e *goldjson.Encoder) error {
+				l := e.NewLine()
+				err := l.AddTime("a", invalidTime)
+				_ = l.End()
+				return err
+			},
+			`{"a":` + timeError + `}`,
+		},
+		{
+			"layout",
+			func(e *goldjson.Encoder) error {
+				l := e.NewLayout("a", "b").NewLine()
+				marshalErr := l.AddMarshal(ErrorMarshal{})
+				timeErr := l.AddTime(invalidTime)
+				_ = l.End()
+				return errors.Join(marshalErr, timeErr)
+			},
+			`{"a":` + marshalError + `,"b":` + timeError + `}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf, goldjson.WithErrorPlaceholders())
+			expected := tt.expected + "\n"
+
+			addErr := tt.build(enc)
+			received := buf.String()
+
+			expectError(t, addErr)
+			expectEqual(t, expected, received)
+		})
+	}
+}
+
+func TestStickyErrors(t *testing.T) {
+	invalidTime := time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC)
+	fields, fieldsWriter := goldjson.NewStaticFields()
+	fieldsWriter.AddString("static", "value")
+	_ = fieldsWriter.End()
+	tests := []struct {
+		name     string
+		opts     []goldjson.Option
+		build    func(*goldjson.LineWriter)
+		expected string
+		failed   bool
+	}{
+		{
+			"no errors",
+			nil,
+			func(l *goldjson.LineWriter) {
+				l.AddString("a", "b")
+				l.AddStaticFields(fields)
+			},
+			`{"a":"b","static":"value"}`,
+			false,
+		},
+		{
+			"marshal",
+			nil,
+			func(l *goldjson.LineWriter) {
+				l.AddString("a", "b")
+				_ = l.AddMarshal("c", ErrorMarshal{})
+				l.AddString("d", "e")
+				l.AddStaticFields(fields)
+			},
+			`{"a":"b"}`,
+			true,
+		},
+		{
+			"time in a record",
+			nil,
+			func(l *goldjson.LineWriter) {
+				l.StartRecord("a")
+				l.AddInt64("b", 1)
+				_ = l.AddTime("c", invalidTime)
+				l.AddInt64("d", 2)
+				l.StartList("e")
+				l.AddInt64("", 3)
+				l.EndList()
+				l.EndRecord()
+				l.AddInt64("f", 4)
+			},
+			`{"a":{"b":1}}`,
+			true,
+		},
+		{
+			"key validation",
+			[]goldjson.Option{goldjson.WithKeyValidation(goldjson.KeyValidation{RejectEmpty: true})},
+			func(l *goldjson.LineWriter) {
+				l.AddInt64("a", 1)
+				l.AddInt64("", 2)
+				l.AddInt64("b", 3)
+			},
+			`{"a":1}`,
+			true,
+		},
+		{
+			"placeholders",
+			[]goldjson.Option{goldjson.WithErrorPlaceholders()},
+			func(l *goldjson.LineWriter) {
+				_ = l.AddTime("a", invalidTime)
+				l.AddInt64("b", 1)
+			},
+			`{"a":{"!error":"time encoding failed: time.Time year outside of range [0,9999]"}}`,
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf, append(tt.opts, goldjson.WithStickyErrors())...)
 			expected := tt.expected + "\n"
 
 			line := enc.NewLine()
 			tt.build(line)
+			lineErr := line.Err()
+			endErr := line.End()
+			received := buf.String()
+
+			expectEqual(t, expected, received)
+			expectEqual(t, tt.failed, lineErr != nil)
+			expectEqual(t, lineErr, endErr)
+		})
+	}
+
+	t.Run("first error", func(t *testing.T) {
+		enc := goldjson.NewEncoder(io.Discard, goldjson.WithStickyErrors())
+
+		line := enc.NewLine()
+		_ = line.AddMarshal("a", ErrorMarshal{})
+		timeErr := line.AddTime("b", invalidTime)
+		err := line.End()
+
+		expectEqual(t, true, strings.Contains(err.Error(), "ErrorMarshal"))
+		expectEqual(t, err, timeErr)
+	})
+
+	t.Run("resets between lines", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf, goldjson.WithStickyErrors())
+
+		line := enc.NewLine()
+		_ = line.AddMarshal("a", ErrorMarshal{})
+		_ = line.End()
+		line = enc.NewLine()
+		line.AddInt64("b", 1)
+		err := line.End()
+		received := buf.String()
+
+		expectNoError(t, err)
+		expectEqual(t, "{}\n{\"b\":1}\n", received)
+	})
+}
+
+func TestErrorChain(t *testing.T) {
+	base := errors.New("base")
+	other := errors.New("other")
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{
+			"nil",
+			nil,
+			`{"err":null}`,
+		},
+		{
+			"single",
+			base,
+			`{"err":[{"type":"*errors.errorString","message":"base"}]}`,
+		},
+		{
+			"wrapped",
+			fmt.Errorf("wrapped: %w", base),
+			`{"err":[{"type":"*fmt.wrapError","message":"wrapped: base"},{"type":"*errors.errorString","message":"base"}]}`,
+		},
+		{
+			"joined",
+			errors.Join(base, fmt.Errorf("wrapped: %w", other)),
+			`{"err":[{"type":"*errors.joinError","message":"base\nwrapped: other"},{"type":"*errors.errorString","message":"base"},{"type":"*fmt.wrapError","message":"wrapped: other"},{"type":"*errors.errorString","message":"other"}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf)
+			expected := tt.expected + "\n"
+
+			line := enc.NewLine()
+			line.AddErrorChain("err", tt.err)
 			_ = line.End()
 			received := buf.String()
 
@@ -397,6 +4987,38 @@ func TestErrors(t *testing.T) {
 		expectEqual(t, expected, received)
 	})
 
+	t.Run("must", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			build func(*goldjson.LineWriter)
+		}{
+			{"invalid time", func(l *goldjson.LineWriter) {
+				l.MustAddTime("invalid", time.Date(-1, 06, 12, 20, 42, 15, 152952812, baseZone))
+			}},
+			{"invalid marshal", func(l *goldjson.LineWriter) {
+				l.MustAddMarshal("invalid", ErrorMarshal{})
+			}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				var buf bytes.Buffer
+				enc := goldjson.NewEncoder(&buf)
+				line := enc.NewLine()
+				var recovered any
+
+				func() {
+					defer func() { recovered = recover() }()
+					tt.build(line)
+				}()
+
+				if recovered == nil {
+					t.Fatal("expected panic")
+				}
+			})
+		}
+	})
+
 	t.Run("cannot write", func(t *testing.T) {
 		enc := goldjson.NewEncoder(ErrorWriter{})
 
@@ -504,10 +5126,38 @@ func Benchmark(b *testing.B) {
 					_ = line.End()
 				}
 			})
+
+			b.Run("goldjson layout", func(b *testing.B) {
+				layout := goldEnc.NewLayout(bb.keys...)
+				for n := 0; n < b.N; n++ {
+					buf.Reset()
+					line := layout.NewLine()
+					line.AddString(bb.stringValue)
+					line.AddUint64(123456789)
+					line.AddInt64(-123456789)
+					line.AddFloat64(-123456.789)
+					line.AddBool(n%2 == 1)
+					_ = line.AddTime(timeValue)
+					_ = line.AddMarshal(pointValue)
+					_ = line.End()
+				}
+			})
 		})
 	}
 }
 
+func BenchmarkSuppressedLine(b *testing.B) {
+	enc := goldjson.NewEncoder(io.Discard, goldjson.WithMinLevel(1))
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		line, _ := enc.NewLineLevel(0)
+		line.AddString("message", "hello, world")
+		line.AddInt64("status", 200)
+		line.AddFloat64("elapsed", 1.5)
+		_ = line.End()
+	}
+}
+
 func randomASCIIString(rng *rand.Rand, maxStringSize int) string {
 	b := make([]byte, 1+rng.Intn(maxStringSize))
 	_, _ = rng.Read(b)
@@ -538,6 +5188,10 @@ func randomString(rng *rand.Rand, maxStringSize int) string {
 	return string(b)
 }
 
+var raceEnabled bool
+
+var checkedEnabled bool
+
 var baseZone = time.FixedZone("night city", 0)
 var baseTime = time.Date(2023, 06, 12, 20, 42, 15, 152952812, baseZone)
 
@@ -566,6 +5220,12 @@ func (ErrorWriter) Write([]byte) (n int, err error) {
 	return 0, errors.New("failed")
 }
 
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
 func slicesEqual[T comparable](a, b []T) int {
 	if len(a) > len(b) {
 		return len(b)
@@ -0,0 +1,128 @@
+// Package goldjsongrpc provides gRPC server interceptors that log every RPC
+// as a goldjson line:
+//
+//	{"method":"/pkg.Service/Method","code":"NotFound","duration_ns":1234567,"peer":"10.0.0.1:51234","metadata":{"x-request-id":["abc"]}}
+//
+// The package is a separate module, so that goldjson itself doesn't depend
+// on gRPC. The module requires a released version of goldjson; for
+// developing against the local version, set up a workspace in the root of
+// the repository (the go.work file is not committed):
+//
+//	go work init . ./goldjsongrpc
+//	go work edit -replace github.com/jussi-kalliokoski/goldjson@v0.1.0=./
+package goldjsongrpc
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jussi-kalliokoski/goldjson"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// The keys of the fields of the lines.
+const (
+	KeyMethod   = "method"
+	KeyCode     = "code"
+	KeyDuration = "duration_ns"
+	KeyPeer     = "peer"
+	KeyMetadata = "metadata"
+)
+
+// Options configures the interceptors.
+type Options struct {
+	// Metadata is the allowlist of the keys of the incoming metadata added
+	// to the lines, in the order of the allowlist, with the keys lowercased
+	// like gRPC does. Unlike with goldjson.LineWriter.AddHeaders, a nil
+	// allowlist adds no metadata, since the metadata commonly carries
+	// credentials.
+	Metadata []string
+}
+
+// UnaryServerInterceptor returns an interceptor that logs every unary RPC
+// with the Encoder once the RPC has been handled.
+//
+// The lines are created with Encoder.NewLineContext, so the context hooks
+// of the Encoder (see goldjson.WithContextHook) can add e.g. the trace IDs
+// carried in the context of the RPC. The keys of the lines are prepared
+// with Encoder.PrepareKey, so the interceptor MUST be created before the
+// Encoder is used.
+func UnaryServerInterceptor(enc *goldjson.Encoder, opts Options) grpc.UnaryServerInterceptor {
+	l := newLogger(enc, opts)
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		l.log(ctx, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns an interceptor that logs every streaming
+// RPC with the Encoder once the RPC has been handled, like
+// UnaryServerInterceptor.
+func StreamServerInterceptor(enc *goldjson.Encoder, opts Options) grpc.StreamServerInterceptor {
+	l := newLogger(enc, opts)
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		l.log(ss.Context(), info.FullMethod, start, err)
+		return err
+	}
+}
+
+type logger struct {
+	enc      *goldjson.Encoder
+	metadata []string
+}
+
+func newLogger(enc *goldjson.Encoder, opts Options) *logger {
+	for _, key := range []string{KeyMethod, KeyCode, KeyDuration, KeyPeer, KeyMetadata} {
+		enc.PrepareKey(key)
+	}
+	l := &logger{enc: enc}
+	for _, key := range opts.Metadata {
+		key = strings.ToLower(key)
+		enc.PrepareKey(key)
+		l.metadata = append(l.metadata, key)
+	}
+	return l
+}
+
+func (l *logger) log(ctx context.Context, method string, start time.Time, err error) {
+	line := l.enc.NewLineContext(ctx)
+	line.AddString(KeyMethod, method)
+	line.AddString(KeyCode, status.Code(err).String())
+	line.AddInt64(KeyDuration, int64(time.Since(start)))
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		line.AddString(KeyPeer, p.Addr.String())
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(l.metadata) > 0 {
+		addMetadata(line, md, l.metadata)
+	}
+	// there's no caller to report the error to
+	_ = line.End()
+}
+
+// addMetadata adds the metadata in the allowlist as a record, omitting the
+// record if none of the keys are present.
+func addMetadata(line *goldjson.LineWriter, md metadata.MD, allowlist []string) {
+	started := false
+	for _, key := range allowlist {
+		values, ok := md[key]
+		if !ok {
+			continue
+		}
+		if !started {
+			line.StartRecord(KeyMetadata)
+			started = true
+		}
+		line.AddStringList(key, values)
+	}
+	if started {
+		line.EndRecord()
+	}
+}
@@ -0,0 +1,133 @@
+package goldjsongrpc_test
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/jussi-kalliokoski/goldjson"
+	"github.com/jussi-kalliokoski/goldjson/goldjsongrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type traceIDKey struct{}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	tests := []struct {
+		name     string
+		ctx      func(ctx context.Context) context.Context
+		err      error
+		expected string
+	}{
+		{
+			"ok",
+			func(ctx context.Context) context.Context { return ctx },
+			nil,
+			`{"trace_id":"abc","method":"/test.Service/Get","code":"OK"}`,
+		},
+		{
+			"error",
+			func(ctx context.Context) context.Context { return ctx },
+			status.Error(codes.NotFound, "not found"),
+			`{"trace_id":"abc","method":"/test.Service/Get","code":"NotFound"}`,
+		},
+		{
+			"peer and metadata",
+			func(ctx context.Context) context.Context {
+				ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 51234}})
+				return metadata.NewIncomingContext(ctx, metadata.Pairs("x-request-id", "r1", "authorization", "secret", "x-tenant", "a", "x-tenant", "b"))
+			},
+			nil,
+			`{"trace_id":"abc","method":"/test.Service/Get","code":"OK","peer":"10.0.0.1:51234","metadata":{"x-tenant":["a","b"],"x-request-id":["r1"]}}`,
+		},
+		{
+			"metadata without allowed keys",
+			func(ctx context.Context) context.Context {
+				return metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "secret"))
+			},
+			nil,
+			`{"trace_id":"abc","method":"/test.Service/Get","code":"OK"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf, goldjson.WithContextHook(func(ctx context.Context, l *goldjson.LineWriter) {
+				if id, ok := ctx.Value(traceIDKey{}).(string); ok {
+					l.AddString("trace_id", id)
+				}
+			}))
+			interceptor := goldjsongrpc.UnaryServerInterceptor(enc, goldjsongrpc.Options{Metadata: []string{"X-Tenant", "x-request-id"}})
+			ctx := tt.ctx(context.WithValue(context.Background(), traceIDKey{}, "abc"))
+			info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Get"}
+
+			resp, err := interceptor(ctx, "req", info, func(ctx context.Context, req any) (any, error) {
+				return "resp", tt.err
+			})
+
+			expectEqual(t, tt.err, err)
+			expectEqual(t, "resp", resp.(string))
+			expectEqual(t, tt.expected+"\n", withoutDuration(t, buf.Bytes()))
+		})
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	var buf bytes.Buffer
+	enc := goldjson.NewEncoder(&buf)
+	interceptor := goldjsongrpc.StreamServerInterceptor(enc, goldjsongrpc.Options{})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-request-id", "r1"))
+	info := &grpc.StreamServerInfo{FullMethod: "/test.Service/Watch", IsServerStream: true}
+	expectedErr := status.Error(codes.Canceled, "canceled")
+
+	err := interceptor(nil, serverStream{ctx: ctx}, info, func(srv any, stream grpc.ServerStream) error {
+		return expectedErr
+	})
+
+	expectEqual(t, expectedErr, err)
+	expectEqual(t, `{"method":"/test.Service/Watch","code":"Canceled"}`+"\n", withoutDuration(t, buf.Bytes()))
+}
+
+// withoutDuration returns the line without the duration field, checking
+// that the duration is a non-negative integer.
+func withoutDuration(tb testing.TB, line []byte) string {
+	tb.Helper()
+	dec := goldjson.NewDecoder(bytes.NewReader(line))
+	if !dec.NextLine() || !dec.Lookup(goldjsongrpc.KeyDuration) {
+		tb.Fatalf("no duration in %s", line)
+	}
+	duration, err := dec.Int64()
+	expectNoError(tb, err)
+	expectEqual(tb, true, duration >= 0)
+	field := `,"` + goldjsongrpc.KeyDuration + `":` + string(dec.Raw())
+	return string(bytes.Replace(line, []byte(field), nil, 1))
+}
+
+func expectNoError(tb testing.TB, err error) {
+	tb.Helper()
+	if err != nil {
+		tb.Fatalf("expected no error, got %##v", err)
+	}
+}
+
+func expectEqual[T comparable](tb testing.TB, expected, received T) {
+	tb.Helper()
+	if expected != received {
+		tb.Fatalf("expected %##v, got %##v", expected, received)
+	}
+}
@@ -0,0 +1,8 @@
+module github.com/jussi-kalliokoski/goldjson/goldjsonproto
+
+go 1.20
+
+require (
+	github.com/jussi-kalliokoski/goldjson v0.1.0
+	google.golang.org/protobuf v1.34.2
+)
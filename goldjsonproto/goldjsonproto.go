@@ -0,0 +1,221 @@
+// Package goldjsonproto adds protobuf messages to the lines of a
+// goldjson.LineWriter, in the JSON mapping of protobuf (as with protojson).
+//
+// The package is a separate module, so that goldjson itself doesn't depend
+// on the protobuf runtime. The module requires a released version of
+// goldjson; for developing against the local version, set up a workspace
+// in the root of the repository (the go.work file is not committed):
+//
+//	go work init . ./goldjsonproto
+//	go work edit -replace github.com/jussi-kalliokoski/goldjson@v0.1.0=./
+package goldjsonproto
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/jussi-kalliokoski/goldjson"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// AddProto adds a key-value pair with a protobuf message to the active
+// record/list of the line, encoded like protojson.Marshal with the default
+// options encodes it:
+//
+//   - the fields are keyed by their JSON names (lowerCamelCase by default),
+//     in the order they're declared in, and unpopulated fields are omitted
+//   - 64-bit integers are encoded as strings, non-finite floats as "NaN",
+//     "Infinity" and "-Infinity", bytes in standard base64, and enums by
+//     the names of their values
+//   - the entries of maps are sorted by their keys
+//   - the wrapper types and google.protobuf.Empty are encoded directly,
+//     while the other well-known types (e.g. google.protobuf.Timestamp or
+//     google.protobuf.Any) are encoded with protojson.Marshal
+//
+// Unlike with AddMarshal, the message is encoded directly into the line,
+// except for the well-known types encoded with protojson. The extensions of
+// the messages are omitted.
+//
+// Returns the first error encountered, in which case the failing value is
+// omitted like with AddRawJSON.
+//
+// If a list is currently active, the key will be ignored.
+func AddProto(l *goldjson.LineWriter, key string, m proto.Message) error {
+	if m == nil {
+		return l.AddRawJSON(key, []byte("null"))
+	}
+	var e encoder
+	return e.addMessage(l, key, m.ProtoReflect())
+}
+
+// encoder holds the scratch buffer for formatting the 64-bit integers.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) addMessage(l *goldjson.LineWriter, key string, m protoreflect.Message) error {
+	md := m.Descriptor()
+	if md.FullName().Parent() == "google.protobuf" {
+		if handled, err := e.addWellKnown(l, key, m); handled {
+			return err
+		}
+	}
+	l.StartRecord(key)
+	var err error
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if !m.Has(fd) {
+			continue
+		}
+		err = firstError(err, e.addField(l, fd, m.Get(fd)))
+	}
+	l.EndRecord()
+	return err
+}
+
+// addWellKnown adds the well-known types that have a special JSON mapping,
+// returning false for the ones that are encoded like other messages.
+func (e *encoder) addWellKnown(l *goldjson.LineWriter, key string, m protoreflect.Message) (bool, error) {
+	md := m.Descriptor()
+	switch md.Name() {
+	case "DoubleValue", "FloatValue", "Int64Value", "UInt64Value", "Int32Value", "UInt32Value", "BoolValue", "StringValue", "BytesValue":
+		fd := md.Fields().ByName("value")
+		return true, e.addValue(l, key, fd, m.Get(fd))
+	case "Empty":
+		l.StartRecord(key)
+		l.EndRecord()
+		return true, nil
+	case "Any", "Timestamp", "Duration", "Struct", "Value", "ListValue", "FieldMask":
+		b, err := protojson.Marshal(m.Interface())
+		if err != nil {
+			return true, err
+		}
+		// protojson randomizes the whitespace of its output
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, b); err != nil {
+			return true, err
+		}
+		return true, l.AddRawJSON(key, compact.Bytes())
+	}
+	return false, nil
+}
+
+func (e *encoder) addField(l *goldjson.LineWriter, fd protoreflect.FieldDescriptor, v protoreflect.Value) error {
+	key := fd.JSONName()
+	switch {
+	case fd.IsList():
+		list := v.List()
+		l.StartList(key)
+		var err error
+		for i := 0; i < list.Len(); i++ {
+			err = firstError(err, e.addValue(l, "", fd, list.Get(i)))
+		}
+		l.EndList()
+		return err
+	case fd.IsMap():
+		return e.addMap(l, key, fd, v.Map())
+	}
+	return e.addValue(l, key, fd, v)
+}
+
+func (e *encoder) addMap(l *goldjson.LineWriter, key string, fd protoreflect.FieldDescriptor, m protoreflect.Map) error {
+	keys := make([]protoreflect.MapKey, 0, m.Len())
+	m.Range(func(k protoreflect.MapKey, _ protoreflect.Value) bool {
+		keys = append(keys, k)
+		return true
+	})
+	sort.Slice(keys, func(i, j int) bool {
+		return lessMapKey(keys[i], keys[j])
+	})
+	l.StartRecord(key)
+	var err error
+	for _, k := range keys {
+		err = firstError(err, e.addValue(l, k.String(), fd.MapValue(), m.Get(k)))
+	}
+	l.EndRecord()
+	return err
+}
+
+func lessMapKey(a, b protoreflect.MapKey) bool {
+	switch x := a.Interface().(type) {
+	case bool:
+		return !x && b.Bool()
+	case int32, int64:
+		return a.Int() < b.Int()
+	case uint32, uint64:
+		return a.Uint() < b.Uint()
+	}
+	return a.String() < b.String()
+}
+
+func (e *encoder) addValue(l *goldjson.LineWriter, key string, fd protoreflect.FieldDescriptor, v protoreflect.Value) error {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		l.AddBool(key, v.Bool())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		l.AddInt64(key, v.Int())
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		l.AddUint64(key, v.Uint())
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		e.buf = strconv.AppendInt(e.buf[:0], v.Int(), 10)
+		l.AddString(key, string(e.buf))
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		e.buf = strconv.AppendUint(e.buf[:0], v.Uint(), 10)
+		l.AddString(key, string(e.buf))
+	case protoreflect.FloatKind:
+		addFloat(l, key, v.Float(), 32)
+	case protoreflect.DoubleKind:
+		addFloat(l, key, v.Float(), 64)
+	case protoreflect.StringKind:
+		l.AddString(key, v.String())
+	case protoreflect.BytesKind:
+		l.AddBytes(key, v.Bytes())
+	case protoreflect.EnumKind:
+		e.addEnum(l, key, fd.Enum(), v.Enum())
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return e.addMessage(l, key, v.Message())
+	}
+	return nil
+}
+
+func (e *encoder) addEnum(l *goldjson.LineWriter, key string, ed protoreflect.EnumDescriptor, n protoreflect.EnumNumber) {
+	if ed.FullName() == "google.protobuf.NullValue" {
+		_ = l.AddRawJSON(key, []byte("null"))
+		return
+	}
+	if value := ed.Values().ByNumber(n); value != nil {
+		l.AddString(key, string(value.Name()))
+		return
+	}
+	l.AddInt64(key, int64(n))
+}
+
+// addFloat adds a float like protojson, which encodes the non-finite values
+// as "NaN", "Infinity" and "-Infinity".
+func addFloat(l *goldjson.LineWriter, key string, value float64, bitSize int) {
+	switch {
+	case math.IsNaN(value):
+		l.AddString(key, "NaN")
+	case math.IsInf(value, 1):
+		l.AddString(key, "Infinity")
+	case math.IsInf(value, -1):
+		l.AddString(key, "-Infinity")
+	case bitSize == 32:
+		l.AddFloat32(key, float32(value))
+	default:
+		l.AddFloat64(key, value)
+	}
+}
+
+func firstError(err, next error) error {
+	if err != nil {
+		return err
+	}
+	return next
+}
@@ -0,0 +1,355 @@
+package goldjsonproto_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/jussi-kalliokoski/goldjson"
+	"github.com/jussi-kalliokoski/goldjson/goldjsonproto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestAddProto(t *testing.T) {
+	md := testMessageDescriptor(t)
+	valueOf := func(value any) protoreflect.Value {
+		if m, ok := value.(proto.Message); ok {
+			return protoreflect.ValueOfMessage(m.ProtoReflect())
+		}
+		return protoreflect.ValueOf(value)
+	}
+	set := func(m *dynamicpb.Message, name string, value any) {
+		m.Set(md.Fields().ByName(protoreflect.Name(name)), valueOf(value))
+	}
+	list := func(m *dynamicpb.Message, name string, values ...any) {
+		l := m.Mutable(md.Fields().ByName(protoreflect.Name(name))).List()
+		for _, v := range values {
+			l.Append(valueOf(v))
+		}
+	}
+	mapOf := func(m *dynamicpb.Message, name string, entries map[any]any) {
+		mp := m.Mutable(md.Fields().ByName(protoreflect.Name(name))).Map()
+		for k, v := range entries {
+			mp.Set(protoreflect.ValueOf(k).MapKey(), protoreflect.ValueOf(v))
+		}
+	}
+
+	tests := []struct {
+		name  string
+		build func() proto.Message
+	}{
+		{"empty", func() proto.Message {
+			return dynamicpb.NewMessage(md)
+		}},
+		{"scalars", func() proto.Message {
+			m := dynamicpb.NewMessage(md)
+			set(m, "flag", true)
+			set(m, "small", int32(-32))
+			set(m, "usmall", uint32(32))
+			set(m, "big", int64(-1<<62))
+			set(m, "ubig", uint64(1<<63))
+			set(m, "single", float32(0.1))
+			set(m, "double", 0.1)
+			set(m, "text", "a\"b<c>\n")
+			set(m, "data", []byte("hello"))
+			set(m, "color", protoreflect.EnumNumber(1))
+			return m
+		}},
+		{"unknown enum value", func() proto.Message {
+			m := dynamicpb.NewMessage(md)
+			set(m, "color", protoreflect.EnumNumber(7))
+			return m
+		}},
+		{"special floats", func() proto.Message {
+			m := dynamicpb.NewMessage(md)
+			set(m, "single", float32(math.Inf(-1)))
+			set(m, "double", math.NaN())
+			list(m, "doubles", math.Inf(1), 1e21, 1e-7, -0.0)
+			return m
+		}},
+		{"small and large float32", func() proto.Message {
+			m := dynamicpb.NewMessage(md)
+			set(m, "single", float32(1e-9))
+			list(m, "singles", float32(3e21), float32(123456.7), float32(0))
+			return m
+		}},
+		{"lists", func() proto.Message {
+			m := dynamicpb.NewMessage(md)
+			list(m, "doubles", 1.0, 2.5)
+			list(m, "texts", "a", "b")
+			child := dynamicpb.NewMessage(md)
+			set(child, "text", "child")
+			list(m, "children", child, dynamicpb.NewMessage(md))
+			return m
+		}},
+		{"maps", func() proto.Message {
+			m := dynamicpb.NewMessage(md)
+			mapOf(m, "by_name", map[any]any{"b": int64(2), "a": int64(1), "c": int64(3)})
+			mapOf(m, "by_number", map[any]any{int32(10): "ten", int32(-1): "minus one", int32(2): "two"})
+			mapOf(m, "by_flag", map[any]any{true: "yes", false: "no"})
+			return m
+		}},
+		{"nested", func() proto.Message {
+			m := dynamicpb.NewMessage(md)
+			child := dynamicpb.NewMessage(md)
+			set(child, "small", int32(1))
+			set(m, "child", child)
+			return m
+		}},
+		{"well-known types", func() proto.Message {
+			m := dynamicpb.NewMessage(md)
+			set(m, "wrapped", wrapperspb.Int64(5))
+			set(m, "time", timestamppb.New(time.Date(2023, 6, 12, 20, 42, 15, 152952812, time.UTC)))
+			set(m, "elapsed", durationpb.New(1500*time.Millisecond))
+			set(m, "nothing", &emptypb.Empty{})
+			s, err := structpb.NewStruct(map[string]any{"b": []any{1, "x", nil}, "a": true})
+			expectNoError(t, err)
+			set(m, "attrs", s)
+			return m
+		}},
+		{"generated message", func() proto.Message {
+			return &descriptorpb.FieldDescriptorProto{
+				Name:     proto.String("field"),
+				Number:   proto.Int32(1),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				JsonName: proto.String("field"),
+				Options:  &descriptorpb.FieldOptions{Deprecated: proto.Bool(true)},
+			}
+		}},
+		{"wrapper at top level", func() proto.Message {
+			return wrapperspb.String("value")
+		}},
+		{"struct at top level", func() proto.Message {
+			s, err := structpb.NewStruct(map[string]any{"a": 1})
+			expectNoError(t, err)
+			return s
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := tt.build()
+			var buf bytes.Buffer
+			enc := goldjson.NewEncoder(&buf)
+			expected := `{"value":` + marshalCompact(t, m) + `}` + "\n"
+
+			line := enc.NewLine()
+			err := goldjsonproto.AddProto(line, "value", m)
+			_ = line.End()
+			received := buf.String()
+
+			expectNoError(t, err)
+			expectEqual(t, expected, received)
+		})
+	}
+
+	t.Run("nil", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf)
+		expected := `{"value":null}` + "\n"
+
+		line := enc.NewLine()
+		err := goldjsonproto.AddProto(line, "value", nil)
+		_ = line.End()
+		received := buf.String()
+
+		expectNoError(t, err)
+		expectEqual(t, expected, received)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf)
+		expected := `{"values":[{"namePart":"a"},"b"]}` + "\n"
+
+		line := enc.NewLine()
+		line.StartList("values")
+		err1 := goldjsonproto.AddProto(line, "ignored", &descriptorpb.UninterpretedOption_NamePart{NamePart: proto.String("a")})
+		err2 := goldjsonproto.AddProto(line, "ignored", wrapperspb.String("b"))
+		line.EndList()
+		_ = line.End()
+		received := buf.String()
+
+		expectNoError(t, err1)
+		expectNoError(t, err2)
+		expectEqual(t, expected, received)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := goldjson.NewEncoder(&buf)
+		expected := `{"before":1,"after":2}` + "\n"
+
+		line := enc.NewLine()
+		line.AddInt64("before", 1)
+		err := goldjsonproto.AddProto(line, "value", &durationpb.Duration{Seconds: 1, Nanos: -1})
+		line.AddInt64("after", 2)
+		_ = line.End()
+		received := buf.String()
+
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		expectEqual(t, expected, received)
+	})
+}
+
+func BenchmarkAddProto(b *testing.B) {
+	m := &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String("field"),
+		Number:   proto.Int32(1),
+		Label:    descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(),
+		Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+		JsonName: proto.String("field"),
+		Options:  &descriptorpb.FieldOptions{Deprecated: proto.Bool(true)},
+	}
+
+	b.Run("AddProto", func(b *testing.B) {
+		enc := goldjson.NewEncoder(discard{})
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			line := enc.NewLine()
+			_ = goldjsonproto.AddProto(line, "value", m)
+			_ = line.End()
+		}
+	})
+
+	b.Run("protojson", func(b *testing.B) {
+		enc := goldjson.NewEncoder(discard{})
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			line := enc.NewLine()
+			data, _ := protojson.Marshal(m)
+			_ = line.AddRawJSON("value", data)
+			_ = line.End()
+		}
+	})
+}
+
+// testMessageDescriptor builds a message type with fields of every kind.
+func testMessageDescriptor(tb testing.TB) protoreflect.MessageDescriptor {
+	tb.Helper()
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(number),
+			Type:   typ.Enum(),
+			Label:  label.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	repeated := descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	entry := func(name string, key descriptorpb.FieldDescriptorProto_Type, value descriptorpb.FieldDescriptorProto_Type) *descriptorpb.DescriptorProto {
+		return &descriptorpb.DescriptorProto{
+			Name: proto.String(name),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("key", 1, key, optional, ""),
+				field("value", 2, value, optional, ""),
+			},
+			Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+		}
+	}
+
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("goldjsonproto_test.proto"),
+		Package: proto.String("goldjsonproto.test"),
+		Syntax:  proto.String("proto3"),
+		Dependency: []string{
+			"google/protobuf/wrappers.proto",
+			"google/protobuf/timestamp.proto",
+			"google/protobuf/duration.proto",
+			"google/protobuf/empty.proto",
+			"google/protobuf/struct.proto",
+		},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Color"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("COLOR_UNSPECIFIED"), Number: proto.Int32(0)},
+				{Name: proto.String("COLOR_RED"), Number: proto.Int32(1)},
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Message"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("flag", 1, descriptorpb.FieldDescriptorProto_TYPE_BOOL, optional, ""),
+				field("small", 2, descriptorpb.FieldDescriptorProto_TYPE_SINT32, optional, ""),
+				field("usmall", 3, descriptorpb.FieldDescriptorProto_TYPE_FIXED32, optional, ""),
+				field("big", 4, descriptorpb.FieldDescriptorProto_TYPE_INT64, optional, ""),
+				field("ubig", 5, descriptorpb.FieldDescriptorProto_TYPE_UINT64, optional, ""),
+				field("single", 6, descriptorpb.FieldDescriptorProto_TYPE_FLOAT, optional, ""),
+				field("double", 7, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, optional, ""),
+				field("text", 8, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional, ""),
+				field("data", 9, descriptorpb.FieldDescriptorProto_TYPE_BYTES, optional, ""),
+				field("color", 10, descriptorpb.FieldDescriptorProto_TYPE_ENUM, optional, ".goldjsonproto.test.Color"),
+				field("doubles", 11, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, repeated, ""),
+				field("singles", 12, descriptorpb.FieldDescriptorProto_TYPE_FLOAT, repeated, ""),
+				field("texts", 13, descriptorpb.FieldDescriptorProto_TYPE_STRING, repeated, ""),
+				field("children", 14, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, repeated, ".goldjsonproto.test.Message"),
+				field("child", 15, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, optional, ".goldjsonproto.test.Message"),
+				field("by_name", 16, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, repeated, ".goldjsonproto.test.Message.ByNameEntry"),
+				field("by_number", 17, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, repeated, ".goldjsonproto.test.Message.ByNumberEntry"),
+				field("by_flag", 18, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, repeated, ".goldjsonproto.test.Message.ByFlagEntry"),
+				field("wrapped", 19, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, optional, ".google.protobuf.Int64Value"),
+				field("time", 20, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, optional, ".google.protobuf.Timestamp"),
+				field("elapsed", 21, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, optional, ".google.protobuf.Duration"),
+				field("nothing", 22, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, optional, ".google.protobuf.Empty"),
+				field("attrs", 23, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, optional, ".google.protobuf.Struct"),
+			},
+			NestedType: []*descriptorpb.DescriptorProto{
+				entry("ByNameEntry", descriptorpb.FieldDescriptorProto_TYPE_STRING, descriptorpb.FieldDescriptorProto_TYPE_INT64),
+				entry("ByNumberEntry", descriptorpb.FieldDescriptorProto_TYPE_SINT32, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				entry("ByFlagEntry", descriptorpb.FieldDescriptorProto_TYPE_BOOL, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+			},
+		}},
+	}
+	fd, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+	expectNoError(tb, err)
+	return fd.Messages().ByName("Message")
+}
+
+func marshalCompact(tb testing.TB, m proto.Message) string {
+	tb.Helper()
+	data, err := protojson.Marshal(m)
+	expectNoError(tb, err)
+	var buf bytes.Buffer
+	expectNoError(tb, json.Compact(&buf, data))
+	return buf.String()
+}
+
+type discard struct{}
+
+func (discard) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func expectNoError(tb testing.TB, err error) {
+	tb.Helper()
+	if err != nil {
+		tb.Fatalf("expected no error, got %##v", err)
+	}
+}
+
+func expectEqual[T comparable](tb testing.TB, expected, received T) {
+	tb.Helper()
+	if expected != received {
+		tb.Fatalf("expected %##v, got %##v", expected, received)
+	}
+}
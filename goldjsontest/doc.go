@@ -0,0 +1,16 @@
+// Package goldjsontest provides a harness for checking that slog handlers
+// built on goldjson, such as goldjson.Handler or custom handlers encoding
+// the records with a goldjson.Encoder, comply with the requirements of
+// log/slog, as checked by testing/slogtest:
+//
+//	func TestHandlerCompliance(t *testing.T) {
+//		err := goldjsontest.TestHandler(func(w io.Writer) slog.Handler {
+//			return NewMyHandler(w)
+//		})
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//	}
+//
+// The harness requires Go 1.21, like log/slog.
+package goldjsontest
@@ -0,0 +1,36 @@
+//go:build go1.21
+
+package goldjsontest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing/slogtest"
+)
+
+// TestHandler runs the checks of testing/slogtest against the handler
+// returned by newHandler, which MUST write the records as lines of JSON
+// records to w, and returns the errors found, joined with errors.Join.
+// Lines that are not valid JSON records are reported as errors as well.
+func TestHandler(newHandler func(w io.Writer) slog.Handler) error {
+	var buf bytes.Buffer
+	h := newHandler(&buf)
+	var parseErrs []error
+	results := func() []map[string]any {
+		var records []map[string]any
+		for i, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+			var record map[string]any
+			if err := json.Unmarshal(line, &record); err != nil {
+				parseErrs = append(parseErrs, fmt.Errorf("goldjsontest: line %d: %w", i+1, err))
+			}
+			records = append(records, record)
+		}
+		return records
+	}
+	err := slogtest.TestHandler(h, results)
+	return errors.Join(append(parseErrs, err)...)
+}
@@ -0,0 +1,73 @@
+//go:build go1.21
+
+package goldjsontest_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/jussi-kalliokoski/goldjson"
+	"github.com/jussi-kalliokoski/goldjson/goldjsontest"
+)
+
+func TestTestHandler(t *testing.T) {
+	err := goldjsontest.TestHandler(func(w io.Writer) slog.Handler {
+		return goldjson.NewHandler(w, nil)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// groupless ignores the groups, violating the requirements of log/slog.
+type groupless struct {
+	slog.Handler
+}
+
+func (h groupless) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return groupless{h.Handler.WithAttrs(attrs)}
+}
+
+func (h groupless) WithGroup(name string) slog.Handler {
+	return h
+}
+
+func TestTestHandlerNonCompliant(t *testing.T) {
+	err := goldjsontest.TestHandler(func(w io.Writer) slog.Handler {
+		return groupless{goldjson.NewHandler(w, nil)}
+	})
+
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+// textHandler writes lines that are not JSON.
+type textHandler struct {
+	w io.Writer
+}
+
+func (h textHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h textHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h textHandler) WithGroup(string) slog.Handler            { return h }
+func (h textHandler) Handle(_ context.Context, r slog.Record) error {
+	_, err := io.WriteString(h.w, r.Message+"\n")
+	return err
+}
+
+func TestTestHandlerNotJSON(t *testing.T) {
+	err := goldjsontest.TestHandler(func(w io.Writer) slog.Handler {
+		return textHandler{w}
+	})
+
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) || !strings.Contains(err.Error(), "goldjsontest: line 1:") {
+		t.Fatalf("expected a syntax error, got %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package goldjson
+
+import "time"
+
+// Group is a compiled nested record with a fixed sequence of keys, for
+// records that are added with the same shape to many lines, e.g.
+//
+//	{"http":{"method":"GET","path":"/","status":200}}
+//
+// The keys are encoded once when the Group is created, like with Layout, so
+// adding a value through a GroupRecord costs only the value encoding and a
+// copy of the pre-encoded key and separator.
+type Group struct {
+	key    string
+	layout *Layout
+}
+
+// NewGroup compiles the given keys into a Group for adding records under the
+// key to the lines of the Encoder.
+func (e *Encoder) NewGroup(key string, keys ...string) *Group {
+	return &Group{key: key, layout: e.NewLayout(keys...)}
+}
+
+// Start starts a record of the Group in the active record/list of the line.
+//
+// GroupRecord.End MUST be called after all the values of the record have
+// been added.
+func (g *Group) Start(l *LineWriter) GroupRecord {
+	l.StartRecord(g.key)
+	return GroupRecord{
+		l: LayoutLine{
+			line:  l,
+			names: g.layout.names,
+			keys:  g.layout.keys,
+		},
+	}
+}
+
+// GroupRecord is a record following a Group. Each Add method adds the value
+// for the next key of the Group.
+//
+// Calling an Add method after the values for all the keys of the Group have
+// been added will panic.
+type GroupRecord struct {
+	l LayoutLine
+}
+
+// Skip omits the next key of the Group from the record.
+func (r *GroupRecord) Skip() {
+	r.l.Skip()
+}
+
+// AddString adds a string value for the next key of the Group.
+func (r *GroupRecord) AddString(value string) {
+	r.l.AddString(value)
+}
+
+// AddInt64 adds an int64 value for the next key of the Group.
+func (r *GroupRecord) AddInt64(value int64) {
+	r.l.AddInt64(value)
+}
+
+// AddUint64 adds a uint64 value for the next key of the Group.
+func (r *GroupRecord) AddUint64(value uint64) {
+	r.l.AddUint64(value)
+}
+
+// AddBool adds a bool value for the next key of the Group.
+func (r *GroupRecord) AddBool(value bool) {
+	r.l.AddBool(value)
+}
+
+// AddFloat64 adds a float64 value for the next key of the Group.
+func (r *GroupRecord) AddFloat64(value float64) {
+	r.l.AddFloat64(value)
+}
+
+// AddTime adds a time.Time value for the next key of the Group. See
+// LayoutLine.AddTime.
+func (r *GroupRecord) AddTime(value time.Time) error {
+	return r.l.AddTime(value)
+}
+
+// AddMarshal adds a JSON value for the next key of the Group. See
+// LayoutLine.AddMarshal.
+func (r *GroupRecord) AddMarshal(value any) error {
+	return r.l.AddMarshal(value)
+}
+
+// End closes the record.
+//
+// After calling End, the GroupRecord can no longer be used.
+func (r *GroupRecord) End() {
+	r.l.line.EndRecord()
+}
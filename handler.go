@@ -0,0 +1,269 @@
+//go:build go1.21
+
+package goldjson
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime"
+)
+
+// HandlerOptions configures a Handler. See NewHandler.
+type HandlerOptions struct {
+	// Level is the minimum level of the records to handle. Defaults to
+	// slog.LevelInfo.
+	Level slog.Leveler
+	// AddSource makes the Handler add the source code position of the log
+	// statement under slog.SourceKey.
+	AddSource bool
+	// ReplaceAttr is called for each non-group attribute before it is
+	// added, like slog.HandlerOptions.ReplaceAttr. Setting it disables the
+	// fast path for the built-in attributes.
+	ReplaceAttr func(groups []string, a slog.Attr) slog.Attr
+	// EncoderOptions are the options of the Encoder writing the records.
+	EncoderOptions []Option
+}
+
+// Handler is a slog.Handler that writes the records as line-delimited JSON,
+// in the same format as slog.JSONHandler:
+//
+//	{"time":"2023-06-12T20:42:15.152952812Z","level":"INFO","msg":"hello","count":3}
+//
+// The attributes added with WithAttrs are encoded once into StaticFields, so
+// they only cost a copy per record. Attributes whose key and value are both
+// zero and groups without attributes are omitted, as are zero times of the
+// records. The levels of the records are added with AddLevel, so their
+// format can be changed with WithLevelFormat.
+//
+// The Handler is safe for concurrent use: the lines are written to the
+// writer one at a time (see WithLocking).
+//
+// The Handler passes the checks of testing/slogtest; see package goldjsontest
+// for running them against custom handlers built on goldjson.
+type Handler struct {
+	encoder *Encoder
+	opts    HandlerOptions
+	// fields are the attributes added with WithAttrs before the first group.
+	fields *StaticFields
+	groups []handlerGroup
+}
+
+type handlerGroup struct {
+	name   string
+	fields *StaticFields
+}
+
+// NewHandler returns a new Handler writing to w. The options may be nil.
+func NewHandler(w io.Writer, opts *HandlerOptions) *Handler {
+	h := &Handler{}
+	if opts != nil {
+		h.opts = *opts
+	}
+	if h.opts.Level == nil {
+		h.opts.Level = slog.LevelInfo
+	}
+	// slog.Handlers must be safe for concurrent use
+	encOpts := append([]Option{WithLocking()}, h.opts.EncoderOptions...)
+	h.encoder = NewEncoder(w, encOpts...)
+	for _, key := range []string{slog.TimeKey, slog.LevelKey, slog.MessageKey, slog.SourceKey} {
+		h.encoder.PrepareKey(key)
+	}
+	return h
+}
+
+// Encoder returns the Encoder of the Handler, e.g. for flushing it.
+func (h *Handler) Encoder() *Encoder {
+	return h.encoder
+}
+
+// Enabled reports whether the level is at least the minimum level of the
+// Handler.
+func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.opts.Level.Level()
+}
+
+// Handle writes the record as a line.
+func (h *Handler) Handle(_ context.Context, r slog.Record) error {
+	l := h.encoder.NewLine()
+	if h.opts.ReplaceAttr == nil {
+		if !r.Time.IsZero() {
+			_ = l.AddTime(slog.TimeKey, r.Time)
+		}
+		l.AddLevel(slog.LevelKey, int(r.Level))
+		if h.opts.AddSource && r.PC != 0 {
+			h.addSource(l, r.PC)
+		}
+		l.AddString(slog.MessageKey, r.Message)
+	} else {
+		if !r.Time.IsZero() {
+			h.addAttr(l, nil, slog.Time(slog.TimeKey, r.Time))
+		}
+		h.addAttr(l, nil, slog.Any(slog.LevelKey, r.Level))
+		if h.opts.AddSource && r.PC != 0 {
+			h.addAttr(l, nil, slog.Any(slog.SourceKey, source(r.PC)))
+		}
+		h.addAttr(l, nil, slog.String(slog.MessageKey, r.Message))
+	}
+	if h.fields != nil {
+		l.AddStaticFields(h.fields)
+	}
+	for _, g := range h.groups {
+		l.StartRecord(g.name)
+		if g.fields != nil {
+			l.AddStaticFields(g.fields)
+		}
+	}
+	if r.NumAttrs() > 0 {
+		var groups []string
+		if h.opts.ReplaceAttr != nil {
+			groups = h.groupNames()
+		}
+		r.Attrs(func(a slog.Attr) bool {
+			h.addAttr(l, groups, a)
+			return true
+		})
+	}
+	for range h.groups {
+		l.EndRecordOmitEmpty()
+	}
+	return l.End()
+}
+
+// WithAttrs returns a Handler that adds the attributes to every record, in
+// the innermost group of the Handler, if any.
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	c := h.clone()
+	fields := &c.fields
+	if len(c.groups) > 0 {
+		fields = &c.groups[len(c.groups)-1].fields
+	}
+	var f *StaticFields
+	var l *LineWriter
+	if *fields != nil {
+		f, l = (*fields).Extend()
+	} else {
+		f, l = h.encoder.NewStaticFields()
+	}
+	groups := c.groupNames()
+	for _, a := range attrs {
+		h.addAttr(l, groups, a)
+	}
+	_ = l.End()
+	*fields = f
+	return c
+}
+
+// WithGroup returns a Handler that adds the attributes of the records, as
+// well as the attributes added with WithAttrs after the group, in a record
+// under the name.
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	c := h.clone()
+	c.groups = append(c.groups, handlerGroup{name: name})
+	return c
+}
+
+func (h *Handler) clone() *Handler {
+	c := *h
+	c.groups = append([]handlerGroup(nil), h.groups...)
+	return &c
+}
+
+func (h *Handler) groupNames() []string {
+	if len(h.groups) == 0 {
+		return nil
+	}
+	names := make([]string, len(h.groups))
+	for i, g := range h.groups {
+		names[i] = g.name
+	}
+	return names
+}
+
+func (h *Handler) addAttr(l *LineWriter, groups []string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if h.opts.ReplaceAttr != nil && a.Value.Kind() != slog.KindGroup {
+		a = h.opts.ReplaceAttr(groups, a)
+		a.Value = a.Value.Resolve()
+	}
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	v := a.Value
+	switch v.Kind() {
+	case slog.KindString:
+		l.AddString(a.Key, v.String())
+	case slog.KindInt64:
+		l.AddInt64(a.Key, v.Int64())
+	case slog.KindUint64:
+		l.AddUint64(a.Key, v.Uint64())
+	case slog.KindFloat64:
+		l.AddFloat64(a.Key, v.Float64())
+	case slog.KindBool:
+		l.AddBool(a.Key, v.Bool())
+	case slog.KindDuration:
+		l.AddInt64(a.Key, int64(v.Duration()))
+	case slog.KindTime:
+		if err := l.AddTime(a.Key, v.Time()); err != nil {
+			l.AddString(a.Key, "!ERROR:"+err.Error())
+		}
+	case slog.KindGroup:
+		attrs := v.Group()
+		if len(attrs) == 0 {
+			return
+		}
+		if a.Key != "" {
+			l.StartRecord(a.Key)
+			if h.opts.ReplaceAttr != nil {
+				groups = append(groups[:len(groups):len(groups)], a.Key)
+			}
+		}
+		for _, a := range attrs {
+			h.addAttr(l, groups, a)
+		}
+		if a.Key != "" {
+			l.EndRecordOmitEmpty()
+		}
+	default:
+		switch value := v.Any().(type) {
+		case error:
+			if isNilPointer(value) {
+				// like slog.JSONHandler
+				l.AddString(a.Key, "<nil>")
+				return
+			}
+			l.AddString(a.Key, value.Error())
+		case *slog.Source:
+			addSource(l, a.Key, value)
+		default:
+			if err := l.AddMarshal(a.Key, value); err != nil {
+				l.AddString(a.Key, fmt.Sprintf("!ERROR:%v", err))
+			}
+		}
+	}
+}
+
+func (h *Handler) addSource(l *LineWriter, pc uintptr) {
+	addSource(l, slog.SourceKey, source(pc))
+}
+
+func addSource(l *LineWriter, key string, s *slog.Source) {
+	l.StartRecord(key)
+	l.AddString("function", s.Function)
+	l.AddString("file", s.File)
+	l.AddInt64("line", int64(s.Line))
+	l.EndRecord()
+}
+
+func source(pc uintptr) *slog.Source {
+	frames := runtime.CallersFrames([]uintptr{pc})
+	frame, _ := frames.Next()
+	return &slog.Source{Function: frame.Function, File: frame.File, Line: frame.Line}
+}
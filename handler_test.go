@@ -0,0 +1,186 @@
+//go:build go1.21
+
+package goldjson_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jussi-kalliokoski/goldjson"
+	"github.com/jussi-kalliokoski/goldjson/goldjsontest"
+)
+
+func TestHandler(t *testing.T) {
+	t.Run("slogtest", func(t *testing.T) {
+		err := goldjsontest.TestHandler(func(w io.Writer) slog.Handler {
+			return goldjson.NewHandler(w, nil)
+		})
+
+		expectNoError(t, err)
+	})
+
+	tests := []struct {
+		name     string
+		opts     *goldjson.HandlerOptions
+		log      func(*slog.Logger)
+		expected string
+	}{
+		{
+			"kinds",
+			nil,
+			func(l *slog.Logger) {
+				l.Info("hello",
+					"s", "x",
+					"i", -1,
+					"u", uint64(1),
+					"f", 1.5,
+					"b", true,
+					"d", time.Second,
+					"t", baseTime,
+					"err", errors.New("failed"),
+					"m", Point{1, 2},
+					"bad", ErrorMarshal{},
+				)
+			},
+			`{"time":"<time>","level":"INFO","msg":"hello","s":"x","i":-1,"u":1,"f":1.5,"b":true,"d":1000000000,"t":"2023-06-12T20:42:15.152952812Z","err":"failed","m":{"x":1,"y":2},"bad":"!ERROR:json: error calling MarshalJSON for type *goldjson_test.ErrorMarshal: failed"}`,
+		},
+		{
+			"nil pointer error",
+			nil,
+			func(l *slog.Logger) {
+				l.Info("hello", "err", (*url.Error)(nil))
+			},
+			`{"time":"<time>","level":"INFO","msg":"hello","err":"<nil>"}`,
+		},
+		{
+			"attrs and groups",
+			nil,
+			func(l *slog.Logger) {
+				l.With("a", 1).WithGroup("g").With("b", 2).WithGroup("h").Info("hello", "c", 3)
+			},
+			`{"time":"<time>","level":"INFO","msg":"hello","a":1,"g":{"b":2,"h":{"c":3}}}`,
+		},
+		{
+			"empty groups",
+			nil,
+			func(l *slog.Logger) {
+				l.WithGroup("g").WithGroup("h").Info("hello", slog.Group("empty"), slog.Group("i", slog.Group("j")))
+			},
+			`{"time":"<time>","level":"INFO","msg":"hello"}`,
+		},
+		{
+			"level",
+			&goldjson.HandlerOptions{Level: slog.LevelWarn},
+			func(l *slog.Logger) {
+				l.Info("skipped")
+				l.Warn("hello")
+			},
+			`{"time":"<time>","level":"WARN","msg":"hello"}`,
+		},
+		{
+			"level format",
+			&goldjson.HandlerOptions{EncoderOptions: []goldjson.Option{goldjson.WithLevelFormat(goldjson.LevelFormatLowercase)}},
+			func(l *slog.Logger) {
+				l.Log(context.Background(), slog.LevelWarn+2, "hello")
+			},
+			`{"time":"<time>","level":"warn+2","msg":"hello"}`,
+		},
+		{
+			"replace attr",
+			&goldjson.HandlerOptions{ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				switch {
+				case a.Key == slog.TimeKey:
+					return slog.Attr{}
+				case len(groups) > 0:
+					return slog.String(a.Key, groups[len(groups)-1])
+				}
+				return a
+			}},
+			func(l *slog.Logger) {
+				l.WithGroup("g").Info("hello", "a", 1, slog.Group("h", "b", 2))
+			},
+			`{"level":"INFO","msg":"hello","g":{"a":"g","h":{"b":"h"}}}`,
+		},
+		{
+			"source",
+			&goldjson.HandlerOptions{AddSource: true},
+			func(l *slog.Logger) {
+				l.Info("hello")
+			},
+			`{"time":"<time>","level":"INFO","source":{"function":"github.com/jussi-kalliokoski/goldjson_test.TestHandler.func<n>","file":"<file>","line":<line>},"msg":"hello"}`,
+		},
+	}
+
+	placeholders := []struct {
+		re          *regexp.Regexp
+		replacement string
+	}{
+		{regexp.MustCompile(`"time":"[^"]+"`), `"time":"<time>"`},
+		{regexp.MustCompile(`func\d+`), `func<n>`},
+		{regexp.MustCompile(`"file":"[^"]+handler_test.go"`), `"file":"<file>"`},
+		{regexp.MustCompile(`"line":\d+`), `"line":<line>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l := slog.New(goldjson.NewHandler(&buf, tt.opts))
+			expected := tt.expected + "\n"
+
+			tt.log(l)
+			received := buf.String()
+			for _, p := range placeholders {
+				received = p.re.ReplaceAllString(received, p.replacement)
+			}
+
+			expectEqual(t, expected, received)
+		})
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		h := goldjson.NewHandler(&bytes.Buffer{}, &goldjson.HandlerOptions{Level: slog.LevelDebug})
+
+		expectEqual(t, true, h.Enabled(context.Background(), slog.LevelDebug))
+		expectEqual(t, false, h.Enabled(context.Background(), slog.LevelDebug-1))
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		const goroutines = 8
+		const linesPerGoroutine = 100
+		var buf bytes.Buffer
+		l := slog.New(goldjson.NewHandler(&buf, nil)).With("service", "api").WithGroup("req")
+
+		var wg sync.WaitGroup
+		for i := 0; i < goroutines; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < linesPerGoroutine; j++ {
+					l.Info("hello", "goroutine", i, "line", j)
+				}
+			}(i)
+		}
+		wg.Wait()
+		lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+
+		expectEqual(t, goroutines*linesPerGoroutine, len(lines))
+		for _, line := range lines {
+			var record struct {
+				Msg string
+				Req struct{ Goroutine, Line int }
+			}
+			expectNoError(t, json.Unmarshal([]byte(line), &record))
+			expectEqual(t, "hello", record.Msg)
+		}
+	})
+}
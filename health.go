@@ -0,0 +1,26 @@
+package goldjson
+
+// HealthChecker is implemented by writers that can report whether they are
+// able to accept lines, e.g. whether a file is still open and writable or a
+// connection is still established. See Encoder.Health.
+type HealthChecker interface {
+	// Health returns nil if the writer is healthy, or an error describing
+	// why it is not.
+	Health() error
+}
+
+// Health reports the health of the destination of the Encoder, e.g. for
+// exposing the readiness of the logging pipeline in the health endpoint of a
+// service. Returns nil if the underlying writer doesn't implement
+// HealthChecker.
+//
+// The writers of the Encoders created with NewFileEncoder and NewMmapEncoder
+// are unhealthy after Close or a failed write or flush that hasn't been
+// reported yet, and the writers wrapped for WithDoubleBuffering are
+// unhealthy after a failed write, or if the wrapped writer is unhealthy.
+func (e *Encoder) Health() error {
+	if h, ok := e.w.(HealthChecker); ok {
+		return h.Health()
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package goldjson
+
+import "time"
+
+// HeartbeatConfig configures a Heartbeat. See Encoder.StartHeartbeat.
+type HeartbeatConfig struct {
+	// Interval is the interval between heartbeat lines. Defaults to one
+	// minute.
+	Interval time.Duration
+	// Fields, if set, are added to every heartbeat line before the heartbeat
+	// fields, e.g. to identify the service.
+	Fields *StaticFields
+	// Dropped, if set, is called for the number of lines dropped so far,
+	// which is added to the heartbeat lines.
+	Dropped func() int64
+}
+
+// Heartbeat periodically writes a heartbeat line through an Encoder, so that
+// downstream pipelines can distinguish a quiet service from a broken
+// pipeline. A heartbeat line looks like:
+//
+//	{"heartbeat":3,"uptime":180.000112,"dropped":0}
+//
+// where heartbeat is the sequence number of the line (starting from 1),
+// uptime is the number of seconds since the Heartbeat was started and
+// dropped is the number reported by HeartbeatConfig.Dropped, if set.
+type Heartbeat struct {
+	encoder *Encoder
+	config  HeartbeatConfig
+	start   time.Time
+	seq     int64
+	err     error
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// StartHeartbeat starts writing heartbeat lines through the Encoder in a
+// background goroutine, until Stop is called on the returned Heartbeat.
+func (e *Encoder) StartHeartbeat(config HeartbeatConfig) *Heartbeat {
+	if config.Interval <= 0 {
+		config.Interval = time.Minute
+	}
+	h := &Heartbeat{
+		encoder: e,
+		config:  config,
+		start:   time.Now(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go h.run()
+	return h
+}
+
+// Stop stops the Heartbeat and waits for the background goroutine to exit.
+// Returns the first error from writing the heartbeat lines, if any.
+//
+// Stop MUST be called only once.
+func (h *Heartbeat) Stop() error {
+	close(h.stop)
+	<-h.done
+	return h.err
+}
+
+func (h *Heartbeat) run() {
+	defer close(h.done)
+	ticker := time.NewTicker(h.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.stop:
+			return
+		case now := <-ticker.C:
+			if err := h.beat(now); err != nil && h.err == nil {
+				h.err = err
+			}
+		}
+	}
+}
+
+func (h *Heartbeat) beat(now time.Time) error {
+	h.seq++
+	line := h.encoder.NewLine()
+	if h.config.Fields != nil {
+		line.AddStaticFields(h.config.Fields)
+	}
+	line.AddInt64("heartbeat", h.seq)
+	line.AddFloat64("uptime", now.Sub(h.start).Seconds())
+	if h.config.Dropped != nil {
+		line.AddInt64("dropped", h.config.Dropped())
+	}
+	return line.End()
+}
@@ -0,0 +1,66 @@
+package goldjson_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jussi-kalliokoski/goldjson"
+)
+
+func TestHeartbeat(t *testing.T) {
+	t.Run("lines", func(t *testing.T) {
+		var w syncWriter
+		enc := goldjson.NewEncoder(&w)
+		fields, fw := enc.NewStaticFields()
+		fw.AddString("service", "test")
+		_ = fw.End()
+
+		h := enc.StartHeartbeat(goldjson.HeartbeatConfig{
+			Interval: time.Millisecond,
+			Fields:   fields,
+			Dropped:  func() int64 { return 5 },
+		})
+		deadline := time.Now().Add(5 * time.Second)
+		for strings.Count(w.String(), "\n") < 3 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		stopErr := h.Stop()
+		lines := strings.Split(strings.TrimSuffix(w.String(), "\n"), "\n")
+
+		expectNoError(t, stopErr)
+		expectEqual(t, true, len(lines) >= 3)
+		for i, line := range lines {
+			var record struct {
+				Service   string  `json:"service"`
+				Heartbeat int64   `json:"heartbeat"`
+				Uptime    float64 `json:"uptime"`
+				Dropped   int64   `json:"dropped"`
+			}
+			expectNoError(t, json.Unmarshal([]byte(line), &record))
+			expectEqual(t, "test", record.Service)
+			expectEqual(t, int64(i+1), record.Heartbeat)
+			expectEqual(t, true, record.Uptime > 0)
+			expectEqual(t, int64(5), record.Dropped)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		written := make(chan struct{}, 1)
+		enc := goldjson.NewEncoder(ErrorWriter{}, goldjson.WithWriteHooks(goldjson.WriteHooks{
+			AfterWrite: func(int, time.Duration, error) {
+				select {
+				case written <- struct{}{}:
+				default:
+				}
+			},
+		}))
+
+		h := enc.StartHeartbeat(goldjson.HeartbeatConfig{Interval: time.Millisecond})
+		<-written
+		stopErr := h.Stop()
+
+		expectError(t, stopErr)
+	})
+}
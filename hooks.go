@@ -0,0 +1,86 @@
+package goldjson
+
+import (
+	"time"
+
+	"github.com/jussi-kalliokoski/goldjson/tokens"
+)
+
+// WriteHooks are called around each write of a line to the underlying
+// writer of an Encoder, e.g. for recording write latency histograms or
+// detecting slow sinks. Either of the hooks may be nil.
+//
+// The hooks are called synchronously from LineWriter.End, so they should be
+// fast.
+type WriteHooks struct {
+	// BeforeWrite is called before writing a line of the given size in
+	// bytes, including the trailing newline.
+	BeforeWrite func(size int)
+	// AfterWrite is called after writing a line of the given size in bytes,
+	// with the time it took to write the line and the error returned by the
+	// writer, if any.
+	AfterWrite func(size int, elapsed time.Duration, err error)
+}
+
+// WithWriteHooks sets the hooks to call around each write of a line.
+func WithWriteHooks(hooks WriteHooks) Option {
+	return func(o *options) {
+		o.writeHooks = hooks
+	}
+}
+
+// WithSlowWriteWarning makes the Encoder measure the time from ending a line
+// to the completion of its write, including the time spent waiting for
+// other writes (see WithLocking), and warn about the writes that take at
+// least the threshold, e.g. due to a blocked stdout or a stalled disk, which
+// otherwise show up as unexplained latency of the calling code.
+//
+// If warn is set, it is called with the size of the line in bytes and the
+// time it took to write it. Otherwise a warning line is written after the
+// slow line:
+//
+//	{"warning":"slow write","size":1234,"elapsed_ns":250000000}
+//
+// The warning line is not measured, so it cannot trigger further warnings.
+func WithSlowWriteWarning(threshold time.Duration, warn func(size int, elapsed time.Duration)) Option {
+	return func(o *options) {
+		o.slowWriteThreshold = threshold
+		o.slowWriteWarn = warn
+	}
+}
+
+func (e *Encoder) write(buf []byte) error {
+	hooks := &e.opts.writeHooks
+	if hooks.BeforeWrite == nil && hooks.AfterWrite == nil && e.opts.slowWriteThreshold <= 0 {
+		return e.writeLine(buf)
+	}
+	if hooks.BeforeWrite != nil {
+		hooks.BeforeWrite(len(buf))
+	}
+	start := time.Now()
+	err := e.writeLine(buf)
+	elapsed := time.Since(start)
+	if hooks.AfterWrite != nil {
+		hooks.AfterWrite(len(buf), elapsed, err)
+	}
+	if e.opts.slowWriteThreshold > 0 && elapsed >= e.opts.slowWriteThreshold {
+		e.warnSlowWrite(len(buf), elapsed)
+	}
+	return err
+}
+
+func (e *Encoder) warnSlowWrite(size int, elapsed time.Duration) {
+	if e.opts.slowWriteWarn != nil {
+		e.opts.slowWriteWarn(size, elapsed)
+		return
+	}
+	buf := make([]byte, 0, 80)
+	buf = append(buf, `{"warning":"slow write","size":`...)
+	buf = tokens.AppendInt64(buf, int64(size))
+	buf = append(buf, `,"elapsed_ns":`...)
+	buf = tokens.AppendInt64(buf, int64(elapsed))
+	buf = append(buf, "}\n"...)
+	// there's no caller to report the error to, and the error of the slow
+	// line itself is reported by End
+	_ = e.writeLine(buf)
+}
@@ -0,0 +1,69 @@
+package goldjson
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// AddStringList adds a key-value pair with a list of string values to the
+// active record/list.
+//
+// If a list is currently active, the key will be ignored.
+func (l *LineWriter) AddStringList(key string, values []string) {
+	if l.checkKey(key) != nil {
+		return
+	}
+	l.appendKey(key)
+	l.buf = append(l.buf, '[')
+	for i, value := range values {
+		if i != 0 {
+			l.buf = append(l.buf, ',')
+		}
+		l.buf = l.encoder.str.AppendValue(l.buf, value)
+	}
+	l.buf = append(l.buf, ']')
+}
+
+// AddURLValues adds a key-value pair with a record of the url.Values (e.g.
+// the query parameters of a request) to the active record/list, with the
+// values of each parameter as a list of strings, sorted by the parameter
+// names:
+//
+//	{"query":{"page":["2"],"tag":["a","b"]}}
+//
+// If a list is currently active, the key will be ignored.
+func (l *LineWriter) AddURLValues(key string, values url.Values) {
+	l.StartRecord(key)
+	for _, name := range sortedKeys(values) {
+		l.AddStringList(name, values[name])
+	}
+	l.EndRecord()
+}
+
+// AddHeaders adds a key-value pair with a record of the HTTP headers to the
+// active record/list, with the values of each header as a list of strings:
+//
+//	{"headers":{"Accept":["text/html"],"User-Agent":["curl/8.0.1"]}}
+//
+// Only the headers in the allowlist are added, in the order of the
+// allowlist, with the names canonicalized (see http.CanonicalHeaderKey). If
+// the allowlist is nil, all the headers are added, sorted by the names,
+// which risks logging sensitive headers such as Authorization and Cookie.
+//
+// If a list is currently active, the key will be ignored.
+func (l *LineWriter) AddHeaders(key string, headers http.Header, allowlist []string) {
+	l.StartRecord(key)
+	if allowlist == nil {
+		for _, name := range sortedKeys(headers) {
+			l.AddStringList(name, headers[name])
+		}
+	} else {
+		for _, name := range allowlist {
+			name = http.CanonicalHeaderKey(name)
+			if values, ok := headers[name]; ok {
+				l.AddStringList(name, values)
+			}
+		}
+	}
+	l.EndRecord()
+}
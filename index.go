@@ -0,0 +1,177 @@
+package goldjson
+
+import (
+	"io"
+	"sync"
+)
+
+// IndexEntry is the location of a line in a log file.
+type IndexEntry struct {
+	// Offset is the offset of the line in bytes.
+	Offset int64
+	// Size is the size of the line in bytes, including the trailing newline.
+	Size int
+}
+
+// Index maps the values of a field to the lines with the value, see
+// IndexWriter and LoadIndex.
+type Index struct {
+	entries map[string][]IndexEntry
+}
+
+// Lookup returns the locations of the lines with the value, in the order
+// the lines were written.
+func (x *Index) Lookup(value string) []IndexEntry {
+	return x.entries[value]
+}
+
+// ReadLines reads the lines with the value from r, e.g. the *os.File of the
+// log file, calling fn for each line (without the trailing newline) in the
+// order the lines were written. The line is only valid until fn returns.
+//
+// Stops at the first error returned by fn or encountered when reading.
+func (x *Index) ReadLines(r io.ReaderAt, value string, fn func(line []byte) error) error {
+	var buf []byte
+	for _, entry := range x.entries[value] {
+		if cap(buf) < entry.Size {
+			buf = make([]byte, entry.Size)
+		}
+		buf = buf[:entry.Size]
+		if _, err := r.ReadAt(buf, entry.Offset); err != nil {
+			return err
+		}
+		if err := fn(buf[:len(buf)-1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadIndex reads an index from a sidecar written by an IndexWriter.
+func LoadIndex(r io.Reader) (*Index, error) {
+	x := &Index{entries: map[string][]IndexEntry{}}
+	dec := NewDecoder(r)
+	for dec.NextLine() {
+		var value string
+		var entry IndexEntry
+		for dec.NextField() {
+			var err error
+			switch string(dec.Key()) {
+			case "value":
+				value, err = dec.String()
+			case "offset":
+				entry.Offset, err = dec.Int64()
+			case "size":
+				var size int64
+				size, err = dec.Int64()
+				entry.Size = int(size)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		x.entries[value] = append(x.entries[value], entry)
+	}
+	if err := dec.Err(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// IndexWriter is an io.Writer that passes the lines written by an Encoder
+// through to another writer, indexing them by the value of a top-level
+// field, e.g. the request ID, for reading the matching lines back without
+// scanning the whole log (see Index.ReadLines).
+//
+// String values are indexed unescaped and other values as their raw JSON,
+// e.g. 3 as "3". Lines without the field are not indexed.
+//
+// The index is kept in memory (see Index) and optionally written to a
+// sidecar, one line per indexed line, to be loaded with LoadIndex.
+//
+// The IndexWriter assumes that each write is a single line, which is the
+// case for the writes of an Encoder.
+type IndexWriter struct {
+	w       io.Writer
+	key     string
+	sidecar *Encoder
+	mu      sync.Mutex
+	offset  int64
+	entries map[string][]IndexEntry
+	dec     Decoder
+}
+
+// NewIndexWriter returns an IndexWriter that writes to w, indexing the lines
+// by the field with the key. If sidecar is not nil, the index is written to
+// it as well.
+func NewIndexWriter(w io.Writer, key string, sidecar io.Writer) *IndexWriter {
+	x := &IndexWriter{w: w, key: key, entries: map[string][]IndexEntry{}}
+	if sidecar != nil {
+		x.sidecar = NewEncoder(sidecar)
+	}
+	return x
+}
+
+// SetOffset sets the offset of the next line written, e.g. the size of the
+// log file when appending to it. It must be called before writing.
+func (x *IndexWriter) SetOffset(offset int64) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.offset = offset
+}
+
+// Index returns a snapshot of the index of the lines written so far.
+func (x *IndexWriter) Index() *Index {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	entries := make(map[string][]IndexEntry, len(x.entries))
+	for value, e := range x.entries {
+		entries[value] = e[:len(e):len(e)]
+	}
+	return &Index{entries: entries}
+}
+
+// Write writes the line p to the underlying writer and indexes it.
+func (x *IndexWriter) Write(p []byte) (int, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if err := writeFull(x.w, p); err != nil {
+		return 0, err
+	}
+	entry := IndexEntry{Offset: x.offset, Size: len(p)}
+	x.offset += int64(len(p))
+	value, ok := x.value(p)
+	if !ok {
+		return len(p), nil
+	}
+	x.entries[string(value)] = append(x.entries[string(value)], entry)
+	if x.sidecar != nil {
+		line := x.sidecar.NewLine()
+		line.AddString("value", string(value))
+		line.AddInt64("offset", entry.Offset)
+		line.AddInt64("size", int64(entry.Size))
+		if err := line.End(); err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+// value returns the value of the indexed field of the line.
+func (x *IndexWriter) value(p []byte) ([]byte, bool) {
+	x.dec.err = nil
+	if len(p) == 0 || p[len(p)-1] != '\n' || !x.dec.setLine(p[:len(p)-1]) {
+		return nil, false
+	}
+	for x.dec.NextField() {
+		if string(x.dec.Key()) != x.key {
+			continue
+		}
+		if x.dec.Type() == ValueString {
+			value, _ := x.dec.Bytes()
+			return value, true
+		}
+		return x.dec.Raw(), true
+	}
+	return nil, false
+}
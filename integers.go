@@ -0,0 +1,65 @@
+package goldjson
+
+import "github.com/jussi-kalliokoski/goldjson/tokens"
+
+// WithSafeIntegers makes the Encoder quote the integers whose absolute value
+// exceeds tokens.MaxSafeInteger (2^53-1) as strings, e.g.
+// "9007199254740993", to protect consumers that parse numbers as float64
+// (such as JSON.parse in JavaScript) from silent precision loss. Smaller
+// integers are encoded as numbers.
+//
+// The option applies to AddInt64, AddUint64 and AddEnum (for values without
+// a registered name), as well as the respective methods of LayoutLine. For
+// fields that should always be strings regardless of the value, such as
+// IDs, use AddInt64String and AddUint64String instead.
+func WithSafeIntegers() Option {
+	return func(o *options) {
+		o.safeIntegers = true
+	}
+}
+
+// AddInt64String adds a key-value pair with an int64 value encoded as a
+// string, e.g. "1234", to the active record/list, for fields that consumers
+// parsing numbers as float64 should always treat as strings, such as the
+// "id_str" companions of numeric IDs. Unlike with WithSafeIntegers, the value
+// is quoted regardless of its magnitude, so the type of the field doesn't
+// depend on the value.
+//
+// If a list is currently active, the key will be ignored.
+func (l *LineWriter) AddInt64String(key string, value int64) {
+	if l.checkKey(key) != nil {
+		return
+	}
+	l.appendKey(key)
+	l.buf = append(l.buf, '"')
+	l.buf = tokens.AppendInt64(l.buf, value)
+	l.buf = append(l.buf, '"')
+}
+
+// AddUint64String adds a key-value pair with a uint64 value encoded as a
+// string, e.g. "1234", to the active record/list. See AddInt64String.
+//
+// If a list is currently active, the key will be ignored.
+func (l *LineWriter) AddUint64String(key string, value uint64) {
+	if l.checkKey(key) != nil {
+		return
+	}
+	l.appendKey(key)
+	l.buf = append(l.buf, '"')
+	l.buf = tokens.AppendUint64(l.buf, value)
+	l.buf = append(l.buf, '"')
+}
+
+func (e *Encoder) appendInt64(buf []byte, value int64) []byte {
+	if e.opts.safeIntegers {
+		return tokens.AppendSafeInt64(buf, value)
+	}
+	return tokens.AppendInt64(buf, value)
+}
+
+func (e *Encoder) appendUint64(buf []byte, value uint64) []byte {
+	if e.opts.safeIntegers {
+		return tokens.AppendSafeUint64(buf, value)
+	}
+	return tokens.AppendUint64(buf, value)
+}
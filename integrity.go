@@ -0,0 +1,240 @@
+package goldjson
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+)
+
+// ChainKey is the key of the field holding the digest of the hash chain in
+// the lines written by a ChainWriter.
+const ChainKey = "chain"
+
+// KeySet maps the IDs of HMAC keys to the keys, e.g. for verifying logs
+// written over key rotations with VerifyFile.
+type KeySet map[string][]byte
+
+// ChainWriter is an io.Writer that passes the lines written by an Encoder
+// through to another writer, chaining them together for detecting tampering
+// (see VerifyFile): a field with ChainKey as the key is appended to each
+// line, holding the digest of the line and the digest of the previous line.
+//
+// Without a key, the digests are plain SHA-256 and thus only detect
+// tampering when the digest of the last line is also stored elsewhere (see
+// Digest), as the whole chain can be recomputed by anyone. With a key, the
+// digests are HMAC-SHA256, which can't be recomputed without the key.
+//
+// The ChainWriter assumes that each write is a single record line, which is
+// the case for the writes of an Encoder.
+type ChainWriter struct {
+	w      io.Writer
+	prefix string
+	mac    hash.Hash
+	mu     sync.Mutex
+	digest []byte
+	buf    []byte
+}
+
+// NewChainWriter returns a ChainWriter that writes to w, using HMAC-SHA256
+// with the key identified by keyID, or plain SHA-256 if the key is nil. The
+// key ID is written in each line for looking up the key when verifying.
+//
+// The key ID may only contain ASCII letters, digits, dots, underscores and
+// dashes, otherwise NewChainWriter panics.
+func NewChainWriter(w io.Writer, keyID string, key []byte) *ChainWriter {
+	c := &ChainWriter{w: w, digest: make([]byte, sha256.Size)}
+	if key == nil {
+		c.prefix, c.mac = "sha256:", sha256.New()
+	} else {
+		if !validKeyID(keyID) {
+			panic("goldjson: invalid key ID " + keyID)
+		}
+		c.prefix, c.mac = "hmac-sha256:"+keyID+":", hmac.New(sha256.New, key)
+	}
+	return c
+}
+
+// Resume continues an existing chain from the digest of its last line, e.g.
+// when appending to a log file verified with VerifyFile (see
+// Report.Digest). It must be called before writing.
+func (c *ChainWriter) Resume(digest []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.digest = append(c.digest[:0], digest...)
+}
+
+// Digest returns the digest of the last line written, which can be stored
+// elsewhere for detecting the removal of lines from the end of the log.
+func (c *ChainWriter) Digest() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]byte(nil), c.digest...)
+}
+
+// Write writes the line p to the underlying writer with the chain field
+// appended.
+func (c *ChainWriter) Write(p []byte) (int, error) {
+	if !bytes.HasSuffix(p, []byte("}\n")) {
+		return 0, errors.New("goldjson: ChainWriter only supports record lines")
+	}
+	content := p[:len(p)-2]
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	digest := chainDigest(c.mac, c.digest, content)
+	c.buf = append(c.buf[:0], content...)
+	if len(content) > 1 {
+		c.buf = append(c.buf, ',')
+	}
+	c.buf = append(c.buf, `"`+ChainKey+`":"`...)
+	c.buf = append(c.buf, c.prefix...)
+	start := len(c.buf)
+	c.buf = append(c.buf, make([]byte, hex.EncodedLen(len(digest)))...)
+	hex.Encode(c.buf[start:], digest)
+	c.buf = append(c.buf, "\"}\n"...)
+	if err := writeFull(c.w, c.buf); err != nil {
+		return 0, err
+	}
+	c.digest = digest
+	return len(p), nil
+}
+
+func chainDigest(mac hash.Hash, prev, content []byte) []byte {
+	mac.Reset()
+	mac.Write(prev)
+	mac.Write(content)
+	return mac.Sum(nil)
+}
+
+func validKeyID(keyID string) bool {
+	for i := 0; i < len(keyID); i++ {
+		c := keyID[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return keyID != ""
+}
+
+// Report describes a log file verified with VerifyFile.
+type Report struct {
+	// Lines is the number of lines verified.
+	Lines int
+	// Digest is the digest of the last line verified, for comparing with a
+	// digest stored elsewhere (see ChainWriter.Digest) or for continuing the
+	// chain (see ChainWriter.Resume).
+	Digest []byte
+}
+
+// ErrIntegrity is matched by the errors returned by VerifyFile for tampered
+// or truncated logs. See IntegrityError.
+var ErrIntegrity = errors.New("goldjson: integrity check failed")
+
+// IntegrityError describes the first tampered or truncated line found by
+// VerifyFile.
+type IntegrityError struct {
+	// Line is the 1-based number of the line.
+	Line   int
+	Reason string
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("%s on line %d: %s", ErrIntegrity, e.Line, e.Reason)
+}
+
+// Unwrap returns ErrIntegrity.
+func (e *IntegrityError) Unwrap() error {
+	return ErrIntegrity
+}
+
+// VerifyFile reads a log written through a ChainWriter from r, verifying
+// the chain of the lines. The HMAC keys are looked up from keys by the key
+// IDs written in the lines. The lines chained with plain SHA-256 are only
+// accepted if keys is empty, so that a log signed with HMAC can't be
+// replaced with one chained without a key.
+//
+// Returns an *IntegrityError for the first line that was modified, inserted,
+// reordered or removed, or that is truncated. The removal of lines from the
+// end of the log can only be detected by comparing Report.Digest with a
+// digest stored elsewhere. Other errors are returned for failing to read r.
+func VerifyFile(r io.Reader, keys KeySet) (Report, error) {
+	var report Report
+	prev := make([]byte, sha256.Size)
+	macs := map[string]hash.Hash{}
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return report, nil
+		}
+		if err != nil && err != io.EOF {
+			return report, err
+		}
+		lineNo := report.Lines + 1
+		if err == io.EOF {
+			return report, &IntegrityError{Line: lineNo, Reason: "truncated line"}
+		}
+		digest, reason := verifyLine(line, prev, keys, macs)
+		if reason != "" {
+			return report, &IntegrityError{Line: lineNo, Reason: reason}
+		}
+		prev = digest
+		report.Lines, report.Digest = lineNo, digest
+	}
+}
+
+func verifyLine(line, prev []byte, keys KeySet, macs map[string]hash.Hash) ([]byte, string) {
+	const field = `"` + ChainKey + `":"`
+	if !bytes.HasSuffix(line, []byte("\"}\n")) {
+		return nil, "missing chain field"
+	}
+	start := bytes.LastIndex(line, []byte(field))
+	if start < 1 {
+		return nil, "missing chain field"
+	}
+	content := line[:start]
+	if start > 1 {
+		if line[start-1] != ',' {
+			return nil, "missing chain field"
+		}
+		content = line[:start-1]
+	}
+	value := line[start+len(field) : len(line)-3]
+	i := bytes.LastIndexByte(value, ':')
+	if i == -1 {
+		return nil, "invalid chain field"
+	}
+	prefix, encoded := string(value[:i+1]), value[i+1:]
+	mac, ok := macs[prefix]
+	if !ok {
+		switch {
+		case prefix == "sha256:" && len(keys) == 0:
+			mac = sha256.New()
+		case len(prefix) > len("hmac-sha256::") && prefix[:len("hmac-sha256:")] == "hmac-sha256:":
+			keyID := prefix[len("hmac-sha256:") : len(prefix)-1]
+			key, ok := keys[keyID]
+			if !ok {
+				return nil, fmt.Sprintf("unknown key ID %q", keyID)
+			}
+			mac = hmac.New(sha256.New, key)
+		default:
+			return nil, "invalid chain field"
+		}
+		macs[prefix] = mac
+	}
+	received := make([]byte, hex.DecodedLen(len(encoded)))
+	if _, err := hex.Decode(received, encoded); err != nil {
+		return nil, "invalid chain field"
+	}
+	expected := chainDigest(mac, prev, content)
+	if !hmac.Equal(expected, received) {
+		return nil, "digest mismatch"
+	}
+	return expected, ""
+}
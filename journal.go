@@ -0,0 +1,227 @@
+package goldjson
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// NewJournaledFileEncoder returns a new Encoder that appends lines to the
+// file at the given path, creating the file if it doesn't exist, and records
+// the offset of the last committed line in a journal next to the file (at
+// the path with ".journal" appended).
+//
+// The lines are committed by Flush and Close, which write the buffered lines
+// (see WithBufferSize) to the file, sync the file to the storage device and
+// then atomically replace the journal with the new offset.
+//
+// When the file is opened, everything after the committed offset is
+// truncated away, so after a crash the file contains only complete lines,
+// none of which have been written twice by a producer that resumes from its
+// own checkpoint of the committed lines. If there is no journal, e.g. for an
+// existing file, everything after the last complete line is truncated away.
+func NewJournaledFileEncoder(path string, opts ...Option) (*Encoder, error) {
+	o := buildOptions(opts)
+	w, err := openJournalWriter(path, o)
+	if err != nil {
+		return nil, err
+	}
+	return newEncoder(w, w, o), nil
+}
+
+type journalWriter struct {
+	mu          sync.Mutex
+	journalPath string
+	file        *os.File
+	buf         *bufio.Writer
+	w           io.Writer
+	size        int64
+	committed   int64
+	err         error
+}
+
+func openJournalWriter(path string, o options) (*journalWriter, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, o.filePermission)
+	if err != nil {
+		return nil, err
+	}
+	w := &journalWriter{
+		journalPath: path + ".journal",
+		file:        f,
+		w:           f,
+	}
+	if err := w.recover(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if o.bufferSize > 0 {
+		w.buf = bufio.NewWriterSize(f, o.bufferSize)
+		w.w = w.buf
+	}
+	return w, nil
+}
+
+// recover truncates the file to the committed offset and positions the file
+// at the end.
+func (w *journalWriter) recover() error {
+	info, err := w.file.Stat()
+	if err != nil {
+		return err
+	}
+	offset, err := w.readJournal()
+	if errors.Is(err, os.ErrNotExist) {
+		offset, err = lastLineEnd(w.file, info.Size())
+	}
+	if err != nil {
+		return err
+	}
+	if offset > info.Size() {
+		return fmt.Errorf("goldjson: journal offset %d is beyond the end of the file (%d bytes)", offset, info.Size())
+	}
+	if err := w.file.Truncate(offset); err != nil {
+		return err
+	}
+	if _, err := w.file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	w.size = offset
+	w.committed = offset
+	return w.writeJournal()
+}
+
+func (w *journalWriter) readJournal() (int64, error) {
+	b, err := os.ReadFile(w.journalPath)
+	if err != nil {
+		return 0, err
+	}
+	offset, err := strconv.ParseInt(string(bytes.TrimSpace(b)), 10, 64)
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("goldjson: invalid journal %s", w.journalPath)
+	}
+	return offset, nil
+}
+
+// writeJournal atomically replaces the journal with the committed offset.
+func (w *journalWriter) writeJournal() error {
+	tmp := w.journalPath + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(strconv.AppendInt(nil, w.committed, 10))
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, w.journalPath)
+}
+
+// lastLineEnd returns the offset after the last newline in the first size
+// bytes of f.
+func lastLineEnd(f *os.File, size int64) (int64, error) {
+	chunk := make([]byte, 4096)
+	for end := size; end > 0; {
+		start := end - int64(len(chunk))
+		if start < 0 {
+			start = 0
+		}
+		b := chunk[:end-start]
+		if _, err := f.ReadAt(b, start); err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(b, '\n'); i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+func (w *journalWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.w.Write(data)
+	w.size += int64(n)
+	if err != nil {
+		// the size of the file is no longer known, so stop committing;
+		// the uncommitted lines are truncated away on the next open
+		w.err = err
+	}
+	return n, err
+}
+
+// Flush commits the written lines.
+func (w *journalWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return os.ErrClosed
+	}
+	return w.commit()
+}
+
+// Health returns an error if the file has been closed, a write has failed or
+// the file can no longer be accessed.
+func (w *journalWriter) Health() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return os.ErrClosed
+	}
+	if w.err != nil {
+		return w.err
+	}
+	_, err := w.file.Stat()
+	return err
+}
+
+// Close commits the written lines and closes the file.
+func (w *journalWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return os.ErrClosed
+	}
+	err := w.commit()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	w.file = nil
+	return err
+}
+
+func (w *journalWriter) commit() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.buf != nil {
+		if err := w.buf.Flush(); err != nil {
+			w.err = err
+			return err
+		}
+	}
+	if w.size == w.committed {
+		return nil
+	}
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	w.committed = w.size
+	return w.writeJournal()
+}
@@ -0,0 +1,105 @@
+package goldjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jussi-kalliokoski/goldjson/tokens"
+)
+
+// WithJSONCompat enables the encoding/json compatibility mode, where the
+// values are encoded byte for byte like json.Marshal encodes them, e.g. for
+// migrating to goldjson when the downstream systems diff or hash the lines:
+//
+//   - "<", ">" and "&" (as well as U+2028 and U+2029) are escaped in keys and
+//     string values, like json.Marshal does for HTML safety, and the control
+//     characters are escaped like the json.Marshal of the Go toolchain does
+//   - the keys of maps added with AddAny are sorted
+//   - AddAny adds time.Duration values as integers (nanoseconds) and errors
+//     and fmt.Stringer values with AddMarshal, like json.Marshal does
+//   - AddMarshal escapes HTML like json.Marshal
+//   - non-finite floats (NaN and infinities), which json.Marshal fails to
+//     encode, are encoded as null, unless rejected like json.Marshal does
+//     with FloatPolicyError (see WithFloatPolicy)
+//
+// The options that would make the output deviate from json.Marshal are
+// ignored: WithSafeSet, WithEscapeSlash, WithNewlineReplacement,
+// WithASCIIOnly, WithSafeIntegers, WithUnsortedMapKeys, WithUTC and
+// WithTimePolicy.
+//
+// The compatibility only extends to the values themselves: the methods that
+// have no json.Marshal counterpart, such as AddDurationList or AddStack, as
+// well as StaticFields created with the package-level NewStaticFields, are
+// encoded as usual.
+func WithJSONCompat() Option {
+	return func(o *options) {
+		o.jsonCompat = true
+	}
+}
+
+// applyJSONCompat overrides the options that conflict with the compatibility
+// mode.
+func (o *options) applyJSONCompat() {
+	set := tokens.HTMLSafeSet()
+	o.safeSet = &set
+	o.escapeSlash = false
+	o.newlineReplacement = nil
+	o.asciiOnly = false
+	o.safeIntegers = false
+	o.unsortedMapKeys = false
+	o.utc = false
+	o.timePolicy = TimePolicyError
+}
+
+// stdlibShortEscapes and stdlibRawReplacement tell whether the json.Marshal
+// of the Go toolchain escapes backspace and form feed as \b and \f, and
+// replaces invalid UTF-8 with an unescaped U+FFFD (both since Go 1.22),
+// unlike the tokens package, which uses \u0008, \u000c and \ufffd.
+var (
+	stdlibShortEscapes   = marshalsAs("\b", `"\b"`)
+	stdlibRawReplacement = marshalsAs("\xff", "\"\uFFFD\"")
+)
+
+func marshalsAs(value, expected string) bool {
+	b, _ := json.Marshal(value)
+	return string(b) == expected
+}
+
+// stdlibEscapes rewrites the escapes in the encoded string(s) at buf[start:]
+// that the json.Marshal of the Go toolchain encodes differently, if the
+// value contains any.
+func stdlibEscapes(buf []byte, start int, value string) []byte {
+	short := stdlibShortEscapes && strings.ContainsAny(value, "\b\f")
+	raw := stdlibRawReplacement && !utf8.ValidString(value)
+	if !short && !raw {
+		return buf
+	}
+	n := start
+	for i := start; i < len(buf); i++ {
+		if buf[i] != '\\' {
+			buf[n] = buf[i]
+			n++
+			continue
+		}
+		switch {
+		case short && bytes.HasPrefix(buf[i:], []byte(`\u0008`)):
+			n += copy(buf[n:], `\b`)
+			i += len(`\u0008`) - 1
+		case short && bytes.HasPrefix(buf[i:], []byte(`\u000c`)):
+			n += copy(buf[n:], `\f`)
+			i += len(`\u000c`) - 1
+		case raw && bytes.HasPrefix(buf[i:], []byte(`\ufffd`)):
+			n += copy(buf[n:], "\uFFFD")
+			i += len(`\ufffd`) - 1
+		default:
+			// copy the escaped character as is, so that an escaped
+			// backslash isn't mistaken for the start of an escape
+			buf[n], buf[n+1] = buf[i], buf[i+1]
+			n += 2
+			i++
+		}
+	}
+	return buf[:n]
+}
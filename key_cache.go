@@ -0,0 +1,68 @@
+package goldjson
+
+import (
+	"strings"
+	"sync"
+)
+
+// maxDynamicKeySize is the maximum length of the keys cached by
+// WithDynamicKeyCache.
+const maxDynamicKeySize = 256
+
+// WithDynamicKeyCache makes the Encoder cache the encoded versions of up to
+// maxEntries keys as they're first seen, like PrepareKey does for keys known
+// before using the Encoder, for services that only discover their common
+// keys at runtime. Once the cache is full, the keys not in the cache are
+// encoded every time as usual.
+//
+// Only keys of up to 256 bytes are cached. The cache is shared by the
+// goroutines using the Encoder and guarded by a sync.RWMutex.
+func WithDynamicKeyCache(maxEntries int) Option {
+	return func(o *options) {
+		o.dynamicKeyCache = maxEntries
+	}
+}
+
+// keyCache is a bounded cache of encoded keys, filled as the keys are seen.
+type keyCache struct {
+	mu         sync.RWMutex
+	keys       map[string][]byte
+	maxEntries int
+}
+
+func newKeyCache(maxEntries int) *keyCache {
+	return &keyCache{
+		keys:       make(map[string][]byte, maxEntries),
+		maxEntries: maxEntries,
+	}
+}
+
+// Append appends the encoded key to buf, encoding it with str unless it's
+// cached.
+func (c *keyCache) Append(buf []byte, key string, str stringEncoder) []byte {
+	if len(key) > maxDynamicKeySize {
+		return str.Append(buf, key)
+	}
+	c.mu.RLock()
+	b, ok := c.keys[key]
+	full := len(c.keys) >= c.maxEntries
+	c.mu.RUnlock()
+	if ok {
+		return append(buf, b...)
+	}
+	start := len(buf)
+	buf = str.Append(buf, key)
+	if !full {
+		c.put(key, buf[start:])
+	}
+	return buf
+}
+
+func (c *keyCache) put(key string, encoded []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.keys[key]; ok || len(c.keys) >= c.maxEntries {
+		return
+	}
+	c.keys[strings.Clone(key)] = append([]byte(nil), encoded...)
+}
@@ -2,23 +2,31 @@ package goldjson
 
 import (
 	"unsafe"
-
-	"github.com/jussi-kalliokoski/goldjson/tokens"
 )
 
 type keyStore struct {
-	keys map[uintptr][]byte
+	keys  map[uintptr][]byte
+	enums map[string]map[int64][]byte
+	str   stringEncoder
+	// dynamic caches the keys seen at runtime, see WithDynamicKeyCache.
+	dynamic *keyCache
 }
 
 func (s keyStore) Clone() keyStore {
-	if s.keys == nil {
-		return s
+	c := keyStore{str: s.str, dynamic: s.dynamic}
+	if s.keys != nil {
+		c.keys = make(map[uintptr][]byte)
+		for k, v := range s.keys {
+			c.keys[k] = v
+		}
 	}
-	keys := make(map[uintptr][]byte)
-	for k, v := range s.keys {
-		keys[k] = v
+	if s.enums != nil {
+		c.enums = make(map[string]map[int64][]byte)
+		for k, v := range s.enums {
+			c.enums[k] = v
+		}
 	}
-	return keyStore{keys}
+	return c
 }
 
 func (s *keyStore) Put(key string) {
@@ -26,7 +34,7 @@ func (s *keyStore) Put(key string) {
 		s.keys = make(map[uintptr][]byte)
 	}
 
-	if b := tokens.AppendString(nil, key); len(b) == len(key)+2 {
+	if b := s.str.Append(nil, key); len(b) == len(key)+2 {
 		s.keys[s.key(key)] = b
 	}
 }
@@ -35,7 +43,21 @@ func (s *keyStore) Append(buf []byte, key string) []byte {
 	if b := s.keys[s.key(key)]; len(b) == len(key)+2 {
 		return append(buf, b...)
 	}
-	return tokens.AppendString(buf, key)
+	if s.dynamic != nil {
+		return s.dynamic.Append(buf, key, s.str)
+	}
+	return s.str.Append(buf, key)
+}
+
+func (s *keyStore) PutEnum(key string, names map[int64]string) {
+	if s.enums == nil {
+		s.enums = make(map[string]map[int64][]byte)
+	}
+	table := make(map[int64][]byte, len(names))
+	for value, name := range names {
+		table[value] = s.str.Append(nil, name)
+	}
+	s.enums[key] = table
 }
 
 func (s *keyStore) key(key string) uintptr {
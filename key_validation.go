@@ -0,0 +1,70 @@
+package goldjson
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// KeyValidation configures the validation of the keys of records. See
+// WithKeyValidation.
+type KeyValidation struct {
+	// RejectEmpty rejects empty keys.
+	RejectEmpty bool
+	// RejectNUL rejects keys containing the NUL character.
+	RejectNUL bool
+	// Pattern, if set, rejects keys that don't match it. Anchor the pattern
+	// (e.g. ^[a-z_]+$) to match the whole key.
+	Pattern *regexp.Regexp
+}
+
+// WithKeyValidation makes the Encoder validate the keys of records, to catch
+// schema hygiene problems when producing the lines instead of when ingesting
+// them. Keys in lists are ignored, so they are never validated.
+//
+// A field with an invalid key is omitted from the line: the Add methods that
+// return an error return a *KeyError, while the others (as well as records
+// and lists started with an invalid key) omit the field silently. In either
+// case, LineWriter.End returns the first *KeyError of the line after writing
+// the line, unless writing the line fails.
+//
+// The keys of StaticFields are validated when the StaticFields are built with
+// Encoder.NewStaticFields.
+func WithKeyValidation(v KeyValidation) Option {
+	return func(o *options) {
+		o.keyValidation = &v
+	}
+}
+
+// ErrInvalidKey is matched by the errors returned for keys rejected by the
+// key validation. See WithKeyValidation.
+var ErrInvalidKey = errors.New("goldjson: invalid key")
+
+// KeyError describes a key rejected by the key validation.
+type KeyError struct {
+	Key    string
+	Reason string
+}
+
+func (e *KeyError) Error() string {
+	return ErrInvalidKey.Error() + " " + strconv.Quote(e.Key) + ": " + e.Reason
+}
+
+// Unwrap returns ErrInvalidKey.
+func (e *KeyError) Unwrap() error {
+	return ErrInvalidKey
+}
+
+func (v *KeyValidation) validate(key string) error {
+	if v.RejectEmpty && key == "" {
+		return &KeyError{Key: key, Reason: "empty key"}
+	}
+	if v.RejectNUL && strings.IndexByte(key, 0) != -1 {
+		return &KeyError{Key: key, Reason: "key contains NUL"}
+	}
+	if v.Pattern != nil && !v.Pattern.MatchString(key) {
+		return &KeyError{Key: key, Reason: "key doesn't match " + v.Pattern.String()}
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package goldjson
+
+import (
+	"time"
+
+	"github.com/jussi-kalliokoski/goldjson/tokens"
+)
+
+// Layout is a compiled sequence of top-level keys for lines that always add
+// the same fields in the same order, which is typical for the fixed part of
+// the records of log handlers (e.g. time, level, message).
+//
+// The keys are encoded once when the Layout is created, so adding a value
+// through a LayoutLine costs only the value encoding and a copy of the
+// pre-encoded key and separator.
+type Layout struct {
+	encoder *Encoder
+	names   []string
+	keys    [][]byte
+}
+
+// NewLayout compiles the given keys into a Layout for creating lines with
+// the Encoder.
+func (e *Encoder) NewLayout(keys ...string) *Layout {
+	l := &Layout{
+		encoder: e,
+		names:   keys,
+		keys:    make([][]byte, len(keys)),
+	}
+	for i, key := range keys {
+		l.keys[i] = e.str.AppendKey(make([]byte, 0, len(key)+3), key)
+	}
+	return l
+}
+
+// NewLine creates a new line following the Layout.
+func (l *Layout) NewLine() LayoutLine {
+	return LayoutLine{
+		line:  l.encoder.NewLine(),
+		names: l.names,
+		keys:  l.keys,
+	}
+}
+
+// LayoutLine is a line whose first fields follow a Layout. Each Add method
+// adds the value for the next key of the Layout.
+//
+// Calling an Add method after the values for all the keys of the Layout have
+// been added will panic.
+type LayoutLine struct {
+	line  *LineWriter
+	names []string
+	keys  [][]byte
+	pos   int
+}
+
+// Skip omits the next key of the Layout from the line.
+func (l *LayoutLine) Skip() {
+	l.pos++
+}
+
+// AddString adds a string value for the next key of the Layout.
+func (l *LayoutLine) AddString(value string) {
+	if l.line.encoder.opts.replaceValue != nil {
+		if ok, _ := l.replaceValue(KindString, value); ok {
+			return
+		}
+	}
+	if l.appendKey() != nil {
+		return
+	}
+	l.line.buf = l.line.encoder.appendStringValue(l.line.buf, value)
+}
+
+// AddInt64 adds an int64 value for the next key of the Layout.
+func (l *LayoutLine) AddInt64(value int64) {
+	if l.line.encoder.opts.replaceValue != nil {
+		if ok, _ := l.replaceValue(KindInt64, value); ok {
+			return
+		}
+	}
+	if l.appendKey() != nil {
+		return
+	}
+	l.line.buf = l.line.encoder.appendInt64(l.line.buf, value)
+}
+
+// AddUint64 adds a uint64 value for the next key of the Layout.
+func (l *LayoutLine) AddUint64(value uint64) {
+	if l.line.encoder.opts.replaceValue != nil {
+		if ok, _ := l.replaceValue(KindUint64, value); ok {
+			return
+		}
+	}
+	if l.appendKey() != nil {
+		return
+	}
+	l.line.buf = l.line.encoder.appendUint64(l.line.buf, value)
+}
+
+// AddBool adds a bool value for the next key of the Layout.
+func (l *LayoutLine) AddBool(value bool) {
+	if l.line.encoder.opts.replaceValue != nil {
+		if ok, _ := l.replaceValue(KindBool, value); ok {
+			return
+		}
+	}
+	if l.appendKey() != nil {
+		return
+	}
+	l.line.buf = tokens.AppendBool(l.line.buf, value)
+}
+
+// AddFloat64 adds a float64 value for the next key of the Layout.
+func (l *LayoutLine) AddFloat64(value float64) {
+	if l.line.encoder.opts.replaceValue != nil {
+		if ok, _ := l.replaceValue(KindFloat64, value); ok {
+			return
+		}
+	}
+	orig, wasEmpty := l.line.buf, l.line.composer.Empty()
+	if l.appendKey() != nil {
+		return
+	}
+	var err error
+	if l.line.buf, err = l.line.encoder.appendFloat64(l.line.buf, value); err != nil {
+		l.line.failValue(orig, wasEmpty, "float rejected", err)
+	}
+}
+
+// AddTime adds a time.Time value for the next key of the Layout.
+//
+// If the value cannot be encoded, the key is skipped (or a placeholder is
+// added, see WithErrorPlaceholders) and the error is returned.
+func (l *LayoutLine) AddTime(value time.Time) error {
+	if l.line.encoder.opts.replaceValue != nil {
+		if ok, err := l.replaceValue(KindTime, value); ok {
+			return err
+		}
+	}
+	orig, wasEmpty := l.line.buf, l.line.composer.Empty()
+	if err := l.appendKey(); err != nil {
+		return err
+	}
+	var err error
+	l.line.buf, err = l.line.encoder.appendTime(l.line.buf, l.line.skewed(value))
+	if err != nil {
+		l.line.failValue(orig, wasEmpty, "time encoding failed", err)
+		return err
+	}
+	return nil
+}
+
+// AddMarshal adds a JSON value for the next key of the Layout.
+//
+// If the value cannot be encoded, the key is skipped (or a placeholder is
+// added, see WithErrorPlaceholders) and the error is returned.
+func (l *LayoutLine) AddMarshal(value any) error {
+	if l.line.encoder.opts.replaceValue != nil {
+		if ok, err := l.replaceValue(KindAny, value); ok {
+			return err
+		}
+	}
+	orig, wasEmpty := l.line.buf, l.line.composer.Empty()
+	if err := l.appendKey(); err != nil {
+		return err
+	}
+	var err error
+	l.line.buf, err = l.line.encoder.appendMarshal(l.line.buf, value)
+	if err != nil {
+		l.line.failValue(orig, wasEmpty, "marshal failed", err)
+		return err
+	}
+	return nil
+}
+
+// Line returns the underlying LineWriter, e.g. for adding dynamic fields
+// after the fields of the Layout.
+//
+// After calling Line, the LayoutLine can no longer be used.
+func (l *LayoutLine) Line() *LineWriter {
+	return l.line
+}
+
+// End finishes the line and writes it to the underlying writer of the
+// Encoder. See LineWriter.End.
+func (l *LayoutLine) End() error {
+	return l.line.End()
+}
+
+// replaceValue consults the hook set with WithReplaceValue for the value of
+// the next key of the Layout, adding the replacement value if the hook
+// replaces the value. Returns true if the value was replaced.
+func (l *LayoutLine) replaceValue(kind Kind, value any) (bool, error) {
+	ok, err := l.line.replaceValue(l.names[l.pos], kind, value)
+	if ok {
+		l.pos++
+	}
+	return ok, err
+}
+
+// appendKey appends the next key of the Layout, returning an error if the key
+// must be omitted (see LineWriter.checkKey).
+func (l *LayoutLine) appendKey() error {
+	key := l.keys[l.pos]
+	if err := l.line.checkKey(l.names[l.pos]); err != nil {
+		l.pos++
+		return err
+	}
+	l.pos++
+	l.line.separator()
+	l.line.buf = append(l.line.buf, key...)
+	return nil
+}
@@ -0,0 +1,253 @@
+package goldjson
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/jussi-kalliokoski/goldjson/tokens"
+)
+
+// WithMinLevel sets the minimum level of the lines created with NewLineLevel.
+// Lines with a lower level are suppressed. The meaning of the levels is up to
+// the caller, as long as more severe levels are greater, e.g. the levels of
+// log/slog.
+func WithMinLevel(level int) Option {
+	return func(o *options) {
+		o.minLevel = level
+		o.hasMinLevel = true
+	}
+}
+
+// WithSampler sets a function that is consulted for each line created with
+// NewLineLevel whose level is not below the minimum level (see WithMinLevel),
+// suppressing the line if it returns false. The function may be called
+// concurrently from multiple goroutines.
+func WithSampler(sample func(level int) bool) Option {
+	return func(o *options) {
+		o.sampler = sample
+	}
+}
+
+// NewLineLevel creates a new line with the given level to be written to the
+// writer, if the level is enabled (see WithMinLevel and WithSampler).
+//
+// If the level is suppressed, a no-op line that omits everything added to it
+// and is discarded on End is returned along with false, so that the caller
+// can skip adding the fields:
+//
+//	if line, ok := enc.NewLineLevel(level); ok {
+//		line.AddString("msg", msg)
+//		_ = line.End()
+//	}
+//
+// The level itself is not added to the line.
+func (e *Encoder) NewLineLevel(level int) (*LineWriter, bool) {
+	enabled := e.LevelEnabled(level)
+	if enabled && e.opts.sampler != nil {
+		enabled = e.opts.sampler(level)
+		if e.sampling != nil {
+			rate, suppressed := e.sampling.observe(level, enabled)
+			if enabled {
+				l := e.NewLine()
+				l.addSamplingFields(rate, suppressed)
+				return l, true
+			}
+		}
+	}
+	if !enabled {
+		return e.suppressed.newSuppressedLine(), false
+	}
+	return e.NewLine(), true
+}
+
+// newSuppressedEncoder returns the Encoder of the lines suppressed by
+// NewLineLevel. It has none of the hooks of the Encoder (e.g. WithLineID or
+// WithReplaceValue), so that nothing is done on behalf of the suppressed
+// lines.
+func newSuppressedEncoder(opts options) *Encoder {
+	e := &Encoder{w: io.Discard, opts: options{useAfterEndCheck: opts.useAfterEndCheck}}
+	e.setup()
+	return e
+}
+
+// newSuppressedLine returns a no-op line that is discarded on End.
+func (e *Encoder) newSuppressedLine() *LineWriter {
+	l := e.newLine(0, 0)
+	l.discard = true
+	if l.checks == nil {
+		l.checks = &lineChecks{}
+	}
+	// the sticky error makes the checks reject every key, like with the
+	// no-op LineWriter of IfVerbose
+	l.checks.reset(e.opts)
+	l.checks.sticky = true
+	l.checks.err = errSuppressed
+	return l
+}
+
+var errSuppressed = errors.New("goldjson: line suppressed")
+
+// discardEncoder is the Encoder of the lines of the Scopes without an
+// Encoder and of the no-op LineWriters of IfVerbose.
+var discardEncoder = newSuppressedEncoder(options{})
+
+// LevelEnabled returns whether lines with the given level pass the minimum
+// level of the Encoder (see WithMinLevel). The sampler is not consulted.
+func (e *Encoder) LevelEnabled(level int) bool {
+	return !e.opts.hasMinLevel || level >= e.opts.minLevel
+}
+
+// WithVerbosity sets the verbosity of the Encoder for LineWriter.IfVerbose.
+// The default is 0.
+func WithVerbosity(level int) Option {
+	return func(o *options) {
+		o.verbosity = level
+	}
+}
+
+// IfVerbose returns the LineWriter if the verbosity of the Encoder is at least
+// the given level (see WithVerbosity), or otherwise a no-op LineWriter that
+// omits everything added to it, so that expensive diagnostic fields can be
+// added conditionally without branching:
+//
+//	line.IfVerbose(2).AddString("query", query)
+//
+// The no-op LineWriter is also returned if the line is suppressed (see
+// NewLineLevel). Records and lists started on the no-op LineWriter must be
+// ended on it, but the no-op LineWriter MUST NOT be ended itself. It is only
+// valid until the next call of IfVerbose on the line or until the line is
+// ended.
+func (l *LineWriter) IfVerbose(level int) *LineWriter {
+	if level <= l.encoder.opts.verbosity && !l.discard {
+		return l
+	}
+	if l.nop == nil {
+		l.nop = &LineWriter{checks: &lineChecks{}}
+	}
+	nop := l.nop
+	// the Encoder without options keeps the hooks of the Encoder of the line
+	// (e.g. WithReplaceValue) from being called for the omitted values
+	*nop = LineWriter{
+		buf:     nop.buf[:0],
+		encoder: discardEncoder,
+		checks:  nop.checks,
+	}
+	// the sticky error makes the checks reject every key, so the values are
+	// never encoded and the records and lists are discarded when closed
+	nop.checks.reset(options{})
+	nop.checks.sticky = true
+	nop.checks.err = errNotVerbose
+	return nop
+}
+
+var errNotVerbose = errors.New("goldjson: omitted due to verbosity")
+
+// LevelFormat determines how levels are encoded by AddLevel.
+type LevelFormat int
+
+const (
+	// LevelFormatText encodes levels as strings like log/slog does, e.g.
+	// "INFO" or "WARN+2".
+	LevelFormatText LevelFormat = iota
+	// LevelFormatLowercase encodes levels as lowercase strings, e.g. "info"
+	// or "warn+2".
+	LevelFormatLowercase
+	// LevelFormatNumeric encodes levels as numbers, e.g. 0 for info or 6 for
+	// WARN+2.
+	LevelFormatNumeric
+	// LevelFormatSyslog encodes levels as the numeric severities of syslog
+	// (RFC 5424), e.g. 6 (informational) for info or 4 (warning) for
+	// WARN+2.
+	LevelFormatSyslog
+)
+
+// WithLevelFormat sets the format for encoding levels with AddLevel. The
+// default is LevelFormatText.
+func WithLevelFormat(format LevelFormat) Option {
+	return func(o *options) {
+		o.levelFormat = format
+	}
+}
+
+// AddLevel adds a key-value pair with a level to the active record/list,
+// encoded according to the LevelFormat of the Encoder (see
+// WithLevelFormat). The levels are interpreted like the levels of log/slog,
+// e.g. 0 for info and 4 for warning.
+//
+// The common levels are encoded from pre-encoded tables.
+//
+// If a list is currently active, the key will be ignored.
+func (l *LineWriter) AddLevel(key string, level int) {
+	if l.encoder.opts.replaceValue != nil {
+		if ok, _ := l.replaceValue(key, KindLevel, level); ok {
+			return
+		}
+	}
+	if l.checkKey(key) != nil {
+		return
+	}
+	l.appendKey(key)
+	l.buf = appendLevel(l.buf, l.encoder.opts.levelFormat, level)
+}
+
+// The range of the levels in the pre-encoded tables.
+const (
+	minTableLevel = -8
+	maxTableLevel = 15
+)
+
+var levelTables = func() (tables [LevelFormatSyslog + 1][maxTableLevel - minTableLevel + 1][]byte) {
+	for format := range tables {
+		for i := range tables[format] {
+			tables[format][i] = encodeLevel(nil, LevelFormat(format), i+minTableLevel)
+		}
+	}
+	return tables
+}()
+
+func appendLevel(buf []byte, format LevelFormat, level int) []byte {
+	if format >= 0 && int(format) < len(levelTables) && level >= minTableLevel && level <= maxTableLevel {
+		return append(buf, levelTables[format][level-minTableLevel]...)
+	}
+	return encodeLevel(buf, format, level)
+}
+
+// syslogSeverities are the syslog severities of the Severities.
+var syslogSeverities = [...]int64{
+	SeverityDebug:   7,
+	SeverityInfo:    6,
+	SeverityWarning: 4,
+	SeverityError:   3,
+}
+
+func encodeLevel(buf []byte, format LevelFormat, level int) []byte {
+	switch format {
+	case LevelFormatNumeric:
+		return tokens.AppendInt64(buf, int64(level))
+	case LevelFormatSyslog:
+		return tokens.AppendInt64(buf, syslogSeverities[levelSeverity(int64(level))])
+	}
+	name, base := "ERROR", 8
+	switch {
+	case level < 0:
+		name, base = "DEBUG", -4
+	case level < 4:
+		name, base = "INFO", 0
+	case level < 8:
+		name, base = "WARN", 4
+	}
+	if format == LevelFormatLowercase {
+		name = strings.ToLower(name)
+	}
+	buf = append(buf, '"')
+	buf = append(buf, name...)
+	if level != base {
+		if level > base {
+			buf = append(buf, '+')
+		}
+		buf = strconv.AppendInt(buf, int64(level-base), 10)
+	}
+	return append(buf, '"')
+}
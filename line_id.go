@@ -0,0 +1,82 @@
+package goldjson
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/jussi-kalliokoski/goldjson/tokens"
+)
+
+// WithLineID makes the Encoder stamp every line with a unique ID under the
+// given key as the first field of the line, e.g. for deduplication and
+// correlation across systems. The ID is appended by the given function,
+// which MUST append a single JSON value to the buffer and return the
+// extended buffer, e.g. by using the appenders of the tokens package. See
+// UUIDv7 for a ready-made generator.
+//
+// The function is called concurrently when lines are created concurrently.
+//
+// Lines whose top-level value is not a record (see NewListLine and
+// NewValueLine) don't get an ID.
+func WithLineID(key string, appendID func(buf []byte) []byte) Option {
+	return func(o *options) {
+		o.lineIDKey = key
+		o.lineID = appendID
+	}
+}
+
+// UUIDv7 appends a new version 7 UUID (RFC 9562), i.e. a UUID that starts
+// with the current Unix time in milliseconds followed by random bits,
+// encoded as a string (see tokens.AppendUUID). The UUIDs created by the
+// process are monotonically increasing, also within the same millisecond.
+//
+// UUIDv7 is meant to be used with WithLineID.
+func UUIDv7(buf []byte) []byte {
+	var id [16]byte
+	uuidv7State.next(&id)
+	return tokens.AppendUUID(buf, id)
+}
+
+var uuidv7State uuidv7Generator
+
+type uuidv7Generator struct {
+	mu     sync.Mutex
+	millis int64
+	seq    uint16
+}
+
+// next fills id with the next UUID. Within the same millisecond (or if the
+// clock goes backwards), the 12-bit counter following the timestamp is
+// incremented instead of randomized, moving on to the next millisecond when
+// the counter overflows.
+func (g *uuidv7Generator) next(id *[16]byte) {
+	_, _ = rand.Read(id[6:])
+	millis := time.Now().UnixMilli()
+	g.mu.Lock()
+	if millis > g.millis {
+		g.millis = millis
+		g.seq = binary.BigEndian.Uint16(id[6:]) & 0x7ff
+	} else {
+		g.seq++
+		if g.seq > 0xfff {
+			g.millis++
+			g.seq = 0
+		}
+	}
+	millis, seq := g.millis, g.seq
+	g.mu.Unlock()
+	binary.BigEndian.PutUint64(id[:8], uint64(millis)<<16)
+	binary.BigEndian.PutUint16(id[6:], 0x7000|seq)
+	id[8] = 0x80 | id[8]&0x3f
+}
+
+func (l *LineWriter) addLineID() {
+	key := l.encoder.opts.lineIDKey
+	if l.checkKey(key) != nil {
+		return
+	}
+	l.appendKey(key)
+	l.buf = l.encoder.opts.lineID(l.buf)
+}
@@ -0,0 +1,36 @@
+package goldjson
+
+// WithLocking makes the Encoder safe for writing lines from multiple
+// goroutines to a writer that is not safe for concurrent use (such as a
+// *bufio.Writer or a net.Conn), by serializing the writes of the lines, as
+// well as Flush, Reopen and Close, with a mutex shared by the Encoder and its
+// clones.
+//
+// The lines are built concurrently in separate buffers and each line is
+// written with a single write, so lines never interleave. The lines are
+// written in the order their End calls acquire the mutex; the lines ended by
+// a single goroutine are written in the order they were ended.
+//
+// Each LineWriter MUST still only be used by a single goroutine.
+//
+// The writers of the Encoders created with NewFileEncoder and NewMmapEncoder,
+// as well as the writers wrapped for WithDoubleBuffering, are already safe
+// for concurrent use and don't need locking.
+func WithLocking() Option {
+	return func(o *options) {
+		o.locking = true
+	}
+}
+
+// writeLine writes the line to the underlying writer, holding the mutex of
+// the Encoder, if any.
+func (e *Encoder) writeLine(buf []byte) error {
+	if e.mu != nil {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+	}
+	if e.bw != nil {
+		return writeBuffered(e.bw, buf)
+	}
+	return writeFull(e.w, buf)
+}
@@ -0,0 +1,30 @@
+package goldjson
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// AddMessagef adds a key-value pair with a string value formatted according
+// to the format specifier (see fmt.Sprintf) to the active record/list.
+//
+// Unlike AddString(key, fmt.Sprintf(format, args...)), the value is
+// formatted into a buffer reused by the LineWriters of the Encoder, so no
+// intermediate string is allocated (though converting the args to
+// interfaces may still allocate).
+//
+// If a list is currently active, the key will be ignored.
+func (l *LineWriter) AddMessagef(key, format string, args ...any) {
+	if l.encoder.opts.replaceValue != nil {
+		l.AddString(key, fmt.Sprintf(format, args...))
+		return
+	}
+	if l.checkKey(key) != nil {
+		return
+	}
+	l.appendKey(key)
+	l.scratch = fmt.Appendf(l.scratch[:0], format, args...)
+	// the value is only read, so it doesn't need to be copied
+	value := unsafe.String(unsafe.SliceData(l.scratch), len(l.scratch))
+	l.buf = l.encoder.str.AppendValue(l.buf, value)
+}
@@ -0,0 +1,197 @@
+//go:build linux
+
+package goldjson
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// NewMmapEncoder returns a new Encoder that appends lines to the file at the
+// given path through a shared memory mapping, creating the file if it
+// doesn't exist.
+//
+// The file is preallocated in chunks (see WithPreallocation), so most lines
+// are written with a plain memory copy instead of a system call. The lines
+// reach the page cache immediately, and thus survive a crash of the process;
+// Flush additionally persists the pages written since the previous Flush to
+// the storage device.
+//
+// If the file has been left with a partial line or preallocated space (e.g.
+// by a crash of the process or the machine), everything after the last
+// complete line is truncated away when the file is opened. Close truncates
+// the preallocated space away.
+//
+// The mmap sink is only available on Linux.
+func NewMmapEncoder(path string, opts ...Option) (*Encoder, error) {
+	o := buildOptions(opts)
+	w, err := openMmapWriter(path, o)
+	if err != nil {
+		return nil, err
+	}
+	return newEncoder(w, w, o), nil
+}
+
+type mmapWriter struct {
+	mu       sync.Mutex
+	file     *os.File
+	data     []byte
+	offset   int64
+	synced   int64
+	chunk    int64
+	pageSize int64
+}
+
+func openMmapWriter(path string, o options) (*mmapWriter, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, o.filePermission)
+	if err != nil {
+		return nil, err
+	}
+	pageSize := int64(os.Getpagesize())
+	chunk := (o.preallocation + pageSize - 1) / pageSize * pageSize
+	if chunk <= 0 {
+		chunk = pageSize
+	}
+	w := &mmapWriter{
+		file:     f,
+		chunk:    chunk,
+		pageSize: pageSize,
+	}
+	if err := w.findEnd(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if err := w.grow(0); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// findEnd finds the end of the last complete line in the file.
+func (w *mmapWriter) findEnd() error {
+	info, err := w.file.Stat()
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 64*1024)
+	end := info.Size()
+	for end > 0 {
+		start := end - int64(len(buf))
+		if start < 0 {
+			start = 0
+		}
+		b := buf[:end-start]
+		if _, err := w.file.ReadAt(b, start); err != nil && err != io.EOF {
+			return err
+		}
+		if i := bytes.LastIndexByte(b, '\n'); i != -1 {
+			end = start + int64(i) + 1
+			break
+		}
+		end = start
+	}
+	w.offset = end
+	w.synced = end
+	return nil
+}
+
+// grow remaps the file so that at least n more bytes fit after the offset.
+func (w *mmapWriter) grow(n int) error {
+	if w.data != nil {
+		if err := syscall.Munmap(w.data); err != nil {
+			return err
+		}
+		w.data = nil
+	}
+	size := (w.offset + int64(n) + w.chunk) / w.chunk * w.chunk
+	if err := w.file.Truncate(size); err != nil {
+		return err
+	}
+	data, err := syscall.Mmap(int(w.file.Fd()), 0, int(size), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	w.data = data
+	return nil
+}
+
+func (w *mmapWriter) Write(data []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	if w.offset+int64(len(data)) > int64(len(w.data)) {
+		if err := w.grow(len(data)); err != nil {
+			return 0, err
+		}
+	}
+	n = copy(w.data[w.offset:], data)
+	w.offset += int64(n)
+	return n, nil
+}
+
+// Flush persists the pages written since the previous Flush to the storage
+// device.
+func (w *mmapWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return os.ErrClosed
+	}
+	return w.sync()
+}
+
+// Health returns an error if the file has been closed or can no longer be
+// accessed.
+func (w *mmapWriter) Health() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return os.ErrClosed
+	}
+	_, err := w.file.Stat()
+	return err
+}
+
+func (w *mmapWriter) sync() error {
+	if w.synced == w.offset {
+		return nil
+	}
+	start := w.synced / w.pageSize * w.pageSize
+	b := w.data[start:w.offset]
+	_, _, errno := syscall.Syscall(syscall.SYS_MSYNC, uintptr(unsafe.Pointer(&b[0])), uintptr(len(b)), syscall.MS_SYNC)
+	if errno != 0 {
+		return errno
+	}
+	w.synced = w.offset
+	return nil
+}
+
+// Close persists the written lines, truncates the preallocated space away
+// and closes the file.
+func (w *mmapWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return os.ErrClosed
+	}
+	err := w.sync()
+	if unmapErr := syscall.Munmap(w.data); err == nil {
+		err = unmapErr
+	}
+	w.data = nil
+	if truncateErr := w.file.Truncate(w.offset); err == nil {
+		err = truncateErr
+	}
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	w.file = nil
+	return err
+}
@@ -0,0 +1,101 @@
+//go:build linux
+
+package goldjson_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jussi-kalliokoski/goldjson"
+)
+
+func TestMmapEncoder(t *testing.T) {
+	writeLines := func(tb testing.TB, enc *goldjson.Encoder, values ...string) {
+		tb.Helper()
+		for _, value := range values {
+			line := enc.NewLine()
+			line.AddString("a", value)
+			expectNoError(tb, line.End())
+		}
+	}
+	readFile := func(tb testing.TB, path string) string {
+		tb.Helper()
+		b, err := os.ReadFile(path)
+		expectNoError(tb, err)
+		return string(b)
+	}
+
+	t.Run("new file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "log.ndjson")
+		enc, err := goldjson.NewMmapEncoder(path)
+		expectNoError(t, err)
+		expected := `{"a":"b"}` + "\n" + `{"a":"c"}` + "\n"
+
+		writeLines(t, enc, "b", "c")
+		flushErr := enc.Flush()
+		closeErr := enc.Close()
+
+		expectNoError(t, flushErr)
+		expectNoError(t, closeErr)
+		expectEqual(t, expected, readFile(t, path))
+	})
+
+	t.Run("grows", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "log.ndjson")
+		enc, err := goldjson.NewMmapEncoder(path, goldjson.WithPreallocation(1))
+		expectNoError(t, err)
+		value := strings.Repeat("x", os.Getpagesize())
+		expected := strings.Repeat(`{"a":"`+value+`"}`+"\n", 3)
+
+		writeLines(t, enc, value, value, value)
+		closeErr := enc.Close()
+
+		expectNoError(t, closeErr)
+		expectEqual(t, expected, readFile(t, path))
+	})
+
+	t.Run("recovers from partial line", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "log.ndjson")
+		existing := `{"a":"b"}` + "\n" + `{"a":"c"}` + "\n"
+		expectNoError(t, os.WriteFile(path, []byte(existing+`{"a":"partial`+string(make([]byte, 100))), 0o644))
+		enc, err := goldjson.NewMmapEncoder(path)
+		expectNoError(t, err)
+		expected := existing + `{"a":"d"}` + "\n"
+
+		writeLines(t, enc, "d")
+		closeErr := enc.Close()
+
+		expectNoError(t, closeErr)
+		expectEqual(t, expected, readFile(t, path))
+	})
+
+	t.Run("recovers from preallocated space", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "log.ndjson")
+		expectNoError(t, os.WriteFile(path, make([]byte, 100*1024), 0o644))
+		enc, err := goldjson.NewMmapEncoder(path)
+		expectNoError(t, err)
+		expected := `{"a":"b"}` + "\n"
+
+		writeLines(t, enc, "b")
+		closeErr := enc.Close()
+
+		expectNoError(t, closeErr)
+		expectEqual(t, expected, readFile(t, path))
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "log.ndjson")
+		enc, err := goldjson.NewMmapEncoder(path)
+		expectNoError(t, err)
+		healthErr := enc.Health()
+		expectNoError(t, enc.Close())
+
+		endErr := enc.NewLine().End()
+
+		expectError(t, endErr)
+		expectNoError(t, healthErr)
+		expectEqual(t, os.ErrClosed, enc.Health())
+	})
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package goldjson
+
+import "errors"
+
+// NewMmapEncoder returns a new Encoder that appends lines to the file at the
+// given path through a shared memory mapping.
+//
+// The mmap sink is only available on Linux, on other platforms an error is
+// always returned.
+func NewMmapEncoder(path string, opts ...Option) (*Encoder, error) {
+	return nil, errors.New("goldjson: the mmap sink is not supported on this platform")
+}
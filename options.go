@@ -0,0 +1,147 @@
+package goldjson
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/jussi-kalliokoski/goldjson/tokens"
+)
+
+// Option configures an Encoder. The options are applied in order, so a later
+// option overrides an earlier one that sets the same behavior.
+//
+// The options are the extension point for the configurable behaviors of the
+// Encoder, such as escaping (WithSafeSet, WithEscapeSlash, WithJSONCompat),
+// the encoding of times (WithUTC, WithTimePolicy) and special values
+// (WithStrict, WithFloatPolicy, WithSafeIntegers, WithComplexFormat) or line
+// breaks in values (WithNewlineReplacement).
+type Option func(*options)
+
+type options struct {
+	bufferSize         int
+	flushInterval      time.Duration
+	rotationCheck      time.Duration
+	filePermission     os.FileMode
+	poolStats          bool
+	doubleBuffering    int
+	preallocation      int64
+	safeSet            *tokens.SafeSet
+	escapeSlash        bool
+	htmlSafe           bool
+	writeHooks         WriteHooks
+	strict             bool
+	keyValidation      *KeyValidation
+	validateRawJSON    bool
+	errorPlaceholders  bool
+	utc                bool
+	complexFormat      ComplexFormat
+	locking            bool
+	timePolicy         TimePolicy
+	floatPolicy        FloatPolicy
+	quota              *Quota
+	contextHooks       []func(ctx context.Context, l *LineWriter)
+	minLevel           int
+	hasMinLevel        bool
+	sampler            func(level int) bool
+	safeIntegers       bool
+	trailerKey         string
+	byteAccounting     bool
+	schemaKey          string
+	schemaFields       []SchemaField
+	lineIDKey          string
+	lineID             func(buf []byte) []byte
+	replaceValue       func(key string, kind Kind, value any) (any, bool)
+	slowWriteThreshold time.Duration
+	slowWriteWarn      func(size int, elapsed time.Duration)
+	newlineReplacement *string
+	fileLocking        bool
+	sampleRateKey      string
+	suppressedKey      string
+	useAfterEndCheck   bool
+	clockSkewKey       string
+	clockSkew          func() time.Duration
+	stickyErrors       bool
+	verbosity          int
+	valueCacheSize     int
+	unsortedMapKeys    bool
+	dynamicKeyCache    int
+	jsonCompat         bool
+	levelFormat        LevelFormat
+	asciiOnly          bool
+	warmProfile        *WarmProfile
+	eventVersionKey    string
+	eventVersion       int64
+	eventRegistry      EventRegistry
+	eventFields        map[string]struct{}
+}
+
+func defaultOptions() options {
+	return options{
+		bufferSize:     32 * 1024,
+		flushInterval:  time.Second,
+		filePermission: 0o644,
+		preallocation:  4 * 1024 * 1024,
+	}
+}
+
+func buildOptions(opts []Option) options {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if checkedBuild {
+		o.useAfterEndCheck = true
+	}
+	if o.jsonCompat {
+		o.applyJSONCompat()
+	}
+	o.declareEventFields()
+	return o
+}
+
+// WithBufferSize sets the size of the write buffer used by encoders that
+// own their writer, such as the one returned by NewFileEncoder. A size of 0
+// disables buffering.
+func WithBufferSize(size int) Option {
+	return func(o *options) {
+		o.bufferSize = size
+	}
+}
+
+// WithFlushInterval sets the maximum time buffered lines are held before
+// being flushed to the underlying file by encoders that own their writer. A
+// non-positive interval disables the automatic flushing, in which case the
+// caller is responsible for calling Flush.
+func WithFlushInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.flushInterval = interval
+	}
+}
+
+// WithRotationCheck makes encoders returned by NewFileEncoder check at most
+// once per interval whether the file at the path has been replaced (e.g. by
+// logrotate), and if so, reopen the path. A non-positive interval disables
+// the check, in which case Reopen can be used to reopen the file explicitly.
+func WithRotationCheck(interval time.Duration) Option {
+	return func(o *options) {
+		o.rotationCheck = interval
+	}
+}
+
+// WithFilePermission sets the permission bits used when NewFileEncoder
+// creates the file.
+func WithFilePermission(perm os.FileMode) Option {
+	return func(o *options) {
+		o.filePermission = perm
+	}
+}
+
+// WithPreallocation sets the size of the chunks in which the file is grown by
+// encoders returned by NewMmapEncoder. The size is rounded up to a multiple
+// of the page size.
+func WithPreallocation(size int64) Option {
+	return func(o *options) {
+		o.preallocation = size
+	}
+}
@@ -0,0 +1,88 @@
+//go:build darwin && cgo
+
+package goldjson
+
+/*
+#include <os/log.h>
+#include <stdlib.h>
+
+static os_log_t goldjson_os_log_create(const char *subsystem, const char *category) {
+	return os_log_create(subsystem, category);
+}
+
+static void goldjson_os_log(os_log_t log, os_log_type_t type, const char *msg) {
+	os_log_with_type(log, type, "%{public}s", msg);
+}
+*/
+import "C"
+
+import (
+	"bytes"
+	"os"
+	"sync"
+	"unsafe"
+)
+
+// NewOSLogEncoder returns a new Encoder that writes each line to the unified
+// logging system of macOS (os_log) with the given subsystem and category,
+// with the JSON line as the message and the severity of the line (see
+// LineSeverity and SeverityKey) as the type of the message: errors as
+// OS_LOG_TYPE_ERROR, warnings as OS_LOG_TYPE_DEFAULT, debug lines as
+// OS_LOG_TYPE_DEBUG, and other lines as OS_LOG_TYPE_INFO.
+//
+// The messages are marked public, so they're not redacted.
+//
+// The os_log sink is only available on macOS, and requires cgo.
+func NewOSLogEncoder(subsystem, category string, opts ...Option) (*Encoder, error) {
+	o := buildOptions(opts)
+	w := openOSLogWriter(subsystem, category)
+	return newEncoder(w, w, o), nil
+}
+
+type osLogWriter struct {
+	mu     sync.Mutex
+	log    C.os_log_t
+	closed bool
+	buf    []byte
+}
+
+func openOSLogWriter(subsystem, category string) *osLogWriter {
+	cSubsystem, cCategory := C.CString(subsystem), C.CString(category)
+	defer C.free(unsafe.Pointer(cSubsystem))
+	defer C.free(unsafe.Pointer(cCategory))
+	return &osLogWriter{log: C.goldjson_os_log_create(cSubsystem, cCategory)}
+}
+
+func (w *osLogWriter) Write(data []byte) (int, error) {
+	logType := C.os_log_type_t(C.OS_LOG_TYPE_INFO)
+	switch LineSeverity(data, SeverityKey) {
+	case SeverityDebug:
+		logType = C.OS_LOG_TYPE_DEBUG
+	case SeverityWarning:
+		logType = C.OS_LOG_TYPE_DEFAULT
+	case SeverityError:
+		logType = C.OS_LOG_TYPE_ERROR
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	// the line can't contain NUL characters, as they're escaped in JSON
+	w.buf = append(w.buf[:0], bytes.TrimSuffix(data, []byte("\n"))...)
+	w.buf = append(w.buf, 0)
+	C.goldjson_os_log(w.log, logType, (*C.char)(unsafe.Pointer(&w.buf[0])))
+	return len(data), nil
+}
+
+// Close stops the writes. The log object is not released, as the log
+// objects of os_log live for the lifetime of the process.
+func (w *osLogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+	w.closed = true
+	return nil
+}
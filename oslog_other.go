@@ -0,0 +1,14 @@
+//go:build !darwin || !cgo
+
+package goldjson
+
+import "errors"
+
+// NewOSLogEncoder returns a new Encoder that writes each line to the unified
+// logging system of macOS (os_log) with the given subsystem and category.
+//
+// The os_log sink is only available on macOS, and requires cgo; on other
+// platforms an error is always returned.
+func NewOSLogEncoder(subsystem, category string, opts ...Option) (*Encoder, error) {
+	return nil, errors.New("goldjson: the os_log sink is not supported on this platform")
+}
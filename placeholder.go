@@ -0,0 +1,37 @@
+package goldjson
+
+// ErrorPlaceholderKey is the key of the placeholder record added in place of
+// a value that failed to encode. See WithErrorPlaceholders.
+const ErrorPlaceholderKey = "!error"
+
+// WithErrorPlaceholders makes the Encoder add a placeholder record in place
+// of a value that fails to encode, instead of omitting the field, so that the
+// loss of data is visible in the output, e.g.:
+//
+//	{"key":{"!error":"marshal failed: json: error calling MarshalJSON for type T: ..."}}
+//
+// The Add methods still return the error.
+func WithErrorPlaceholders() Option {
+	return func(o *options) {
+		o.errorPlaceholders = true
+	}
+}
+
+// failValue handles a value that failed to encode after its key has been
+// appended, by either adding a placeholder for the value or restoring the
+// line to the state before the key.
+func (l *LineWriter) failValue(orig []byte, wasEmpty bool, reason string, err error) {
+	l.recordError(err)
+	if l.encoder.opts.errorPlaceholders {
+		l.buf = append(l.buf, '{')
+		l.buf = l.encoder.str.AppendKey(l.buf, ErrorPlaceholderKey)
+		l.buf = l.encoder.str.AppendValue(l.buf, reason+": "+err.Error())
+		l.buf = append(l.buf, '}')
+		return
+	}
+	l.buf = orig
+	if wasEmpty {
+		l.composer.SetEmpty()
+	}
+	l.rejectKey()
+}
@@ -0,0 +1,91 @@
+package goldjson
+
+import (
+	"math/bits"
+	"sync/atomic"
+)
+
+// PoolStatsBuckets is the number of buckets in
+// PoolStats.BufferCapacityHistogram.
+const PoolStatsBuckets = 16
+
+// PoolStats describes the behavior of the internal LineWriter pool of an
+// Encoder. See WithPoolStats.
+type PoolStats struct {
+	// Lines is the number of lines created.
+	Lines uint64
+	// Misses is the number of lines that could not reuse a pooled
+	// LineWriter, i.e. the number of LineWriters (and buffers) allocated.
+	Misses uint64
+	// Returned is the number of LineWriters returned to the pool.
+	Returned uint64
+	// Pooled is the number of LineWriters currently in the pool. The
+	// garbage collector may drop pooled LineWriters without notice, so this
+	// is an upper bound.
+	Pooled int64
+	// BufferCapacityHistogram counts the buffer capacities of the
+	// LineWriters returned to the pool. Bucket i counts capacities of at
+	// most 64<<i bytes, except for the last bucket, which counts all the
+	// capacities that are larger than that of the second to last bucket.
+	BufferCapacityHistogram [PoolStatsBuckets]uint64
+}
+
+// WithPoolStats enables collecting statistics about the internal LineWriter
+// pool of the Encoder, to be read with Encoder.PoolStats.
+//
+// Collecting the statistics adds a few atomic operations per line.
+func WithPoolStats() Option {
+	return func(o *options) {
+		o.poolStats = true
+	}
+}
+
+type poolStats struct {
+	lines    atomic.Uint64
+	misses   atomic.Uint64
+	returned atomic.Uint64
+	buckets  [PoolStatsBuckets]atomic.Uint64
+}
+
+func (s *poolStats) get(miss bool) {
+	s.lines.Add(1)
+	if miss {
+		s.misses.Add(1)
+	}
+}
+
+func (s *poolStats) put(capacity int) {
+	s.returned.Add(1)
+	s.buckets[poolStatsBucket(capacity)].Add(1)
+}
+
+func poolStatsBucket(capacity int) int {
+	if capacity <= 64 {
+		return 0
+	}
+	i := bits.Len(uint(capacity-1)) - 6
+	if i >= PoolStatsBuckets {
+		return PoolStatsBuckets - 1
+	}
+	return i
+}
+
+// PoolStats returns the statistics of the internal LineWriter pool of the
+// Encoder. The statistics are only collected if the Encoder was created with
+// WithPoolStats, otherwise the zero value is returned.
+func (e *Encoder) PoolStats() PoolStats {
+	s := e.poolStats
+	if s == nil {
+		return PoolStats{}
+	}
+	stats := PoolStats{
+		Lines:    s.lines.Load(),
+		Misses:   s.misses.Load(),
+		Returned: s.returned.Load(),
+	}
+	stats.Pooled = int64(stats.Returned) - int64(stats.Lines-stats.Misses)
+	for i := range s.buckets {
+		stats.BufferCapacityHistogram[i] = s.buckets[i].Load()
+	}
+	return stats
+}
@@ -0,0 +1,176 @@
+package goldjson
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jussi-kalliokoski/goldjson/tokens"
+)
+
+// Quota limits the volume of output per category (see LineWriter.SetCategory),
+// e.g. per tenant or service sharing the logging infrastructure, so that a
+// single noisy category can't crowd out the others. See WithQuota.
+type Quota struct {
+	// Bytes is the number of bytes, including the trailing newlines, each
+	// category may write within the window. Zero or less is unlimited.
+	Bytes int64
+	// Limits overrides Bytes for the given categories.
+	Limits map[string]int64
+	// Window is the length of the sliding window. The quota is only
+	// enforced if the window is positive.
+	Window time.Duration
+	// KeepEvery downsamples the lines over the quota instead of dropping
+	// all of them, keeping every KeepEvery-th line. Zero drops all.
+	KeepEvery int
+	// Notice, if set, is called when a category goes over the quota
+	// (exceeded is true) and when it's back under the quota, with the number
+	// of lines dropped while over the quota. Otherwise the notices are
+	// written as lines:
+	//
+	//	{"warning":"quota exceeded","category":"tenant-a","limit":1048576,"window_ns":60000000000}
+	//	{"warning":"quota recovered","category":"tenant-a","dropped":1234}
+	Notice func(category string, exceeded bool, dropped uint64)
+}
+
+// WithQuota makes the Encoder enforce the quota on the lines written with
+// End (or through a Backfill), dropping (or downsampling) the lines of the
+// categories that have written more than their limit within the sliding
+// window. End returns nil for the dropped lines, like for the lines
+// suppressed by NewLineLevel.
+//
+// The usage is shared by the Encoder and its clones. The lines created with
+// EmergencyLine, as well as the notices themselves, are not subject to the
+// quota. The window is approximated from the usage of the current and the
+// previous window, which costs a mutex and a map lookup per line.
+func WithQuota(quota Quota) Option {
+	return func(o *options) {
+		o.quota = &quota
+	}
+}
+
+type quotas struct {
+	quota   *Quota
+	mu      sync.Mutex
+	windows map[string]*quotaWindow
+}
+
+// quotaWindow is the usage of a category in the current and the previous
+// fixed window.
+type quotaWindow struct {
+	start   time.Time
+	current int64
+	prev    int64
+	over    bool
+	// overLines is the number of lines over the quota, for downsampling.
+	overLines uint64
+	dropped   uint64
+}
+
+func newQuotas(quota *Quota) *quotas {
+	return &quotas{quota: quota, windows: map[string]*quotaWindow{}}
+}
+
+func (q *quotas) limit(category string) int64 {
+	if limit, ok := q.quota.Limits[category]; ok {
+		return limit
+	}
+	return q.quota.Bytes
+}
+
+// allow tells whether a line of the category and size may be written,
+// counting it towards the usage if so. Returns the notice to emit, if any.
+func (q *quotas) allow(category string, size int, now time.Time) (ok bool, notice quotaNotice) {
+	limit := q.limit(category)
+	if limit <= 0 {
+		return true, quotaNotice{}
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	w := q.windows[category]
+	if w == nil {
+		w = &quotaWindow{start: now}
+		q.windows[category] = w
+	}
+	used := w.used(now, q.quota.Window)
+	if used+int64(size) <= limit {
+		if w.over {
+			notice = quotaNotice{category: category, dropped: w.dropped, active: true}
+			w.over, w.overLines, w.dropped = false, 0, 0
+		}
+		w.current += int64(size)
+		return true, notice
+	}
+	if !w.over {
+		w.over = true
+		notice = quotaNotice{category: category, exceeded: true, limit: limit, active: true}
+	}
+	w.overLines++
+	if keep := q.quota.KeepEvery; keep > 0 && w.overLines%uint64(keep) == 0 {
+		w.current += int64(size)
+		return true, notice
+	}
+	w.dropped++
+	return false, notice
+}
+
+// used returns the usage within the sliding window ending at now, weighing
+// the usage of the previous window by its overlap with the sliding window.
+func (w *quotaWindow) used(now time.Time, window time.Duration) int64 {
+	elapsed := now.Sub(w.start)
+	switch {
+	case elapsed >= 2*window:
+		w.start, w.current, w.prev = now, 0, 0
+		elapsed = 0
+	case elapsed >= window:
+		w.start, w.current, w.prev = w.start.Add(window), 0, w.current
+		elapsed -= window
+	}
+	overlap := 1 - float64(elapsed)/float64(window)
+	return w.current + int64(float64(w.prev)*overlap)
+}
+
+type quotaNotice struct {
+	active   bool
+	category string
+	exceeded bool
+	limit    int64
+	dropped  uint64
+}
+
+// allowQuota tells whether a line of the category and size may be written
+// according to the quota, emitting the notice for it, if any.
+func (e *Encoder) allowQuota(category string, size int) bool {
+	if e.quotas == nil {
+		return true
+	}
+	ok, notice := e.quotas.allow(category, size, time.Now())
+	if notice.active {
+		e.noticeQuota(notice)
+	}
+	return ok
+}
+
+func (e *Encoder) noticeQuota(n quotaNotice) {
+	if notice := e.opts.quota.Notice; notice != nil {
+		notice(n.category, n.exceeded, n.dropped)
+		return
+	}
+	buf := make([]byte, 0, 128)
+	if n.exceeded {
+		buf = append(buf, `{"warning":"quota exceeded","category":`...)
+		buf = e.str.AppendValue(buf, n.category)
+		buf = append(buf, `,"limit":`...)
+		buf = tokens.AppendInt64(buf, n.limit)
+		buf = append(buf, `,"window_ns":`...)
+		buf = tokens.AppendInt64(buf, int64(e.opts.quota.Window))
+	} else {
+		buf = append(buf, `{"warning":"quota recovered","category":`...)
+		buf = e.str.AppendValue(buf, n.category)
+		buf = append(buf, `,"dropped":`...)
+		buf = tokens.AppendUint64(buf, n.dropped)
+	}
+	buf = append(buf, "}\n"...)
+	// there's no caller to report the error to, and the notice is not
+	// subject to the quota
+	_ = e.writeLine(buf)
+}
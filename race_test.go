@@ -0,0 +1,9 @@
+//go:build race
+
+package goldjson_test
+
+func init() {
+	// the race detector randomly drops pooled items and instruments
+	// allocations, making allocation counts unreliable
+	raceEnabled = true
+}
@@ -0,0 +1,78 @@
+package goldjson
+
+import (
+	"encoding/json"
+
+	"github.com/jussi-kalliokoski/goldjson/tokens"
+)
+
+// WithRawJSONValidation makes the Encoder validate pre-encoded JSON values,
+// i.e. the values added with AddRawJSON and json.RawMessage values added
+// with AddMarshal, before appending them to the line. Without validation,
+// the values are trusted to be valid JSON and are appended as is.
+func WithRawJSONValidation() Option {
+	return func(o *options) {
+		o.validateRawJSON = true
+	}
+}
+
+// AddRawJSON adds a key-value pair with a pre-encoded JSON value to the
+// active record/list. The value is appended as is, except for values
+// spanning multiple lines, which are compacted to keep the output
+// line-delimited. An empty value is encoded as null.
+//
+// Unless the Encoder validates raw JSON values (see WithRawJSONValidation),
+// the caller MUST ensure that the value is valid JSON, otherwise the output
+// will be malformed.
+//
+// If a list is currently active, the key will be ignored.
+func (l *LineWriter) AddRawJSON(key string, value []byte) error {
+	return l.addRawJSON(key, value, l.encoder.opts.validateRawJSON)
+}
+
+// AddValidatedRawJSON is like AddRawJSON, but always validates the value,
+// regardless of WithRawJSONValidation, e.g. for values from less trusted
+// sources than the others added with AddRawJSON. An invalid value is
+// rejected with an error like with WithRawJSONValidation.
+func (l *LineWriter) AddValidatedRawJSON(key string, value []byte) error {
+	return l.addRawJSON(key, value, true)
+}
+
+func (l *LineWriter) addRawJSON(key string, value []byte, validate bool) error {
+	if err := l.checkKey(key); err != nil {
+		return err
+	}
+	orig, wasEmpty := l.buf, l.composer.Empty()
+	l.appendKey(key)
+	var err error
+	l.buf, err = tokens.AppendRawJSON(l.buf, value, validate)
+	if err != nil {
+		l.failValue(orig, wasEmpty, "raw JSON rejected", err)
+		return err
+	}
+	return nil
+}
+
+// appendMarshal appends the value encoded as JSON, validating
+// json.RawMessage values if the Encoder is configured to.
+func (e *Encoder) appendMarshal(buf []byte, value any) ([]byte, error) {
+	if e.opts.validateRawJSON {
+		switch v := value.(type) {
+		case json.RawMessage:
+			return tokens.AppendRawJSON(buf, v, true)
+		case *json.RawMessage:
+			if v != nil {
+				return tokens.AppendRawJSON(buf, *v, true)
+			}
+		}
+	}
+	if e.opts.jsonCompat || e.opts.htmlSafe {
+		// json.Marshal escapes HTML
+		b, err := json.Marshal(value)
+		if err != nil {
+			return buf, err
+		}
+		return append(buf, b...), nil
+	}
+	return tokens.AppendMarshal(buf, value)
+}
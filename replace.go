@@ -0,0 +1,145 @@
+package goldjson
+
+import (
+	"time"
+
+	"github.com/jussi-kalliokoski/goldjson/tokens"
+)
+
+// Kind is the kind of a value passed to the hook set with WithReplaceValue,
+// identifying the method the value was added with.
+type Kind int
+
+const (
+	// KindString is the kind of the values added with AddString and
+	// AddSafeString, passed to the hook as a string.
+	KindString Kind = iota
+	// KindInt64 is the kind of the values added with AddInt64, passed to the
+	// hook as an int64.
+	KindInt64
+	// KindUint64 is the kind of the values added with AddUint64, passed to
+	// the hook as a uint64.
+	KindUint64
+	// KindFloat64 is the kind of the values added with AddFloat64, passed to
+	// the hook as a float64.
+	KindFloat64
+	// KindBool is the kind of the values added with AddBool, passed to the
+	// hook as a bool.
+	KindBool
+	// KindTime is the kind of the values added with AddTime, passed to the
+	// hook as a time.Time.
+	KindTime
+	// KindAny is the kind of the values added with AddMarshal, passed to the
+	// hook as is.
+	KindAny
+	// KindFloat32 is the kind of the values added with AddFloat32, passed to
+	// the hook as a float32.
+	KindFloat32
+	// KindBytes is the kind of the values added with AddBytes, passed to the
+	// hook as a copy of the []byte.
+	KindBytes
+	// KindLevel is the kind of the values added with AddLevel, passed to the
+	// hook as an int.
+	KindLevel
+)
+
+// String returns the name of the Kind.
+func (k Kind) String() string {
+	switch k {
+	case KindString:
+		return "string"
+	case KindInt64:
+		return "int64"
+	case KindUint64:
+		return "uint64"
+	case KindFloat64:
+		return "float64"
+	case KindBool:
+		return "bool"
+	case KindTime:
+		return "time"
+	case KindAny:
+		return "any"
+	case KindFloat32:
+		return "float32"
+	case KindBytes:
+		return "bytes"
+	case KindLevel:
+		return "level"
+	default:
+		return "unknown"
+	}
+}
+
+// WithReplaceValue sets a hook that is consulted before adding a value with
+// AddString, AddSafeString, AddInt64, AddUint64, AddFloat64, AddFloat32,
+// AddBool, AddTime, AddMarshal, AddBytes or AddLevel, e.g. for converting
+// units, hashing user IDs or scrubbing values globally. The key is the key
+// the value is added with, which is ignored if a list is active. The hook is
+// also consulted by the Add methods of LayoutLine, GroupRecord and
+// TemplateLine, with the key of the Layout, Group or Template slot.
+//
+// The fields of StaticFields created with Encoder.NewStaticFields (as well
+// as the fixed fields of Templates) are passed to the hook once, when they
+// are built, not for every line they are added to. Raw JSON (e.g.
+// AddRawJSON) is added as is, without consulting the hook.
+//
+// If the hook returns true, the returned value is added instead of the
+// original value, encoded according to its type: strings, integers, floats,
+// bools, times and byte slices like with the respective methods, and other
+// values like with AddMarshal. Levels are thus replaced with plain integers,
+// not encoded according to the LevelFormat. If the hook returns false, the
+// original value is added.
+//
+// The hook is called synchronously for every value, so it should be fast.
+// Passing the values to the hook as interfaces may allocate.
+func WithReplaceValue(hook func(key string, kind Kind, value any) (any, bool)) Option {
+	return func(o *options) {
+		o.replaceValue = hook
+	}
+}
+
+// replaceValue consults the hook, adding the replacement value if the hook
+// replaces the value. Returns true if the value was replaced.
+func (l *LineWriter) replaceValue(key string, kind Kind, value any) (bool, error) {
+	replacement, ok := l.encoder.opts.replaceValue(key, kind, value)
+	if !ok {
+		return false, nil
+	}
+	return true, l.addReplacement(key, replacement)
+}
+
+func (l *LineWriter) addReplacement(key string, value any) error {
+	if err := l.checkKey(key); err != nil {
+		return err
+	}
+	orig, wasEmpty := l.buf, l.composer.Empty()
+	l.appendKey(key)
+	var err error
+	switch v := value.(type) {
+	case string:
+		l.buf = l.encoder.str.AppendValue(l.buf, v)
+	case int:
+		l.buf = l.encoder.appendInt64(l.buf, int64(v))
+	case int64:
+		l.buf = l.encoder.appendInt64(l.buf, v)
+	case uint64:
+		l.buf = l.encoder.appendUint64(l.buf, v)
+	case float64:
+		l.buf, err = l.encoder.appendFloat64(l.buf, v)
+	case float32:
+		l.buf, err = l.encoder.appendFloat32(l.buf, v)
+	case bool:
+		l.buf = tokens.AppendBool(l.buf, v)
+	case time.Time:
+		l.buf, err = l.encoder.appendTime(l.buf, l.skewed(v))
+	case []byte:
+		l.buf = tokens.AppendBase64(l.buf, v)
+	default:
+		l.buf, err = l.encoder.appendMarshal(l.buf, v)
+	}
+	if err != nil {
+		l.failValue(orig, wasEmpty, "replaced value encoding failed", err)
+	}
+	return err
+}
@@ -0,0 +1,67 @@
+package goldjson
+
+import "sync"
+
+// WithSamplingFields makes the Encoder add fields describing the sampling
+// (see WithSampler) to the lines created with NewLineLevel that pass the
+// sampler, so that downstream analytics can re-weight the counts of the
+// sampled lines:
+//
+//	{"sample_rate":0.25,"suppressed_since_last":3,"msg":"hello"}
+//
+// where the value under rateKey is the fraction of the lines of the level
+// that have passed the sampler so far, and the value under suppressedKey is
+// the number of lines of the level suppressed by the sampler since the
+// previous line of the level that passed it. The lines suppressed by the
+// minimum level (see WithMinLevel) are not counted.
+//
+// The fields are added as the first fields of the line, and only if a
+// sampler is set. An empty key omits the respective field. The counters are
+// shared by the Encoder and its clones.
+func WithSamplingFields(rateKey, suppressedKey string) Option {
+	return func(o *options) {
+		o.sampleRateKey = rateKey
+		o.suppressedKey = suppressedKey
+	}
+}
+
+type samplingCounters struct {
+	mu     sync.Mutex
+	levels map[int]*levelCounters
+}
+
+type levelCounters struct {
+	seen       uint64
+	passed     uint64
+	suppressed uint64
+}
+
+// observe counts a line of the level that passed or was suppressed by the
+// sampler. For passed lines, returns the rate and the number of lines
+// suppressed since the previous passed line.
+func (c *samplingCounters) observe(level int, passed bool) (rate float64, suppressed uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counters := c.levels[level]
+	if counters == nil {
+		counters = &levelCounters{}
+		c.levels[level] = counters
+	}
+	counters.seen++
+	if !passed {
+		counters.suppressed++
+		return 0, 0
+	}
+	counters.passed++
+	suppressed, counters.suppressed = counters.suppressed, 0
+	return float64(counters.passed) / float64(counters.seen), suppressed
+}
+
+func (l *LineWriter) addSamplingFields(rate float64, suppressed uint64) {
+	if key := l.encoder.opts.sampleRateKey; key != "" {
+		l.AddFloat64(key, rate)
+	}
+	if key := l.encoder.opts.suppressedKey; key != "" {
+		l.AddUint64(key, suppressed)
+	}
+}
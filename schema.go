@@ -0,0 +1,185 @@
+package goldjson
+
+import "sync"
+
+// SchemaType is the JSON type of the values of a field, as recorded by the
+// schema tracking. See WithSchema.
+type SchemaType string
+
+// The types of the values of fields.
+const (
+	SchemaString SchemaType = "string"
+	SchemaNumber SchemaType = "number"
+	SchemaBool   SchemaType = "bool"
+	SchemaNull   SchemaType = "null"
+	SchemaRecord SchemaType = "record"
+	SchemaList   SchemaType = "list"
+)
+
+// SchemaField describes a top-level field of the lines written by an
+// Encoder.
+type SchemaField struct {
+	Key string
+	// Types are the types of the values of the field, in the order they
+	// were first seen.
+	Types []SchemaType
+}
+
+// WithSchema enables tracking the schema of the lines, i.e. the keys and the
+// types of the values of the top-level fields added to the record lines of
+// the Encoder and its clones. The schema can be read with Encoder.Schema, or
+// written as a line with Encoder.WriteSchema, e.g. for letting downstream
+// consumers set up typed columns before the data lines arrive:
+//
+//	{"_schema":{"msg":["string"],"status":["number","null"]}}
+//
+// The schema starts out with the given declared fields, so that the schema
+// line can also be written right after creating the Encoder.
+//
+// The fields of StaticFields are not tracked. The tracking adds the cost of
+// tracking the structure of each line, like the strict mode, and a read lock
+// per line.
+func WithSchema(key string, fields ...SchemaField) Option {
+	return func(o *options) {
+		o.schemaKey = key
+		o.schemaFields = fields
+	}
+}
+
+type schemaEntry struct {
+	key string
+	// offset is the buffer offset of the field, including the separator.
+	offset int
+}
+
+type schemaStore struct {
+	mu     sync.RWMutex
+	fields []SchemaField
+	index  map[string]int
+}
+
+func newSchemaStore(fields []SchemaField) *schemaStore {
+	s := &schemaStore{index: map[string]int{}}
+	for _, f := range fields {
+		for _, typ := range f.Types {
+			s.add(f.Key, typ)
+		}
+	}
+	return s
+}
+
+// observe records the fields of a line, given the encoded line.
+func (s *schemaStore) observe(buf []byte, entries []schemaEntry) {
+	s.mu.RLock()
+	known := true
+	for _, entry := range entries {
+		if !s.has(entry.key, schemaTypeAt(buf, entry.offset)) {
+			known = false
+			break
+		}
+	}
+	s.mu.RUnlock()
+	if known {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range entries {
+		s.add(entry.key, schemaTypeAt(buf, entry.offset))
+	}
+}
+
+func (s *schemaStore) has(key string, typ SchemaType) bool {
+	i, ok := s.index[key]
+	if !ok {
+		return false
+	}
+	for _, t := range s.fields[i].Types {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *schemaStore) add(key string, typ SchemaType) {
+	if s.has(key, typ) {
+		return
+	}
+	i, ok := s.index[key]
+	if !ok {
+		i = len(s.fields)
+		s.index[key] = i
+		s.fields = append(s.fields, SchemaField{Key: key})
+	}
+	s.fields[i].Types = append(s.fields[i].Types, typ)
+}
+
+// schemaTypeAt returns the type of the value of the field encoded at the
+// offset of buf.
+func schemaTypeAt(buf []byte, offset int) SchemaType {
+	i := offset
+	if buf[i] == ',' {
+		i++
+	}
+	// skip the key
+	for i++; buf[i] != '"'; i++ {
+		if buf[i] == '\\' {
+			i++
+		}
+	}
+	// skip the closing quote and the colon
+	switch buf[i+2] {
+	case '"':
+		return SchemaString
+	case 't', 'f':
+		return SchemaBool
+	case 'n':
+		return SchemaNull
+	case '{':
+		return SchemaRecord
+	case '[':
+		return SchemaList
+	default:
+		return SchemaNumber
+	}
+}
+
+// Schema returns the fields seen so far in the lines of the Encoder and its
+// clones, in the order they were first seen, or nil if the Encoder was not
+// created with WithSchema.
+func (e *Encoder) Schema() []SchemaField {
+	s := e.schema
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	fields := make([]SchemaField, len(s.fields))
+	for i, f := range s.fields {
+		fields[i] = SchemaField{Key: f.Key, Types: append([]SchemaType(nil), f.Types...)}
+	}
+	return fields
+}
+
+// WriteSchema writes the fields seen so far (see Schema) as a line, with the
+// fields as a record under the key given to WithSchema. The schema line
+// itself is not tracked. Does nothing if the Encoder was not created with
+// WithSchema.
+func (e *Encoder) WriteSchema() error {
+	if e.schema == nil {
+		return nil
+	}
+	l := e.NewLine()
+	l.checks.schema = false
+	l.StartRecord(e.opts.schemaKey)
+	for _, f := range e.Schema() {
+		l.StartList(f.Key)
+		for _, typ := range f.Types {
+			l.AddString("", string(typ))
+		}
+		l.EndList()
+	}
+	l.EndRecord()
+	return l.End()
+}
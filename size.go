@@ -0,0 +1,98 @@
+package goldjson
+
+import (
+	"encoding/base64"
+	"time"
+
+	"github.com/jussi-kalliokoski/goldjson/tokens"
+)
+
+// EstimateLineSize returns the size of a record line with fields of the given
+// sizes (see EstimateFieldSize and StaticFields.EstimateSize), including the
+// separators, the braces and the trailing newline, e.g. for checking whether
+// a line will exceed the size limit of a sink before encoding it:
+//
+//	size := goldjson.EstimateLineSize(
+//		fields.EstimateSize(),
+//		goldjson.EstimateFieldSize("message", goldjson.EstimateStringSize(msg)),
+//	)
+//
+// Fields of size 0 (e.g. empty StaticFields) are ignored.
+//
+// The estimates match the output of an Encoder with the default options.
+// Options that change the encoding (e.g. WithSafeIntegers, WithLineID or
+// WithTrailer) can make the lines larger.
+func EstimateLineSize(fieldSizes ...int) int {
+	n := len("{}\n")
+	fields := 0
+	for _, size := range fieldSizes {
+		if size > 0 {
+			n += size
+			fields++
+		}
+	}
+	if fields > 1 {
+		n += fields - 1
+	}
+	return n
+}
+
+// EstimateFieldSize returns the size of a record field with the key and a
+// value of the given size, excluding the separator.
+func EstimateFieldSize(key string, valueSize int) int {
+	return tokens.StringSize(key) + len(":") + valueSize
+}
+
+// EstimateStringSize returns the size of a string value added with AddString.
+func EstimateStringSize(value string) int {
+	return tokens.StringSize(value)
+}
+
+// EstimateInt64Size returns the size of an int64 value added with AddInt64.
+func EstimateInt64Size(value int64) int {
+	var buf [20]byte
+	return len(tokens.AppendInt64(buf[:0], value))
+}
+
+// EstimateUint64Size returns the size of a uint64 value added with AddUint64.
+func EstimateUint64Size(value uint64) int {
+	var buf [20]byte
+	return len(tokens.AppendUint64(buf[:0], value))
+}
+
+// EstimateFloat64Size returns the size of a float64 value added with
+// AddFloat64.
+func EstimateFloat64Size(value float64) int {
+	var buf [32]byte
+	return len(tokens.AppendFloat64(buf[:0], value))
+}
+
+// EstimateBoolSize returns the size of a bool value added with AddBool.
+func EstimateBoolSize(value bool) int {
+	if value {
+		return len("true")
+	}
+	return len("false")
+}
+
+// EstimateTimeSize returns the size of a time.Time value added with AddTime,
+// or 0 if AddTime fails for the value.
+func EstimateTimeSize(value time.Time) int {
+	var buf [64]byte
+	b, err := tokens.AppendTime(buf[:0], value)
+	if err != nil {
+		return 0
+	}
+	return len(b)
+}
+
+// EstimateBytesSize returns the size of a []byte value added with AddBytes.
+func EstimateBytesSize(value []byte) int {
+	return base64.StdEncoding.EncodedLen(len(value)) + len(`""`)
+}
+
+// EstimateSize returns the size of the fields when added to a record with
+// AddStaticFields, excluding the separator.
+func (f *StaticFields) EstimateSize() int {
+	return len(f.buf)
+}
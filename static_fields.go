@@ -3,6 +3,10 @@ package goldjson
 // StaticFields represents a pre-built set of record fields.
 type StaticFields struct {
 	buf []byte
+	// keys are the top-level keys of the fields, only tracked in strict mode.
+	keys []string
+	// encoder is the Encoder the fields were encoded with, for Extend.
+	encoder *Encoder
 }
 
 // NewStaticFields can be used for caching static fields in a record for
@@ -11,15 +15,101 @@ type StaticFields struct {
 //
 // Use End() on the LineWriter to complete the StaticFields construction.
 func NewStaticFields() (*StaticFields, *LineWriter) {
+	return newStaticFields(keyStore{}, options{})
+}
+
+// NewStaticFields is like the package-level NewStaticFields, but the fields
+// are encoded according to the options and prepared keys of the Encoder.
+func (e *Encoder) NewStaticFields() (*StaticFields, *LineWriter) {
+	return newStaticFields(e.keys, e.opts)
+}
+
+// NewLineWith creates a new line starting with the StaticFields, like
+// NewLine followed by LineWriter.AddStaticFields.
+func (e *Encoder) NewLineWith(staticFields *StaticFields) *LineWriter {
+	l := e.NewLine()
+	l.AddStaticFields(staticFields)
+	return l
+}
+
+func newStaticFields(keys keyStore, opts options) (*StaticFields, *LineWriter) {
+	// the fields are added to lines that get their own trailer, schema
+	// tracking, ID and event version, and building them isn't a write
+	opts.writeHooks = WriteHooks{}
+	opts.slowWriteThreshold = 0
+	opts.trailerKey = ""
+	opts.schemaKey = ""
+	opts.lineID = nil
+	opts.eventVersionKey = ""
+	opts.eventFields = nil
+	opts.clockSkew = nil
+	opts.valueCacheSize = 0
+	opts.dynamicKeyCache = 0
+	opts.warmProfile = nil
+	opts.hasMinLevel = false
+	opts.sampler = nil
 	f := &StaticFields{}
+	encoder := &Encoder{
+		keys: keys,
+		w:    staticFieldsWriter{f},
+		opts: opts,
+	}
+	encoder.setup()
+	f.encoder = encoder
 	l := &LineWriter{
-		isFirstEntry: 1,
-		encoder:      &Encoder{w: staticFieldsWriter{f}},
+		encoder: encoder,
+		end:     '}',
+	}
+	if opts.checked() {
+		l.checks = newLineChecks(opts)
 	}
 
 	return f, l
 }
 
+// Clone returns a copy of the StaticFields.
+func (f *StaticFields) Clone() *StaticFields {
+	return &StaticFields{
+		buf:     append([]byte(nil), f.buf...),
+		keys:    append([]string(nil), f.keys...),
+		encoder: f.encoder,
+	}
+}
+
+// Merge returns new StaticFields with the fields of f followed by the fields
+// of other, without encoding the fields again. Neither f nor other is
+// modified.
+//
+// In strict mode (see WithStrict), the keys of f and other MUST NOT overlap.
+func (f *StaticFields) Merge(other *StaticFields) *StaticFields {
+	m := f.Clone()
+	if len(other.buf) == 0 {
+		return m
+	}
+	if len(m.buf) > 0 {
+		m.buf = append(m.buf, ',')
+	}
+	m.buf = append(m.buf, other.buf...)
+	m.keys = append(m.keys, other.keys...)
+	return m
+}
+
+// Extend returns new StaticFields starting with the fields of f, along with
+// a LineWriter to add more fields to them, e.g. for accumulating attributes
+// layer by layer without encoding the earlier layers again. The fields are
+// encoded according to the options the fields of f were encoded with.
+//
+// Use End() on the LineWriter to complete the StaticFields construction.
+func (f *StaticFields) Extend() (*StaticFields, *LineWriter) {
+	keys, opts := keyStore{}, options{}
+	if f.encoder != nil {
+		keys, opts = f.encoder.keys, f.encoder.opts
+	}
+	extended, l := newStaticFields(keys, opts)
+	l.AddStaticFields(f)
+	return extended, l
+}
+
 type staticFieldsWriter struct {
 	staticFields *StaticFields
 }
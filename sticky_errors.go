@@ -0,0 +1,47 @@
+package goldjson
+
+// WithStickyErrors makes the LineWriters of the Encoder keep the first error
+// of the line, like bufio.Writer keeps the first write error: once a value
+// fails to encode (e.g. AddTime with a time that can't be encoded or
+// AddMarshal with a failing marshaler) or a key is rejected by the key
+// validation (see WithKeyValidation), the later Add methods of the line are
+// no-ops. The error is returned by LineWriter.Err and LineWriter.End, so
+// that it doesn't need to be checked after every Add:
+//
+//	line := enc.NewLine()
+//	_ = line.AddTime("start", start)
+//	_ = line.AddMarshal("request", req)
+//	line.AddString("message", "request received")
+//	if err := line.End(); err != nil {
+//		// ...
+//	}
+//
+// Records and lists can still be started and ended after the error, keeping
+// the line balanced, but the records and lists started after the error are
+// omitted. The line is still written, with the fields added before the
+// error.
+func WithStickyErrors() Option {
+	return func(o *options) {
+		o.stickyErrors = true
+	}
+}
+
+// Err returns the first error of the line, see WithStickyErrors. Without
+// WithStickyErrors, only key validation errors (see WithKeyValidation) and
+// rejected non-finite floats (see FloatPolicyError) are kept. Returns nil for
+// the lines suppressed by NewLineLevel.
+func (l *LineWriter) Err() error {
+	if l.checks == nil || l.discard {
+		return nil
+	}
+	return l.checks.err
+}
+
+// recordError keeps the error as the sticky error of the line, unless the
+// line already has one. ErrNonFiniteFloat is kept without sticky errors as
+// well, since AddFloat64 has no other way of reporting it.
+func (l *LineWriter) recordError(err error) {
+	if l.checks != nil && (l.checks.sticky || err == ErrNonFiniteFloat) && l.checks.err == nil {
+		l.checks.err = err
+	}
+}
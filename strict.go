@@ -0,0 +1,31 @@
+package goldjson
+
+import "errors"
+
+// WithStrict enables the strict mode, where the Encoder only produces output
+// that is valid according to RFC 8259 and free of the ambiguities some
+// strict parsers reject:
+//
+//   - non-finite floats (NaN and infinities) are encoded as null instead of
+//     strings, unless rejected with FloatPolicyError (see WithFloatPolicy)
+//   - a key that already exists in the active record is rejected: the Add
+//     methods that return an error return ErrDuplicateKey, while the others
+//     (as well as records and lists started with a duplicate key) are
+//     omitted from the line
+//   - AddSafeString escapes the value like AddString
+//   - LineWriter.End closes the records and lists that have been left open
+//
+// The keys of StaticFields created with Encoder.NewStaticFields of a strict
+// Encoder are considered when checking for duplicate keys after adding the
+// StaticFields; the StaticFields themselves are always added as is.
+//
+// The strict mode adds the cost of tracking the keys of each open record.
+func WithStrict() Option {
+	return func(o *options) {
+		o.strict = true
+	}
+}
+
+// ErrDuplicateKey is returned in strict mode when adding a key that already
+// exists in the active record. See WithStrict.
+var ErrDuplicateKey = errors.New("goldjson: duplicate key")
@@ -0,0 +1,53 @@
+package goldjson
+
+import (
+	"reflect"
+	"strings"
+)
+
+// PrepareKeysFromStruct prepares the keys of the fields of the struct type of
+// v (or the struct type v points to), as named by their json tags like with
+// encoding/json, with one call per type. The fields of embedded structs, as
+// well as the fields of nested struct types (including the element types of
+// pointers, slices, arrays and maps), are prepared too.
+//
+// Like with PrepareKey, the keys are identified by their memory location, so
+// the prepared keys are used for the key strings taken from the same struct
+// tags (or field names), such as the ones used by reflection-based encoders.
+// For keys given as string literals, use PrepareKey with the literals.
+//
+// NOTE: Not thread-safe, MUST only be called before using the Encoder.
+func (e *Encoder) PrepareKeysFromStruct(v any) {
+	e.prepareStructKeys(reflect.TypeOf(v), map[reflect.Type]bool{})
+}
+
+func (e *Encoder) prepareStructKeys(t reflect.Type, seen map[reflect.Type]bool) {
+	for t != nil && (t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map) {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct || seen[t] {
+		return
+	}
+	seen[t] = true
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			// the fields of embedded structs are promoted
+			e.prepareStructKeys(f.Type, seen)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		e.PrepareKey(name)
+		e.prepareStructKeys(f.Type, seen)
+	}
+}
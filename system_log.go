@@ -0,0 +1,85 @@
+package goldjson
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Severity is the severity of a line forwarded to a system log, see
+// NewEventLogEncoder and NewOSLogEncoder.
+type Severity int
+
+// The severities of lines.
+const (
+	SeverityDebug Severity = iota
+	SeverityInfo
+	SeverityWarning
+	SeverityError
+)
+
+// SeverityKey is the key of the field the system log sinks read the severity
+// of the lines from, see LineSeverity. It's the key of the level written by
+// Handler.
+const SeverityKey = "level"
+
+// LineSeverity returns the severity of a record line by the value of the
+// top-level field with the key: strings like the levels of log/slog, e.g.
+// "INFO" or "WARN+2", are recognized by the prefixes DEBUG, INFO, WARN and
+// ERROR (case-insensitively, along with TRACE, FATAL and PANIC), and numbers
+// like the numeric levels of log/slog, e.g. 4 for a warning.
+//
+// Lines without a recognized level are of SeverityInfo.
+func LineSeverity(line []byte, key string) Severity {
+	var d Decoder
+	if !d.setLine(bytes.TrimSuffix(line, []byte("\n"))) {
+		return SeverityInfo
+	}
+	for d.NextField() {
+		if string(d.Key()) != key {
+			continue
+		}
+		switch d.Type() {
+		case ValueNumber:
+			level, err := d.Int64()
+			if err != nil {
+				return SeverityInfo
+			}
+			return levelSeverity(level)
+		case ValueString:
+			s, err := d.Bytes()
+			if err != nil {
+				return SeverityInfo
+			}
+			return nameSeverity(s)
+		}
+		return SeverityInfo
+	}
+	return SeverityInfo
+}
+
+func levelSeverity(level int64) Severity {
+	switch {
+	case level < 0:
+		return SeverityDebug
+	case level < 4:
+		return SeverityInfo
+	case level < 8:
+		return SeverityWarning
+	}
+	return SeverityError
+}
+
+func nameSeverity(name []byte) Severity {
+	hasPrefix := func(prefix string) bool {
+		return len(name) >= len(prefix) && strings.EqualFold(string(name[:len(prefix)]), prefix)
+	}
+	switch {
+	case hasPrefix("DEBUG"), hasPrefix("TRACE"):
+		return SeverityDebug
+	case hasPrefix("WARN"):
+		return SeverityWarning
+	case hasPrefix("ERROR"), hasPrefix("FATAL"), hasPrefix("PANIC"):
+		return SeverityError
+	}
+	return SeverityInfo
+}
@@ -0,0 +1,190 @@
+package goldjson
+
+import (
+	"sync"
+	"time"
+)
+
+// Template is a pre-built line with named slots for the values that change
+// from line to line, for lines where most of the fields are always the same,
+// e.g.
+//
+//	tpl, w := enc.NewTemplate()
+//	w.AddString("service", "api")
+//	tpl.Slot("time")
+//	w.AddString("region", "eu-north-1")
+//	tpl.Slot("msg")
+//	_ = w.End()
+//
+//	line := tpl.NewLine()
+//	_ = line.AddTime(time.Now())
+//	line.AddString("request served")
+//	_ = line.End()
+//
+// The fields between the slots are encoded once, like StaticFields, and the
+// keys of the slots are encoded once, like with Layout, so a line of the
+// Template costs only copies of the pre-encoded fields and the encoding of
+// the values of the slots.
+type Template struct {
+	encoder *Encoder
+	builder *LineWriter
+	fields  *StaticFields
+	names   []string
+	// offsets and keyOffsets are the positions of the slots in the encoded
+	// fields and in their keys.
+	offsets    []int
+	keyOffsets []int
+
+	once   sync.Once
+	chunks []*StaticFields
+	layout *Layout
+}
+
+// NewTemplate returns a new Template for creating lines with the Encoder,
+// and a LineWriter to add the fields of the Template. The fields are encoded
+// according to the options and prepared keys of the Encoder.
+//
+// Use End() on the LineWriter to complete the Template construction before
+// creating lines from it.
+func (e *Encoder) NewTemplate() (*Template, *LineWriter) {
+	fields, builder := e.NewStaticFields()
+	t := &Template{
+		encoder: e,
+		builder: builder,
+		fields:  fields,
+	}
+	return t, builder
+}
+
+// Slot adds a slot for the given key at the current position of the
+// LineWriter of the Template. The values of the slots are added to the lines
+// of the Template in the order of the slots.
+//
+// Slots can only be added to the top level of the line, before calling End
+// on the LineWriter of the Template.
+func (t *Template) Slot(key string) {
+	b := t.builder
+	if b.composer.Depth() != 0 {
+		panic("goldjson: template slot in a nested record or list")
+	}
+	t.names = append(t.names, key)
+	t.offsets = append(t.offsets, len(b.buf))
+	keyOffset := 0
+	if b.checks != nil {
+		keyOffset = len(b.checks.keys)
+	}
+	t.keyOffsets = append(t.keyOffsets, keyOffset)
+}
+
+// compile splits the encoded fields of the Template into the StaticFields
+// between the slots.
+func (t *Template) compile() {
+	prev, prevKey := 0, 0
+	offsets := append(t.offsets, len(t.fields.buf))
+	keyOffsets := append(t.keyOffsets, len(t.fields.keys))
+	t.chunks = make([]*StaticFields, len(offsets))
+	for i, offset := range offsets {
+		buf := t.fields.buf[prev:offset]
+		if len(buf) > 0 && buf[0] == ',' {
+			buf = buf[1:]
+		}
+		t.chunks[i] = &StaticFields{
+			buf:     buf,
+			keys:    t.fields.keys[prevKey:keyOffsets[i]],
+			encoder: t.fields.encoder,
+		}
+		prev, prevKey = offset, keyOffsets[i]
+	}
+	t.layout = t.encoder.NewLayout(t.names...)
+	t.builder = nil
+}
+
+// NewLine creates a new line following the Template.
+func (t *Template) NewLine() TemplateLine {
+	t.once.Do(t.compile)
+	return TemplateLine{
+		l:      t.layout.NewLine(),
+		chunks: t.chunks,
+	}
+}
+
+// TemplateLine is a line following a Template. Each Add method adds the
+// value for the next slot of the Template, along with the fields of the
+// Template before the slot.
+//
+// Calling an Add method after the values for all the slots of the Template
+// have been added will panic.
+type TemplateLine struct {
+	l      LayoutLine
+	chunks []*StaticFields
+}
+
+// Skip omits the next slot of the Template from the line.
+func (t *TemplateLine) Skip() {
+	t.l.line.AddStaticFields(t.chunks[t.l.pos])
+	t.l.Skip()
+}
+
+// AddString adds a string value for the next slot of the Template.
+func (t *TemplateLine) AddString(value string) {
+	t.l.line.AddStaticFields(t.chunks[t.l.pos])
+	t.l.AddString(value)
+}
+
+// AddInt64 adds an int64 value for the next slot of the Template.
+func (t *TemplateLine) AddInt64(value int64) {
+	t.l.line.AddStaticFields(t.chunks[t.l.pos])
+	t.l.AddInt64(value)
+}
+
+// AddUint64 adds a uint64 value for the next slot of the Template.
+func (t *TemplateLine) AddUint64(value uint64) {
+	t.l.line.AddStaticFields(t.chunks[t.l.pos])
+	t.l.AddUint64(value)
+}
+
+// AddBool adds a bool value for the next slot of the Template.
+func (t *TemplateLine) AddBool(value bool) {
+	t.l.line.AddStaticFields(t.chunks[t.l.pos])
+	t.l.AddBool(value)
+}
+
+// AddFloat64 adds a float64 value for the next slot of the Template.
+func (t *TemplateLine) AddFloat64(value float64) {
+	t.l.line.AddStaticFields(t.chunks[t.l.pos])
+	t.l.AddFloat64(value)
+}
+
+// AddTime adds a time.Time value for the next slot of the Template. See
+// LayoutLine.AddTime.
+func (t *TemplateLine) AddTime(value time.Time) error {
+	t.l.line.AddStaticFields(t.chunks[t.l.pos])
+	return t.l.AddTime(value)
+}
+
+// AddMarshal adds a JSON value for the next slot of the Template. See
+// LayoutLine.AddMarshal.
+func (t *TemplateLine) AddMarshal(value any) error {
+	t.l.line.AddStaticFields(t.chunks[t.l.pos])
+	return t.l.AddMarshal(value)
+}
+
+// Line adds the rest of the fields of the Template, omitting the slots
+// without values, and returns the underlying LineWriter, e.g. for adding
+// dynamic fields after the fields of the Template.
+//
+// After calling Line, the TemplateLine can no longer be used.
+func (t *TemplateLine) Line() *LineWriter {
+	for t.l.pos < len(t.l.keys) {
+		t.Skip()
+	}
+	t.l.line.AddStaticFields(t.chunks[t.l.pos])
+	return t.l.line
+}
+
+// End adds the rest of the fields of the Template, omitting the slots
+// without values, finishes the line and writes it to the underlying writer
+// of the Encoder. See LineWriter.End.
+func (t *TemplateLine) End() error {
+	return t.Line().End()
+}
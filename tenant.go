@@ -0,0 +1,35 @@
+package goldjson
+
+// AddTenant registers a tenant of the Encoder, e.g. a customer of a
+// multi-tenant service, with its own prepared keys and the given fields
+// added to every line of the tenant. The fields may be nil.
+//
+// Returns the Encoder of the tenant, a clone of the receiver writing to the
+// same writer, for preparing the keys of the tenant (see PrepareKey) and
+// creating StaticFields with them. The lines of the tenant are created with
+// NewLineFor.
+//
+// NOTE: Not thread-safe, MUST only be called before using the Encoder.
+func (e *Encoder) AddTenant(name string, fields *StaticFields) *Encoder {
+	c := e.Clone()
+	s := NewScope(c)
+	if fields != nil {
+		s = s.With(fields)
+	}
+	if e.tenants == nil {
+		e.tenants = make(map[string]*Scope)
+	}
+	e.tenants[name] = s
+	return c
+}
+
+// NewLineFor creates a new line for the tenant registered with AddTenant,
+// using the prepared keys of the tenant and with the fields of the tenant
+// already added. If the tenant has not been registered, the line is created
+// like with NewLine.
+func (e *Encoder) NewLineFor(tenant string) *LineWriter {
+	if s, ok := e.tenants[tenant]; ok {
+		return s.NewLine()
+	}
+	return e.NewLine()
+}
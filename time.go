@@ -0,0 +1,163 @@
+package goldjson
+
+import (
+	"time"
+
+	"github.com/jussi-kalliokoski/goldjson/tokens"
+)
+
+// TimePolicy determines how time values whose year is outside of the range
+// [0,9999] supported by RFC 3339 are encoded.
+type TimePolicy int
+
+const (
+	// TimePolicyError makes AddTime return an error and omit the field.
+	TimePolicyError TimePolicy = iota
+	// TimePolicyClamp encodes the time as the closest supported time, i.e.
+	// 0000-01-01T00:00:00Z or 9999-12-31T23:59:59.999999999Z.
+	TimePolicyClamp
+	// TimePolicyUnix encodes the time as the (possibly fractional) number of
+	// seconds since the Unix epoch.
+	TimePolicyUnix
+	// TimePolicyExtendedYear encodes the time as a string with the year in
+	// the ISO 8601 expanded representation, e.g. "+010000-01-01T00:00:00Z".
+	TimePolicyExtendedYear
+)
+
+// WithTimePolicy sets the policy for encoding time values whose year is
+// outside of the range [0,9999]. The default is TimePolicyError.
+func WithTimePolicy(policy TimePolicy) Option {
+	return func(o *options) {
+		o.timePolicy = policy
+	}
+}
+
+// WithUTC makes the Encoder convert time values to UTC before encoding them,
+// so that the timestamps produced in different time zones are directly
+// comparable regardless of the local time zone of the process. This applies
+// to AddTime and AddTimeList, as well as the AddTime methods of LayoutLine,
+// GroupRecord and TemplateLine.
+//
+// The conversion (time.Time.UTC) also drops the monotonic clock reading, like
+// Round(0), so the values are normalized the same way as with
+// t.UTC().Round(0).
+func WithUTC() Option {
+	return func(o *options) {
+		o.utc = true
+	}
+}
+
+// WithClockSkew makes the Encoder correct the time values it encodes for a
+// known clock skew of the host, e.g. an offset derived from NTP, by adding
+// the duration returned by skew to them. The skew is called once per line,
+// so it can be updated while the Encoder is in use, and it should be fast.
+//
+// If key is not empty, the applied correction is added to each record line
+// as a field with the key, in nanoseconds.
+//
+// The time values in StaticFields are not corrected.
+func WithClockSkew(key string, skew func() time.Duration) Option {
+	return func(o *options) {
+		o.clockSkewKey = key
+		o.clockSkew = skew
+	}
+}
+
+func (l *LineWriter) initClockSkew(record bool) {
+	l.skew = l.encoder.opts.clockSkew()
+	key := l.encoder.opts.clockSkewKey
+	if key == "" || !record || l.checkKey(key) != nil {
+		return
+	}
+	l.appendKey(key)
+	l.buf = tokens.AppendInt64(l.buf, int64(l.skew))
+}
+
+// skewed returns the time value corrected for the clock skew of the line.
+func (l *LineWriter) skewed(value time.Time) time.Time {
+	if l.skew == 0 {
+		return value
+	}
+	return value.Add(l.skew)
+}
+
+// AddTimeList adds a key-value pair with a list of time.Time values to the
+// active record/list, e.g. for the timestamps of a sequence of events.
+//
+// The values are encoded like with AddTime. If any of the values cannot be
+// encoded, the error is returned and the whole list is handled like a failed
+// AddTime.
+//
+// If a list is currently active, the key will be ignored.
+func (l *LineWriter) AddTimeList(key string, values []time.Time) error {
+	if err := l.checkKey(key); err != nil {
+		return err
+	}
+	orig, wasEmpty := l.buf, l.composer.Empty()
+	l.appendKey(key)
+	afterKey := len(l.buf)
+	l.buf = append(l.buf, '[')
+	for i, value := range values {
+		if i != 0 {
+			l.buf = append(l.buf, ',')
+		}
+		var err error
+		l.buf, err = l.encoder.appendTime(l.buf, l.skewed(value))
+		if err != nil {
+			l.buf = l.buf[:afterKey]
+			l.failValue(orig, wasEmpty, "time encoding failed", err)
+			return err
+		}
+	}
+	l.buf = append(l.buf, ']')
+	return nil
+}
+
+// AddDurationList adds a key-value pair with a list of time.Duration values
+// encoded as strings (see tokens.AppendDuration) to the active record/list.
+//
+// If a list is currently active, the key will be ignored.
+func (l *LineWriter) AddDurationList(key string, values []time.Duration) {
+	if l.checkKey(key) != nil {
+		return
+	}
+	l.appendKey(key)
+	l.buf = append(l.buf, '[')
+	for i, value := range values {
+		if i != 0 {
+			l.buf = append(l.buf, ',')
+		}
+		l.buf = tokens.AppendDuration(l.buf, value)
+	}
+	l.buf = append(l.buf, ']')
+}
+
+var (
+	minTime = time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC)
+	maxTime = time.Date(9999, 12, 31, 23, 59, 59, 999999999, time.UTC)
+)
+
+func (e *Encoder) appendTime(buf []byte, value time.Time) ([]byte, error) {
+	if e.opts.utc {
+		value = value.UTC()
+	}
+	b, err := tokens.AppendTime(buf, value)
+	if err == nil {
+		return b, nil
+	}
+	switch e.opts.timePolicy {
+	case TimePolicyClamp:
+		if value.Before(minTime) {
+			value = minTime
+		} else {
+			value = maxTime
+		}
+		return tokens.AppendTime(buf, value)
+	case TimePolicyUnix:
+		return tokens.AppendTimeUnix(buf, value), nil
+	case TimePolicyExtendedYear:
+		return tokens.AppendTimeExtended(buf, value), nil
+	default:
+		return b, err
+	}
+}
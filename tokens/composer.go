@@ -0,0 +1,163 @@
+package tokens
+
+// Composer tracks the structure of a JSON record or list being appended to a
+// buffer, appending the separators, keys and brackets, which is the part of
+// encoding that custom encoders would otherwise need to duplicate from
+// goldjson.LineWriter, which is built on it. The values are appended with
+// the other appenders of the package.
+//
+// The zero value is ready to use for a top-level record whose opening
+// bracket has been appended, e.g.:
+//
+//	var c tokens.Composer
+//	buf = append(buf, '{')
+//	buf = c.AppendKey(buf, "id")
+//	buf = tokens.AppendInt64(buf, 1)
+//	buf = c.StartList(buf, "tags")
+//	buf = c.AppendKey(buf, "") // the key is ignored in lists
+//	buf = tokens.AppendString(buf, "a")
+//	buf = c.EndList(buf)
+//	buf = append(buf, '}') // {"id":1,"tags":["a"]}
+//
+// The records and lists can be nested to any depth; the Composer only
+// allocates when nesting deeper than 64 levels.
+type Composer struct {
+	// notFirst and isArray are bit sets with a bit for each depth of the
+	// innermost window of 64 depths, so that the zero value is a top-level
+	// record with no entries yet.
+	notFirst uint64
+	isArray  uint64
+	depth    int
+	// outer are the bit sets of the enclosing windows, if any.
+	outer []composerWindow
+}
+
+type composerWindow struct {
+	notFirst uint64
+	isArray  uint64
+}
+
+// Reset resets the Composer for a new top-level record, or list if inList is
+// true, whose opening bracket has been appended.
+func (c *Composer) Reset(inList bool) {
+	*c = Composer{outer: c.outer[:0]}
+	if inList {
+		c.isArray = 1
+	}
+}
+
+// Depth returns the nesting depth of the active record/list, 0 being the
+// top-level value.
+func (c *Composer) Depth() int {
+	return c.depth + 64*len(c.outer)
+}
+
+// InList tells whether the active value is a list.
+func (c *Composer) InList() bool {
+	return c.isArray&(1<<c.depth) != 0
+}
+
+// Empty tells whether no entries have been added to the active record/list.
+func (c *Composer) Empty() bool {
+	return c.notFirst&(1<<c.depth) == 0
+}
+
+// SetEmpty marks the active record/list as having no entries, e.g. after
+// truncating the buffer to remove the entries that were appended.
+func (c *Composer) SetEmpty() {
+	c.notFirst &^= 1 << c.depth
+}
+
+// AppendSeparator appends the comma separating the next entry of the active
+// record/list from the previous one, if any.
+func (c *Composer) AppendSeparator(buf []byte) []byte {
+	bit := uint64(1) << c.depth
+	if c.notFirst&bit != 0 {
+		return append(buf, ',')
+	}
+	c.notFirst |= bit
+	return buf
+}
+
+// AppendKey appends the separator and, if the active value is a record, the
+// encoded key followed by a colon (see AppendKey), before a value is
+// appended.
+func (c *Composer) AppendKey(buf []byte, key string) []byte {
+	buf = c.AppendSeparator(buf)
+	if c.InList() {
+		return buf
+	}
+	return AppendKey(buf, key)
+}
+
+// AppendKeySafeSet appends the separator and key like AppendKey, escaping the
+// ASCII characters of the key that are not in the given set (see
+// AppendKeySafeSet).
+func (c *Composer) AppendKeySafeSet(buf []byte, key string, set *SafeSet) []byte {
+	buf = c.AppendSeparator(buf)
+	if c.InList() {
+		return buf
+	}
+	return AppendKeySafeSet(buf, key, set)
+}
+
+// StartRecord appends the key (see AppendKey) and the opening bracket of a
+// nested record.
+func (c *Composer) StartRecord(buf []byte, key string) []byte {
+	return c.Start(c.AppendKey(buf, key), false)
+}
+
+// EndRecord appends the closing bracket of the active record.
+//
+// If the active record is the top-level record, this function will panic.
+func (c *Composer) EndRecord(buf []byte) []byte {
+	c.pop()
+	return append(buf, '}')
+}
+
+// StartList appends the key (see AppendKey) and the opening bracket of a
+// nested list.
+func (c *Composer) StartList(buf []byte, key string) []byte {
+	return c.Start(c.AppendKey(buf, key), true)
+}
+
+// EndList appends the closing bracket of the active list.
+//
+// If the active list is the top-level list, this function will panic.
+func (c *Composer) EndList(buf []byte) []byte {
+	c.pop()
+	return append(buf, ']')
+}
+
+// Start appends the opening bracket of a nested record, or list if inList is
+// true, for encoders that append the separator and the key themselves (see
+// AppendSeparator), e.g. from a cache of encoded keys. The nested value is
+// ended with EndRecord or EndList.
+func (c *Composer) Start(buf []byte, inList bool) []byte {
+	if c.depth == 63 {
+		c.outer = append(c.outer, composerWindow{notFirst: c.notFirst, isArray: c.isArray})
+		c.notFirst, c.isArray, c.depth = 0, 0, -1
+	}
+	c.depth++
+	bit := uint64(1) << c.depth
+	c.notFirst &^= bit
+	if inList {
+		c.isArray |= bit
+		return append(buf, '[')
+	}
+	c.isArray &^= bit
+	return append(buf, '{')
+}
+
+func (c *Composer) pop() {
+	if c.depth > 0 {
+		c.depth--
+		return
+	}
+	if len(c.outer) == 0 {
+		panic("tokens: no open record or list to end")
+	}
+	w := c.outer[len(c.outer)-1]
+	c.outer = c.outer[:len(c.outer)-1]
+	c.notFirst, c.isArray, c.depth = w.notFirst, w.isArray, 63
+}
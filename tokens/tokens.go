@@ -1,13 +1,16 @@
 package tokens
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"math"
+	"runtime"
 	"strconv"
 	"time"
 	"unicode/utf8"
+	"unsafe"
 )
 
 // AppendInt64 appends an encoded int64 value to the buffer.
@@ -20,6 +23,37 @@ func AppendUint64(buf []byte, value uint64) []byte {
 	return strconv.AppendUint(buf, value, 10)
 }
 
+// MaxSafeInteger is the largest integer n such that n and n+1 can both be
+// represented exactly as a float64, i.e. 2^53-1 (Number.MAX_SAFE_INTEGER in
+// JavaScript).
+const MaxSafeInteger = 1<<53 - 1
+
+// AppendSafeInt64 appends an encoded int64 value to the buffer like
+// AppendInt64, except that values whose absolute value exceeds MaxSafeInteger
+// are quoted as strings, e.g. "9007199254740993", to keep consumers that
+// parse numbers as float64 (such as JSON.parse) from silently losing
+// precision.
+func AppendSafeInt64(buf []byte, value int64) []byte {
+	if value > MaxSafeInteger || value < -MaxSafeInteger {
+		buf = append(buf, '"')
+		buf = strconv.AppendInt(buf, value, 10)
+		return append(buf, '"')
+	}
+	return strconv.AppendInt(buf, value, 10)
+}
+
+// AppendSafeUint64 appends an encoded uint64 value to the buffer like
+// AppendUint64, except that values exceeding MaxSafeInteger are quoted as
+// strings, like with AppendSafeInt64.
+func AppendSafeUint64(buf []byte, value uint64) []byte {
+	if value > MaxSafeInteger {
+		buf = append(buf, '"')
+		buf = strconv.AppendUint(buf, value, 10)
+		return append(buf, '"')
+	}
+	return strconv.AppendUint(buf, value, 10)
+}
+
 // AppendBool appends an encoded bool value to the buffer.
 func AppendBool(buf []byte, value bool) []byte {
 	return strconv.AppendBool(buf, value)
@@ -31,22 +65,37 @@ func AppendBool(buf []byte, value bool) []byte {
 // marshaled as strings ("+Inf", "-Inf", "NaN" respectively) instead of
 // erroring.
 func AppendFloat64(buf []byte, value float64) []byte {
+	return appendFloat(buf, value, 64)
+}
+
+// AppendFloat32 appends an encoded float32 value to the buffer, formatted
+// with 32-bit precision like json.Marshal formats float32 values, e.g. 0.1
+// instead of the 0.10000000149011612 of AppendFloat64(float64(value)).
+//
+// Non-finite values are encoded like with AppendFloat64.
+func AppendFloat32(buf []byte, value float32) []byte {
+	return appendFloat(buf, float64(value), 32)
+}
+
+func appendFloat(buf []byte, value float64, bits int) []byte {
 	// json.Marshal fails on special floats, so handle them here.
 	switch {
 	case math.IsInf(value, 1):
-		return fmt.Append(buf, "\"+Inf\"")
+		return append(buf, `"+Inf"`...)
 	case math.IsInf(value, -1):
-		return fmt.Append(buf, "\"-Inf\"")
+		return append(buf, `"-Inf"`...)
 	case math.IsNaN(value):
-		return fmt.Append(buf, "\"NaN\"")
+		return append(buf, `"NaN"`...)
 	default:
 		abs := math.Abs(value)
 		fmt := byte('f')
-		if abs < 1e-6 || abs >= 1e21 {
-			fmt = 'e'
+		if abs != 0 {
+			if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+				fmt = 'e'
+			}
 		}
 		oldLen := len(buf)
-		buf = strconv.AppendFloat(buf, value, fmt, -1, 64)
+		buf = strconv.AppendFloat(buf, value, fmt, -1, bits)
 		b := buf[oldLen:]
 		if fmt == 'e' {
 			// clean up e-09 to e-9
@@ -59,20 +108,167 @@ func AppendFloat64(buf []byte, value float64) []byte {
 	}
 }
 
+// AppendFloat64Prec appends an encoded float64 value to the buffer, rounded
+// to prec digits after the decimal point, with the trailing zeros removed,
+// e.g. 1.5 for 1.50012 with prec 3.
+//
+// A negative prec, as well as values that AppendFloat64 would encode in
+// exponent form because of their magnitude, are encoded like with
+// AppendFloat64. Non-finite values are encoded like with AppendFloat64.
+func AppendFloat64Prec(buf []byte, value float64, prec int) []byte {
+	if prec < 0 || math.IsInf(value, 0) || math.IsNaN(value) || math.Abs(value) >= 1e21 {
+		return AppendFloat64(buf, value)
+	}
+	buf = strconv.AppendFloat(buf, value, 'f', prec, 64)
+	if prec == 0 {
+		return buf
+	}
+	n := len(buf)
+	for buf[n-1] == '0' {
+		n--
+	}
+	if buf[n-1] == '.' {
+		n--
+	}
+	return buf[:n]
+}
+
+// AppendComplex128 appends a complex128 value encoded as a string in the form
+// "a+bi" to the buffer, e.g. "1.5-2i" or "0+1e-09i". The parts are formatted
+// like with strconv.FormatComplex, without the parentheses.
+func AppendComplex128(buf []byte, value complex128) []byte {
+	buf = append(buf, '"')
+	buf = strconv.AppendFloat(buf, real(value), 'g', -1, 64)
+	start := len(buf)
+	buf = strconv.AppendFloat(buf, imag(value), 'g', -1, 64)
+	if c := buf[start]; c != '+' && c != '-' {
+		buf = append(buf, 0)
+		copy(buf[start+1:], buf[start:])
+		buf[start] = '+'
+	}
+	return append(buf, 'i', '"')
+}
+
 // AppendTime appends an encoded time value to the buffer.
 func AppendTime(buf []byte, value time.Time) ([]byte, error) {
 	if y := value.Year(); y < 0 || y >= 10000 {
 		// RFC 3339 is clear that years are 4 digits exactly.
 		// See golang.org/issue/4556#c15 for more discussion.
-		return buf, errors.New("time.Time year outside of range [0,9999]")
+		return buf, errYearOutOfRange
 	}
 	buf = append(buf, '"')
 	buf = value.AppendFormat(buf, time.RFC3339Nano)
 	return append(buf, '"'), nil
 }
 
+var errYearOutOfRange = errors.New("time.Time year outside of range [0,9999]")
+
+// AppendTimeExtended appends an encoded time value to the buffer, like
+// AppendTime, except that years outside of the range [0,9999] are encoded in
+// the ISO 8601 expanded representation with a sign and (at least) 6 digits,
+// e.g. "+010000-01-01T00:00:00Z", as in JavaScript.
+func AppendTimeExtended(buf []byte, value time.Time) []byte {
+	y := value.Year()
+	if y >= 0 && y < 10000 {
+		buf, _ = AppendTime(buf, value)
+		return buf
+	}
+	buf = append(buf, '"')
+	if y < 0 {
+		buf = append(buf, '-')
+		y = -y
+	} else {
+		buf = append(buf, '+')
+	}
+	for pad := 100000; pad > 1 && y < pad; pad /= 10 {
+		buf = append(buf, '0')
+	}
+	buf = strconv.AppendInt(buf, int64(y), 10)
+	start := len(buf)
+	buf = value.AppendFormat(buf, time.RFC3339Nano)
+	// drop the year as formatted by time, skipping the sign of a negative
+	// year
+	end := start + 1 + bytes.IndexByte(buf[start+1:], '-')
+	buf = append(buf[:start], buf[end:]...)
+	return append(buf, '"')
+}
+
+// AppendDuration appends a time.Duration value encoded as a string in the
+// format of time.Duration.String to the buffer, e.g. "1h2m0.5s" or "1.5ms".
+// The value can be parsed with time.ParseDuration.
+func AppendDuration(buf []byte, value time.Duration) []byte {
+	buf = append(buf, '"')
+	buf = append(buf, value.String()...)
+	return append(buf, '"')
+}
+
+// AppendUUID appends a UUID encoded as a string in the canonical hyphenated
+// lowercase hex format to the buffer, e.g.
+// "01890a5d-ac96-774b-bcce-b302099a8057".
+func AppendUUID(buf []byte, value [16]byte) []byte {
+	const hex = "0123456789abcdef"
+	buf = append(buf, '"')
+	for i, b := range value {
+		if i == 4 || i == 6 || i == 8 || i == 10 {
+			buf = append(buf, '-')
+		}
+		buf = append(buf, hex[b>>4], hex[b&0xf])
+	}
+	return append(buf, '"')
+}
+
+// AppendBase64 appends a byte slice encoded as a string in standard base64
+// (with padding) to the buffer, e.g. "aGVsbG8=", like encoding/json encodes
+// []byte values.
+func AppendBase64(buf []byte, value []byte) []byte {
+	buf = append(buf, '"')
+	start := len(buf)
+	buf = append(buf, make([]byte, base64.StdEncoding.EncodedLen(len(value)))...)
+	base64.StdEncoding.Encode(buf[start:], value)
+	return append(buf, '"')
+}
+
+// AppendTimeUnix appends a time value encoded as the (possibly fractional)
+// number of seconds since the Unix epoch to the buffer, e.g. 1686602535.5.
+func AppendTimeUnix(buf []byte, value time.Time) []byte {
+	sec, nsec := value.Unix(), int64(value.Nanosecond())
+	if sec < 0 && nsec > 0 {
+		sec, nsec = sec+1, 1e9-nsec
+		if sec == 0 {
+			buf = append(buf, '-')
+		}
+	}
+	buf = strconv.AppendInt(buf, sec, 10)
+	if nsec == 0 {
+		return buf
+	}
+	buf = append(buf, '.')
+	start := len(buf)
+	for pad := int64(1e8); nsec < pad; pad /= 10 {
+		buf = append(buf, '0')
+	}
+	buf = strconv.AppendInt(buf, nsec, 10)
+	// trim trailing zeros
+	end := len(buf)
+	for end > start && buf[end-1] == '0' {
+		end--
+	}
+	return buf[:end]
+}
+
 // AppendMarshal appends an encoded JSON value to the buffer.
+//
+// A json.RawMessage value is appended with AppendRawJSON without validation
+// instead of re-encoding it.
 func AppendMarshal(buf []byte, value any) ([]byte, error) {
+	switch v := value.(type) {
+	case json.RawMessage:
+		return AppendRawJSON(buf, v, false)
+	case *json.RawMessage:
+		if v != nil {
+			return AppendRawJSON(buf, *v, false)
+		}
+	}
 	bw := bytesWriter{buf}
 	enc := json.NewEncoder(&bw)
 	enc.SetEscapeHTML(false)
@@ -83,27 +279,209 @@ func AppendMarshal(buf []byte, value any) ([]byte, error) {
 	return buf, nil
 }
 
+// AppendRawJSON appends a pre-encoded JSON value to the buffer as is. An
+// empty value is encoded as null. A value spanning multiple lines is
+// compacted (and thus validated) to keep the output line-delimited, other
+// values are only validated if validate is true.
+func AppendRawJSON(buf []byte, raw []byte, validate bool) ([]byte, error) {
+	if len(raw) == 0 {
+		return append(buf, "null"...), nil
+	}
+	if bytes.IndexByte(raw, '\n') != -1 || bytes.IndexByte(raw, '\r') != -1 {
+		b := bytes.NewBuffer(buf)
+		if err := json.Compact(b, raw); err != nil {
+			return buf, err
+		}
+		return b.Bytes(), nil
+	}
+	if validate && !json.Valid(raw) {
+		return buf, errInvalidRawJSON
+	}
+	return append(buf, raw...), nil
+}
+
+var errInvalidRawJSON = errors.New("invalid raw JSON value")
+
 // AppendString appends an encoded (quoted and escaped) string value to the
 // buffer.
 func AppendString(buf []byte, s string) []byte {
 	buf = append(buf, '"')
-	buf = appendJSONString(buf, s)
+	buf = appendJSONString(buf, s, &safeSet)
+	return append(buf, '"')
+}
+
+// AppendStringSafeSet appends an encoded (quoted and escaped) string value to
+// the buffer, escaping the ASCII characters that are not in the given set.
+//
+// The set MUST NOT contain the characters that JSON requires to be escaped,
+// see SafeSet.Sanitized.
+func AppendStringSafeSet(buf []byte, s string, set *SafeSet) []byte {
+	buf = append(buf, '"')
+	buf = appendJSONString(buf, s, set)
+	return append(buf, '"')
+}
+
+// AppendStringHTMLSafe appends an encoded (quoted and escaped) string value
+// to the buffer like AppendString, but also escapes "<", ">" and "&" like
+// json.Marshal does by default, for output embedded in HTML.
+func AppendStringHTMLSafe(buf []byte, s string) []byte {
+	buf = append(buf, '"')
+	buf = appendJSONString(buf, s, &htmlSafeSet)
+	return append(buf, '"')
+}
+
+// AppendStringReplaceNewlines appends an encoded string value to the buffer
+// like AppendStringSafeSet, but replaces each line break (\r\n, \n or \r) in
+// the value with the replacement, which is escaped as well. This is useful
+// for consumers that mangle the escaped line breaks of multi-line strings.
+//
+// The set MUST NOT contain the characters that JSON requires to be escaped,
+// see SafeSet.Sanitized.
+func AppendStringReplaceNewlines(buf []byte, s, replacement string, set *SafeSet) []byte {
+	buf = append(buf, '"')
+	start := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\n' && s[i] != '\r' {
+			continue
+		}
+		buf = appendJSONString(buf, s[start:i], set)
+		buf = appendJSONString(buf, replacement, set)
+		if s[i] == '\r' && i+1 < len(s) && s[i+1] == '\n' {
+			i++
+		}
+		start = i + 1
+	}
+	buf = appendJSONString(buf, s[start:], set)
 	return append(buf, '"')
 }
 
+// StringSize returns the size of the string value encoded with AppendString,
+// including the quotes, without encoding it.
+func StringSize(s string) int {
+	return jsonStringSize(s, &safeSet) + 2
+}
+
+// AppendKey appends an encoded (quoted and escaped) record key followed by a
+// colon to the buffer, e.g. "key": for key, using the same escaping as the
+// keys written by goldjson.LineWriter.
+func AppendKey[K string | []byte](buf []byte, key K) []byte {
+	return AppendKeySafeSet(buf, key, &safeSet)
+}
+
+// AppendKeySafeSet appends an encoded record key followed by a colon to the
+// buffer like AppendKey, escaping the ASCII characters that are not in the
+// given set.
+//
+// The set MUST NOT contain the characters that JSON requires to be escaped,
+// see SafeSet.Sanitized.
+func AppendKeySafeSet[K string | []byte](buf []byte, key K, set *SafeSet) []byte {
+	var s string
+	switch key := any(key).(type) {
+	case string:
+		s = key
+	case []byte:
+		// the key is only read, so it doesn't need to be copied
+		s = unsafe.String(unsafe.SliceData(key), len(key))
+	}
+	buf = append(buf, '"')
+	buf = appendJSONString(buf, s, set)
+	return append(buf, '"', ':')
+}
+
+// MaxStackDepth is the maximum number of frames appended by AppendStack.
+const MaxStackDepth = 64
+
+// AppendStack appends the stack of the calling goroutine to the buffer as a
+// list of strings in the form "file:line function", innermost frame first,
+// e.g. ["/src/app/main.go:42 main.run","/src/app/main.go:17 main.main"].
+//
+// The argument skip is the number of frames to skip, with 0 identifying the
+// caller of AppendStack. At most MaxStackDepth frames are appended.
+func AppendStack(buf []byte, skip int) []byte {
+	return appendStack(buf, skip+1, &safeSet)
+}
+
+// AppendStackSafeSet appends the stack of the calling goroutine to the buffer
+// like AppendStack, escaping the ASCII characters that are not in the given
+// set.
+//
+// The set MUST NOT contain the characters that JSON requires to be escaped,
+// see SafeSet.Sanitized.
+func AppendStackSafeSet(buf []byte, skip int, set *SafeSet) []byte {
+	return appendStack(buf, skip+1, set)
+}
+
+func appendStack(buf []byte, skip int, set *SafeSet) []byte {
+	var pcs [MaxStackDepth]uintptr
+	// skip runtime.Callers and appendStack.
+	n := runtime.Callers(skip+2, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	buf = append(buf, '[')
+	for i := 0; ; i++ {
+		frame, more := frames.Next()
+		if frame.PC == 0 {
+			break
+		}
+		if i != 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, '"')
+		buf = appendJSONString(buf, frame.File, set)
+		buf = append(buf, ':')
+		buf = strconv.AppendInt(buf, int64(frame.Line), 10)
+		buf = append(buf, ' ')
+		buf = appendJSONString(buf, frame.Function, set)
+		buf = append(buf, '"')
+		if !more {
+			break
+		}
+	}
+	return append(buf, ']')
+}
+
+// SafeSet is a table of the ASCII characters that can be represented inside
+// a JSON string without escaping. The characters for which the value is false
+// are escaped. The forward slash (/) is escaped as \/ when it is not in the
+// set.
+type SafeSet [utf8.RuneSelf]bool
+
+// DefaultSafeSet returns the set used by AppendString, i.e. all the
+// characters except for the ones JSON requires to be escaped: the ASCII
+// control characters (0-31), the double quote (") and the backslash (\).
+func DefaultSafeSet() SafeSet {
+	return safeSet
+}
+
+// HTMLSafeSet returns the set used by AppendStringHTMLSafe, i.e. the
+// DefaultSafeSet without "<", ">" and "&".
+func HTMLSafeSet() SafeSet {
+	return htmlSafeSet
+}
+
+// Sanitized returns a copy of the set with the characters JSON requires to be
+// escaped removed from it.
+func (s SafeSet) Sanitized() SafeSet {
+	for b := range s {
+		if !safeSet[b] {
+			s[b] = false
+		}
+	}
+	return s
+}
+
 // appendJSONString escapes s for JSON and appends it to buf.
 // It does not surround the string in quotation marks.
 //
 // Modified from encoding/json/encode.go:encodeState.string,
-// with escapeHTML set to false.
-func appendJSONString(buf []byte, s string) []byte {
+// with the HTML-safe set replaced with the given set.
+func appendJSONString(buf []byte, s string, set *SafeSet) []byte {
 	char := func(b byte) { buf = append(buf, b) }
 	str := func(s string) { buf = append(buf, s...) }
 
 	start := 0
 	for i := 0; i < len(s); {
 		if b := s[i]; b < utf8.RuneSelf {
-			if safeSet[b] {
+			if set[b] {
 				i++
 				continue
 			}
@@ -112,7 +490,7 @@ func appendJSONString(buf []byte, s string) []byte {
 			}
 			char('\\')
 			switch b {
-			case '\\', '"':
+			case '\\', '"', '/':
 				char(b)
 			case '\n':
 				char('n')
@@ -169,6 +547,36 @@ func appendJSONString(buf []byte, s string) []byte {
 	return buf
 }
 
+// jsonStringSize returns the length of s escaped by appendJSONString.
+func jsonStringSize(s string, set *SafeSet) int {
+	n := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			switch {
+			case set[b]:
+				n++
+			case b == '\\' || b == '"' || b == '/' || b == '\n' || b == '\r' || b == '\t':
+				n += 2
+			default:
+				n += len(`\u0000`)
+			}
+			i++
+			continue
+		}
+		c, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case c == utf8.RuneError && size == 1:
+			n += len(`\ufffd`)
+		case c == '\u2028' || c == '\u2029':
+			n += len(`\u2028`)
+		default:
+			n += size
+		}
+		i += size
+	}
+	return n
+}
+
 var hex = "0123456789abcdef"
 
 // Copied from encoding/json/tables.go.
@@ -179,7 +587,7 @@ var hex = "0123456789abcdef"
 //
 // All values are true except for the ASCII control characters (0-31), the
 // double quote ("), and the backslash character ("\").
-var safeSet = [utf8.RuneSelf]bool{
+var safeSet = SafeSet{
 	' ':      true,
 	'!':      true,
 	'"':      false,
@@ -278,6 +686,14 @@ var safeSet = [utf8.RuneSelf]bool{
 	'\u007f': true,
 }
 
+// htmlSafeSet is the safeSet without the characters json.Marshal escapes for
+// HTML safety.
+var htmlSafeSet = func() SafeSet {
+	set := safeSet
+	set['<'], set['>'], set['&'] = false, false, false
+	return set
+}()
+
 type bytesWriter struct {
 	buf []byte
 }
@@ -1,8 +1,12 @@
 package tokens_test
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -46,6 +50,50 @@ func TestAppendUint64(t *testing.T) {
 	}
 }
 
+func TestAppendSafeInt64(t *testing.T) {
+	tests := []struct {
+		name     string
+		val      int64
+		expected string
+	}{
+		{"zero", 0, "0"},
+		{"max safe", tokens.MaxSafeInteger, "9007199254740991"},
+		{"min safe", -tokens.MaxSafeInteger, "-9007199254740991"},
+		{"above max safe", tokens.MaxSafeInteger + 1, `"9007199254740992"`},
+		{"below min safe", -tokens.MaxSafeInteger - 1, `"-9007199254740992"`},
+		{"min", math.MinInt64, `"-9223372036854775808"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := string(tokens.AppendSafeInt64([]byte("abc"), tt.val))
+
+			expectEqual(t, "abc"+tt.expected, received)
+		})
+	}
+}
+
+func TestAppendSafeUint64(t *testing.T) {
+	tests := []struct {
+		name     string
+		val      uint64
+		expected string
+	}{
+		{"zero", 0, "0"},
+		{"max safe", tokens.MaxSafeInteger, "9007199254740991"},
+		{"above max safe", tokens.MaxSafeInteger + 1, `"9007199254740992"`},
+		{"max", math.MaxUint64, `"18446744073709551615"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := string(tokens.AppendSafeUint64([]byte("abc"), tt.val))
+
+			expectEqual(t, "abc"+tt.expected, received)
+		})
+	}
+}
+
 func TestAppendBool(t *testing.T) {
 	tests := []struct {
 		val      bool
@@ -86,6 +134,16 @@ func TestAppendFloat64(t *testing.T) {
 				expectEqual(t, expected, received)
 			})
 		}
+
+		for _, tt := range tests {
+			t.Run(tt.name+" appended", func(t *testing.T) {
+				expected := "abc" + fmt.Sprintf("%q", tt.expected)
+
+				received := string(tokens.AppendFloat64([]byte("abc"), tt.val))
+
+				expectEqual(t, expected, received)
+			})
+		}
 	})
 
 	t.Run("normal", func(t *testing.T) {
@@ -93,6 +151,7 @@ func TestAppendFloat64(t *testing.T) {
 			val      float64
 			expected string
 		}{
+			{0, "0"},
 			{0.591824, "0.591824"},
 			{1e-09, "1e-9"},
 			{1e-12, "1e-12"},
@@ -109,6 +168,128 @@ func TestAppendFloat64(t *testing.T) {
 	})
 }
 
+func TestAppendFloat32(t *testing.T) {
+	t.Run("special", func(t *testing.T) {
+		z := float32(0)
+		expected := `"+Inf","-Inf","NaN"`
+
+		buf := tokens.AppendFloat32(nil, 1/z)
+		buf = append(buf, ',')
+		buf = tokens.AppendFloat32(buf, -1/z)
+		buf = append(buf, ',')
+		buf = tokens.AppendFloat32(buf, 0/z)
+		received := string(buf)
+
+		expectEqual(t, expected, received)
+	})
+
+	t.Run("normal", func(t *testing.T) {
+		tests := []float32{0, 0.1, -0.3, 1.5, 16777217, 1e-6, 9.9e-7, 1e-9, 1e20, 1e21, math.MaxFloat32, math.SmallestNonzeroFloat32}
+
+		for _, tt := range tests {
+			expected, err := json.Marshal(tt)
+			expectNoError(t, err)
+			t.Run(string(expected), func(t *testing.T) {
+				received := string(tokens.AppendFloat32(nil, tt))
+
+				expectEqual(t, string(expected), received)
+			})
+		}
+	})
+}
+
+func TestAppendFloat64Prec(t *testing.T) {
+	z := float64(0)
+	tests := []struct {
+		name     string
+		val      float64
+		prec     int
+		expected string
+	}{
+		{"zero", 0, 3, "0"},
+		{"rounded", 1.23456, 3, "1.235"},
+		{"trailing zeros", 1.5, 3, "1.5"},
+		{"integer", 2, 3, "2"},
+		{"negative", -0.126, 2, "-0.13"},
+		{"no decimals", 1234.5, 0, "1234"},
+		{"small", 1e-9, 3, "0"},
+		{"large", 1e21, 3, "1e+21"},
+		{"shortest", 1.23456, -1, "1.23456"},
+		{"NaN", 0 / z, 3, `"NaN"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := string(tokens.AppendFloat64Prec([]byte("abc"), tt.val, tt.prec))
+
+			expectEqual(t, "abc"+tt.expected, received)
+		})
+	}
+}
+
+func TestAppendComplex128(t *testing.T) {
+	z := float64(0)
+	tests := []struct {
+		name     string
+		val      complex128
+		expected string
+	}{
+		{"zero", 0, `"0+0i"`},
+		{"positive imaginary", complex(1.5, 2), `"1.5+2i"`},
+		{"negative imaginary", complex(-1.5, -2), `"-1.5-2i"`},
+		{"exponent", complex(1e21, 1e-9), `"1e+21+1e-09i"`},
+		{"special", complex(0/z, 1/z), `"NaN+Infi"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := string(tokens.AppendComplex128([]byte("abc"), tt.val))
+
+			expectEqual(t, "abc"+tt.expected, received)
+		})
+	}
+}
+
+func TestAppendStack(t *testing.T) {
+	t.Run("caller first", func(t *testing.T) {
+		var frames []string
+
+		err := json.Unmarshal(tokens.AppendStack(nil, 0), &frames)
+
+		expectNoError(t, err)
+		expectEqual(t, true, len(frames) > 1)
+		expectEqual(t, true, strings.Contains(frames[0], "tokens_test.go:"))
+		expectEqual(t, true, strings.HasSuffix(frames[0], " github.com/jussi-kalliokoski/goldjson/tokens_test.TestAppendStack.func1"))
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		var frames []string
+		var skipped []string
+		appendStack := func() []byte {
+			return tokens.AppendStack([]byte("abc"), 1)
+		}
+
+		received := appendStack()
+		err := json.Unmarshal(received[3:], &skipped)
+		_ = json.Unmarshal(tokens.AppendStack(nil, 0), &frames)
+
+		expectEqual(t, "abc", string(received[:3]))
+		expectNoError(t, err)
+		expectEqual(t, frames[1], skipped[1])
+		expectEqual(t, true, strings.HasSuffix(skipped[0], " github.com/jussi-kalliokoski/goldjson/tokens_test.TestAppendStack.func2"))
+	})
+
+	t.Run("safe set", func(t *testing.T) {
+		set := tokens.DefaultSafeSet()
+		set['/'] = false
+
+		received := string(tokens.AppendStackSafeSet(nil, 0, &set))
+
+		expectEqual(t, true, strings.Contains(received, `\/`))
+		expectEqual(t, strings.Count(received, "/"), strings.Count(received, `\/`))
+	})
+}
+
 func TestAppendString(t *testing.T) {
 	t.Run("special", func(t *testing.T) {
 		tests := []struct {
@@ -164,6 +345,155 @@ func TestAppendString(t *testing.T) {
 	})
 }
 
+func TestStringSize(t *testing.T) {
+	tests := []string{
+		"",
+		"hello",
+		"quote \" backslash \\ slash /",
+		"\n\r\t\b\x00\x1f<>&",
+		"héllo ☃ 😀",
+		"invalid \xff\xfe utf-8",
+		"separators \u2028\u2029",
+	}
+
+	for _, s := range tests {
+		t.Run(s, func(t *testing.T) {
+			expected := len(tokens.AppendString(nil, s))
+			received := tokens.StringSize(s)
+
+			expectEqual(t, expected, received)
+		})
+	}
+}
+
+func TestAppendStringReplaceNewlines(t *testing.T) {
+	set := tokens.DefaultSafeSet()
+	tests := []struct {
+		name        string
+		value       string
+		replacement string
+		expected    string
+	}{
+		{"no newlines", "abc", " ", `"abc"`},
+		{"newline", "a\nb", " ", `"a b"`},
+		{"carriage return", "a\rb", " ", `"a b"`},
+		{"crlf", "a\r\nb\n\rc", " ", `"a b  c"`},
+		{"leading and trailing", "\na\n", "|", `"|a|"`},
+		{"removed", "a\nb", "", `"ab"`},
+		{"escaped replacement", "a\nb\tc", "\"\n", `"a\"\nb\tc"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := string(tokens.AppendStringReplaceNewlines([]byte("abc"), tt.value, tt.replacement, &set))
+
+			expectEqual(t, "abc"+tt.expected, received)
+		})
+	}
+}
+
+func TestAppendStringSafeSet(t *testing.T) {
+	set := tokens.DefaultSafeSet()
+	set['='] = false
+	set['\u007f'] = false
+	set['"'] = true
+	set['\n'] = true
+	set['/'] = false
+	sanitized := set.Sanitized()
+	tests := []struct {
+		name     string
+		key      string
+		expected string
+	}{
+		{"normal", "abc", `"abc"`},
+		{"escaped by set", "a=b\u007f", `"a\u003db\u007f"`},
+		{"required escapes", "\"\n", `"\"\n"`},
+		{"slash", "</script>", `"<\/script>"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := string(tokens.AppendStringSafeSet(nil, tt.key, &sanitized))
+
+			expectEqual(t, tt.expected, received)
+		})
+	}
+
+	t.Run("default", func(t *testing.T) {
+		set := tokens.DefaultSafeSet()
+		s := "a=b\u007f\"\n<>&"
+		expected := string(tokens.AppendString(nil, s))
+
+		received := string(tokens.AppendStringSafeSet(nil, s, &set))
+
+		expectEqual(t, expected, received)
+	})
+}
+
+func TestAppendStringHTMLSafe(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"normal", "abc"},
+		{"html", "<script>a && b</script>"},
+		{"required escapes", "\"\n\\"},
+		{"line separators", "a\u2028b\u2029c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expected, err := json.Marshal(tt.value)
+			expectNoError(t, err)
+
+			received := tokens.AppendStringHTMLSafe(nil, tt.value)
+
+			expectEqual(t, string(expected), string(received))
+		})
+	}
+
+	t.Run("set", func(t *testing.T) {
+		set := tokens.HTMLSafeSet()
+		s := "<a href=\"/\">&amp;</a>"
+		expected := string(tokens.AppendStringHTMLSafe(nil, s))
+
+		received := string(tokens.AppendStringSafeSet(nil, s, &set))
+
+		expectEqual(t, expected, received)
+	})
+}
+
+func TestAppendKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		expected string
+	}{
+		{"empty", "", `"":`},
+		{"normal", "abc", `"abc":`},
+		{"escaped", "a\"b\n", `"a\"b\n":`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := string(tokens.AppendKey([]byte("{"), tt.key))
+			receivedBytes := string(tokens.AppendKey([]byte("{"), []byte(tt.key)))
+
+			expectEqual(t, "{"+tt.expected, received)
+			expectEqual(t, "{"+tt.expected, receivedBytes)
+		})
+	}
+
+	t.Run("safe set", func(t *testing.T) {
+		set := tokens.DefaultSafeSet()
+		set['/'] = false
+
+		received := string(tokens.AppendKeySafeSet(nil, "a/b", &set))
+
+		expectEqual(t, `"a\/b":`, received)
+	})
+}
+
 func TestAppendMarshal(t *testing.T) {
 	t.Run("valid", func(t *testing.T) {
 		tests := []struct {
@@ -173,6 +503,9 @@ func TestAppendMarshal(t *testing.T) {
 		}{
 			{"Point", Point{1.23, -0.5}, `{"x":1.23,"y":-0.5}`},
 			{"CustomMarshal", CustomMarshal{"html", "<>"}, `{"html":"<>"}`},
+			{"RawMessage", json.RawMessage(`{"a": "<>"}`), `{"a": "<>"}`},
+			{"*RawMessage", &json.RawMessage{'1'}, `1`},
+			{"nil RawMessage", json.RawMessage(nil), `null`},
 		}
 
 		for _, tt := range tests {
@@ -206,6 +539,54 @@ func TestAppendMarshal(t *testing.T) {
 	})
 }
 
+func TestAppendRawJSON(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			val      string
+			validate bool
+			expected string
+		}{
+			{"as is", `{"a": [1, 2]}`, false, `{"a": [1, 2]}`},
+			{"validated", `{"a": [1, 2]}`, true, `{"a": [1, 2]}`},
+			{"empty", ``, true, `null`},
+			{"multiple lines", "{\n\t\"a\": \"b\"\r\n}", false, `{"a":"b"}`},
+			{"invalid without validation", `{`, false, `{`},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				b, err := tokens.AppendRawJSON(nil, []byte(tt.val), tt.validate)
+				received := string(b)
+
+				expectNoError(t, err)
+				expectEqual(t, tt.expected, received)
+			})
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			val      string
+			validate bool
+		}{
+			{"validated", `{"a":`, true},
+			{"multiple lines", "{\n", false},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				expected := []byte("abc")
+				received, err := tokens.AppendRawJSON(expected, []byte(tt.val), tt.validate)
+
+				expectError(t, err)
+				expectEqual(t, string(expected), string(received))
+			})
+		}
+	})
+}
+
 func TestAppendTime(t *testing.T) {
 	zone := time.FixedZone("night city", 0)
 
@@ -251,6 +632,167 @@ func TestAppendTime(t *testing.T) {
 	})
 }
 
+func TestAppendDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		val      time.Duration
+		expected string
+	}{
+		{"zero", 0, `"0s"`},
+		{"nanoseconds", 12, `"12ns"`},
+		{"microseconds", 1500, `"1.5µs"`},
+		{"negative", -1500 * time.Millisecond, `"-1.5s"`},
+		{"hours", 26*time.Hour + 3*time.Second, `"26h0m3s"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := string(tokens.AppendDuration([]byte("abc"), tt.val))
+
+			expectEqual(t, "abc"+tt.expected, received)
+		})
+	}
+}
+
+func TestAppendUUID(t *testing.T) {
+	tests := []struct {
+		name     string
+		val      [16]byte
+		expected string
+	}{
+		{"zero", [16]byte{}, `"00000000-0000-0000-0000-000000000000"`},
+		{"v7", [16]byte{0x01, 0x89, 0x0a, 0x5d, 0xac, 0x96, 0x77, 0x4b, 0xbc, 0xce, 0xb3, 0x02, 0x09, 0x9a, 0x80, 0x57}, `"01890a5d-ac96-774b-bcce-b302099a8057"`},
+		{"max", [16]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, `"ffffffff-ffff-ffff-ffff-ffffffffffff"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := string(tokens.AppendUUID([]byte("abc"), tt.val))
+
+			expectEqual(t, "abc"+tt.expected, received)
+		})
+	}
+}
+
+func TestAppendBase64(t *testing.T) {
+	tests := []struct {
+		name     string
+		val      []byte
+		expected string
+	}{
+		{"empty", nil, `""`},
+		{"one", []byte("h"), `"aA=="`},
+		{"two", []byte("he"), `"aGU="`},
+		{"three", []byte("hel"), `"aGVs"`},
+		{"binary", []byte{0xfb, 0xff, 0x00}, `"+/8A"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expected, _ := json.Marshal(tt.val)
+			received := string(tokens.AppendBase64([]byte("abc"), tt.val))
+
+			expectEqual(t, "abc"+tt.expected, received)
+			if tt.val != nil {
+				expectEqual(t, string(expected), tt.expected)
+			}
+		})
+	}
+}
+
+func TestAllocations(t *testing.T) {
+	z := float64(0)
+	set := tokens.DefaultSafeSet()
+	keyBytes := []byte("a\nb")
+	zone := time.FixedZone("night city", 0)
+	tests := []struct {
+		name   string
+		append func([]byte) []byte
+	}{
+		{"int64", func(b []byte) []byte { return tokens.AppendInt64(b, -591824) }},
+		{"uint64", func(b []byte) []byte { return tokens.AppendUint64(b, 591824) }},
+		{"bool", func(b []byte) []byte { return tokens.AppendBool(b, true) }},
+		{"float64", func(b []byte) []byte { return tokens.AppendFloat64(b, 1e-12) }},
+		{"positive infinity", func(b []byte) []byte { return tokens.AppendFloat64(b, 1/z) }},
+		{"negative infinity", func(b []byte) []byte { return tokens.AppendFloat64(b, -1/z) }},
+		{"NaN", func(b []byte) []byte { return tokens.AppendFloat64(b, 0/z) }},
+		{"string", func(b []byte) []byte { return tokens.AppendString(b, "a\n\u2028\xff") }},
+		{"string replace newlines", func(b []byte) []byte { return tokens.AppendStringReplaceNewlines(b, "a\r\nb\n", " ", &set) }},
+		{"complex128", func(b []byte) []byte { return tokens.AppendComplex128(b, complex(1.5, 2)) }},
+		{"duration", func(b []byte) []byte { return tokens.AppendDuration(b, -26*time.Hour-1500*time.Microsecond) }},
+		{"uuid", func(b []byte) []byte { return tokens.AppendUUID(b, [16]byte{0x01, 0x89}) }},
+		{"base64", func(b []byte) []byte { return tokens.AppendBase64(b, []byte("hello")) }},
+		{"key", func(b []byte) []byte { return tokens.AppendKey(b, "a\nb") }},
+		{"byte key", func(b []byte) []byte { return tokens.AppendKey(b, keyBytes) }},
+		{"time", func(b []byte) []byte {
+			b, _ = tokens.AppendTime(b, time.Date(2077, 06, 12, 20, 42, 15, 152952812, zone))
+			return b
+		}},
+		{"invalid time", func(b []byte) []byte {
+			b, _ = tokens.AppendTime(b, time.Date(-1, 06, 12, 20, 42, 15, 152952812, zone))
+			return b
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := make([]byte, 0, 1024)
+
+			received := testing.AllocsPerRun(100, func() {
+				_ = tt.append(buf[:0])
+			})
+
+			expectEqual(t, 0, received)
+		})
+	}
+}
+
+func TestAppendTimeExtended(t *testing.T) {
+	zone := time.FixedZone("night city", 0)
+	tests := []struct {
+		name     string
+		val      time.Time
+		expected string
+	}{
+		{"in range", time.Date(2077, 06, 12, 20, 42, 15, 152952812, zone), `"2077-06-12T20:42:15.152952812Z"`},
+		{"negative", time.Date(-1, 06, 12, 20, 42, 15, 152952, zone), `"-000001-06-12T20:42:15.000152952Z"`},
+		{"large", time.Date(10000, 06, 12, 20, 42, 15, 0, zone), `"+010000-06-12T20:42:15Z"`},
+		{"very large", time.Date(12345678, 06, 12, 20, 42, 15, 0, time.FixedZone("", 3600)), `"+12345678-06-12T20:42:15+01:00"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := string(tokens.AppendTimeExtended(nil, tt.val))
+
+			expectEqual(t, tt.expected, received)
+		})
+	}
+}
+
+func TestAppendTimeUnix(t *testing.T) {
+	tests := []struct {
+		name     string
+		val      time.Time
+		expected string
+	}{
+		{"epoch", time.Unix(0, 0), "0"},
+		{"whole", time.Unix(1686602535, 0), "1686602535"},
+		{"fractional", time.Unix(1686602535, 500000000), "1686602535.5"},
+		{"nanoseconds", time.Unix(1686602535, 1), "1686602535.000000001"},
+		{"negative", time.Unix(-5, 0), "-5"},
+		{"negative fractional", time.Unix(-6, 700000000), "-5.3"},
+		{"negative fraction", time.Unix(-1, 700000000), "-0.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := string(tokens.AppendTimeUnix(nil, tt.val))
+
+			expectEqual(t, tt.expected, received)
+		})
+	}
+}
+
 type Point struct {
 	X float64 `json:"x"`
 	Y float64 `json:"y"`
@@ -291,3 +833,92 @@ func expectError(tb testing.TB, err error) {
 		tb.Fatalf("expected error, got <nil>")
 	}
 }
+
+func TestComposer(t *testing.T) {
+	t.Run("record", func(t *testing.T) {
+		var c tokens.Composer
+		buf := []byte("{")
+		expectEqual(t, true, c.Empty())
+		buf = c.AppendKey(buf, "id")
+		buf = tokens.AppendInt64(buf, 1)
+		buf = c.StartList(buf, "tags")
+		expectEqual(t, true, c.InList())
+		expectEqual(t, 1, c.Depth())
+		buf = c.AppendKey(buf, "ignored")
+		buf = tokens.AppendString(buf, "a")
+		buf = c.StartRecord(buf, "")
+		buf = c.AppendKey(buf, "b\n")
+		buf = tokens.AppendBool(buf, true)
+		buf = c.EndRecord(buf)
+		buf = c.StartList(buf, "")
+		buf = c.EndList(buf)
+		buf = c.EndList(buf)
+		buf = c.StartRecord(buf, "empty")
+		expectEqual(t, true, c.Empty())
+		buf = c.EndRecord(buf)
+		expectEqual(t, false, c.Empty())
+		expectEqual(t, false, c.InList())
+		buf = append(buf, '}')
+
+		expectEqual(t, `{"id":1,"tags":["a",{"b\n":true},[]],"empty":{}}`, string(buf))
+	})
+
+	t.Run("list", func(t *testing.T) {
+		var c tokens.Composer
+		c.Reset(true)
+		buf := []byte("[")
+		buf = c.AppendKeySafeSet(buf, "ignored", nil)
+		buf = tokens.AppendInt64(buf, 1)
+		buf = c.StartRecord(buf, "")
+		set := tokens.DefaultSafeSet()
+		set['='] = false
+		buf = c.AppendKeySafeSet(buf, "a=", &set)
+		buf = tokens.AppendInt64(buf, 2)
+		buf = c.EndRecord(buf)
+		buf = append(buf, ']')
+
+		expectEqual(t, `[1,{"a\u003d":2}]`, string(buf))
+	})
+
+	t.Run("deeply nested", func(t *testing.T) {
+		const depth = 150
+		var c tokens.Composer
+		buf := []byte("{")
+		for i := 0; i < depth; i++ {
+			buf = c.StartList(buf, "a")
+			buf = c.AppendKey(buf, "")
+			buf = tokens.AppendInt64(buf, int64(i))
+			buf = c.StartRecord(buf, "")
+		}
+		expectEqual(t, 2*depth, c.Depth())
+		for i := 0; i < depth; i++ {
+			buf = c.EndRecord(buf)
+			buf = c.AppendKey(buf, "")
+			buf = tokens.AppendBool(buf, true)
+			buf = c.EndList(buf)
+			buf = c.AppendKey(buf, "b")
+			buf = tokens.AppendBool(buf, false)
+		}
+		buf = append(buf, '}')
+		expected := "{"
+		for i := 0; i < depth; i++ {
+			expected += `"a":[` + strconv.Itoa(i) + `,{`
+		}
+		for i := 0; i < depth; i++ {
+			expected += `},true],"b":false`
+		}
+		expected += "}"
+
+		expectEqual(t, 0, c.Depth())
+		expectEqual(t, expected, string(buf))
+		expectEqual(t, true, json.Valid(buf))
+	})
+
+	t.Run("end top-level", func(t *testing.T) {
+		var c tokens.Composer
+		defer func() {
+			expectEqual(t, "tokens: no open record or list to end", recover())
+		}()
+		_ = c.EndRecord(nil)
+	})
+}
@@ -0,0 +1,303 @@
+// Package tokenstest provides a property-testing harness that cross-checks
+// the appenders of package tokens against encoding/json with random values,
+// e.g. for verifying that swapping encoding/json for goldjson doesn't change
+// the output on a given platform and Go version:
+//
+//	func TestEncodingParity(t *testing.T) {
+//		if err := tokenstest.CheckAll(tokenstest.Config{N: 1000000}); err != nil {
+//			t.Fatal(err)
+//		}
+//	}
+//
+// The output of the appenders is required to be byte-equal to the output of
+// encoding/json (with HTML escaping disabled), except for the following
+// documented divergences:
+//
+//   - non-finite floats are encoded as strings ("+Inf", "-Inf" and "NaN")
+//     by tokens.AppendFloat64, while encoding/json fails
+//   - the backspace and form feed characters are escaped as \u0008 and
+//     \u000c by tokens.AppendString, while encoding/json escapes them as \b
+//     and \f since Go 1.22
+//   - invalid UTF-8 is replaced with \ufffd by tokens.AppendString, while
+//     the encoding/json of some Go versions (e.g. when built on
+//     encoding/json/v2) inserts the replacement character as is
+//
+// The numbers are formatted with package strconv by both, so the output
+// doesn't depend on the locale or the region of the host.
+package tokenstest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jussi-kalliokoski/goldjson/tokens"
+)
+
+// Config configures the checks.
+type Config struct {
+	// N is the number of random values checked per appender. The default is
+	// 10000.
+	N int
+	// Seed is the seed of the random values. The default of 0 picks a seed
+	// based on the current time, which is reported with the mismatches.
+	Seed int64
+}
+
+// Mismatch describes a value for which the output of an appender differs
+// from encoding/json beyond the documented divergences.
+type Mismatch struct {
+	// Appender is the name of the appender, e.g. "AppendFloat64".
+	Appender string
+	// Value is the value that was encoded.
+	Value any
+	// Expected is the output of encoding/json, or its error.
+	Expected string
+	// Received is the output of the appender, or its error.
+	Received string
+	// Seed is the seed the values were generated with.
+	Seed int64
+}
+
+func (m *Mismatch) Error() string {
+	return fmt.Sprintf("tokenstest: %s(%#v) = %s, encoding/json = %s (seed %d)", m.Appender, m.Value, m.Received, m.Expected, m.Seed)
+}
+
+// CheckAll runs all the checks of the package, returning the first mismatch
+// as a *Mismatch.
+func CheckAll(cfg Config) error {
+	checks := []func(Config) error{
+		CheckInt64,
+		CheckUint64,
+		CheckBool,
+		CheckFloat64,
+		CheckString,
+		CheckTime,
+	}
+	cfg = cfg.withDefaults()
+	for _, check := range checks {
+		if err := check(cfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckInt64 cross-checks tokens.AppendInt64 with random values.
+func CheckInt64(cfg Config) error {
+	return check(cfg, "AppendInt64", randInt64, func(buf []byte, v int64) ([]byte, error) {
+		return tokens.AppendInt64(buf, v), nil
+	})
+}
+
+// CheckUint64 cross-checks tokens.AppendUint64 with random values.
+func CheckUint64(cfg Config) error {
+	return check(cfg, "AppendUint64", randUint64, func(buf []byte, v uint64) ([]byte, error) {
+		return tokens.AppendUint64(buf, v), nil
+	})
+}
+
+// CheckBool cross-checks tokens.AppendBool with both values.
+func CheckBool(cfg Config) error {
+	return check(cfg, "AppendBool", func(r *rand.Rand) bool { return r.Intn(2) == 0 }, func(buf []byte, v bool) ([]byte, error) {
+		return tokens.AppendBool(buf, v), nil
+	})
+}
+
+// CheckFloat64 cross-checks tokens.AppendFloat64 with random values: random
+// bit patterns (including subnormals and non-finite values), short decimals
+// and values around the boundaries of the exponent form.
+func CheckFloat64(cfg Config) error {
+	return check(cfg, "AppendFloat64", randFloat64, func(buf []byte, v float64) ([]byte, error) {
+		return tokens.AppendFloat64(buf, v), nil
+	})
+}
+
+// CheckString cross-checks tokens.AppendString with random strings mixing
+// ASCII, control characters, multi-byte characters and invalid UTF-8.
+func CheckString(cfg Config) error {
+	return check(cfg, "AppendString", randString, func(buf []byte, v string) ([]byte, error) {
+		return tokens.AppendString(buf, v), nil
+	})
+}
+
+// CheckTime cross-checks tokens.AppendTime with random times in random
+// time zones, including years outside of the range supported by RFC 3339,
+// for which both are required to fail.
+func CheckTime(cfg Config) error {
+	return check(cfg, "AppendTime", randTime, tokens.AppendTime)
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.N <= 0 {
+		cfg.N = 10000
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+	return cfg
+}
+
+func check[T any](cfg Config, name string, gen func(*rand.Rand) T, appendValue func([]byte, T) ([]byte, error)) error {
+	cfg = cfg.withDefaults()
+	r := rand.New(rand.NewSource(cfg.Seed))
+	var received []byte
+	var expected bytes.Buffer
+	enc := json.NewEncoder(&expected)
+	enc.SetEscapeHTML(false)
+	for i := 0; i < cfg.N; i++ {
+		v := gen(r)
+		var receivedErr error
+		received, receivedErr = appendValue(received[:0], v)
+		expected.Reset()
+		expectedErr := enc.Encode(v)
+		exp := bytes.TrimSuffix(expected.Bytes(), []byte("\n"))
+		if diverges(v, expectedErr) {
+			continue
+		}
+		if (receivedErr == nil) != (expectedErr == nil) || (receivedErr == nil && !bytes.Equal(normalize(received), normalize(exp))) {
+			return &Mismatch{
+				Appender: name,
+				Value:    v,
+				Expected: describe(exp, expectedErr),
+				Received: describe(received, receivedErr),
+				Seed:     cfg.Seed,
+			}
+		}
+	}
+	return nil
+}
+
+// diverges tells whether the value is covered by a documented divergence
+// that can't be normalized.
+func diverges(v any, expectedErr error) bool {
+	f, ok := v.(float64)
+	return ok && expectedErr != nil && (math.IsInf(f, 0) || math.IsNaN(f))
+}
+
+// normalize rewrites the escapes of an encoded string that are subject to
+// the documented divergences: \b and \f as \u0008 and \u000c, and \ufffd as
+// the replacement character as is.
+func normalize(b []byte) []byte {
+	if len(b) == 0 || b[0] != '"' || bytes.IndexByte(b, '\\') == -1 {
+		return b
+	}
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		if b[i] != '\\' {
+			out = append(out, b[i])
+			continue
+		}
+		i++
+		switch b[i] {
+		case 'b':
+			out = append(out, `\u0008`...)
+		case 'f':
+			out = append(out, `\u000c`...)
+		case 'u':
+			if string(b[i+1:i+5]) == "fffd" {
+				out = utf8.AppendRune(out, utf8.RuneError)
+				i += 4
+			} else {
+				out = append(out, '\\', 'u')
+			}
+		default:
+			out = append(out, '\\', b[i])
+		}
+	}
+	return out
+}
+
+func describe(b []byte, err error) string {
+	if err != nil {
+		return "error " + err.Error()
+	}
+	return string(b)
+}
+
+func randInt64(r *rand.Rand) int64 {
+	switch r.Intn(4) {
+	case 0:
+		return int64(r.Uint64())
+	case 1:
+		return []int64{0, -1, 1, math.MinInt64, math.MaxInt64}[r.Intn(5)]
+	default:
+		// small magnitudes are the common case
+		return r.Int63n(1<<uint(r.Intn(62)+1)) - 1<<uint(r.Intn(62))
+	}
+}
+
+func randUint64(r *rand.Rand) uint64 {
+	if r.Intn(2) == 0 {
+		return r.Uint64()
+	}
+	return r.Uint64() >> uint(r.Intn(64))
+}
+
+func randFloat64(r *rand.Rand) float64 {
+	switch r.Intn(5) {
+	case 0:
+		return math.Float64frombits(r.Uint64())
+	case 1:
+		// short decimals, e.g. 123.45
+		return float64(r.Int63n(1e9)-5e8) / math.Pow10(r.Intn(10))
+	case 2:
+		// around the boundaries of the exponent form
+		boundary := []float64{1e-6, 1e21}[r.Intn(2)]
+		f := math.Float64frombits(math.Float64bits(boundary) + uint64(r.Intn(5)) - 2)
+		if r.Intn(2) == 0 {
+			f = -f
+		}
+		return f
+	case 3:
+		return []float64{0, math.Copysign(0, -1), math.SmallestNonzeroFloat64, math.MaxFloat64, -math.MaxFloat64, math.Inf(1), math.Inf(-1), math.NaN()}[r.Intn(8)]
+	default:
+		return r.NormFloat64() * math.Pow10(r.Intn(60)-30)
+	}
+}
+
+func randString(r *rand.Rand) string {
+	var sb strings.Builder
+	n := r.Intn(32)
+	for i := 0; i < n; i++ {
+		switch r.Intn(6) {
+		case 0:
+			sb.WriteByte(byte(r.Intn(0x20)))
+		case 1:
+			sb.WriteByte(`"\/<>&`[r.Intn(6)])
+		case 2:
+			sb.WriteByte(byte(0x80 + r.Intn(0x80)))
+		case 3:
+			sb.WriteRune([]rune{' ', ' ', '\u007f', '�', utf8.MaxRune, 'é', '☃'}[r.Intn(7)])
+		case 4:
+			sb.WriteRune(rune(r.Intn(utf8.MaxRune + 1)))
+		default:
+			sb.WriteByte(byte(0x20 + r.Intn(0x60)))
+		}
+	}
+	return sb.String()
+}
+
+func randTime(r *rand.Rand) time.Time {
+	var sec int64
+	if r.Intn(10) == 0 {
+		// beyond the range [0,9999] once in a while
+		sec = r.Int63n(1<<40) - 1<<39
+	} else {
+		sec = r.Int63n(253402300800+62167219200) - 62167219200
+	}
+	nsec := int64(0)
+	if r.Intn(2) == 0 {
+		nsec = r.Int63n(1e9)
+	}
+	zone := time.UTC
+	if r.Intn(2) == 0 {
+		zone = time.FixedZone("", (r.Intn(48)-24)*1800)
+	}
+	return time.Unix(sec, nsec).In(zone)
+}
@@ -0,0 +1,42 @@
+package tokenstest_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jussi-kalliokoski/goldjson/tokens/tokenstest"
+)
+
+func TestCheckAll(t *testing.T) {
+	n := 200000
+	if testing.Short() {
+		n = 10000
+	}
+
+	err := tokenstest.CheckAll(tokenstest.Config{N: n})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMismatch(t *testing.T) {
+	err := error(&tokenstest.Mismatch{
+		Appender: "AppendFloat64",
+		Value:    1e21,
+		Expected: "1e+21",
+		Received: "1000000000000000000000",
+		Seed:     1,
+	})
+	var mismatch *tokenstest.Mismatch
+
+	expected := "tokenstest: AppendFloat64(1e+21) = 1000000000000000000000, encoding/json = 1e+21 (seed 1)"
+	received := err.Error()
+
+	if !errors.As(err, &mismatch) {
+		t.Fatal("expected a *Mismatch")
+	}
+	if expected != received {
+		t.Fatalf("expected %q, got %q", expected, received)
+	}
+}
@@ -0,0 +1,43 @@
+package goldjson
+
+import (
+	"time"
+
+	"github.com/jussi-kalliokoski/goldjson/tokens"
+)
+
+// WithTrailer makes the Encoder append a trailer record under the given key
+// as the last field of every line, describing how the line was produced:
+//
+//	{"msg":"hello","_meta":{"encode_ns":1250,"fields":1,"dropped":0}}
+//
+// where encode_ns is the time in nanoseconds from creating the line to
+// ending it, fields is the number of fields (including the entries of
+// records and lists, at any depth) added to the line and dropped is the
+// number of fields omitted from the line, e.g. due to duplicate or invalid
+// keys or failed values.
+//
+// The fields of StaticFields are not counted, and lines whose top-level value
+// is not a record (see NewListLine and NewValueLine) don't get a trailer.
+//
+// The trailer adds the cost of tracking the structure of each line, like
+// the strict mode.
+func WithTrailer(key string) Option {
+	return func(o *options) {
+		o.trailerKey = key
+	}
+}
+
+// appendTrailer appends the trailer to the top-level record.
+func (l *LineWriter) appendTrailer() {
+	c := l.checks
+	l.separator()
+	l.buf = l.encoder.keys.Append(l.buf, l.encoder.opts.trailerKey)
+	l.buf = append(l.buf, `:{"encode_ns":`...)
+	l.buf = tokens.AppendInt64(l.buf, int64(time.Since(c.start)))
+	l.buf = append(l.buf, `,"fields":`...)
+	l.buf = tokens.AppendInt64(l.buf, int64(c.fields))
+	l.buf = append(l.buf, `,"dropped":`...)
+	l.buf = tokens.AppendInt64(l.buf, int64(c.dropped))
+	l.buf = append(l.buf, '}')
+}
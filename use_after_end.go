@@ -0,0 +1,35 @@
+package goldjson
+
+// WithUseAfterEndCheck makes the LineWriters of the Encoder panic when used
+// after End (or Detach), instead of silently corrupting another line: by
+// default the LineWriter is returned to a pool on End, so a stale reference
+// to it may write into a line being built by another goroutine.
+//
+// With the check, the LineWriters are not returned to the pool, so each line
+// allocates, and the structure of the lines is tracked like in the strict
+// mode. The option is thus meant for tests and debugging.
+func WithUseAfterEndCheck() Option {
+	return func(o *options) {
+		o.useAfterEndCheck = true
+	}
+}
+
+// errUseAfterEnd is the panic value for the use of a LineWriter after End.
+const errUseAfterEnd = "goldjson: LineWriter used after End"
+
+// endedChecks marks the lines that have been ended when the use after End is
+// checked.
+var endedChecks = lineChecks{
+	ended:  true,
+	scopes: []checkScope{{discardFrom: -1}},
+}
+
+func (l *LineWriter) markEnded() {
+	l.checks = &endedChecks
+}
+
+func (c *lineChecks) checkEnded() {
+	if c.ended {
+		panic(errUseAfterEnd)
+	}
+}
@@ -0,0 +1,124 @@
+package goldjson
+
+import (
+	"strings"
+	"sync"
+)
+
+// maxCachedValueSize is the maximum length of the string values cached by
+// WithValueCache.
+const maxCachedValueSize = 256
+
+// WithValueCache makes the Encoder cache the encoded (quoted and escaped)
+// versions of up to size string values added with AddString (and
+// LayoutLine.AddString), evicting the least recently used values when full,
+// so that frequently repeated values (e.g. user agents or request paths) are
+// escaped only once.
+//
+// Only values of up to 256 bytes are cached. Adding a value that is not
+// cached allocates a copy of it for the cache, so the option only pays off
+// for values that repeat often. The cache is shared by the goroutines using
+// the Encoder and guarded by a mutex.
+func WithValueCache(size int) Option {
+	return func(o *options) {
+		o.valueCacheSize = size
+	}
+}
+
+// appendStringValue appends an encoded string value, through the value cache
+// if enabled.
+func (e *Encoder) appendStringValue(buf []byte, value string) []byte {
+	if e.values != nil {
+		return e.values.AppendValue(buf, value, e.str)
+	}
+	return e.str.AppendValue(buf, value)
+}
+
+// valueCache is a bounded LRU cache of encoded string values.
+type valueCache struct {
+	mu      sync.Mutex
+	index   map[string]int32
+	entries []valueCacheEntry
+	// head and tail are the most and the least recently used entries, or -1
+	// if the cache is empty.
+	head, tail int32
+}
+
+type valueCacheEntry struct {
+	value      string
+	encoded    []byte
+	prev, next int32
+}
+
+func newValueCache(size int) *valueCache {
+	return &valueCache{
+		index:   make(map[string]int32, size),
+		entries: make([]valueCacheEntry, 0, size),
+		head:    -1,
+		tail:    -1,
+	}
+}
+
+// AppendValue appends the encoded value to buf, encoding it with str unless
+// it's cached.
+func (c *valueCache) AppendValue(buf []byte, value string, str stringEncoder) []byte {
+	if len(value) > maxCachedValueSize {
+		return str.AppendValue(buf, value)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if i, ok := c.index[value]; ok {
+		c.moveToFront(i)
+		return append(buf, c.entries[i].encoded...)
+	}
+	var i int32
+	if len(c.entries) < cap(c.entries) {
+		i = int32(len(c.entries))
+		c.entries = append(c.entries, valueCacheEntry{prev: -1, next: -1})
+	} else {
+		i = c.tail
+		c.unlink(i)
+		delete(c.index, c.entries[i].value)
+	}
+	e := &c.entries[i]
+	e.value = strings.Clone(value)
+	e.encoded = str.AppendValue(e.encoded[:0], value)
+	c.index[e.value] = i
+	c.pushFront(i)
+	return append(buf, e.encoded...)
+}
+
+func (c *valueCache) moveToFront(i int32) {
+	if c.head == i {
+		return
+	}
+	c.unlink(i)
+	c.pushFront(i)
+}
+
+func (c *valueCache) unlink(i int32) {
+	e := &c.entries[i]
+	if e.prev != -1 {
+		c.entries[e.prev].next = e.next
+	} else {
+		c.head = e.next
+	}
+	if e.next != -1 {
+		c.entries[e.next].prev = e.prev
+	} else {
+		c.tail = e.prev
+	}
+	e.prev, e.next = -1, -1
+}
+
+func (c *valueCache) pushFront(i int32) {
+	e := &c.entries[i]
+	e.prev, e.next = -1, c.head
+	if c.head != -1 {
+		c.entries[c.head].prev = i
+	}
+	c.head = i
+	if c.tail == -1 {
+		c.tail = i
+	}
+}
@@ -0,0 +1,134 @@
+package goldjson
+
+import "sort"
+
+// maxWarmPoolSize is the maximum number of LineWriters preallocated for a
+// WarmProfile.
+const maxWarmPoolSize = 1024
+
+// WarmProfile describes the steady state of a running Encoder, for bringing
+// the Encoder of the next process to the same state at startup instead of
+// after a warm-up period (see WithWarmProfile). Export it with
+// Encoder.WarmProfile, e.g. at shutdown, and persist it as JSON.
+type WarmProfile struct {
+	// Keys are the keys observed by the Encoder, cached with
+	// WithDynamicKeyCache.
+	Keys []string `json:"keys,omitempty"`
+	// LineSize is the buffer capacity that fits the typical line.
+	LineSize int `json:"line_size,omitempty"`
+	// PoolSize is the number of LineWriters the Encoder has needed.
+	PoolSize int `json:"pool_size,omitempty"`
+}
+
+// WarmProfile exports the steady state of the Encoder: the keys in the
+// dynamic key cache (see WithDynamicKeyCache), and with WithPoolStats, the
+// buffer capacity of 90% of the lines and the number of LineWriters
+// allocated (see PoolStats). The fields that haven't been observed are left
+// zero.
+func (e *Encoder) WarmProfile() WarmProfile {
+	var p WarmProfile
+	if c := e.keys.dynamic; c != nil {
+		c.mu.RLock()
+		p.Keys = make([]string, 0, len(c.keys))
+		for key := range c.keys {
+			p.Keys = append(p.Keys, key)
+		}
+		c.mu.RUnlock()
+		sort.Strings(p.Keys)
+	}
+	if e.poolStats != nil {
+		stats := e.PoolStats()
+		p.LineSize = percentileCapacity(stats.BufferCapacityHistogram, 0.9)
+		// the LineWriters preallocated for a warm profile are needed as
+		// well, even though they didn't miss
+		p.PoolSize = int(stats.Misses) + e.warmPoolSize()
+		if p.PoolSize > maxWarmPoolSize {
+			p.PoolSize = maxWarmPoolSize
+		}
+	}
+	return p
+}
+
+// percentileCapacity returns the upper bound of the histogram bucket (see
+// PoolStats.BufferCapacityHistogram) of the given percentile, or 0 for an
+// empty histogram.
+func percentileCapacity(histogram [PoolStatsBuckets]uint64, percentile float64) int {
+	var total uint64
+	for _, n := range histogram {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	var seen uint64
+	for i, n := range histogram {
+		seen += n
+		if float64(seen) >= percentile*float64(total) {
+			return 64 << i
+		}
+	}
+	return 64 << (PoolStatsBuckets - 1)
+}
+
+// WithWarmProfile makes the Encoder start from the state described by the
+// profile, exported from a previous Encoder with Encoder.WarmProfile: the
+// keys of the profile are cached (enabling WithDynamicKeyCache with room for
+// them if needed), and the pool is filled with LineWriters whose buffers fit
+// the typical line.
+//
+// The pooled LineWriters are subject to the garbage collection like any
+// pooled objects, so the profile is best loaded right before the Encoder is
+// used. With WithPoolStats, the preallocated LineWriters are counted as
+// returned to the pool. The pool of the clones of the Encoder (see Clone) is
+// not filled.
+func WithWarmProfile(profile WarmProfile) Option {
+	return func(o *options) {
+		o.warmProfile = &profile
+	}
+}
+
+// warmKeys caches the keys of the warm profile, if any.
+func (e *Encoder) warmKeys() {
+	p := e.opts.warmProfile
+	if p == nil || e.keys.dynamic == nil {
+		return
+	}
+	for _, key := range p.Keys {
+		if len(key) <= maxDynamicKeySize {
+			e.keys.dynamic.put(key, e.str.Append(nil, key))
+		}
+	}
+}
+
+// warmPoolSize returns the number of LineWriters preallocated for the warm
+// profile.
+func (e *Encoder) warmPoolSize() int {
+	p := e.opts.warmProfile
+	if p == nil || e.opts.useAfterEndCheck {
+		// lines are not pooled with the use after end check
+		return 0
+	}
+	if p.PoolSize > maxWarmPoolSize {
+		return maxWarmPoolSize
+	}
+	return p.PoolSize
+}
+
+// warmPool fills the pool according to the warm profile, if any.
+func (e *Encoder) warmPool() {
+	p := e.opts.warmProfile
+	if p == nil {
+		return
+	}
+	size := p.LineSize
+	if size < 0 {
+		size = 0
+	}
+	for i := e.warmPoolSize(); i > 0; i-- {
+		l := &LineWriter{encoder: e, buf: make([]byte, 0, size)}
+		if e.poolStats != nil {
+			e.poolStats.put(cap(l.buf))
+		}
+		e.p.Put(l)
+	}
+}
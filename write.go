@@ -0,0 +1,76 @@
+package goldjson
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+)
+
+// PartialWriteError is returned by LineWriter.End when the underlying writer
+// failed after writing only a part of the line, in which case the output
+// contains a truncated line that a reader needs to skip or repair.
+//
+// Short writes without an error, as well as retriable errors (timeouts,
+// EAGAIN and EINTR) after some of the line was written, are retried with
+// the rest of the line, so PartialWriteError is only returned when the
+// writer fails without making progress.
+type PartialWriteError struct {
+	// Written is the number of bytes of the line that were written.
+	Written int
+	// Size is the size of the line in bytes, including the trailing newline.
+	Size int
+	// Err is the error returned by the writer.
+	Err error
+}
+
+func (e *PartialWriteError) Error() string {
+	return fmt.Sprintf("goldjson: partial write of %d/%d bytes: %v", e.Written, e.Size, e.Err)
+}
+
+// Unwrap returns the error returned by the writer.
+func (e *PartialWriteError) Unwrap() error {
+	return e.Err
+}
+
+// writeFull writes the whole buf to w, retrying short writes as long as the
+// writer makes progress.
+func writeFull(w io.Writer, buf []byte) error {
+	written := 0
+	for written < len(buf) {
+		n, err := w.Write(buf[written:])
+		written += n
+		if err == nil && n == 0 {
+			err = io.ErrShortWrite
+		}
+		if err == nil || (n > 0 && isRetriable(err)) {
+			continue
+		}
+		if written == 0 {
+			return err
+		}
+		return &PartialWriteError{Written: written, Size: len(buf), Err: err}
+	}
+	return nil
+}
+
+// writeBuffered writes the whole buf to a *bufio.Writer like writeFull, but
+// without the retries: the errors of a bufio.Writer are sticky, so retrying
+// would fail without making progress, and it never writes short without an
+// error.
+func writeBuffered(w *bufio.Writer, buf []byte) error {
+	n, err := w.Write(buf)
+	if err == nil || n == 0 {
+		return err
+	}
+	return &PartialWriteError{Written: n, Size: len(buf), Err: err}
+}
+
+func isRetriable(err error) bool {
+	var timeout interface{ Timeout() bool }
+	if errors.As(err, &timeout) && timeout.Timeout() {
+		return true
+	}
+	return errors.Is(err, io.ErrShortWrite) || errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR)
+}